@@ -12,62 +12,130 @@
 package main
 
 import (
+	"codewind/filewatcher"
 	"codewind/utils"
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 )
 
 /* This is the entrypoint for the application.
- * The application takes one optional argument, which is the URL of the Codewind server. */
+ * The application takes one optional argument, which is the URL of the Codewind server, optionally followed by the
+ * path of the installer. The path of a JSON configuration file may be specified by `--config <path>` (see
+ * filewatcher/configfile.go).
+ *
+ * If `--check` is specified, the setup is checked (see filewatcher/preflight.go) rather than watched: a summary is
+ * printed, and the exit code is non-zero if any check failed.
+ *
+ * The filewatcher itself is implemented by the filewatcher package (see watcher.go), so that it may also be embedded
+ * in other programs. */
 func main() {
 
+	// Log statements are output asynchronously, so any that are pending would otherwise be lost on return
+	defer utils.FlushLog(logFlushTimeout)
+
+	args, configFilePath, check, err := parseCommandLine(os.Args[1:])
+	if err != nil {
+		utils.LogSevereErr("Invalid command line arguments", err)
+		exitIfChecking(check)
+		return
+	}
+
+	// Load the configuration before anything else, so that an invalid configuration is reported before anything starts
+	config, err := filewatcher.LoadConfig(configFilePath)
+	if err != nil {
+		utils.LogSevereErr("Unable to load the configuration", err)
+		exitIfChecking(check)
+		return
+	}
+
 	// Default URL if no args
 	baseURL := "http://localhost:9090"
 
 	var installerPath string
 
 	// If one arg is specified, use it as a URL
-	if len(os.Args) >= 2 {
-		baseURL = os.Args[1]
+	if len(args) >= 1 {
+		baseURL = args[0]
 
-		if len(os.Args) == 3 {
-			installerPath = os.Args[2]
+		if len(args) == 2 {
+			installerPath = args[1]
 		}
 	}
 
-	if value, ok := os.LookupEnv("MOCK_CWCTL_INSTALLER_PATH"); ok {
-		installerPath = value
+	watcher, err := filewatcher.NewWatcher(baseURL, installerPath, config)
+	if err != nil {
+		utils.LogSevereErr("Unable to create the filewatcher", err)
+		exitIfChecking(check)
+		return
 	}
 
-	baseURL = utils.StripTrailingForwardSlash(baseURL)
+	if check {
+		report := watcher.Check()
+		utils.FlushLog(logFlushTimeout)
+		fmt.Print("\n" + report.String())
+		if !report.Passed() {
+			os.Exit(1)
+		}
+		return
+	}
 
-	httpPostOutputQueue, err := NewHttpPostOutputQueue(baseURL)
-	if err != nil {
-		utils.LogSevereErr("Unable to create HTTP POST output queue", err)
+	if err := watcher.Start(context.Background()); err != nil {
+		utils.LogSevereErr("Unable to start the filewatcher", err)
 		return
 	}
 
-	projectList := NewProjectList(httpPostOutputQueue, installerPath)
+	startForceSyncSignalHandler(watcher)
 
-	clientUUID := *utils.GenerateUuid()
+	startShutdownSignalHandler(watcher)
 
-	watchService := NewWatchService(projectList, baseURL, clientUUID)
+	for {
+		time.Sleep(1000 * time.Millisecond)
+	}
+}
 
-	projectList.SetWatchService(watchService)
+// parseCommandLine returns the positional arguments, the value of the optional `--config <path>` (or
+// `--config=<path>`) argument, and whether the `--check` argument was given.
+func parseCommandLine(args []string) ([]string, string, bool, error) {
 
-	httpGetStatusThread, err := NewHttpGetStatusThread(baseURL, projectList)
+	positionalArgs := []string{}
+	configFilePath := ""
+	check := false
 
-	if err != nil {
-		utils.LogSevereErr("Unable to create HTTP GET status thread", err)
-		return
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+
+		if arg == "--config" {
+			if index+1 >= len(args) {
+				return nil, "", check, errors.New("--config requires the path of a configuration file")
+			}
+			index++
+			configFilePath = args[index]
+
+		} else if strings.HasPrefix(arg, "--config=") {
+			configFilePath = strings.TrimPrefix(arg, "--config=")
+
+		} else if arg == "--check" {
+			check = true
+
+		} else {
+			positionalArgs = append(positionalArgs, arg)
+		}
 	}
 
-	StartWSConnectionManager(baseURL, projectList, httpGetStatusThread)
+	return positionalArgs, configFilePath, check, nil
+}
 
-	debugTimer := NewDebugTimer(watchService, projectList, httpPostOutputQueue)
-	debugTimer.Start()
+// logFlushTimeout is how long to wait for pending log statements to be output, before the process exits.
+const logFlushTimeout = 2 * time.Second
 
-	for {
-		time.Sleep(1000 * time.Millisecond)
+// exitIfChecking exits with a non-zero code if the setup is being checked, as the check could not be run.
+func exitIfChecking(check bool) {
+	if check {
+		utils.FlushLog(logFlushTimeout)
+		os.Exit(1)
 	}
 }
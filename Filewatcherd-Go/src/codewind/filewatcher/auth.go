@@ -0,0 +1,276 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/utils"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * When communicating with a secured Codewind server, each HTTP and WebSocket request includes a bearer token, which
+ * is obtained from the TokenProvider before each request. If the server rejects the token (401), the token is
+ * invalidated, and a new one is obtained on the next request.
+ *
+ * The token provider is created from the ServerConfig when the watcher is started (see newTokenProvider), unless one
+ * has been set with SetTokenProvider:
+ * - AuthToken (FILEWATCHER_AUTH_TOKEN): the initial access token. If neither this nor a token endpoint are set,
+ *   requests are unauthenticated.
+ * - AuthTokenEndpoint (FILEWATCHER_AUTH_TOKEN_ENDPOINT): an OAuth2 token endpoint, used to obtain a new access token
+ *   when the current one is rejected (or not set); this requires AuthRefreshToken and AuthClientID.
+ */
+
+// TokenProvider supplies the bearer token that is included in requests to the server. Implementations must be safe
+// to call from multiple goroutines.
+type TokenProvider interface {
+	// GetToken returns the current token, "" if requests should not be authenticated, or an error if no valid token
+	// could be obtained.
+	GetToken() (string, error)
+
+	// InvalidateToken is called when the server rejects the given token; the next call to GetToken should return a new token.
+	InvalidateToken(rejectedToken string)
+}
+
+// noTokenProvider is used when authentication is not configured.
+type noTokenProvider struct{}
+
+func (noTokenProvider) GetToken() (string, error) { return "", nil }
+
+func (noTokenProvider) InvalidateToken(rejectedToken string) {}
+
+// maxConsecutiveTokenRefreshFailures is the number of consecutive failed refreshes after which the refreshing token
+// provider gives up: all subsequent calls to GetToken return an error, rather than retrying the token endpoint forever.
+const maxConsecutiveTokenRefreshFailures = 3
+
+// refreshingTokenProvider obtains a new access token from an OAuth2 token endpoint (using the refresh token grant)
+// when the current token is rejected.
+type refreshingTokenProvider struct {
+	tokenEndpoint string
+	clientID      string
+
+	// lock must be acquired before reading/writing the fields below
+	lock                       *sync.Mutex
+	accessToken                string
+	refreshToken               string
+	consecutiveRefreshFailures int
+	refreshError               error // Non-nil once the provider has given up
+}
+
+func (provider *refreshingTokenProvider) GetToken() (string, error) {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	if provider.refreshError != nil {
+		return "", provider.refreshError
+	}
+
+	if provider.accessToken != "" {
+		return provider.accessToken, nil
+	}
+
+	// Refresh while holding the lock, so that concurrent requests only cause a single refresh
+	err := provider.refresh()
+	if err != nil {
+		provider.consecutiveRefreshFailures++
+
+		if provider.consecutiveRefreshFailures >= maxConsecutiveTokenRefreshFailures {
+			provider.refreshError = errors.New("Unable to obtain an access token from " + provider.tokenEndpoint + " after " +
+				strconv.Itoa(provider.consecutiveRefreshFailures) + " attempts; requests to the server will fail until the filewatcher is restarted with valid credentials. Last error: " + err.Error())
+			utils.LogSevere(provider.refreshError.Error())
+			return "", provider.refreshError
+		}
+
+		utils.LogErrorErr("Unable to obtain an access token from "+provider.tokenEndpoint, err)
+		return "", err
+	}
+
+	provider.consecutiveRefreshFailures = 0
+	return provider.accessToken, nil
+}
+
+func (provider *refreshingTokenProvider) InvalidateToken(rejectedToken string) {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	// Another request may have already replaced the rejected token
+	if provider.accessToken == rejectedToken {
+		utils.LogInfo("The access token was rejected by the server, so a new token will be requested")
+		provider.accessToken = ""
+	}
+}
+
+/** The fields of the token endpoint response that we use. */
+type tokenEndpointResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refresh requests a new access token from the token endpoint; the caller must hold the lock.
+func (provider *refreshingTokenProvider) refresh() error {
+
+	utils.LogInfo("Requesting a new access token from " + provider.tokenEndpoint)
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", provider.refreshToken)
+	form.Set("client_id", provider.clientID)
+
+	tr := newServerTransport()
+
+	client := &http.Client{Transport: tr, Timeout: 30 * time.Second}
+
+	resp, err := client.PostForm(provider.tokenEndpoint, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != 200 {
+		return errors.New("Token endpoint response code: " + strconv.Itoa(resp.StatusCode))
+	}
+
+	var tokenResponse tokenEndpointResponse
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return err
+	}
+
+	if tokenResponse.AccessToken == "" {
+		return errors.New("Token endpoint response did not contain an access token")
+	}
+
+	provider.accessToken = tokenResponse.AccessToken
+
+	// The token endpoint may rotate the refresh token
+	if tokenResponse.RefreshToken != "" {
+		provider.refreshToken = tokenResponse.RefreshToken
+	}
+
+	return nil
+}
+
+// staticTokenProvider always returns the same token, as no token endpoint was configured.
+type staticTokenProvider struct {
+	token string
+}
+
+func (provider *staticTokenProvider) GetToken() (string, error) { return provider.token, nil }
+
+func (provider *staticTokenProvider) InvalidateToken(rejectedToken string) {
+	utils.LogError("The access token was rejected by the server, and cannot be refreshed as FILEWATCHER_AUTH_TOKEN_ENDPOINT is not set")
+}
+
+// newTokenProvider returns the token provider described by the authentication settings of the configuration.
+func newTokenProvider(config ServerConfig) TokenProvider {
+
+	token := strings.TrimSpace(config.AuthToken)
+	tokenEndpoint := strings.TrimSpace(config.AuthTokenEndpoint)
+
+	if tokenEndpoint == "" {
+		if token == "" {
+			return noTokenProvider{}
+		}
+		return &staticTokenProvider{token}
+	}
+
+	refreshToken := strings.TrimSpace(config.AuthRefreshToken)
+	clientID := strings.TrimSpace(config.AuthClientID)
+
+	if refreshToken == "" || clientID == "" {
+		utils.LogSevere("FILEWATCHER_AUTH_TOKEN_ENDPOINT is set, but FILEWATCHER_AUTH_REFRESH_TOKEN or FILEWATCHER_AUTH_CLIENT_ID is not, so the access token cannot be refreshed")
+		if token == "" {
+			return noTokenProvider{}
+		}
+		return &staticTokenProvider{token}
+	}
+
+	return &refreshingTokenProvider{
+		tokenEndpoint: tokenEndpoint,
+		clientID:      clientID,
+		lock:          &sync.Mutex{},
+		accessToken:   token,
+		refreshToken:  refreshToken,
+	}
+}
+
+var (
+	// tokenProviderLock must be acquired before reading/writing tokenProvider
+	tokenProviderLock = &sync.Mutex{}
+
+	tokenProvider TokenProvider // nil until set, or created from the configuration by initTokenProvider
+)
+
+// SetTokenProvider replaces the token provider that is consulted before each request to the server.
+func SetTokenProvider(provider TokenProvider) {
+	if provider == nil {
+		provider = noTokenProvider{}
+	}
+
+	tokenProviderLock.Lock()
+	defer tokenProviderLock.Unlock()
+	tokenProvider = provider
+}
+
+// initTokenProvider creates the token provider from the configuration, unless one has already been set (by
+// SetTokenProvider, or by an earlier watcher).
+func initTokenProvider(config ServerConfig) {
+	tokenProviderLock.Lock()
+	defer tokenProviderLock.Unlock()
+
+	if tokenProvider == nil {
+		tokenProvider = newTokenProvider(config)
+	}
+}
+
+func getTokenProvider() TokenProvider {
+	tokenProviderLock.Lock()
+	defer tokenProviderLock.Unlock()
+
+	if tokenProvider == nil {
+		return noTokenProvider{}
+	}
+	return tokenProvider
+}
+
+// addAuthorizationHeader adds the bearer token (if any) to the request header, and returns the token that was used.
+func addAuthorizationHeader(header http.Header) (string, error) {
+
+	token, err := getTokenProvider().GetToken()
+	if err != nil {
+		return "", err
+	}
+
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	return token, nil
+}
+
+// checkUnauthorizedResponse invalidates the token if the server rejected it, so that the next request uses a new token.
+func checkUnauthorizedResponse(resp *http.Response, token string) {
+	if resp != nil && resp.StatusCode == http.StatusUnauthorized && token != "" {
+		getTokenProvider().InvalidateToken(token)
+	}
+}
@@ -0,0 +1,66 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// A request whose token is rejected (401) invalidates the token, so that the retry of the request uses a new token
+// from the token endpoint.
+func TestUnauthorizedRequestRefreshesTokenAndIsRetried(t *testing.T) {
+	fake := newFakeCodewindServer()
+	defer fake.close()
+
+	fake.requireToken("fresh-token")
+	fake.issueTokens("fresh-token")
+
+	config := newFakeServerConfig()
+	config.Server.AuthToken = "expired-token"
+	config.Server.AuthTokenEndpoint = fake.tokenEndpointURL()
+	config.Server.AuthRefreshToken = "refresh-token"
+	config.Server.AuthClientID = "filewatcher"
+
+	resetServerConnectionState()
+	defer resetServerConnectionState()
+	initTokenProvider(config.Server)
+
+	projectList := NewProjectList(nil, "", config)
+	defer projectList.Shutdown()
+
+	backoff := config.Server.GetRetry.newBackoff(0)
+	if err := doGetRequest(fake.url(), projectList, config.Server.GetMaxAttempts, &backoff); err != nil {
+		t.Fatal("The GET request should succeed once the token is refreshed:", err)
+	}
+
+	requests := fake.requests("")
+	if len(requests) != 3 {
+		t.Fatalf("Expected the rejected request, the token request, and the retry, but was: %v", requests)
+	}
+
+	if rejected := requests[0]; rejected.path != fakeServerWatchlistPath || rejected.token != "expired-token" || rejected.statusCode != http.StatusUnauthorized {
+		t.Errorf("The first request should have been rejected for its expired token: %+v", rejected)
+	}
+
+	tokenRequest := requests[1]
+	form, err := url.ParseQuery(string(tokenRequest.body))
+	if tokenRequest.path != fakeServerTokenPath || err != nil || form.Get("grant_type") != "refresh_token" ||
+		form.Get("refresh_token") != "refresh-token" || form.Get("client_id") != "filewatcher" {
+		t.Errorf("The token should have been refreshed with the refresh token grant: %+v", tokenRequest)
+	}
+
+	if retry := requests[2]; retry.path != fakeServerWatchlistPath || retry.token != "fresh-token" || retry.statusCode != http.StatusOK {
+		t.Errorf("The request should have been retried with the refreshed token: %+v", retry)
+	}
+}
@@ -0,0 +1,1622 @@
+/*******************************************************************************
+* Copyright (c) 2019, 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"bytes"
+	"codewind/models"
+	"codewind/utils"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CLIState will call the cwctl project sync command, in order to allow the
+// Codewind CLI to detect and communicate file changes to the server.
+//
+// This class will ensure that only one instance of the cwctl project sync command is running
+// at a time, per project. File changes are collapsed into syncs after a quiet period; failed syncs are retried with a
+// backoff, and stop being attempted while the circuit breaker of the project is open. Each of these behaviours is
+// configured by the CLIConfig passed to NewCLIState (see config.go), and is described at the field or function that
+// implements it.
+//
+// The fields of a CLIState are not modified after construction (other than the disposed flag, which is atomic), so they
+// may be read by any goroutine. The mutable state of the syncs of the project (the timestamp, pending changes, pause,
+// circuit breaker, retry backoff, sync lag, and most recent ProjectToWatch) is instead owned by the readChannel goroutine:
+// it is local to that goroutine, and only changed in response to the entries that other goroutines send to its channel.
+// Anything that is passed to a sync goroutine (the ProjectToWatch, and the change set) is not modified until the result
+// of that sync is received. New mutable state should follow the same pattern. State that other goroutines need to read
+// (such as whether a sync is active, see IsSyncing()) is published to the sync status registry (see statusserver.go).
+//
+// Once a project is no longer watched, Dispose() should be called to stop the goroutine of this object,
+// and to kill any cwctl process that is still running. On shutdown of the filewatcher, Shutdown() should be called
+// first, to allow any pending changes to be synced.
+type CLIState struct {
+	projectID string
+
+	installerPath string
+
+	projectPath string
+
+	/** The configuration this object was created with (for the settings that are shared with other projects). */
+	config CLIConfig
+
+	/** The arguments of a sync, before those specific to the project (see cwctlsynccommand.go) */
+	syncCommand *cwctlSyncCommand
+
+	/**
+	 * For automated testing only (MOCK_CWCTL_INSTALLER_PATH): a mock cwctl command that is run instead of the installer.
+	 * If the path ends in '.jar' it is run as a runnable Java JAR, otherwise it is run directly as an executable (for
+	 * example, a mock written in Go).
+	 */
+	mockInstallerPath string
+
+	/**
+	 * If true (FILEWATCHER_DRY_RUN), cwctl is never run: each invocation is instead logged (including its arguments and
+	 * timestamp) and treated as successful, so that the paths, project IDs and timestamps that would be used may be
+	 * verified. The capabilities of the installer are still probed (see cwctlcapabilities.go), so that the logged
+	 * arguments match those of a real sync.
+	 */
+	dryRun bool
+
+	/**
+	 * The absolute path of the working directory of cwctl (see resolveCwctlWorkingDir); if empty, the directory
+	 * containing the installer is used. If the working directory does not exist, the sync fails without running cwctl.
+	 */
+	workingDir string
+
+	/** Maximum time a single cwctl invocation may run before it is killed, and reported as a failure; 0 if there is no limit. */
+	syncTimeout time.Duration
+
+	/**
+	 * How long to wait for file change events to stop arriving, before starting a sync; 0 to start immediately. This
+	 * allows a burst of changes (for example, a formatter rewriting many files) to be handled by a single sync, rather
+	 * than many back-to-back syncs, in addition to the batching performed by FileChangeEventBatchUtil.
+	 */
+	quietPeriod time.Duration
+
+	/**
+	 * The minimum time between the completion of a sync and the start of the next, unless overridden by the
+	 * `minSyncIntervalMs` of the ProjectToWatch (see getMinSyncInterval); this bounds the rate of syncs under sustained
+	 * activity.
+	 */
+	minSyncInterval time.Duration
+
+	/**
+	 * If cwctl fails this many consecutive times (0 if disabled), the circuit breaker of the project opens: cwctl is not
+	 * run for the cooldown, after which a single probe sync is run. If the probe succeeds the circuit is closed,
+	 * otherwise it re-opens. This prevents a cwctl that is fundamentally broken for a project from being run on every
+	 * file change. A webhook may be notified when it opens (see failurewebhook.go).
+	 */
+	circuitBreakerThreshold int
+	circuitBreakerCooldown  time.Duration
+
+	channel chan CLIStateChannelEntry
+
+	/** Cancelled by Dispose(); this terminates readChannel, and kills any running cwctl process. */
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	/** Set to 1 (atomically) by Dispose(), before ctx is cancelled; once set, no further entries are sent to the channel. */
+	disposed int32
+
+	/** Optional; informed of the result of each cwctl invocation. */
+	resultListener CLIStateResultListener
+
+	/**
+	 * The maximum number of bytes of each cwctl output stream (and their combination) that are kept (and logged); 0 if
+	 * unlimited. Any further output is discarded, and the output is marked as truncated; the exit code is not affected.
+	 */
+	maxOutputBytes int
+
+	/** Environment variables to set for each cwctl process; immutable after construction. */
+	extraEnv map[string]string
+
+	/** The source of timestamps and timers (other than the sync timeout, which applies to the cwctl process). */
+	clock Clock
+
+	/**
+	 * While cwctl fails repeatedly for the same reason, each failure message is only logged the first time; repeats are
+	 * counted, and reported at most once every repeatedFailureLogSummaryInterval (and once the message changes, or a sync
+	 * succeeds). This is safe to use from any goroutine.
+	 */
+	failureLogFilter *utils.RepeatedLogFilter
+}
+
+// repeatedFailureLogSummaryInterval is how often repeats of the same failure message of a project are reported.
+const repeatedFailureLogSummaryInterval = 5 * time.Minute
+
+// CLIStateResultListener is called after each cwctl invocation of a project completes, with the result of the sync, the
+// exit code of the process (exitCodeUnknown if it did not exit normally, or was not run), its combined output, and how
+// long it took to run. Listeners are called on a separate goroutine, so they may block without delaying subsequent syncs.
+type CLIStateResultListener func(projectID string, result SyncResult, exitCode int, output string, elapsedTimeInMsecs int64)
+
+// marshalMockProjectJSON creates the project JSON that is passed to the mock cwctl. This is a variable so that automated
+// tests may simulate a failure.
+var marshalMockProjectJSON = json.Marshal
+
+// newCLIStateRetryBackoff returns the backoff used to schedule retries of failed syncs (if no further file changes are
+// received in the meantime): 1s, 2s, 4s, (...) up to a maximum of 60s. This is a variable so that the values may be replaced by automated tests.
+var newCLIStateRetryBackoff = func() utils.ExponentialBackoff {
+	return utils.ExponentialBackoff{
+		MinFailureDelay: 1000,
+		FailureDelay:    0,
+		MaxFailureDelay: 60000,
+		BackoffExponent: 2,
+	}
+}
+
+// SyncResult is the category of the result of a cwctl invocation of a project, so that callers may distinguish the
+// kinds of failure without interpreting the exit code of the process (which RunProjectReturn preserves separately).
+type SyncResult int
+
+const (
+	// SyncResultSucceeded is used when cwctl completed with an exit code of 0.
+	SyncResultSucceeded SyncResult = iota
+
+	// SyncResultFailed is used when cwctl completed with a non-zero exit code, or failed without one.
+	SyncResultFailed
+
+	// SyncResultTimeout is used when cwctl was killed after exceeding the sync timeout.
+	SyncResultTimeout
+
+	// SyncResultDisposed is used when cwctl was killed because the CLIState was disposed.
+	SyncResultDisposed
+
+	// SyncResultProjectPathMissing is used when cwctl was not run, because the project directory no longer exists.
+	SyncResultProjectPathMissing
+
+	// SyncResultSpawnFailed is used when the cwctl process could not be started (for example, the installer is
+	// missing, or is not executable).
+	SyncResultSpawnFailed
+
+	// SyncResultSuperseded is used when cwctl was killed (or not started) because a sync of the entire project was
+	// requested while it was syncing individual changes; this is not a failure, as the full sync includes them.
+	SyncResultSuperseded
+
+	// SyncResultInvalidArguments is used when cwctl was not run, because its arguments could not be determined (for
+	// example, a ref path of the project could not be converted to a local path).
+	SyncResultInvalidArguments
+)
+
+// String returns a short description of the result, for example to allow an incorrectly installed cwctl to be
+// distinguished from a failed sync.
+func (result SyncResult) String() string {
+	switch result {
+	case SyncResultSucceeded:
+		return "succeeded"
+	case SyncResultFailed:
+		return "syncFailed"
+	case SyncResultTimeout:
+		return "timeout"
+	case SyncResultDisposed:
+		return "disposed"
+	case SyncResultProjectPathMissing:
+		return "projectPathMissing"
+	case SyncResultSpawnFailed:
+		return "spawnFailed"
+	case SyncResultSuperseded:
+		return "superseded"
+	case SyncResultInvalidArguments:
+		return "invalidArguments"
+	}
+	return "unknown"
+}
+
+// exitCodeUnknown is the exit code of a RunProjectReturn when cwctl did not exit normally, or was not run.
+const exitCodeUnknown = -1
+
+// NewCLIState contains the state of the CLI project sync commmand for a single project (id+path), configured by the
+// given config. The result listener is optional, and may be nil. The extra environment variables (optional, may be
+// nil) are set for each cwctl process, in addition to (or replacing) those of the filewatcher process. An error is
+// returned if the installer is not an executable file (see validateInstallerPath), or the config is invalid.
+func NewCLIState(projectIDParam string, installerPathParam string, projectPathParam string, configParam CLIConfig,
+	resultListenerParam CLIStateResultListener, extraEnvParam map[string]string) (*CLIState, error) {
+
+	return newCLIStateWithClock(projectIDParam, installerPathParam, projectPathParam, configParam, resultListenerParam, extraEnvParam, realClock{})
+}
+
+// newCLIStateWithClock is the same as NewCLIState, but uses the given clock rather than the system clock (for testing).
+func newCLIStateWithClock(projectIDParam string, installerPathParam string, projectPathParam string, configParam CLIConfig,
+	resultListenerParam CLIStateResultListener, extraEnvParam map[string]string, clockParam Clock) (*CLIState, error) {
+
+	if installerPathParam == "" {
+		// This object should not be instantiated if the installerPath is empty.
+		return nil, errors.New("Installer path is empty: " + installerPathParam)
+	}
+
+	// Relative paths are resolved against the current working directory now, so that later behaviour (such as the
+	// working directory of cwctl) does not depend on it.
+	absInstallerPath, err := filepath.Abs(installerPathParam)
+	if err != nil {
+		return nil, errors.New("Unable to resolve the absolute path of the installer " + installerPathParam + ": " + err.Error())
+	}
+	installerPathParam = absInstallerPath
+
+	// A misconfigured installer path (eg the directory containing cwctl) is reported now, rather than as a confusing
+	// exec error on the first sync. In an automated test, the mock installer is run instead.
+	if strings.TrimSpace(configParam.MockInstallerPath) == "" {
+		if err := validateInstallerPath(installerPathParam); err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.TrimSpace(projectPathParam) != "" {
+		absProjectPath, err := filepath.Abs(projectPathParam)
+		if err != nil {
+			return nil, errors.New("Unable to resolve the absolute path of the project " + projectPathParam + ": " + err.Error())
+		}
+		projectPathParam = absProjectPath
+	}
+
+	if problems := configParam.validate(); len(problems) > 0 {
+		return nil, errors.New("Invalid configuration: " + strings.Join(problems, "; "))
+	}
+
+	workingDir, err := resolveCwctlWorkingDir(strings.TrimSpace(configParam.WorkingDir), projectPathParam)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	result := &CLIState{
+		projectID:               projectIDParam,
+		installerPath:           installerPathParam,
+		projectPath:             projectPathParam,
+		config:                  configParam,
+		syncCommand:             configParam.syncCommand(),
+		mockInstallerPath:       strings.TrimSpace(configParam.MockInstallerPath),
+		dryRun:                  configParam.DryRun,
+		workingDir:              workingDir,
+		syncTimeout:             configParam.SyncTimeout,
+		quietPeriod:             configParam.QuietPeriod,
+		minSyncInterval:         configParam.MinSyncInterval,
+		circuitBreakerThreshold: configParam.CircuitBreakerThreshold,
+		circuitBreakerCooldown:  configParam.CircuitBreakerCooldown,
+		channel:                 make(chan CLIStateChannelEntry, configParam.ChannelCapacity),
+		ctx:                     ctx,
+		cancel:                  cancel,
+		resultListener:          resultListenerParam,
+		maxOutputBytes:          configParam.MaxOutputBytes,
+		extraEnv:                make(map[string]string),
+		clock:                   clockParam,
+		failureLogFilter:        utils.NewRepeatedLogFilter(repeatedFailureLogSummaryInterval),
+	}
+
+	for key, value := range extraEnvParam {
+		result.extraEnv[key] = value
+	}
+
+	syncStatusRegistry.register(result)
+
+	// The backoff is created here, rather than by the goroutine, as automated tests may replace newCLIStateRetryBackoff
+	go result.readChannel(newCLIStateRetryBackoff())
+
+	return result, nil
+
+}
+
+// validateInstallerPath returns an error describing the problem if the installer does not exist, is not a regular file
+// (for example, it is the directory containing cwctl), or (other than on Windows) is not executable.
+func validateInstallerPath(installerPath string) error {
+
+	info, err := os.Stat(installerPath)
+	if err != nil {
+		return errors.New("Unable to access the installer " + installerPath + ": " + err.Error())
+	}
+
+	if info.IsDir() {
+		return errors.New("The installer path " + installerPath + " is a directory; it must be the path of the cwctl executable")
+	} else if !info.Mode().IsRegular() {
+		return errors.New("The installer path " + installerPath + " is not a regular file; it must be the path of the cwctl executable")
+	}
+
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0 {
+		return errors.New("The installer " + installerPath + " is not executable (its permissions are " + info.Mode().Perm().String() + ")")
+	}
+
+	return nil
+}
+
+// resolveCwctlWorkingDir returns the absolute path of the working directory of cwctl for the given value of
+// CWCTL_WORKING_DIR: empty (or 'installer') for the directory containing the installer, 'project' for the project
+// directory, otherwise the given directory.
+func resolveCwctlWorkingDir(setting string, projectPath string) (string, error) {
+
+	if setting == "" || strings.EqualFold(setting, "installer") {
+		return "", nil
+	}
+
+	if strings.EqualFold(setting, "project") {
+		return projectPath, nil
+	}
+
+	absWorkingDir, err := filepath.Abs(setting)
+	if err != nil {
+		return "", errors.New("Unable to resolve the absolute path of the cwctl working directory " + setting + ": " + err.Error())
+	}
+
+	return absWorkingDir, nil
+}
+
+// OnFileChangeEvent is called by eventbatchutil and projectlist.
+// This method is defacto non-blocking: it will pass the file notification to the go channel (which should be read immediately)
+// then immediately return. If the channel is not read within callerSendTimeout, an error is returned rather than
+// blocking the caller.
+func (state *CLIState) OnFileChangeEvent(projectCreationTimeInAbsoluteMsecsParam int64, ptw *models.ProjectToWatch) error {
+	return state.OnFileChangeEventWithChanges(projectCreationTimeInAbsoluteMsecsParam, ptw, nil, "")
+}
+
+// OnFileChangeEventWithChanges is the same as OnFileChangeEvent, but with the changes (sorted by timestamp) that were
+// received, so that the files which were changed and deleted may be passed to cwctl (see syncchangeset.go). If the
+// changes are nil, they are unknown, and cwctl will examine the entire project. The correlation ID of the batch of
+// changes (if any) is logged with the sync that includes them.
+func (state *CLIState) OnFileChangeEventWithChanges(projectCreationTimeInAbsoluteMsecsParam int64, ptw *models.ProjectToWatch, changes []ChangedFileEntry, correlationID string) error {
+
+	if strings.TrimSpace(state.projectPath) == "" {
+		msg := "Project path passed to CLIState is empty, so ignoring file change event."
+		utils.LogSevere(msg)
+		return errors.New(msg)
+	}
+
+	// Inform channel that a new file change list was received (but don't actually send it)
+	return state.sendToChannelWithTimeout(CLIStateChannelEntry{projectCreationTimeInAbsoluteMsecsParam: projectCreationTimeInAbsoluteMsecsParam, ptw: ptw, changes: changes, correlationID: correlationID}, callerSendTimeout)
+}
+
+// OnFullResyncRequested is the same as OnFileChangeEvent, but is called when the individual changes are no longer
+// known (for example, too many changes were received), so the entire project must be synced: an active sync of
+// individual changes is cancelled (as the partial sync would only delay it), and the full sync is started as soon as
+// its process exits, without waiting for the quiet period. A running sync of the entire project is never cancelled.
+func (state *CLIState) OnFullResyncRequested(projectCreationTimeInAbsoluteMsecsParam int64, ptw *models.ProjectToWatch, correlationID string) error {
+
+	if strings.TrimSpace(state.projectPath) == "" {
+		msg := "Project path passed to CLIState is empty, so ignoring full resync request."
+		utils.LogSevere(msg)
+		return errors.New(msg)
+	}
+
+	return state.sendToChannelWithTimeout(CLIStateChannelEntry{projectCreationTimeInAbsoluteMsecsParam: projectCreationTimeInAbsoluteMsecsParam, ptw: ptw, isFullResync: true, correlationID: correlationID}, callerSendTimeout)
+}
+
+// UpdateProjectToWatch replaces the watch settings (ignore rules, ref paths) that are used by the next sync, without
+// starting a sync; a sync that is already running is not affected. This method is non-blocking, in the same way as
+// OnFileChangeEvent.
+func (state *CLIState) UpdateProjectToWatch(ptw *models.ProjectToWatch) error {
+	return state.sendToChannelWithTimeout(CLIStateChannelEntry{ptw: ptw, isProjectToWatchUpdate: true}, callerSendTimeout)
+}
+
+// RetryFailedSync immediately retries the most recent sync, if it failed and its retry has not yet run. This
+// method is non-blocking, in the same way as OnFileChangeEvent.
+func (state *CLIState) RetryFailedSync() error {
+	return state.sendToChannelWithTimeout(CLIStateChannelEntry{isRetryNow: true}, callerSendTimeout)
+}
+
+// HasPendingChanges returns true if there are file changes of the project that have not yet been synced, other than
+// those of the active sync (if any): they are waiting for the quiet period or minimum sync interval to elapse, or for
+// the retry of a failed sync, or the project is paused, or its circuit breaker is open. Together with IsSyncing(),
+// this indicates whether the changes of the project have been synced (eg so that an IDE may show that it is syncing).
+// This may be called from any goroutine; it returns false once the CLIState is disposed.
+func (state *CLIState) HasPendingChanges() bool {
+	changesPending, _ := syncStatusRegistry.syncState(state)
+	return changesPending
+}
+
+// IsSyncing returns true if a sync of the project is active (including one that is waiting for a cwctl process slot).
+// This may be called from any goroutine; it returns false once the CLIState is disposed.
+func (state *CLIState) IsSyncing() bool {
+	_, syncActive := syncStatusRegistry.syncState(state)
+	return syncActive
+}
+
+// Pause prevents cwctl from being run for this project (other than a sync that is already running), until Resume() is
+// called. File change events continue to be received while paused. This method is non-blocking, in the same way as
+// OnFileChangeEvent.
+func (state *CLIState) Pause() error {
+	return state.sendToChannelWithTimeout(CLIStateChannelEntry{isPausedChange: true, paused: true}, callerSendTimeout)
+}
+
+// Resume allows cwctl to be run again for this project; if any file changes were received while paused, a single sync
+// is run for all of them. This method is non-blocking, in the same way as OnFileChangeEvent.
+func (state *CLIState) Resume() error {
+	return state.sendToChannelWithTimeout(CLIStateChannelEntry{isPausedChange: true, paused: false}, callerSendTimeout)
+}
+
+// Shutdown waits for any running sync to complete, then runs a final sync if there are changes that have not yet
+// been synced (or if forceSync is true), ignoring the quiet period and any pause. Failed syncs are not retried. The
+// caller should then call Dispose(), which kills the cwctl process if this method does not return in time.
+func (state *CLIState) Shutdown(forceSync bool) error {
+
+	shutdownComplete := make(chan struct{})
+
+	err := state.sendToChannelWithTimeout(CLIStateChannelEntry{shutdownComplete: shutdownComplete, shutdownForceSync: forceSync}, callerSendTimeout)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-shutdownComplete:
+		return nil
+	case <-state.ctx.Done():
+		return errors.New("CLI state for project " + state.projectID + " was disposed before shutdown completed")
+	}
+}
+
+// Dispose stops the channel goroutine of this object, and kills the cwctl process (if one is running). Once disposed,
+// OnFileChangeEvent will return an error rather than block. It is safe to call this method multiple times.
+func (state *CLIState) Dispose() {
+	utils.LogInfo("Disposing of CLI state for project " + state.projectID)
+	atomic.StoreInt32(&state.disposed, 1)
+	state.cancel()
+	syncStatusRegistry.unregister(state)
+}
+
+// isDisposed returns true once Dispose() has been called; this may be called from any goroutine.
+func (state *CLIState) isDisposed() bool {
+	return atomic.LoadInt32(&state.disposed) == 1
+}
+
+func (state *CLIState) newDisposedError() error {
+	return errors.New("CLI state for project " + state.projectID + " has been disposed")
+}
+
+// sendToChannel passes the entry to the readChannel goroutine, or returns an error if this object has been disposed.
+//
+// Rather than closing 'channel' on dispose (which would cause senders to panic), senders instead check the disposed
+// flag, then select on the done channel of the context. The flag is checked first as the channel is buffered: once the
+// context is cancelled, a send to a channel with free capacity could otherwise still (randomly) be selected, and the
+// entry would then never be read.
+func (state *CLIState) sendToChannel(entry CLIStateChannelEntry) error {
+	if state.isDisposed() {
+		return state.newDisposedError()
+	}
+
+	select {
+	case state.channel <- entry:
+		return nil
+	case <-state.ctx.Done():
+		return state.newDisposedError()
+	}
+}
+
+// callerSendTimeout is the maximum time that the public methods of CLIState will block their caller (for example, the
+// project list goroutine), while waiting for the readChannel goroutine to receive an entry.
+const callerSendTimeout = 10 * time.Second
+
+// sendToChannelWithTimeout is the same as sendToChannel, but returns an error if the entry is not received within the
+// timeout. This is only used for entries from external callers: the entries of internal goroutines (such as the
+// result of a cwctl process) must not be dropped.
+func (state *CLIState) sendToChannelWithTimeout(entry CLIStateChannelEntry, timeout time.Duration) error {
+
+	if state.isDisposed() {
+		return state.newDisposedError()
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case state.channel <- entry:
+		return nil
+	case <-state.ctx.Done():
+		return state.newDisposedError()
+	case <-timer.C:
+		msg := "The CLI state for project " + state.projectID + " did not receive a channel entry within " + timeout.String() + ", so the entry was dropped"
+		utils.LogSevere(msg)
+		return errors.New(msg)
+	}
+}
+
+// fullSyncTimestamp is the timestamp of a sync when no earlier point in time is known from which to examine the changes
+// of the project (the epoch): cwctl syncs every file of the project, as each was modified after it.
+const fullSyncTimestamp int64 = 0
+
+// firstSyncTimestamp returns the timestamp of the syncs of a project until one has succeeded: the creation time of the
+// project, or fullSyncTimestamp if that is not known, or is later than the current time (as changes made before it would
+// otherwise never be synced).
+func firstSyncTimestamp(projectCreationTimeInAbsoluteMsecs int64, nowInAbsoluteMsecs int64) int64 {
+	if projectCreationTimeInAbsoluteMsecs <= 0 || projectCreationTimeInAbsoluteMsecs > nowInAbsoluteMsecs {
+		return fullSyncTimestamp
+	}
+	return projectCreationTimeInAbsoluteMsecs
+}
+
+// describeSyncTimestamp returns the timestamp of a sync as a string, noting if the entire project is synced.
+func describeSyncTimestamp(timestamp int64) string {
+	if timestamp == fullSyncTimestamp {
+		return timestampToString(timestamp) + " (no previous sync, so the entire project is synced)"
+	}
+	return timestampToString(timestamp)
+}
+
+// readChannel processes the entries of the channel until the CLIState is disposed; the retry backoff is used to delay
+// the retries of failed syncs.
+func (state *CLIState) readChannel(retryBackoff utils.ExponentialBackoff) {
+	processWaiting := false // Once the current command completes, should we start another one
+	processActive := false  // Is there currently a cwctl command active.
+
+	// The timestamp of the next sync; until a sync succeeds, this is determined by firstSyncTimestamp
+	lastTimestamp := fullSyncTimestamp
+	futureCreationTimeLogged := false // True once a creation time later than the current time has been logged
+
+	// If pinned, the timestamp is not advanced after a successful sync (the configuration has already been validated)
+	timestampPinned, fixedTimestamp, _ := state.config.pinnedTimestamp()
+	if timestampPinned {
+		pinnedTo := "its creation time"
+		if fixedTimestamp > 0 {
+			lastTimestamp = fixedTimestamp
+			pinnedTo = timestampToString(fixedTimestamp)
+		}
+		utils.LogWarning("The sync timestamp of project " + state.projectID + " is pinned to " + pinnedTo +
+			", so every sync re-examines every file modified since then; this is for diagnosis only")
+	}
+
+	// Incremented on each new file change event; a scheduled retry is only run if no new file change
+	// events have been received since it was scheduled (as the newer event supersedes it).
+	fileChangeGeneration := 0
+
+	// True if the most recent sync failed, and it has not yet been retried (or superseded by another sync).
+	retryPending := false
+
+	// True if we are waiting for the quiet period to elapse after the most recent file change event.
+	waitingForQuietPeriod := false
+	var cancelQuietPeriod context.CancelFunc
+
+	// The time at which the most recent sync completed (zero if none has), and whether a sync is waiting for the
+	// minimum sync interval to elapse since then.
+	var lastSyncCompletionTime time.Time
+	waitingForMinSyncInterval := false
+
+	// The files changed since the most recent successful sync, other than those of the active sync (if any)
+	pendingChanges := newSyncChangeSet()
+	var activeChanges *syncChangeSet
+
+	// Kills the cwctl process of the active sync (if any), when superseded by a sync of the entire project
+	var cancelActiveSync context.CancelFunc
+
+	// The number of consecutive failed syncs, and whether the circuit breaker is open (no syncs are started until the
+	// cool-down has elapsed).
+	consecutiveFailures := 0
+	circuitOpen := false
+
+	// True if syncing has been paused; file changes are still recorded (in processWaiting), but no sync is started.
+	paused := false
+
+	// True once Shutdown() has been called; shutdownComplete is then closed (and set to nil) once there is no sync
+	// active or waiting, after which no further syncs are started.
+	shuttingDown := false
+	var shutdownComplete chan struct{}
+
+	mostRecentPtw := (*models.ProjectToWatch)(nil) // The watch settings of the project, as of the most recent file change
+
+	// Whether the syncs are keeping up with the file changes of the project (see synclag.go)
+	lagTracker := newSyncLagTracker(state)
+
+	// Whether there are changes that have yet to be synced, as last published to the sync status registry
+	changesPending := false
+
+	for {
+
+		var channelResult CLIStateChannelEntry
+
+		select {
+		case channelResult = <-state.channel:
+		case <-state.ctx.Done():
+		}
+
+		// If both were ready, select may have chosen an entry that is still buffered in the channel; once disposed,
+		// such entries are discarded.
+		if state.ctx.Err() != nil {
+			// Any running cwctl process is killed by the cancellation of the context
+			if cancelActiveSync != nil {
+				cancelActiveSync()
+			}
+			state.failureLogFilter.Reset()
+			utils.LogInfoProject(state.projectID, "CLI state channel goroutine has terminated for project "+state.projectID)
+			return
+		}
+
+		if channelResult.runProjectReturn != nil {
+			// Event: Previous run of cwctl command has completed
+			processActive = false
+
+			if cancelActiveSync != nil {
+				cancelActiveSync()
+				cancelActiveSync = nil
+			}
+
+			rpr := channelResult.runProjectReturn
+
+			// A superseded sync is immediately followed by the full sync, so it does not delay it
+			if rpr.result != SyncResultSuperseded {
+				lastSyncCompletionTime = state.clock.Now()
+			}
+
+			syncStatusRegistry.syncCompleted(state, rpr, nowInMsecs(state.clock))
+			recordExpvarSyncResult(rpr.result)
+
+			// If changes were received while the sync ran, another sync will immediately follow it
+			if rpr.result != SyncResultDisposed {
+				lagTracker.syncCompleted(processWaiting)
+			}
+
+			if state.resultListener != nil && rpr.result != SyncResultDisposed && rpr.result != SyncResultSuperseded {
+				// Call the listener on a separate goroutine, so that it cannot block this one
+				go state.resultListener(state.projectID, rpr.result, rpr.exitCode, rpr.output, rpr.elapsedTime)
+			}
+
+			if rpr.result == SyncResultSucceeded {
+				// Success, so update the timestamp (unless pinned) to the process start time, minus the safety margin (see
+				// mtimeresolution.go): the next sync
+				// will re-examine any files that were modified near the boundary of this one. Syncing a file twice
+				// is harmless, whereas a missed file is not synced until it is next modified. The timestamp is
+				// compared against file modification times, so it is optionally adjusted for file system clock skew.
+				if timestampPinned {
+					utils.LogInfoProject(state.projectID, "Timestamp was not updated, as it is pinned to "+strconv.FormatInt(lastTimestamp, 10))
+				} else {
+					timestampSafetyMargin := getTimestampSafetyMargin(state.projectPath, state.config)
+					newTimestamp := rpr.spawnTime + getClockSkewCompensation() - int64(timestampSafetyMargin/time.Millisecond)
+					if newTimestamp > lastTimestamp {
+						lastTimestamp = newTimestamp
+					}
+					utils.LogInfoProject(state.projectID, "Updating timestamp to latest: "+strconv.FormatInt(lastTimestamp, 10))
+				}
+
+				// Any repeats of the failure messages are reported, so that a subsequent failure is logged in full
+				state.failureLogFilter.Reset()
+
+				retryBackoff.SuccessReset()
+
+				if state.circuitBreakerThreshold > 0 && consecutiveFailures >= state.circuitBreakerThreshold {
+					utils.LogInfoProject(state.projectID, "Circuit breaker for project "+state.projectID+" has closed, as the sync succeeded")
+				}
+				consecutiveFailures = 0
+				syncStatusRegistry.circuitBreakerChanged(state, false, consecutiveFailures)
+
+			} else if rpr.result == SyncResultSuperseded {
+				// The changes of the cancelled sync are included in the full sync, which is already waiting
+				pendingChanges.merge(activeChanges)
+				utils.LogInfoProject(state.projectID, "Sync of project "+state.projectID+" was cancelled, as it was superseded by a sync of the entire project")
+
+			} else {
+				if rpr.result == SyncResultDisposed {
+					// Nothing to do: the goroutine will terminate on the next iteration
+					continue
+				}
+
+				// The changes of the failed sync have not been synced, so they are passed to the next sync
+				pendingChanges.merge(activeChanges)
+
+				// While cwctl fails for the same reason, the message is only logged periodically
+				switch rpr.result {
+				case SyncResultProjectPathMissing:
+					state.failureLogFilter.Log("result", "Unable to sync project "+state.projectID+": "+rpr.output, utils.LogError)
+				case SyncResultInvalidArguments:
+					state.failureLogFilter.Log("result", "Unable to sync project "+state.projectID+", as the cwctl arguments are invalid: "+rpr.output, utils.LogError)
+				case SyncResultSpawnFailed:
+					state.failureLogFilter.Log("result", "Unable to run the installer; it may be missing, or not be executable: "+rpr.output, utils.LogSevere)
+				case SyncResultTimeout:
+					state.failureLogFilter.Log("result", "Installer was killed after exceeding the sync timeout of "+state.syncTimeout.String()+": "+rpr.output, utils.LogSevere)
+				default:
+					state.failureLogFilter.Log("result", "Non-zero error code from installer ("+strconv.Itoa(rpr.exitCode)+"): "+rpr.output, utils.LogSevere)
+				}
+
+				retryBackoff.FailIncrease()
+
+				consecutiveFailures++
+				if state.circuitBreakerThreshold > 0 && consecutiveFailures >= state.circuitBreakerThreshold {
+					// Opening the circuit is logged once, rather than on each file change while it is open
+					circuitOpen = true
+					utils.LogSevere("Circuit breaker for project " + state.projectID + " has opened after " + strconv.Itoa(consecutiveFailures) +
+						" consecutive failed syncs; cwctl will not be run for " + state.circuitBreakerCooldown.String())
+					state.scheduleEntry(state.circuitBreakerCooldown, CLIStateChannelEntry{isCircuitBreakerCooldownElapsed: true})
+				}
+				syncStatusRegistry.circuitBreakerChanged(state, circuitOpen, consecutiveFailures)
+
+				// Persistent failures are also notified to the webhook, if configured (see failurewebhook.go)
+				if reason := failureWebhookReason(state.config, consecutiveFailures, circuitOpen); reason != "" {
+					sendFailureWebhook(state.config, failureWebhookPayload{
+						ProjectID:           state.projectID,
+						Reason:              reason,
+						Error:               rpr.result.String(),
+						ExitCode:            rpr.exitCode,
+						ConsecutiveFailures: consecutiveFailures,
+						OutputTail:          rpr.output,
+						Timestamp:           nowInMsecs(state.clock),
+					})
+				}
+
+				// If another sync is already waiting, then it will pick up the changes from the failed sync; otherwise,
+				// schedule a retry so that the changes aren't lost (unless shutting down, or the circuit is open, in
+				// which case the probe sync will pick them up).
+				if !processWaiting && !shuttingDown && !circuitOpen {
+					retryPending = true
+					state.scheduleRetry(fileChangeGeneration, time.Duration(retryBackoff.GetFailureDelay())*time.Millisecond)
+				}
+			}
+
+		} else if channelResult.isRetry {
+			// Event: A previously scheduled retry of a failed sync is ready to run
+			if !retryPending {
+				utils.LogDebugProject(state.projectID, "Ignoring scheduled retry for project "+state.projectID+", as the failed sync was already retried.")
+			} else if channelResult.fileChangeGeneration == fileChangeGeneration {
+				utils.LogInfoProject(state.projectID, "Retrying failed sync for project "+state.projectID)
+				processWaiting = true
+			} else {
+				utils.LogDebugProject(state.projectID, "Ignoring scheduled retry for project "+state.projectID+", as it was superseded by a newer file change.")
+			}
+
+		} else if channelResult.isRetryNow {
+			// Event: A failed sync should be retried immediately, rather than waiting for its scheduled retry
+			if retryPending {
+				utils.LogInfoProject(state.projectID, "Retrying failed sync for project "+state.projectID+" without waiting for the scheduled retry")
+				processWaiting = true
+			}
+
+		} else if channelResult.isQuietPeriodElapsed {
+			// Event: The quiet period has elapsed; this is only relevant if no newer file change has reset it
+			if channelResult.fileChangeGeneration == fileChangeGeneration {
+				waitingForQuietPeriod = false
+				cancelQuietPeriod = nil
+			}
+
+		} else if channelResult.shutdownComplete != nil {
+			// Event: The filewatcher is shutting down, so run a final sync of any pending changes
+			if !shuttingDown {
+				shuttingDown = true
+				shutdownComplete = channelResult.shutdownComplete
+				if channelResult.shutdownForceSync || retryPending {
+					processWaiting = true
+				}
+				utils.LogInfoProject(state.projectID, "Shutting down CLI state for project "+state.projectID+", sync active: "+strconv.FormatBool(processActive)+", sync pending: "+strconv.FormatBool(processWaiting))
+			} else if shutdownComplete == nil {
+				// Shutdown has already completed
+				close(channelResult.shutdownComplete)
+			} else {
+				// Shutdown was already requested, so complete this request at the same time
+				go func(existing chan struct{}, additional chan struct{}) {
+					<-existing
+					close(additional)
+				}(shutdownComplete, channelResult.shutdownComplete)
+			}
+
+		} else if channelResult.isCircuitBreakerCooldownElapsed {
+			// Event: The circuit breaker cool-down has elapsed, so run a probe sync; the circuit is closed if it
+			// succeeds, and re-opened if it fails
+			circuitOpen = false
+			processWaiting = true
+			utils.LogInfoProject(state.projectID, "Circuit breaker cool-down for project "+state.projectID+" has elapsed, so running a probe sync")
+			syncStatusRegistry.circuitBreakerChanged(state, circuitOpen, consecutiveFailures)
+
+		} else if channelResult.isMinSyncIntervalElapsed {
+			// Event: The minimum interval since the previous sync has elapsed
+			waitingForMinSyncInterval = false
+
+		} else if channelResult.isProjectToWatchUpdate {
+			// Event: The watch settings of the project have changed; these apply from the next sync
+			if channelResult.ptw != nil {
+				mostRecentPtw = channelResult.ptw
+			}
+
+		} else if channelResult.isPausedChange {
+			// Event: Syncing of the project has been paused or resumed
+			if paused != channelResult.paused {
+				paused = channelResult.paused
+				if paused {
+					utils.LogInfoProject(state.projectID, "Syncing of project "+state.projectID+" has been paused")
+					lagTracker.reset("Syncs of project " + state.projectID + " are no longer lagging behind its file changes, as syncing has been paused")
+				} else {
+					utils.LogInfoProject(state.projectID, "Syncing of project "+state.projectID+" has been resumed, sync pending: "+strconv.FormatBool(processWaiting))
+				}
+				syncStatusRegistry.pausedChanged(state, paused)
+			}
+
+		} else {
+			// Event: Another thread has informed us of new file changes
+			fileChangeGeneration++
+
+			pendingChanges.addChanges(channelResult.changes)
+			pendingChanges.addCorrelationID(channelResult.correlationID)
+
+			lagTracker.changesReceived(processActive)
+
+			if lastTimestamp == fullSyncTimestamp {
+				creationTime := channelResult.projectCreationTimeInAbsoluteMsecsParam
+				if newTimestamp := firstSyncTimestamp(creationTime, nowInMsecs(state.clock)); newTimestamp != fullSyncTimestamp {
+					utils.LogInfoProject(state.projectID, "Timestamp updated from "+timestampToString(lastTimestamp)+" to "+timestampToString(newTimestamp)+" from project creation time.")
+					lastTimestamp = newTimestamp
+				} else if creationTime > 0 && !futureCreationTimeLogged {
+					futureCreationTimeLogged = true
+					utils.LogWarning("The creation time of project " + state.projectID + " (" + timestampToString(creationTime) +
+						") is later than the current time, so the entire project will be synced")
+				}
+			}
+
+			if channelResult.ptw != nil {
+				mostRecentPtw = channelResult.ptw
+			}
+
+			processWaiting = true
+
+			if channelResult.isFullResync {
+				// Only a sync of individual changes is cancelled: a full sync that is already running is not repeated
+				// work, and may be close to completion.
+				if processActive && cancelActiveSync != nil && activeChanges != nil && activeChanges.isKnown() && !shuttingDown {
+					utils.LogInfoProject(state.projectID, "Cancelling the active sync of project "+state.projectID+", as a sync of the entire project was requested")
+					cancelActiveSync()
+					cancelActiveSync = nil
+				}
+
+				// The batch has already ended, so there is no need to wait for the quiet period
+				if cancelQuietPeriod != nil {
+					cancelQuietPeriod()
+					cancelQuietPeriod = nil
+				}
+				waitingForQuietPeriod = false
+
+			} else if state.quietPeriod > 0 {
+				// (Re)start the quiet period
+				if cancelQuietPeriod != nil {
+					cancelQuietPeriod()
+				}
+				waitingForQuietPeriod = true
+				cancelQuietPeriod = state.scheduleQuietPeriodElapsed(fileChangeGeneration)
+			}
+		}
+
+		if !processActive && processWaiting && !waitingForQuietPeriod && !paused && !shuttingDown && !waitingForMinSyncInterval {
+			// Defer the sync if the previous sync completed too recently
+			if !lastSyncCompletionTime.IsZero() {
+				remaining := state.getMinSyncInterval(mostRecentPtw) - state.clock.Now().Sub(lastSyncCompletionTime)
+				if remaining > 0 {
+					utils.LogDebugProject(state.projectID, "Deferring sync of project "+state.projectID+" by "+remaining.String()+", to maintain the minimum interval between syncs")
+					waitingForMinSyncInterval = true
+					state.scheduleEntry(remaining, CLIStateChannelEntry{isMinSyncIntervalElapsed: true})
+				}
+			}
+		}
+
+		// On shutdown, the quiet period, pause, and minimum interval no longer apply, as there will be no further
+		// opportunity to sync; an open circuit still applies, as the sync would be expected to fail.
+		if !processActive && processWaiting && !circuitOpen &&
+			((!waitingForQuietPeriod && !paused && !shuttingDown && !waitingForMinSyncInterval) || shutdownComplete != nil) {
+			// Start a new process if there isn't one running, and we received an update event.
+			processWaiting = false
+			retryPending = false
+			processActive = true
+			activeChanges = pendingChanges
+			pendingChanges = newSyncChangeSet()
+			if len(activeChanges.correlationIDs) == 0 {
+				// Not the result of a batch of changes (for example, a forced sync)
+				activeChanges.addCorrelationID(newCorrelationID())
+			}
+			syncStatusRegistry.syncStarted(state, activeChanges.correlationIDs)
+			var syncCtx context.Context
+			syncCtx, cancelActiveSync = context.WithCancel(state.ctx)
+			go state.runProjectCommand(syncCtx, lastTimestamp, mostRecentPtw, activeChanges)
+		}
+
+		// The changes of a failed sync are pending until it is retried (or, if the circuit is open, until the probe sync)
+		if pending := processWaiting || retryPending || circuitOpen; pending != changesPending {
+			changesPending = pending
+			syncStatusRegistry.changesPendingChanged(state, changesPending)
+		}
+
+		if shutdownComplete != nil && !processActive && (!processWaiting || circuitOpen) {
+			utils.LogInfoProject(state.projectID, "CLI state for project "+state.projectID+" has completed shutdown")
+			close(shutdownComplete)
+			shutdownComplete = nil
+		}
+	}
+
+}
+
+// getMinSyncInterval returns the minimum interval between syncs of the project, as overridden by the ptw (if non-nil).
+func (state *CLIState) getMinSyncInterval(ptw *models.ProjectToWatch) time.Duration {
+	if ptw != nil && ptw.MinSyncIntervalMs > 0 {
+		return time.Duration(ptw.MinSyncIntervalMs) * time.Millisecond
+	}
+	return state.minSyncInterval
+}
+
+// scheduleRetry will inform the channel that a failed sync should be retried, after the given delay.
+func (state *CLIState) scheduleRetry(fileChangeGeneration int, delay time.Duration) {
+
+	utils.LogInfoProject(state.projectID, "Scheduling a retry of the failed sync for project "+state.projectID+" in "+delay.String())
+
+	state.scheduleEntry(delay, CLIStateChannelEntry{isRetry: true, fileChangeGeneration: fileChangeGeneration})
+}
+
+// scheduleQuietPeriodElapsed will inform the channel once the quiet period has elapsed since the given file change.
+func (state *CLIState) scheduleQuietPeriodElapsed(fileChangeGeneration int) context.CancelFunc {
+	return state.scheduleEntry(state.quietPeriod, CLIStateChannelEntry{isQuietPeriodElapsed: true, fileChangeGeneration: fileChangeGeneration})
+}
+
+// scheduleEntry sends the entry to the channel once the delay has elapsed on the clock of this object, unless the
+// returned function is called first (or this object is disposed).
+func (state *CLIState) scheduleEntry(delay time.Duration, entry CLIStateChannelEntry) context.CancelFunc {
+
+	ctx, cancel := context.WithCancel(state.ctx)
+
+	// The timer is started before returning, so that a fake clock can be advanced as soon as this method returns
+	afterChan := state.clock.After(delay)
+
+	go func() {
+		defer cancel()
+
+		select {
+		case <-afterChan:
+			state.sendToChannel(entry)
+		case <-ctx.Done():
+		}
+	}()
+
+	return cancel
+}
+
+// CLIStateChannelEntry runprojectReturn will be non-null if it is a runProjectCommand response, isRetry will be true if it is
+// a scheduled retry of a failed sync, isRetryNow will be true if a failed sync should be retried immediately,
+// isQuietPeriodElapsed will be true if the quiet period timer has elapsed, isPausedChange will be true if syncing was
+// paused or resumed (according to paused), shutdownComplete will be non-nil on shutdown, isProjectToWatchUpdate will be
+// true if only the watch settings (ptw) have changed, isMinSyncIntervalElapsed will be true if the minimum interval
+// since the previous sync has elapsed, isCircuitBreakerCooldownElapsed will be true if the circuit breaker should
+// run a probe sync, otherwise it is a new file change (of the entire project, if isFullResync is true). */
+type CLIStateChannelEntry struct {
+	projectCreationTimeInAbsoluteMsecsParam int64
+	runProjectReturn                        *RunProjectReturn
+	ptw                                     *models.ProjectToWatch // The current watch settings of the project (ignore rules, ref paths)
+	isRetry                                 bool
+	isRetryNow                              bool
+	isQuietPeriodElapsed                    bool
+	fileChangeGeneration                    int // For retry/quiet period: the value of fileChangeGeneration when the timer was scheduled
+	isPausedChange                          bool
+	paused                                  bool
+	shutdownComplete                        chan struct{} // Closed by the channel goroutine once shutdown is complete
+	shutdownForceSync                       bool
+	isProjectToWatchUpdate                  bool
+	isMinSyncIntervalElapsed                bool
+	isCircuitBreakerCooldownElapsed         bool
+	isFullResync                            bool               // For a file change: the entire project must be synced
+	changes                                 []ChangedFileEntry // For a file change: the changes, sorted by timestamp; nil if unknown
+	correlationID                           string             // For a file change: the correlation ID of the batch, if any
+}
+
+// runProjectCommand runs cwctl for the project, and sends the result to the channel. The sync context is cancelled if
+// this sync is superseded by a sync of the entire project (or the CLIState is disposed), which kills the process.
+func (state *CLIState) runProjectCommand(syncCtx context.Context, timestamp int64, ptw *models.ProjectToWatch, changes *syncChangeSet) {
+
+	// Don't bother calling cwctl if the project directory has been deleted (or is on a volume that is no longer mounted)
+	if _, err := os.Stat(state.projectPath); os.IsNotExist(err) {
+		msg := "Project path no longer exists, skipping sync: " + state.projectPath
+		state.failureLogFilter.Log("projectPath", msg, utils.LogError)
+
+		result := RunProjectReturn{
+			result:           SyncResultProjectPathMissing,
+			exitCode:         exitCodeUnknown,
+			output:           msg,
+			stderr:           msg,
+			syncedFileCount:  unknownFileCount,
+			deletedFileCount: unknownFileCount,
+		}
+		state.sendToChannel(CLIStateChannelEntry{runProjectReturn: &result})
+		return
+	}
+
+	firstArg := ""
+
+	currInstallPath := state.resolveInstallerPath(ptw)
+
+	var args []string
+
+	// The arguments that are specific to this project (other than its ID, path and timestamp)
+	var projectSpecificArgs []string
+
+	lastTimestamp := timestamp
+
+	if state.mockInstallerPath == "" {
+
+		// Normal call to `cwctl project sync`
+
+		firstArg = currInstallPath
+		// Example:
+		// cwctl project sync -p
+		// /Users/tobes/workspaces/git/eclipse/codewind/codewind-workspace/lib5 \
+		// -i b1a78500-eaa5-11e9-b0c1-97c28a7e77c7 -t 1571944337
+		// (or as described by the sync command template, see cwctlsynccommand.go)
+
+		// Do not wrap paths in quotes; it's not needed and Go doesn't like that :P
+		// (No shell is involved, so each argument is received by cwctl as-is, including any spaces, unicode, or shell
+		// special characters.)
+
+		args = append(args, state.syncCommand.syncArgs(state.projectPath, state.projectID, lastTimestamp)...)
+
+		// Pass the ignore rules of the project, and the files that were changed/deleted, if supported by this version of cwctl
+		capabilities := getCwctlSyncCapabilities(currInstallPath, state.syncCommand)
+		projectSpecificArgs = append(projectSpecificArgs, capabilities.ignoreRuleArgs(ptw)...)
+		projectSpecificArgs = append(projectSpecificArgs, capabilities.changeSetArgs(changes)...)
+		args = append(args, projectSpecificArgs...)
+
+	} else {
+
+		// The filewatcher is being run in an automated test scenario: we will now run a
+		// mock version of cwctl that simulates the project sync command. This mock
+		// version takes slightly different parameters.
+
+		if ptw == nil {
+			ptw = &models.ProjectToWatch{}
+		}
+
+		// Convert filesToWatch to absolute paths; if any can't be converted, the sync is aborted, as the mock would
+		// otherwise be run with an incomplete set of files, and report misleading results.
+		convertedFilesToWatch, err := convertRefPathsToLocalFiles(ptw.RefPaths, utils.ConvertAbsoluteUnixStyleNormalizedPathToLocalFile)
+		if err != nil {
+			msg := "Unable to convert the ref paths of project " + state.projectID + ", so the sync was not run: " + err.Error()
+			utils.LogSevere(msg)
+
+			result := RunProjectReturn{
+				result:           SyncResultInvalidArguments,
+				exitCode:         exitCodeUnknown,
+				output:           msg,
+				stderr:           msg,
+				syncedFileCount:  unknownFileCount,
+				deletedFileCount: unknownFileCount,
+			}
+			state.sendToChannel(CLIStateChannelEntry{runProjectReturn: &result})
+			return
+		}
+
+		simplifiedPtwObj := DebugSimplifiedPtw{
+			FilesToWatch:     convertedFilesToWatch,
+			IgnoredFilenames: ptw.IgnoredFilenames,
+			IgnoredPaths:     ptw.IgnoredPaths,
+		}
+
+		// As above, the sync is aborted if the project JSON cannot be created, rather than running the mock without it
+		simplifiedPtw, err := marshalMockProjectJSON(simplifiedPtwObj)
+		if err != nil {
+			msg := "Unable to marshal the project JSON of project " + state.projectID + ", so the sync was not run: " + err.Error()
+			utils.LogSevere(msg)
+
+			result := RunProjectReturn{
+				result:           SyncResultInvalidArguments,
+				exitCode:         exitCodeUnknown,
+				output:           msg,
+				stderr:           msg,
+				syncedFileCount:  unknownFileCount,
+				deletedFileCount: unknownFileCount,
+			}
+			state.sendToChannel(CLIStateChannelEntry{runProjectReturn: &result})
+			return
+		}
+
+		base64Conversion := base64.StdEncoding.EncodeToString(simplifiedPtw)
+
+		if strings.HasSuffix(strings.ToLower(state.mockInstallerPath), ".jar") {
+			firstArg = "java"
+			args = append(args, "-jar", state.mockInstallerPath)
+		} else {
+			firstArg = state.mockInstallerPath
+		}
+
+		args = append(args, "-p", state.projectPath, "-i",
+			state.projectID, "-t", strconv.FormatInt(lastTimestamp, 10), "-projectJson", base64Conversion)
+
+		currInstallPath = state.mockInstallerPath
+	}
+
+	debugStr := ""
+
+	for _, key := range args {
+
+		debugStr += "[ " + key + "] "
+	}
+
+	// Each log of the sync includes the correlation IDs of its changes (see syncchangeset.go)
+	correlationID := changes.correlationIDString()
+	logFields := map[string]string{"projectID": state.projectID, "correlationID": correlationID}
+
+	utils.LogInfoFields("Calling cwctl project sync for project "+state.projectID+" with timestamp "+describeSyncTimestamp(lastTimestamp)+", using "+currInstallPath+
+		" ("+changes.String()+")", logFields)
+	utils.LogDebugProject(state.projectID, "Calling cwctl project sync with: ["+state.projectID+"] { "+debugStr+"}")
+
+	// Start process and wait for complete on this thread.
+
+	installerPwd := filepath.Dir(currInstallPath)
+	if state.workingDir != "" {
+		installerPwd = state.workingDir
+	}
+
+	// The spawn time is captured before waiting for a process slot, rather than when the process actually starts:
+	// all file changes that are received by this point have already been reported to the channel goroutine, and
+	// any changes made while we are waiting will have a modification time after the spawn time, and so will be
+	// re-examined by the next sync (which is guaranteed, as their file change events will arrive after this
+	// sync was started).
+	spawnTimeInMsecs := nowInMsecs(state.clock)
+
+	if state.dryRun {
+		utils.LogInfoFields("Dry run: would run '"+firstArg+"' in '"+installerPwd+"' for project "+state.projectID+" with timestamp "+
+			describeSyncTimestamp(lastTimestamp)+", arguments: { "+debugStr+"}", logFields)
+
+		// Treated as a success, so that the timestamp is advanced in the same way as a real sync
+		result := RunProjectReturn{
+			result:           SyncResultSucceeded,
+			exitCode:         0,
+			spawnTime:        spawnTimeInMsecs,
+			syncedFileCount:  unknownFileCount,
+			deletedFileCount: unknownFileCount,
+		}
+		state.sendToChannel(CLIStateChannelEntry{runProjectReturn: &result})
+		return
+	}
+
+	if info, err := os.Stat(installerPwd); err != nil || !info.IsDir() {
+		msg := "The working directory of cwctl does not exist, or is not a directory, so cwctl was not run: " + installerPwd
+		state.failureLogFilter.Log("workingDir", msg, utils.LogSevere)
+
+		result := RunProjectReturn{
+			result:           SyncResultSpawnFailed,
+			exitCode:         exitCodeUnknown,
+			output:           msg,
+			stderr:           msg,
+			spawnTime:        spawnTimeInMsecs,
+			syncedFileCount:  unknownFileCount,
+			deletedFileCount: unknownFileCount,
+		}
+		state.sendToChannel(CLIStateChannelEntry{runProjectReturn: &result})
+		return
+	}
+
+	// Combine this sync with those of other projects of the same workspace, if enabled (see workspacesync.go)
+	if batcher := getWorkspaceSyncBatcher(state.config); batcher.isEligible(state, currInstallPath, projectSpecificArgs) {
+		if result := batcher.sync(syncCtx, state, state.workingDir, lastTimestamp, spawnTimeInMsecs); result != nil {
+			// The workspace sync is logged for all of its projects, so it is also logged with the IDs of this project
+			utils.LogInfoFields("Cwctl call for the workspace of project "+state.projectID+" completed, result: "+result.result.String(), logFields)
+			state.sendToChannel(CLIStateChannelEntry{runProjectReturn: result})
+			return
+		}
+
+		if syncCtx.Err() != nil {
+			// Disposed or superseded while waiting for the other projects of the workspace
+			state.sendSupersededResult(spawnTimeInMsecs)
+			return
+		}
+
+		// Otherwise, no other project joined the group, so this project is synced alone
+	}
+
+	if err := acquireCwctlProcessSlot(syncCtx, state.projectID, state.config.MaxConcurrentProcesses); err != nil {
+		// Disposed or superseded while waiting to start the process
+		state.sendSupersededResult(spawnTimeInMsecs)
+		return
+	}
+
+	processStartTimeInMsecs := nowInMsecs(state.clock)
+
+	// The process is killed if the CLIState is disposed, the sync is superseded, or (if set) the sync timeout is exceeded
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if state.syncTimeout > 0 {
+		ctx, cancel = context.WithTimeout(syncCtx, state.syncTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(syncCtx)
+	}
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, firstArg, args...)
+	cmd.Dir = installerPwd
+	if len(state.extraEnv) > 0 {
+		cmd.Env = mergeEnvironment(os.Environ(), state.extraEnv)
+	}
+
+	stdout, stderr, combinedOutput := newCwctlOutputWriters(state.maxOutputBytes)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		releaseCwctlProcessSlot()
+
+		if syncCtx.Err() != nil {
+			// Disposed or superseded before the process could be started
+			state.sendSupersededResult(spawnTimeInMsecs)
+			return
+		}
+
+		// The process never ran, so this is not recorded as a sync duration
+		msg := "Unable to start '" + firstArg + "': " + err.Error()
+		state.failureLogFilter.Log("start", msg, utils.LogSevere)
+		recordSyncSpawnFailure(state.projectID, err)
+
+		result := RunProjectReturn{
+			result:           SyncResultSpawnFailed,
+			exitCode:         exitCodeUnknown,
+			output:           msg,
+			stderr:           msg,
+			spawnTime:        spawnTimeInMsecs,
+			syncedFileCount:  unknownFileCount,
+			deletedFileCount: unknownFileCount,
+		}
+		state.sendToChannel(CLIStateChannelEntry{runProjectReturn: &result})
+		return
+	}
+
+	err := cmd.Wait()
+
+	releaseCwctlProcessSlot()
+
+	elapsedTimeInMsecs := nowInMsecs(state.clock) - processStartTimeInMsecs
+
+	utils.LogInfoFields("Cwctl call completed, elapsed time of cwctl call: "+strconv.FormatInt(elapsedTimeInMsecs, 10), logFields)
+
+	if err != nil {
+
+		syncResult := SyncResultFailed
+		exitCode := exitCodeUnknown
+
+		one, castable := err.(*exec.ExitError)
+		if castable {
+			exitCode = one.ExitCode()
+		}
+
+		if state.ctx.Err() != nil {
+			// The process was killed by the context, so the exit code is not meaningful
+			syncResult = SyncResultDisposed
+			utils.LogInfoProject(state.projectID, "'project sync' installer command was terminated, as the CLI state for project "+state.projectID+" was disposed.")
+
+		} else if syncCtx.Err() != nil {
+			// The process was killed because the sync was superseded
+			syncResult = SyncResultSuperseded
+			utils.LogInfoProject(state.projectID, "'project sync' installer command was terminated, as a sync of the entire project "+state.projectID+" was requested.")
+
+		} else if ctx.Err() == context.DeadlineExceeded {
+			syncResult = SyncResultTimeout
+			state.failureLogFilter.Log("timeout", "'project sync' installer command did not complete within "+state.syncTimeout.String()+", and was killed.", utils.LogError)
+		}
+
+		// A process that was killed due to disposal (or that was superseded) did not complete a sync, so it is not recorded
+		if syncResult != SyncResultDisposed && syncResult != SyncResultSuperseded {
+			getSyncMetricsRecorder().RecordSyncDuration(state.projectID, elapsedTimeInMsecs, false)
+		}
+
+		// The correlation ID is not included, as it would make each repeat unique; it is logged with the call above
+		if syncResult != SyncResultSuperseded {
+			state.failureLogFilter.Log("command", "Error running 'project sync' installer command: "+debugStr, utils.LogError)
+			state.failureLogFilter.Log("stdout", "Out: "+stdout.String(), utils.LogError)
+			state.failureLogFilter.Log("stderr", "Err: "+stderr.String(), utils.LogError)
+		}
+
+		result := RunProjectReturn{
+			result:      syncResult,
+			exitCode:    exitCode,
+			output:      combinedOutput.String(),
+			stdout:      stdout.String(),
+			stderr:      stderr.String(),
+			spawnTime:   spawnTimeInMsecs,
+			elapsedTime: elapsedTimeInMsecs,
+		}
+		result.syncedFileCount, result.deletedFileCount = parseSyncFileCounts(result.stdout)
+
+		state.sendToChannel(CLIStateChannelEntry{runProjectReturn: &result})
+
+	} else {
+
+		getSyncMetricsRecorder().RecordSyncDuration(state.projectID, elapsedTimeInMsecs, true)
+
+		utils.LogInfoFields("Successfully ran installer command for project "+state.projectID, logFields)
+		utils.LogDebugProject(state.projectID, "Successfully ran installer command: "+debugStr)
+		utils.LogDebugProject(state.projectID, "Output:"+stdout.String())
+
+		if strings.TrimSpace(stderr.String()) != "" {
+			utils.LogWarning("Error output from successful installer command: " + stderr.String())
+		}
+
+		result := RunProjectReturn{
+			result:      SyncResultSucceeded,
+			exitCode:    0,
+			output:      combinedOutput.String(),
+			stdout:      stdout.String(),
+			stderr:      stderr.String(),
+			spawnTime:   spawnTimeInMsecs,
+			elapsedTime: elapsedTimeInMsecs,
+		}
+		result.syncedFileCount, result.deletedFileCount = parseSyncFileCounts(result.stdout)
+
+		if result.syncedFileCount != unknownFileCount || result.deletedFileCount != unknownFileCount {
+			utils.LogInfoFields("Sync of project "+state.projectID+" synced "+fileCountToString(result.syncedFileCount)+
+				" files, and deleted "+fileCountToString(result.deletedFileCount)+" files", logFields)
+		}
+
+		recordSyncFileCounts(state.projectID, result.syncedFileCount, result.deletedFileCount)
+
+		state.sendToChannel(CLIStateChannelEntry{runProjectReturn: &result})
+
+	}
+}
+
+// sendSupersededResult informs the channel that a sync was superseded before its process was started; nothing is sent
+// if the CLIState has been disposed, as the channel goroutine has terminated.
+func (state *CLIState) sendSupersededResult(spawnTimeInMsecs int64) {
+	if state.ctx.Err() != nil {
+		return
+	}
+
+	result := RunProjectReturn{
+		result:           SyncResultSuperseded,
+		exitCode:         exitCodeUnknown,
+		spawnTime:        spawnTimeInMsecs,
+		syncedFileCount:  unknownFileCount,
+		deletedFileCount: unknownFileCount,
+	}
+	state.sendToChannel(CLIStateChannelEntry{runProjectReturn: &result})
+}
+
+// Limits the number of cwctl processes that may run concurrently, across all projects (CWCTL_MAX_CONCURRENT_PROCESSES);
+// syncs beyond that limit wait for a running process to complete.
+var (
+	cwctlProcessSemaphore     chan bool
+	cwctlProcessSemaphoreOnce sync.Once
+)
+
+// acquireCwctlProcessSlot blocks until a cwctl process may be started, or the context is done (in which case an error
+// is returned, and no slot is held); every successful call must be followed by a call to releaseCwctlProcessSlot() once
+// the process has completed. The limit is shared by all projects, so is set by the maxProcesses of the first call.
+func acquireCwctlProcessSlot(ctx context.Context, projectID string, maxProcesses int) error {
+
+	// Create the semaphore on first use
+	cwctlProcessSemaphoreOnce.Do(func() {
+		if maxProcesses < 1 {
+			maxProcesses = 1
+		}
+		cwctlProcessSemaphore = make(chan bool, maxProcesses)
+	})
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// Fast path: a slot is available immediately
+	select {
+	case cwctlProcessSemaphore <- true:
+		return nil
+	default:
+	}
+
+	utils.LogInfo("The maximum number of concurrent cwctl processes (" + strconv.Itoa(cap(cwctlProcessSemaphore)) + ") are running, so project " + projectID + " is waiting to sync.")
+
+	waitStartTime := time.Now()
+	waitTime := func() string {
+		return strconv.FormatInt(int64(time.Since(waitStartTime)/time.Millisecond), 10)
+	}
+
+	select {
+	case cwctlProcessSemaphore <- true:
+	case <-ctx.Done():
+		utils.LogInfo("Project " + projectID + " stopped waiting to start cwctl after " + waitTime() + " msecs, as its sync was cancelled.")
+		return ctx.Err()
+	}
+
+	// If the context was done at the same time, the slot may have been chosen at random
+	if ctx.Err() != nil {
+		releaseCwctlProcessSlot()
+		return ctx.Err()
+	}
+
+	utils.LogInfo("Project " + projectID + " waited " + waitTime() + " msecs to start cwctl.")
+
+	return nil
+}
+
+func releaseCwctlProcessSlot() {
+	<-cwctlProcessSemaphore
+}
+
+// cwctlOutputTruncatedMarker is appended to cwctl output that exceeded the maximum output size.
+const cwctlOutputTruncatedMarker = "\n[truncated]"
+
+// cappedOutputBuffer is a buffer that keeps at most 'limit' bytes (if non-zero), discarding the remainder.
+type cappedOutputBuffer struct {
+	buffer    bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedOutputBuffer) write(p []byte) {
+	if b.limit > 0 && b.buffer.Len()+len(p) > b.limit {
+		b.buffer.Write(p[:b.limit-b.buffer.Len()])
+		b.truncated = true
+		return
+	}
+	b.buffer.Write(p)
+}
+
+func (b *cappedOutputBuffer) String() string {
+	if b.truncated {
+		return b.buffer.String() + cwctlOutputTruncatedMarker
+	}
+	return b.buffer.String()
+}
+
+// cwctlOutputWriter captures a single output stream (stdout or stderr) of a cwctl process, while also
+// appending it to the combined output of both streams (which is shared, and thus guarded by a lock).
+type cwctlOutputWriter struct {
+	stream   cappedOutputBuffer
+	combined *cappedOutputBuffer
+	lock     *sync.Mutex
+}
+
+// newCwctlOutputWriters returns the writers of the stdout and stderr of a cwctl process, and their combined output,
+// each of which keeps at most maxOutputBytes bytes (0 if unlimited).
+func newCwctlOutputWriters(maxOutputBytes int) (*cwctlOutputWriter, *cwctlOutputWriter, *cappedOutputBuffer) {
+
+	combined := &cappedOutputBuffer{limit: maxOutputBytes}
+	lock := &sync.Mutex{}
+
+	stdout := &cwctlOutputWriter{stream: cappedOutputBuffer{limit: maxOutputBytes}, combined: combined, lock: lock}
+	stderr := &cwctlOutputWriter{stream: cappedOutputBuffer{limit: maxOutputBytes}, combined: combined, lock: lock}
+
+	return stdout, stderr, combined
+}
+
+// Write always reports that the entire output was written, even if it was discarded: otherwise the copying of the
+// output of the process would fail, and the process would be reported as failed regardless of its exit code.
+func (w *cwctlOutputWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.stream.write(p)
+	w.combined.write(p)
+	return len(p), nil
+}
+
+func (w *cwctlOutputWriter) String() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.stream.String()
+}
+
+// mergeEnvironment returns the environment (in os.Environ() 'key=value' format) with the overrides applied: existing
+// variables are replaced, and new variables are appended in key order.
+func mergeEnvironment(environ []string, overrides map[string]string) []string {
+
+	// Environment variable names are case-insensitive on Windows
+	normalizeKey := func(key string) string {
+		if runtime.GOOS == "windows" {
+			return strings.ToUpper(key)
+		}
+		return key
+	}
+
+	overriddenKeys := make(map[string]bool)
+	for key := range overrides {
+		overriddenKeys[normalizeKey(key)] = true
+	}
+
+	result := []string{}
+	for _, entry := range environ {
+		key := entry
+		if index := strings.Index(entry, "="); index > 0 {
+			key = entry[:index]
+		}
+		if !overriddenKeys[normalizeKey(key)] {
+			result = append(result, entry)
+		}
+	}
+
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		result = append(result, key+"="+overrides[key])
+	}
+
+	return result
+}
+
+// resolveInstallerPath returns the installer path of the project, if it has one and it exists, otherwise the
+// installer path that this CLIState was created with.
+func (state *CLIState) resolveInstallerPath(ptw *models.ProjectToWatch) string {
+
+	if ptw == nil || strings.TrimSpace(ptw.InstallerPath) == "" {
+		return state.installerPath
+	}
+
+	// The override may be either a local path, or a unix-style normalized path (like PathToMonitor)
+	overridePath := strings.TrimSpace(ptw.InstallerPath)
+	if strings.HasPrefix(overridePath, "/") {
+		if converted, err := utils.ConvertAbsoluteUnixStyleNormalizedPathToLocalFile(overridePath); err == nil {
+			overridePath = converted
+		}
+	}
+
+	if err := validateInstallerPath(overridePath); err != nil {
+		utils.LogError("The installer path of project " + state.projectID + " is invalid, so the default installer will be used instead: " + err.Error())
+		return state.installerPath
+	}
+
+	return overridePath
+}
+
+// RunProjectReturn contains the return value of runProjectCommand()
+type RunProjectReturn struct {
+	result    SyncResult
+	exitCode  int    // The exit code of the process; exitCodeUnknown if it did not exit normally, or was not run
+	output    string // stdout and stderr, combined in the order they were written
+	stdout    string
+	stderr    string
+	spawnTime int64 // When the sync was requested (before waiting for a process slot), in absolute msecs
+
+	elapsedTime int64 // How long the process ran for, in msecs
+
+	// The number of files synced and deleted, as parsed from stdout; unknownFileCount if they could not be parsed.
+	syncedFileCount  int
+	deletedFileCount int
+}
+
+// convertRefPathsToLocalFiles converts the 'from' path of each ref path (in absolute, normalized, Unix-style form) to a
+// local path, using the given conversion function. Duplicate paths (after conversion and cleaning) are removed, keeping
+// the first occurrence. An error is returned if any path cannot be converted (for the first such path). Large lists are
+// converted concurrently (see utils.ConvertPathsConcurrently).
+func convertRefPathsToLocalFiles(refPaths []models.RefPathEntry, convert func(string) (string, error)) ([]string, error) {
+
+	fromPaths := make([]string, len(refPaths))
+	for index, refPath := range refPaths {
+		fromPaths[index] = refPath.From
+	}
+	localPaths, errs := utils.ConvertPathsConcurrently(fromPaths, 0, convert)
+
+	result := []string{}
+	seen := make(map[string]bool)
+
+	for index, fromPath := range fromPaths {
+
+		if errs[index] != nil {
+			return nil, errors.New("Unable to convert ref path '" + fromPath + "': " + errs[index].Error())
+		}
+		localPath := filepath.Clean(localPaths[index])
+
+		// Paths are case-insensitive on Windows
+		key := localPath
+		if runtime.GOOS == "windows" {
+			key = strings.ToLower(localPath)
+		}
+
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		result = append(result, localPath)
+	}
+
+	return result, nil
+}
+
+// DebugSimplifiedPtw is only used during automated testing.
+type DebugSimplifiedPtw struct {
+	FilesToWatch     []string `json:"filesToWatch"`
+	IgnoredFilenames []string `json:"ignoredFilenames"`
+	IgnoredPaths     []string `json:"ignoredPaths"`
+}
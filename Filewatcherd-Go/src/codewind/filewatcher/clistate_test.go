@@ -0,0 +1,1231 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"codewind/utils"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// replaceRetryBackoff replaces the backoff of the retries of failed syncs of subsequently created CLIStates, returning
+// a function that restores the original.
+func replaceRetryBackoff(minDelayInMsecs int, maxDelayInMsecs int) func() {
+	original := newCLIStateRetryBackoff
+
+	newCLIStateRetryBackoff = func() utils.ExponentialBackoff {
+		return utils.ExponentialBackoff{
+			MinFailureDelay: minDelayInMsecs,
+			FailureDelay:    0,
+			MaxFailureDelay: maxDelayInMsecs,
+			BackoffExponent: 2,
+		}
+	}
+
+	return func() { newCLIStateRetryBackoff = original }
+}
+
+// syncStatusOf returns the sync status of the project of the CLIState, as returned by /status.
+func syncStatusOf(t *testing.T, state *CLIState) ProjectSyncStatus {
+	t.Helper()
+
+	for _, status := range syncStatusRegistry.snapshot() {
+		if status.ProjectID == state.projectID {
+			return status
+		}
+	}
+	t.Fatal("The project " + state.projectID + " is not registered")
+	return ProjectSyncStatus{}
+}
+
+// holdAllCwctlProcessSlots acquires every cwctl process slot, returning a function that releases them.
+func holdAllCwctlProcessSlots(t *testing.T) func() {
+	t.Helper()
+
+	// The limit is set by the first call
+	held := 0
+	for held == 0 || held < cap(cwctlProcessSemaphore) {
+		if err := acquireCwctlProcessSlot(context.Background(), "test", DefaultConfig().CLI.MaxConcurrentProcesses); err != nil {
+			t.Fatal(err)
+		}
+		held++
+	}
+
+	return func() {
+		for ; held > 0; held-- {
+			releaseCwctlProcessSlot()
+		}
+	}
+}
+
+func newTestChangedFileEntry(t *testing.T, path string) ChangedFileEntry {
+	t.Helper()
+
+	entry, err := NewChangedFileEntry(path, "MODIFY", time.Now().UnixNano()/int64(time.Millisecond), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *entry
+}
+
+func expectResult(t *testing.T, results resultRecorder, expected SyncResult) {
+	t.Helper()
+
+	if result := results.next(t); result != expected {
+		t.Fatalf("Expected the sync to be %v, but it was %v", expected, result)
+	}
+}
+
+func TestCLIStateRetriesFailedSyncsWithExponentialBackoff(t *testing.T) {
+	defer replaceRetryBackoff(100, 400)()
+
+	mock := newMockCwctl(t, 3, 3, 3, 3, 0, 3)
+	defer mock.cleanup()
+
+	clock := newFakeClock(time.Now())
+	results := newResultRecorder()
+	state := mock.newCLIState(t, mock.config(t), clock, results.listener)
+	defer state.Dispose()
+
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The delay doubles after each failure, up to the maximum
+	for _, delay := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 400 * time.Millisecond} {
+		expectResult(t, results, SyncResultFailed)
+		clock.waitForWaiter(t, delay)
+		clock.Advance(delay)
+	}
+	expectResult(t, results, SyncResultSucceeded)
+
+	if pending := clock.pendingDurations(); len(pending) != 0 {
+		t.Fatalf("Expected no retry to be scheduled after a successful sync, but found %v", pending)
+	}
+
+	// The backoff is reset by the successful sync
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectResult(t, results, SyncResultFailed)
+	clock.waitForWaiter(t, 100*time.Millisecond)
+
+	if calls := mock.calls(t); len(calls) != 6 {
+		t.Fatalf("Expected 6 calls of cwctl, but there were %d", len(calls))
+	}
+}
+
+func TestCLIStateRetryIsSupersededByNewerFileChange(t *testing.T) {
+	defer replaceRetryBackoff(100, 400)()
+
+	mock := newMockCwctl(t, 3)
+	defer mock.cleanup()
+
+	clock := newFakeClock(time.Now())
+	results := newResultRecorder()
+	state := mock.newCLIState(t, mock.config(t), clock, results.listener)
+	defer state.Dispose()
+
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectResult(t, results, SyncResultFailed)
+	clock.waitForWaiter(t, 100*time.Millisecond)
+
+	// The new file change starts a sync (which includes the changes of the failed sync) without waiting for the retry
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectResult(t, results, SyncResultSucceeded)
+
+	// So once the retry is due, it is ignored
+	clock.Advance(100 * time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+
+	if calls := mock.calls(t); len(calls) != 2 {
+		t.Fatalf("Expected 2 calls of cwctl, but there were %d", len(calls))
+	}
+}
+
+func TestCLIStateCircuitBreakerOpensProbesAndCloses(t *testing.T) {
+	defer replaceRetryBackoff(100, 400)()
+
+	// The two failures open the circuit, the first probe fails, and the second succeeds
+	mock := newMockCwctl(t, 3, 3, 3)
+	defer mock.cleanup()
+
+	config := mock.config(t)
+	config.CircuitBreakerThreshold = 2
+	config.CircuitBreakerCooldown = time.Minute
+
+	clock := newFakeClock(time.Now())
+	results := newResultRecorder()
+	state := mock.newCLIState(t, config, clock, results.listener)
+	defer state.Dispose()
+
+	circuitStateIs := func(open bool, consecutiveFailures int) func() bool {
+		return func() bool {
+			status := syncStatusOf(t, state)
+			return status.CircuitBreakerOpen == open && status.ConsecutiveFailures == consecutiveFailures
+		}
+	}
+
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectResult(t, results, SyncResultFailed)
+	clock.waitForWaiter(t, 100*time.Millisecond)
+	clock.Advance(100 * time.Millisecond)
+	expectResult(t, results, SyncResultFailed)
+
+	// Open: the failed sync is not retried, and file changes do not run cwctl, until the cool-down has elapsed
+	waitFor(t, "the circuit to open", circuitStateIs(true, 2))
+	clock.waitForWaiter(t, config.CircuitBreakerCooldown)
+
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if calls := mock.calls(t); len(calls) != 2 {
+		t.Fatalf("Expected cwctl not to be run while the circuit is open, but it was run %d times", len(calls))
+	}
+
+	// Half-open: once the cool-down has elapsed, a single probe sync is run, which re-opens the circuit if it fails
+	clock.Advance(config.CircuitBreakerCooldown)
+	expectResult(t, results, SyncResultFailed)
+	waitFor(t, "the circuit to re-open after the failed probe", circuitStateIs(true, 3))
+	clock.waitForWaiter(t, config.CircuitBreakerCooldown)
+
+	// Closed: a successful probe resets the consecutive failures, so syncs are run as soon as changes are received
+	clock.Advance(config.CircuitBreakerCooldown)
+	expectResult(t, results, SyncResultSucceeded)
+	waitFor(t, "the circuit to close after the successful probe", circuitStateIs(false, 0))
+
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectResult(t, results, SyncResultSucceeded)
+
+	if calls := mock.calls(t); len(calls) != 5 {
+		t.Fatalf("Expected 5 calls of cwctl, but there were %d", len(calls))
+	}
+	if pending := clock.pendingDurations(); len(pending) != 0 {
+		t.Fatalf("Expected no retry or cool-down to be scheduled once the circuit has closed, but found %v", pending)
+	}
+}
+
+func TestCLIStateFullResyncCancelsInFlightSyncOfIndividualFiles(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+	mock.blockUntilReleased()
+
+	clock := newFakeClock(time.Now())
+	results := newResultRecorder()
+	state := mock.newCLIState(t, mock.config(t), clock, results.listener)
+	defer state.Dispose()
+
+	changes := []ChangedFileEntry{newTestChangedFileEntry(t, "/project/a.txt")}
+	if err := state.OnFileChangeEventWithChanges(0, nil, changes, "individual-changes"); err != nil {
+		t.Fatal(err)
+	}
+	mock.waitForCalls(t, 1)
+
+	// The sync of the individual file is still running (until released), so the full sync can only start once it has
+	// been killed
+	if err := state.OnFullResyncRequested(0, nil, "full-resync"); err != nil {
+		t.Fatal(err)
+	}
+	mock.waitForCalls(t, 2)
+
+	// The changes of the cancelled sync are included in the full sync
+	waitFor(t, "the full sync to include the changes of the cancelled sync", func() bool {
+		correlationIDs := strings.Join(syncStatusOf(t, state).LastSyncCorrelationIDs, ",")
+		return strings.Contains(correlationIDs, "individual-changes") && strings.Contains(correlationIDs, "full-resync")
+	})
+
+	// Whereas a running sync of the entire project is not cancelled by another request for one
+	if err := state.OnFullResyncRequested(0, nil, "second-full-resync"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if calls := mock.calls(t); len(calls) != 2 {
+		t.Fatalf("Expected the running full sync not to be cancelled, but cwctl was run %d times", len(calls))
+	}
+
+	// The cancelled sync is neither reported as a success nor a failure
+	mock.release(t)
+	expectResult(t, results, SyncResultSucceeded)
+	expectResult(t, results, SyncResultSucceeded)
+
+	if status := syncStatusOf(t, state); status.LastError != "" {
+		t.Errorf("Expected the cancelled sync not to be reported as an error, but got %q", status.LastError)
+	}
+	if calls := mock.calls(t); len(calls) != 3 {
+		t.Fatalf("Expected 3 calls of cwctl, but there were %d", len(calls))
+	}
+}
+
+func TestCLIStateSyncLagWarningThreshold(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+	mock.blockUntilReleased()
+
+	config := mock.config(t)
+	config.SyncLagWarningThreshold = 10 * time.Second
+	config.AdaptiveBatchWindow = true
+
+	clock := newFakeClock(time.Now())
+	results := newResultRecorder()
+	state := mock.newCLIState(t, config, clock, results.listener)
+	defer state.Dispose()
+
+	lagStateIs := func(laggingSince time.Time, batchWindowScale int) func() bool {
+		return func() bool {
+			status := syncStatusOf(t, state)
+			laggingSinceInMsecs := int64(0)
+			if !laggingSince.IsZero() {
+				laggingSinceInMsecs = laggingSince.UnixNano() / int64(time.Millisecond)
+			}
+			return status.SyncLaggingSince == laggingSinceInMsecs && status.BatchWindowScale == batchWindowScale
+		}
+	}
+
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	mock.waitForCalls(t, 1)
+
+	// Changes received while the sync is running begin the lag, which is below the threshold
+	laggingSince := clock.Now()
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the project to begin lagging", lagStateIs(laggingSince, 1))
+
+	clock.Advance(config.SyncLagWarningThreshold - time.Second)
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if !lagStateIs(laggingSince, 1)() {
+		t.Fatalf("Expected the batch window not to be widened below the threshold, but the status is %+v", syncStatusOf(t, state))
+	}
+
+	// Once the lag reaches the threshold, the batch window is doubled, and doubled again at each further multiple
+	clock.Advance(time.Second)
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the batch window to be widened at the threshold", lagStateIs(laggingSince, 2))
+
+	clock.Advance(config.SyncLagWarningThreshold)
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the batch window to be widened at twice the threshold", lagStateIs(laggingSince, 4))
+	if scale := syncStatusRegistry.batchWindowScale(state.projectID); scale != 4 {
+		t.Errorf("Expected the batch window of the project to be widened by a factor of 4, but got %d", scale)
+	}
+
+	// The changes are synced by the sync that follows, which catches up, as no changes are received while it runs
+	mock.release(t)
+	expectResult(t, results, SyncResultSucceeded)
+	expectResult(t, results, SyncResultSucceeded)
+	waitFor(t, "the project to catch up", lagStateIs(time.Time{}, 1))
+}
+
+func TestAcquireCwctlProcessSlotStopsWaitingWhenCancelled(t *testing.T) {
+	releaseAll := holdAllCwctlProcessSlots(t)
+	defer releaseAll()
+
+	held := len(cwctlProcessSemaphore)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- acquireCwctlProcessSlot(ctx, "waiting", DefaultConfig().CLI.MaxConcurrentProcesses)
+	}()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("Expected to wait for a process slot, but the wait ended: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+
+	select {
+	case err := <-acquired:
+		if err == nil {
+			t.Fatal("Expected an error once the wait for a process slot was cancelled")
+		}
+	case <-time.After(mockCwctlTimeout):
+		t.Fatal("Timed out waiting for the wait for a process slot to be cancelled")
+	}
+
+	if len(cwctlProcessSemaphore) != held {
+		t.Fatalf("Expected %d process slots to be held, but %d are", held, len(cwctlProcessSemaphore))
+	}
+
+	// A context that is already done never acquires a slot, even if one is free
+	releaseAll()
+	if err := acquireCwctlProcessSlot(ctx, "cancelled", DefaultConfig().CLI.MaxConcurrentProcesses); err == nil {
+		releaseCwctlProcessSlot()
+		t.Fatal("Expected an error from a cancelled context")
+	}
+}
+
+func TestCLIStateSyncWaitingForProcessSlotIsSuperseded(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	results := newResultRecorder()
+	state := mock.newCLIState(t, mock.config(t), realClock{}, results.listener)
+	defer state.Dispose()
+
+	releaseAll := holdAllCwctlProcessSlots(t)
+	defer releaseAll()
+
+	changes := []ChangedFileEntry{newTestChangedFileEntry(t, "/project/file.txt")}
+	if err := state.OnFileChangeEventWithChanges(0, nil, changes, "changes"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the sync to start", state.IsSyncing)
+
+	// The sync of the individual changes stops waiting for a slot, so the full sync is started while the slots are held
+	if err := state.OnFullResyncRequested(0, nil, "full"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the full sync to start", func() bool {
+		return strings.Contains(strings.Join(syncStatusOf(t, state).LastSyncCorrelationIDs, ","), "full")
+	})
+
+	if calls := mock.calls(t); len(calls) != 0 {
+		t.Fatalf("Expected cwctl not to be run while the process slots are held, but it was run %d times", len(calls))
+	}
+
+	releaseAll()
+	expectResult(t, results, SyncResultSucceeded)
+
+	if calls := mock.calls(t); len(calls) != 1 {
+		t.Fatalf("Expected cwctl to be run once, but it was run %d times", len(calls))
+	}
+}
+
+func TestMergeEnvironment(t *testing.T) {
+
+	environ := []string{"PATH=/usr/bin", "INSECURE=false", "HOME=/home/user", "INSECURE=true", "EMPTY=", "NO_VALUE"}
+
+	tests := []struct {
+		description string
+		overrides   map[string]string
+		expected    []string
+	}{
+		{"no overrides", nil, environ},
+		{
+			"overrides of existing and new variables",
+			map[string]string{"INSECURE": "true", "CONNECTION_ID": "local", "AUTH": "token"},
+			// Every entry of an overridden variable is removed, and the overrides are appended, sorted by name
+			[]string{"PATH=/usr/bin", "HOME=/home/user", "EMPTY=", "NO_VALUE", "AUTH=token", "CONNECTION_ID=local", "INSECURE=true"},
+		},
+		{
+			"overrides with empty values",
+			map[string]string{"EMPTY": "set", "PATH": "", "NO_VALUE": "set"},
+			[]string{"INSECURE=false", "HOME=/home/user", "INSECURE=true", "EMPTY=set", "NO_VALUE=set", "PATH="},
+		},
+	}
+
+	for _, test := range tests {
+		actual := mergeEnvironment(environ, test.overrides)
+		if strings.Join(actual, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("With %s, expected %q, but got %q", test.description, test.expected, actual)
+		}
+	}
+}
+
+func TestCLIStatePassesEnvironmentToCwctl(t *testing.T) {
+	const inherited = "FILEWATCHER_TEST_INHERITED"
+	const overridden = "FILEWATCHER_TEST_OVERRIDDEN"
+
+	os.Setenv(inherited, "inherited")
+	os.Setenv(overridden, "original")
+	defer os.Unsetenv(inherited)
+	defer os.Unsetenv(overridden)
+
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+	mock.env[overridden] = "override"
+
+	results := newResultRecorder()
+	state := mock.newCLIState(t, mock.config(t), realClock{}, results.listener)
+	defer state.Dispose()
+
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectResult(t, results, SyncResultSucceeded)
+
+	call := mock.waitForCalls(t, 1)[0]
+
+	if value, _ := call.getenv(inherited); value != "inherited" {
+		t.Errorf("Expected cwctl to inherit %s, but its value was %q", inherited, value)
+	}
+	if value, _ := call.getenv(overridden); value != "override" {
+		t.Errorf("Expected %s to be overridden, but its value was %q", overridden, value)
+	}
+
+	count := 0
+	for _, entry := range call.Env {
+		if strings.HasPrefix(entry, overridden+"=") {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("Expected %s to be set once, but it was set %d times", overridden, count)
+	}
+}
+
+func TestCLIStateBurstOfFileChangesDoesNotBlockSenders(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+	mock.blockUntilReleased()
+
+	config := mock.config(t)
+	config.ChannelCapacity = 16
+
+	results := newResultRecorder()
+	state := mock.newCLIState(t, config, realClock{}, results.listener)
+	defer state.Dispose()
+
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	mock.waitForCalls(t, 1)
+
+	// While cwctl is running, a burst of concurrent file changes (more than the capacity of the channel) is accepted
+	// without waiting for the sync
+	senders := 2 * config.ChannelCapacity
+	errs := make(chan error, senders)
+	for index := 0; index < senders; index++ {
+		go func() {
+			errs <- state.OnFileChangeEvent(0, nil)
+		}()
+	}
+
+	for index := 0; index < senders; index++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(callerSendTimeout / 2):
+			t.Fatal("Timed out waiting for a file change to be accepted")
+		}
+	}
+
+	// The burst is collapsed into a single sync, once the first completes
+	mock.release(t)
+	expectResult(t, results, SyncResultSucceeded)
+	expectResult(t, results, SyncResultSucceeded)
+
+	time.Sleep(100 * time.Millisecond)
+	if calls := mock.calls(t); len(calls) != 2 {
+		t.Fatalf("Expected cwctl to be run twice, but it was run %d times", len(calls))
+	}
+}
+
+func TestNewCLIStateRejectsNegativeChannelCapacity(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	config := mock.config(t)
+	config.ChannelCapacity = -1
+
+	state, err := newCLIStateWithClock("project", config.MockInstallerPath, mock.projectPath, config, nil, mock.env, realClock{})
+	if err == nil {
+		state.Dispose()
+		t.Fatal("Expected a negative channel capacity to be rejected")
+	}
+}
+
+func TestFirstSyncTimestamp(t *testing.T) {
+
+	tests := []struct {
+		creationTime int64
+		now          int64
+		expected     int64
+	}{
+		{1000, 2000, 1000},
+		{2000, 2000, 2000},
+		{0, 2000, fullSyncTimestamp},
+		{-1, 2000, fullSyncTimestamp},
+		{3000, 2000, fullSyncTimestamp}, // Later than the current time
+	}
+
+	for _, test := range tests {
+		if actual := firstSyncTimestamp(test.creationTime, test.now); actual != test.expected {
+			t.Errorf("firstSyncTimestamp(%d, %d) = %d, expected %d", test.creationTime, test.now, actual, test.expected)
+		}
+	}
+}
+
+func TestCLIStateTimestampsAndDelaysFollowTheClock(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	config := mock.config(t)
+	config.QuietPeriod = 500 * time.Millisecond
+	config.MinSyncInterval = 3 * time.Second
+	config.TimestampSafetyMargin = 100 * time.Millisecond
+
+	start := time.Unix(1600000000, 0)
+	clock := newFakeClock(start)
+	creationTime := start.Add(-time.Minute).UnixNano() / int64(time.Millisecond)
+
+	results := newResultRecorder()
+	state := mock.newCLIState(t, config, clock, results.listener)
+	defer state.Dispose()
+
+	// The first sync waits for the quiet period, and then syncs the changes since the creation of the project
+	if err := state.OnFileChangeEvent(creationTime, nil); err != nil {
+		t.Fatal(err)
+	}
+	clock.waitForWaiter(t, config.QuietPeriod)
+	if calls := mock.calls(t); len(calls) != 0 {
+		t.Fatalf("Expected cwctl not to be run during the quiet period, but it was run %d times", len(calls))
+	}
+
+	clock.Advance(config.QuietPeriod)
+	expectResult(t, results, SyncResultSucceeded)
+	firstSpawnTime := clock.Now()
+
+	if timestamp := mock.waitForCalls(t, 1)[0].arg("-t"); timestamp != strconv.FormatInt(creationTime, 10) {
+		t.Fatalf("Expected the first sync to have the creation time %d as its timestamp, but it was %s", creationTime, timestamp)
+	}
+
+	// The next sync waits for the quiet period, and then for the rest of the minimum interval since the first
+	clock.Advance(time.Second)
+	if err := state.OnFileChangeEvent(creationTime, nil); err != nil {
+		t.Fatal(err)
+	}
+	clock.waitForWaiter(t, config.QuietPeriod)
+	clock.Advance(config.QuietPeriod)
+
+	remaining := config.MinSyncInterval - clock.Now().Sub(firstSpawnTime)
+	clock.waitForWaiter(t, remaining)
+	if calls := mock.calls(t); len(calls) != 1 {
+		t.Fatalf("Expected cwctl not to be run within the minimum sync interval, but it was run %d times", len(calls))
+	}
+
+	clock.Advance(remaining)
+	expectResult(t, results, SyncResultSucceeded)
+
+	// Its timestamp is the spawn time of the first sync, less the safety margin
+	expected := firstSpawnTime.Add(-config.TimestampSafetyMargin).UnixNano() / int64(time.Millisecond)
+	if timestamp := mock.waitForCalls(t, 2)[1].arg("-t"); timestamp != strconv.FormatInt(expected, 10) {
+		t.Fatalf("Expected the second sync to have the timestamp %d, but it was %s", expected, timestamp)
+	}
+}
+
+func TestCLIStateFutureCreationTimeSyncsEntireProject(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	clock := newFakeClock(time.Unix(1600000000, 0))
+	results := newResultRecorder()
+	state := mock.newCLIState(t, mock.config(t), clock, results.listener)
+	defer state.Dispose()
+
+	creationTime := clock.Now().Add(time.Hour).UnixNano() / int64(time.Millisecond)
+	if err := state.OnFileChangeEvent(creationTime, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectResult(t, results, SyncResultSucceeded)
+
+	if timestamp := mock.waitForCalls(t, 1)[0].arg("-t"); timestamp != strconv.FormatInt(fullSyncTimestamp, 10) {
+		t.Fatalf("Expected the entire project to be synced, but the timestamp was %s", timestamp)
+	}
+}
+
+// projectJSONOf returns the (decoded) project JSON argument of the call of the mock cwctl.
+func projectJSONOf(t *testing.T, call mockCwctlCall) DebugSimplifiedPtw {
+	t.Helper()
+
+	decoded, err := base64.StdEncoding.DecodeString(call.arg("-projectJson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result DebugSimplifiedPtw
+	if err := json.Unmarshal(decoded, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestCLIStateProjectUpdateDuringSyncAppliesToNextSync(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+	mock.blockUntilReleased()
+
+	results := newResultRecorder()
+	state := mock.newCLIState(t, mock.config(t), realClock{}, results.listener)
+	defer state.Dispose()
+
+	if err := state.OnFileChangeEvent(0, &models.ProjectToWatch{IgnoredPaths: []string{"/old"}}); err != nil {
+		t.Fatal(err)
+	}
+	mock.waitForCalls(t, 1)
+
+	// The new rules arrive while the sync is running, separately from the next file change
+	if err := state.UpdateProjectToWatch(&models.ProjectToWatch{IgnoredPaths: []string{"/new"}, IgnoredFilenames: []string{"*.log"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.release(t)
+	expectResult(t, results, SyncResultSucceeded)
+	expectResult(t, results, SyncResultSucceeded)
+
+	calls := mock.waitForCalls(t, 2)
+
+	if ignoredPaths := projectJSONOf(t, calls[0]).IgnoredPaths; strings.Join(ignoredPaths, ",") != "/old" {
+		t.Errorf("Expected the running sync to keep its rules, but its ignored paths were %v", ignoredPaths)
+	}
+
+	next := projectJSONOf(t, calls[1])
+	if strings.Join(next.IgnoredPaths, ",") != "/new" || strings.Join(next.IgnoredFilenames, ",") != "*.log" {
+		t.Errorf("Expected the next sync to use the new rules, but got %+v", next)
+	}
+}
+
+func TestConvertRefPathsToLocalFiles(t *testing.T) {
+
+	toLocal := func(path string) (string, error) {
+		return path, nil
+	}
+
+	refPaths := []models.RefPathEntry{
+		{From: "/a/b/file.txt", To: "/file.txt"},
+		{From: "/a/c/../b/file.txt", To: "/other.txt"}, // The same file, once cleaned
+		{From: "/a/other.txt", To: "/other.txt"},
+		{From: "/a/b/file.txt", To: "/third.txt"},
+	}
+
+	actual, err := convertRefPathsToLocalFiles(refPaths, toLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{filepath.Clean("/a/b/file.txt"), filepath.Clean("/a/other.txt")}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %q, but got %q", expected, actual)
+	}
+
+	if actual, err := convertRefPathsToLocalFiles(nil, toLocal); err != nil || len(actual) != 0 {
+		t.Errorf("Expected no paths for no ref paths, but got %q (%v)", actual, err)
+	}
+}
+
+func TestConvertRefPathsToLocalFilesReportsFirstFailure(t *testing.T) {
+
+	convert := func(path string) (string, error) {
+		if strings.HasPrefix(path, "/bad") {
+			return "", errors.New("invalid path")
+		}
+		return path, nil
+	}
+
+	refPaths := []models.RefPathEntry{{From: "/good"}, {From: "/bad-1"}, {From: "/bad-2"}}
+
+	actual, err := convertRefPathsToLocalFiles(refPaths, convert)
+	if err == nil {
+		t.Fatalf("Expected an error, but got %q", actual)
+	}
+	if actual != nil {
+		t.Errorf("Expected no paths on failure, but got %q", actual)
+	}
+	if !strings.Contains(err.Error(), "/bad-1") || !strings.Contains(err.Error(), "invalid path") {
+		t.Errorf("Expected the error to describe the first path that could not be converted, but got: %v", err)
+	}
+}
+
+func TestCappedOutputBuffer(t *testing.T) {
+
+	tests := []struct {
+		limit     int
+		writes    []string
+		expected  string
+		truncated bool
+	}{
+		{10, []string{"12345", "67890"}, "1234567890", false}, // At the cap
+		{10, []string{"12345", "678901"}, "1234567890", true}, // Past the cap
+		{10, []string{"1234567890", ""}, "1234567890", false},
+		{10, []string{"1234567890", "1"}, "1234567890", true},
+		{10, []string{"123456789012345"}, "1234567890", true},
+		{10, []string{"12345678901", "abc"}, "1234567890", true}, // Writes after truncation are discarded
+		{0, []string{"12345", "678901"}, "12345678901", false},   // No limit
+	}
+
+	for _, test := range tests {
+		buffer := &cappedOutputBuffer{limit: test.limit}
+		for _, write := range test.writes {
+			buffer.write([]byte(write))
+		}
+
+		expected := test.expected
+		if test.truncated {
+			expected += cwctlOutputTruncatedMarker
+		}
+
+		if buffer.truncated != test.truncated || buffer.String() != expected {
+			t.Errorf("Writing %q with a limit of %d: expected %q (truncated: %v), but got %q (truncated: %v)",
+				test.writes, test.limit, expected, test.truncated, buffer.String(), buffer.truncated)
+		}
+	}
+}
+
+func TestCwctlOutputWritersReportEntireOutputWritten(t *testing.T) {
+	stdout, stderr, combined := newCwctlOutputWriters(8)
+
+	for _, write := range []struct {
+		writer *cwctlOutputWriter
+		output string
+	}{{stdout, "out1 "}, {stderr, "err1 "}, {stdout, "out2 "}} {
+		if count, err := write.writer.Write([]byte(write.output)); err != nil || count != len(write.output) {
+			t.Fatalf("Expected the entire output to be reported as written, but got %d (%v)", count, err)
+		}
+	}
+
+	// Each stream, and the combined output, are capped separately
+	if actual, expected := stdout.stream.String(), "out1 out"+cwctlOutputTruncatedMarker; actual != expected {
+		t.Errorf("Expected stdout to be %q, but got %q", expected, actual)
+	}
+	if actual, expected := stderr.stream.String(), "err1 "; actual != expected {
+		t.Errorf("Expected stderr to be %q, but got %q", expected, actual)
+	}
+	if actual, expected := combined.String(), "out1 err"+cwctlOutputTruncatedMarker; actual != expected {
+		t.Errorf("Expected the combined output to be %q, but got %q", expected, actual)
+	}
+}
+
+func TestNewCLIStateResolvesRelativePaths(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(mock.dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+
+	// The temporary directory may be a symbolic link (for example, on macOS), so the expected paths are relative to
+	// the working directory as reported by the OS
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := mock.config(t)
+	results := newResultRecorder()
+	state, err := newCLIStateWithClock("project-relative", filepath.Join("bin", "cwctl"), "project", config, results.listener, mock.env, realClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Dispose()
+
+	if expected := filepath.Join(workingDir, "bin", "cwctl"); state.installerPath != expected {
+		t.Errorf("Expected the installer path to be resolved to %q, but it was %q", expected, state.installerPath)
+	}
+	if expected := filepath.Join(workingDir, "project"); state.projectPath != expected {
+		t.Errorf("Expected the project path to be resolved to %q, but it was %q", expected, state.projectPath)
+	}
+
+	// The resolved path is used even if the working directory changes
+	if err := os.Chdir(originalDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectResult(t, results, SyncResultSucceeded)
+
+	if path := mock.waitForCalls(t, 1)[0].arg("-p"); path != filepath.Join(workingDir, "project") {
+		t.Errorf("Expected cwctl to be passed the absolute project path, but it was passed %q", path)
+	}
+}
+
+func TestValidateInstallerPath(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	writeFile := func(name string, mode os.FileMode) string {
+		path := filepath.Join(mock.dir, name)
+		if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		description string
+		path        string
+		expected    string // A fragment of the error, or "" if the path is valid
+	}{
+		{"an executable", writeFile("cwctl", 0755), ""},
+		{"a missing file", filepath.Join(mock.dir, "missing"), "Unable to access"},
+		{"a directory", mock.projectPath, "is a directory"},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, struct {
+			description string
+			path        string
+			expected    string
+		}{"a file that is not executable", writeFile("not-executable", 0644), "is not executable"})
+	}
+
+	for _, test := range tests {
+		err := validateInstallerPath(test.path)
+		if test.expected == "" && err != nil {
+			t.Errorf("Expected %s to be valid, but got: %v", test.description, err)
+		} else if test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)) {
+			t.Errorf("Expected an error containing %q for %s, but got: %v", test.expected, test.description, err)
+		}
+	}
+}
+
+func TestCLIStateResolveInstallerPath(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	override := filepath.Join(mock.dir, "override-cwctl")
+	if err := ioutil.WriteFile(override, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	state := mock.newCLIState(t, mock.config(t), realClock{}, nil)
+	defer state.Dispose()
+
+	tests := []struct {
+		description string
+		ptw         *models.ProjectToWatch
+		expected    string
+	}{
+		{"no project", nil, state.installerPath},
+		{"no override", &models.ProjectToWatch{}, state.installerPath},
+		{"a valid override", &models.ProjectToWatch{InstallerPath: " " + override + " "}, override},
+		{"a missing override", &models.ProjectToWatch{InstallerPath: filepath.Join(mock.dir, "missing")}, state.installerPath},
+		{"a directory override", &models.ProjectToWatch{InstallerPath: mock.dir}, state.installerPath},
+	}
+
+	for _, test := range tests {
+		if actual := state.resolveInstallerPath(test.ptw); actual != test.expected {
+			t.Errorf("With %s, expected the installer path %q, but got %q", test.description, test.expected, actual)
+		}
+	}
+}
+
+func TestConvertRefPathsToWindowsLocalFiles(t *testing.T) {
+
+	toWindows := func(path string) (string, error) {
+		return utils.ConvertAbsoluteUnixStyleNormalizedPathToLocalFileOS(path, true)
+	}
+
+	// A path without a drive letter cannot be converted, so none are returned
+	refPaths := []models.RefPathEntry{{From: "/c/Users/a/file.txt"}, {From: "/1/file.txt"}, {From: "/c/Users/a/file.txt"}}
+	if actual, err := convertRefPathsToLocalFiles(refPaths, toWindows); err == nil || !strings.Contains(err.Error(), "/1/file.txt") {
+		t.Errorf("Expected an error describing the path without a drive letter, but got %q (%v)", actual, err)
+	}
+
+	refPaths = []models.RefPathEntry{{From: "/c/Users/a/file.txt"}, {From: "/d/file.txt"}, {From: "/c/Users/a/file.txt"}}
+	actual, err := convertRefPathsToLocalFiles(refPaths, toWindows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Clean("c:\\Users\\a\\file.txt"), filepath.Clean("d:\\file.txt")}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %q, but got %q", expected, actual)
+	}
+}
+
+func TestCLIStateDeduplicatesRefPathsOfMockSync(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	results := newResultRecorder()
+	state := mock.newCLIState(t, mock.config(t), realClock{}, results.listener)
+	defer state.Dispose()
+
+	refPath := filepath.ToSlash(filepath.Join(mock.dir, "ref.txt"))
+	if runtime.GOOS == "windows" {
+		refPath = utils.ConvertFromWindowsDriveLetter(filepath.Join(mock.dir, "ref.txt"))
+	}
+
+	ptw := &models.ProjectToWatch{RefPaths: []models.RefPathEntry{
+		{From: refPath, To: "/ref.txt"},
+		{From: refPath, To: "/other.txt"},
+		{From: path.Dir(refPath) + "/./ref.txt", To: "/third.txt"},
+	}}
+	if err := state.OnFileChangeEvent(0, ptw); err != nil {
+		t.Fatal(err)
+	}
+	expectResult(t, results, SyncResultSucceeded)
+
+	filesToWatch := projectJSONOf(t, mock.waitForCalls(t, 1)[0]).FilesToWatch
+	if len(filesToWatch) != 1 || utils.NormalizePathCase(filesToWatch[0]) != utils.NormalizePathCase(filepath.Join(mock.dir, "ref.txt")) {
+		t.Errorf("Expected the duplicate ref paths to be passed once, but got %q", filesToWatch)
+	}
+}
+
+func TestCLIStateAbortsMockSyncWithUnconvertibleRefPath(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("Every ref path can be converted on this platform")
+	}
+
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	results := newResultRecorder()
+	state := mock.newCLIState(t, mock.config(t), realClock{}, results.listener)
+	defer state.Dispose()
+
+	ptw := &models.ProjectToWatch{RefPaths: []models.RefPathEntry{{From: "/1/file.txt", To: "/file.txt"}}}
+	if err := state.OnFileChangeEvent(0, ptw); err != nil {
+		t.Fatal(err)
+	}
+	expectResult(t, results, SyncResultInvalidArguments)
+
+	if calls := mock.calls(t); len(calls) != 0 {
+		t.Fatalf("Expected cwctl not to be run, but it was run %d times", len(calls))
+	}
+}
+
+func TestCLIStateAbortsMockSyncIfProjectJSONCannotBeMarshalled(t *testing.T) {
+	original := marshalMockProjectJSON
+	marshalMockProjectJSON = func(interface{}) ([]byte, error) {
+		return nil, errors.New("simulated marshal failure")
+	}
+	defer func() { marshalMockProjectJSON = original }()
+
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	results := newResultRecorder()
+	state := mock.newCLIState(t, mock.config(t), realClock{}, results.listener)
+	defer state.Dispose()
+
+	if err := state.OnFileChangeEvent(0, &models.ProjectToWatch{}); err != nil {
+		t.Fatal(err)
+	}
+	expectResult(t, results, SyncResultInvalidArguments)
+
+	waitFor(t, "the marshal failure to be reported as the last error of the project", func() bool {
+		return strings.Contains(syncStatusOf(t, state).LastError, "simulated marshal failure")
+	})
+	if calls := mock.calls(t); len(calls) != 0 {
+		t.Fatalf("Expected cwctl not to be run, but it was run %d times", len(calls))
+	}
+}
+
+func TestCLIStateDisposeWhileFileChangesAreSent(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	config := mock.config(t)
+	config.ChannelCapacity = 1
+
+	changes := []ChangedFileEntry{newTestChangedFileEntry(t, "/project/a.txt")}
+
+	for iteration := 0; iteration < 10; iteration++ {
+		state := mock.newCLIState(t, config, realClock{}, newResultRecorder().listener)
+
+		const senders = 8
+		start := make(chan struct{})
+		done := make(chan error, senders*100)
+		var senderGroup sync.WaitGroup
+
+		for sender := 0; sender < senders; sender++ {
+			senderGroup.Add(1)
+			go func(sender int) {
+				defer senderGroup.Done()
+				<-start
+				for index := 0; index < 100; index++ {
+					var err error
+					switch (sender + index) % 4 {
+					case 0:
+						err = state.OnFileChangeEvent(0, nil)
+					case 1:
+						err = state.OnFileChangeEventWithChanges(0, nil, changes, "")
+					case 2:
+						err = state.UpdateProjectToWatch(&models.ProjectToWatch{IgnoredPaths: []string{"/" + strconv.Itoa(index)}})
+					case 3:
+						err = state.OnFullResyncRequested(0, nil, "")
+					}
+					done <- err
+				}
+			}(sender)
+		}
+
+		// Dispose (more than once) while the senders are running
+		close(start)
+		time.Sleep(time.Millisecond * time.Duration(iteration))
+		var disposeGroup sync.WaitGroup
+		for index := 0; index < 2; index++ {
+			disposeGroup.Add(1)
+			go func() {
+				defer disposeGroup.Done()
+				state.Dispose()
+			}()
+		}
+		disposeGroup.Wait()
+
+		finished := make(chan struct{})
+		go func() {
+			senderGroup.Wait()
+			close(finished)
+		}()
+		select {
+		case <-finished:
+		case <-time.After(callerSendTimeout / 2):
+			t.Fatal("Timed out waiting for the senders, which should not block once the CLI state is disposed")
+		}
+		close(done)
+
+		// Each call either succeeded (before the dispose), or reported that the CLI state was disposed
+		for err := range done {
+			if err != nil && !strings.Contains(err.Error(), "has been disposed") {
+				t.Fatalf("Expected the only error to be that the CLI state was disposed, but got: %v", err)
+			}
+		}
+
+		if err := state.OnFileChangeEvent(0, nil); err == nil || !strings.Contains(err.Error(), "has been disposed") {
+			t.Fatalf("Expected an error once the CLI state was disposed, but got: %v", err)
+		}
+	}
+}
+
+func TestCLIStateConcurrentTraffic(t *testing.T) {
+	defer replaceRetryBackoff(1, 5)()
+
+	// Every other sync fails, so that results, retries, and circuit breaker changes are interleaved with the file changes
+	exitCodes := []int{}
+	for index := 0; index < 100; index++ {
+		exitCodes = append(exitCodes, 3*(index%2))
+	}
+	mock := newMockCwctl(t, exitCodes...)
+	defer mock.cleanup()
+
+	config := mock.config(t)
+	config.ChannelCapacity = 4
+	config.CircuitBreakerThreshold = 3
+	config.CircuitBreakerCooldown = 10 * time.Millisecond
+
+	var resultCount int32
+	listener := func(projectID string, result SyncResult, exitCode int, output string, elapsedTimeInMsecs int64) {
+		atomic.AddInt32(&resultCount, 1)
+	}
+
+	state := mock.newCLIState(t, config, realClock{}, listener)
+	defer state.Dispose()
+
+	changes := []ChangedFileEntry{newTestChangedFileEntry(t, "/project/a.txt")}
+
+	stop := make(chan struct{})
+	errs := make(chan error, 1000)
+	var group sync.WaitGroup
+
+	// Each goroutine sends one kind of entry (or reads the status of the syncs) until it is stopped
+	senders := []func(index int) error{
+		func(index int) error { return state.OnFileChangeEvent(0, nil) },
+		func(index int) error { return state.OnFileChangeEventWithChanges(0, nil, changes, "") },
+		func(index int) error {
+			return state.UpdateProjectToWatch(&models.ProjectToWatch{IgnoredPaths: []string{"/" + strconv.Itoa(index)}})
+		},
+		func(index int) error { return state.RetryFailedSync() },
+		func(index int) error {
+			if index%2 == 0 {
+				return state.Pause()
+			}
+			return state.Resume()
+		},
+		func(index int) error {
+			state.HasPendingChanges()
+			state.IsSyncing()
+			syncStatusRegistry.snapshot()
+			return nil
+		},
+	}
+	for _, sender := range senders {
+		group.Add(1)
+		go func(sender func(index int) error) {
+			defer group.Done()
+			for index := 0; ; index++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := sender(index); err != nil {
+					errs <- err
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}(sender)
+	}
+
+	// The traffic continues until several syncs have completed, and then while the CLI state is disposed
+	waitFor(t, "the results of several syncs", func() bool {
+		return atomic.LoadInt32(&resultCount) >= 4
+	})
+	state.Dispose()
+
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+
+	finished := make(chan struct{})
+	go func() {
+		group.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(callerSendTimeout / 2):
+		t.Fatal("Timed out waiting for the senders, which should not block once the CLI state is disposed")
+	}
+	close(errs)
+
+	for err := range errs {
+		if !strings.Contains(err.Error(), "has been disposed") {
+			t.Fatalf("Expected the only error to be that the CLI state was disposed, but got: %v", err)
+		}
+	}
+}
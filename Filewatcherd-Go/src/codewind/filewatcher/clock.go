@@ -0,0 +1,37 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"time"
+)
+
+// Clock is the source of the current time, and of timers, for CLIState. The default is the real (system) clock; a fake
+// clock may be used in tests, so that timestamps, retries, and the quiet period can be tested without sleeping.
+type Clock interface {
+	Now() time.Time
+
+	// After returns a channel that receives the current time once the duration has elapsed, in the same way as time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock of the system.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// nowInMsecs returns the current time of the clock, in absolute msecs.
+func nowInMsecs(clock Clock) int64 {
+	return clock.Now().UnixNano() / int64(time.Millisecond)
+}
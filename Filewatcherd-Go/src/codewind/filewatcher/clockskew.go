@@ -0,0 +1,159 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/utils"
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * cwctl sync compares the modification time of each file against the timestamp of the previous sync, which is taken
+ * from the filewatcher's clock. If the clock of the file system (for example, an NFS server, or the host of a
+ * container) differs from ours, changes may be missed (file system clock behind) or resent (file system clock ahead).
+ *
+ * To detect this, on startup and then every ClockSkewCheckInterval (10 minutes by default), a temporary file is
+ * written to ClockSkewDir and its modification time is compared to the current time. A warning is logged if the
+ * difference exceeds ClockSkewThreshold; if CompensateClockSkew is enabled, the measured skew is also added to the
+ * timestamp passed to cwctl (see WatchConfig).
+ */
+
+var (
+	// clockSkewLock must be acquired before reading/writing the fields below
+	clockSkewLock = &sync.Mutex{}
+
+	measuredClockSkewInMsecs int64 // File system clock minus our clock; positive if the file system clock is ahead
+	clockSkewMeasured        bool  // False until the first successful measurement
+	compensateClockSkew      bool  // Set from the configuration by StartClockSkewMonitor
+)
+
+// StartClockSkewMonitor measures the clock skew immediately, and then periodically on a separate goroutine, until the
+// context is cancelled.
+func StartClockSkewMonitor(ctx context.Context, config WatchConfig) {
+
+	dir := strings.TrimSpace(config.ClockSkewDir)
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	thresholdInMsecs := int64(config.ClockSkewThreshold / time.Millisecond)
+
+	clockSkewLock.Lock()
+	compensateClockSkew = config.CompensateClockSkew
+	clockSkewLock.Unlock()
+
+	checkClockSkew(dir, thresholdInMsecs)
+
+	if config.ClockSkewCheckInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(config.ClockSkewCheckInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				checkClockSkew(dir, thresholdInMsecs)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func checkClockSkew(dir string, thresholdInMsecs int64) {
+
+	skew, err := measureClockSkew(dir)
+	if err != nil {
+		utils.LogErrorErr("Unable to measure the clock skew of the file system using directory "+dir, err)
+		return
+	}
+
+	clockSkewLock.Lock()
+	measuredClockSkewInMsecs = skew
+	clockSkewMeasured = true
+	clockSkewLock.Unlock()
+
+	absSkew := skew
+	if absSkew < 0 {
+		absSkew = -absSkew
+	}
+
+	if absSkew > thresholdInMsecs {
+		utils.LogWarning("The clock of the file system containing " + dir + " differs from the filewatcher clock by " +
+			strconv.FormatInt(skew, 10) + " msecs; file changes may be missed or resent by cwctl sync. Synchronize the clocks, or set FILEWATCHER_COMPENSATE_CLOCK_SKEW=true.")
+	} else {
+		utils.LogDebug("Measured file system clock skew: " + strconv.FormatInt(skew, 10) + " msecs")
+	}
+}
+
+// measureClockSkew writes a temporary file to the directory, and returns its modification time minus the time at
+// which it was written, in msecs.
+func measureClockSkew(dir string) (int64, error) {
+
+	// The file is owned by the filewatcher, so changes to it are not reported if the directory is within a project
+	file, err := ioutil.TempFile(dir, utils.FilewatcherOwnedFilenamePrefix+"clock-skew-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+
+	before := time.Now()
+	_, err = file.Write([]byte("clock skew check"))
+	closeErr := file.Close()
+	after := time.Now()
+
+	if err != nil {
+		return 0, err
+	}
+	if closeErr != nil {
+		return 0, closeErr
+	}
+
+	info, err := os.Stat(file.Name())
+	if err != nil {
+		return 0, err
+	}
+
+	// Compare against the midpoint of the write, to reduce the effect of a slow file system
+	writeTime := before.Add(after.Sub(before) / 2)
+
+	return int64(info.ModTime().Sub(writeTime) / time.Millisecond), nil
+}
+
+// GetMeasuredClockSkew returns the most recently measured clock skew in msecs (file system clock minus our clock),
+// and false if it has not yet been measured.
+func GetMeasuredClockSkew() (int64, bool) {
+	clockSkewLock.Lock()
+	defer clockSkewLock.Unlock()
+
+	return measuredClockSkewInMsecs, clockSkewMeasured
+}
+
+// getClockSkewCompensation returns the value to add to the cwctl sync timestamp to account for clock skew: 0
+// unless CompensateClockSkew is enabled.
+func getClockSkewCompensation() int64 {
+	clockSkewLock.Lock()
+	defer clockSkewLock.Unlock()
+
+	if !compensateClockSkew || !clockSkewMeasured {
+		return 0
+	}
+	return measuredClockSkewInMsecs
+}
@@ -0,0 +1,556 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/utils"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * The configuration of the filewatcher is loaded once on startup (see LoadConfig), and passed to the components that
+ * use it (CLIState, the project list, the watch service, and the HTTP GET/WebSocket connections). Programs that embed
+ * the filewatcher (see watcher.go), and tests, may instead construct a Config directly, starting from DefaultConfig();
+ * the environment is then not read.
+ *
+ * Settings may be specified in a configuration file (see configfile.go), whose path is given by the `--config`
+ * command line argument, or the `FILEWATCHER_CONFIG_FILE` environment variable; its fields mirror those of Config.
+ * Each setting may also be specified by an environment variable (as documented on each field), which takes precedence
+ * over the file.
+ *
+ * Logging (see utils/logger.go) and the shutdown grace period (see shutdown.go) are configured before the Config is
+ * loaded, so are only read from the environment.
+ */
+
+// Config is the configuration of the filewatcher.
+type Config struct {
+	CLI    CLIConfig    `json:"cli"`
+	Watch  WatchConfig  `json:"watch"`
+	Server ServerConfig `json:"server"`
+}
+
+// CLIConfig is the configuration of the cwctl syncs of each project (see CLIState).
+type CLIConfig struct {
+	MockInstallerPath string `json:"mockInstallerPath"` // MOCK_CWCTL_INSTALLER_PATH: for automated testing only
+	DryRun            bool   `json:"dryRun"`            // FILEWATCHER_DRY_RUN: log cwctl invocations rather than run them
+
+	// CWCTL_WORKING_DIR: "" (or 'installer') for the directory containing the installer, 'project' for the project
+	// directory, otherwise the path of a directory.
+	WorkingDir string `json:"workingDir"`
+
+	SyncTimeout     time.Duration `json:"syncTimeout"`     // CWCTL_SYNC_TIMEOUT_SECS: 0 for no limit
+	QuietPeriod     time.Duration `json:"quietPeriod"`     // CWCTL_SYNC_QUIET_PERIOD_MS: 0 to sync immediately
+	MinSyncInterval time.Duration `json:"minSyncInterval"` // CWCTL_SYNC_MIN_INTERVAL_MS: 0 for no minimum
+
+	// CWCTL_SYNC_TIMESTAMP_MARGIN_MS: filesystems may store modification times with a granularity as coarse as 1-2
+	// seconds, in which case a file that is modified during a sync may have a recorded mtime that is earlier than the
+	// spawn time of that sync; this is subtracted from the spawn time when calculating the timestamp of the next sync.
+	// CWCTL_SYNC_TIMESTAMP_MARGIN_DETECT: if true, the margin of projects on the file system of
+	// CWCTL_SYNC_TIMESTAMP_MARGIN_DETECT_DIR ("" for the OS temp directory) is instead its measured resolution (see
+	// mtimeresolution.go).
+	TimestampSafetyMargin          time.Duration `json:"timestampSafetyMargin"`
+	DetectTimestampSafetyMargin    bool          `json:"detectTimestampSafetyMargin"`
+	TimestampSafetyMarginDetectDir string        `json:"timestampSafetyMarginDetectDir"`
+
+	// CWCTL_SYNC_PINNED_TIMESTAMP: for diagnosing missed changes only: "" to advance the timestamp after each successful
+	// sync (the default), 'creation' to instead keep the timestamp of the first sync of each project (its creation time,
+	// see firstSyncTimestamp), or a fixed timestamp in absolute msecs. While pinned, every sync re-examines every file
+	// modified since the timestamp, so each sync does more work the longer the project is watched; this is not
+	// intended for normal operation.
+	PinnedTimestamp string `json:"pinnedTimestamp"`
+
+	CircuitBreakerThreshold int           `json:"circuitBreakerThreshold"` // CWCTL_CIRCUIT_BREAKER_THRESHOLD: 0 to disable
+	CircuitBreakerCooldown  time.Duration `json:"circuitBreakerCooldown"`  // CWCTL_CIRCUIT_BREAKER_COOLDOWN_SECS
+
+	// CWCTL_SYNC_CHANNEL_CAPACITY: the channel of each CLIState is buffered so that a burst of entries does not block
+	// their senders while the readChannel goroutine is briefly busy (for example, launching a sync). Consecutive file
+	// change entries are collapsed by readChannel, so buffering does not change the resulting syncs. Each project has at
+	// most a handful of concurrent senders (the project list, the cwctl result goroutine, and the retry/quiet period
+	// timers), so a small buffer is sufficient.
+	ChannelCapacity int `json:"channelCapacity"`
+
+	// CWCTL_MAX_OUTPUT_BYTES: 0 for no limit; a verbose (or runaway) cwctl process could otherwise exhaust the memory of
+	// the filewatcher.
+	MaxOutputBytes int `json:"maxOutputBytes"`
+
+	MaxConcurrentProcesses int `json:"maxConcurrentProcesses"` // CWCTL_MAX_CONCURRENT_PROCESSES: across all projects
+
+	// CWCTL_SYNC_JITTER_MS: when every project is synced at once (on reconnection to the server, or a forced sync), the
+	// sync of each project is started after a random delay of up to this long, so that cwctl is not spawned for every
+	// project simultaneously; 0 to start them all immediately.
+	SyncJitter time.Duration `json:"syncJitter"`
+
+	// CWCTL_SYNC_LAG_WARNING_SECS: 0 to disable; CWCTL_SYNC_LAG_ADAPTIVE_BATCH_WINDOW: if true, the batch window of a
+	// project whose syncs lag behind its file changes is widened until they catch up (see synclag.go).
+	SyncLagWarningThreshold time.Duration `json:"syncLagWarningThreshold"`
+	AdaptiveBatchWindow     bool          `json:"adaptiveBatchWindow"`
+
+	// CWCTL_FAILURE_WEBHOOK_URL: "" to disable; CWCTL_FAILURE_WEBHOOK_THRESHOLD: 0 to only notify when the circuit
+	// breaker opens (see failurewebhook.go).
+	FailureWebhookURL       string        `json:"failureWebhookURL"`
+	FailureWebhookThreshold int           `json:"failureWebhookThreshold"`
+	FailureWebhookTimeout   time.Duration `json:"failureWebhookTimeout"` // CWCTL_FAILURE_WEBHOOK_TIMEOUT_MS
+
+	WorkspaceSync       bool          `json:"workspaceSync"`       // CWCTL_WORKSPACE_SYNC
+	WorkspaceSyncWindow time.Duration `json:"workspaceSyncWindow"` // CWCTL_WORKSPACE_SYNC_WINDOW_MS
+
+	// CWCTL_SYNC_COMMAND: the template of the arguments of a sync, which must contain the {path}, {id} and {timestamp}
+	// placeholders (see cwctlsynccommand.go).
+	SyncCommand string `json:"syncCommand"`
+}
+
+// WatchConfig is the configuration of the watching of each project, and the batching of its file changes.
+type WatchConfig struct {
+	Mode            WatchMode     `json:"mode"`            // FILEWATCHER_MODE: 'native' or 'polling'
+	PollingInterval time.Duration `json:"pollingInterval"` // FILEWATCHER_POLLING_INTERVAL_MS
+	SymlinkMode     SymlinkMode   `json:"symlinkMode"`     // FILEWATCHER_SYMLINK_MODE: 'file', 'follow', or 'ignore'
+
+	// In polling mode, a project with no file changes for the idle threshold is polled at the (longer) idle polling
+	// interval instead, until its next change; 0 to always use the polling interval. Native watching has no cost
+	// while a project is idle, so is unaffected.
+	IdleThreshold       time.Duration `json:"idleThreshold"`       // FILEWATCHER_IDLE_THRESHOLD_SECS
+	IdlePollingInterval time.Duration `json:"idlePollingInterval"` // FILEWATCHER_IDLE_POLLING_INTERVAL_MS
+
+	// Guards against watching an unexpectedly large tree (eg a home directory), which may exhaust the native watches of
+	// the OS (eg fs.inotify.max_user_watches on Linux): directories deeper than the maximum depth within the project
+	// root are not watched, and a project root containing more than the maximum number of files and directories is not
+	// watched at all (if more are created later, new directories are no longer watched). 0 for no limit.
+	MaxDepth        int `json:"maxDepth"`        // FILEWATCHER_MAX_DEPTH
+	MaxWatchedFiles int `json:"maxWatchedFiles"` // FILEWATCHER_MAX_WATCHED_FILES
+
+	SelfTest        bool          `json:"selfTest"`        // FILEWATCHER_WATCH_SELF_TEST
+	SelfTestTimeout time.Duration `json:"selfTestTimeout"` // FILEWATCHER_WATCH_SELF_TEST_TIMEOUT_MS
+
+	BatchWindow      time.Duration `json:"batchWindow"`      // FILEWATCHER_BATCH_WINDOW_MS: unless overridden by the project
+	MaxPendingEvents int           `json:"maxPendingEvents"` // FILEWATCHER_MAX_PENDING_EVENTS: 0 for no limit
+	HonorGitIgnore   bool          `json:"honorGitIgnore"`   // FILEWATCHER_HONOR_GITIGNORE
+
+	// If enabled, the changes of a project that is not synced by cwctl are instead sent to the server, in POST requests
+	// of at most MaxChangesPerChunk changes each (see splitIntoChunks). This is the transmission path of servers that
+	// predate cwctl sync, so is disabled by default.
+	PostChangesToServer bool `json:"postChangesToServer"` // FILEWATCHER_POST_FILE_CHANGES
+	MaxChangesPerChunk  int  `json:"maxChangesPerChunk"`  // FILEWATCHER_MAX_CHANGES_PER_CHUNK
+
+	// A change of a file larger than the maximum size (eg a video, dataset, or build output) does not trigger a sync;
+	// 0 for no limit. This may be overridden for individual projects by the `maxFileSizeBytes` field of the
+	// ProjectToWatch. If enabled, the first change of each such file is logged.
+	MaxFileSizeBytes  int  `json:"maxFileSizeBytes"`  // FILEWATCHER_MAX_FILE_SIZE_BYTES
+	LogOversizedFiles bool `json:"logOversizedFiles"` // FILEWATCHER_LOG_OVERSIZED_FILES
+
+	// The clock skew of the file system is measured in this directory (see clockskew.go), which should be on the same
+	// file system as the watched projects; "" for the OS temp directory.
+	ClockSkewDir           string        `json:"clockSkewDir"`           // FILEWATCHER_CLOCK_SKEW_DIR
+	ClockSkewThreshold     time.Duration `json:"clockSkewThreshold"`     // FILEWATCHER_CLOCK_SKEW_THRESHOLD_MS
+	ClockSkewCheckInterval time.Duration `json:"clockSkewCheckInterval"` // FILEWATCHER_CLOCK_SKEW_CHECK_INTERVAL_MINS: 0 to only check on startup
+	CompensateClockSkew    bool          `json:"compensateClockSkew"`    // FILEWATCHER_COMPENSATE_CLOCK_SKEW
+
+	// FILEWATCHER_CASE_INSENSITIVE_PATHS: whether paths that differ only in case refer to the same file (see
+	// utils.IsCaseInsensitiveFileSystem); by default, true on Windows and macOS.
+	CaseInsensitivePaths bool `json:"caseInsensitivePaths"`
+}
+
+// ServerConfig is the configuration of the connections to the Codewind server, and of the servers embedded in the
+// filewatcher.
+type ServerConfig struct {
+	ReconcileInterval time.Duration `json:"reconcileInterval"` // FILEWATCHER_RECONCILE_INTERVAL_SECS
+	GetMaxAttempts    int           `json:"getMaxAttempts"`    // FILEWATCHER_GET_MAX_ATTEMPTS
+	GetRetry          BackoffConfig `json:"getRetry"`          // FILEWATCHER_GET_RETRY_MIN_MS, FILEWATCHER_GET_RETRY_MAX_MS
+
+	WSPingInterval time.Duration `json:"wsPingInterval"` // FILEWATCHER_WS_PING_INTERVAL_MS
+	WSPongTimeout  time.Duration `json:"wsPongTimeout"`  // FILEWATCHER_WS_PONG_TIMEOUT_MS
+	WSReconnect    BackoffConfig `json:"wsReconnect"`    // FILEWATCHER_WS_RECONNECT_MIN_MS, FILEWATCHER_WS_RECONNECT_MAX_MS
+
+	// The bearer token of each request (see auth.go): the initial access token, and the OAuth2 token endpoint (with the
+	// refresh token and client ID) from which a new token is obtained when it is rejected. If neither the token nor the
+	// endpoint are set, requests are unauthenticated.
+	AuthToken         string `json:"authToken"`         // FILEWATCHER_AUTH_TOKEN
+	AuthTokenEndpoint string `json:"authTokenEndpoint"` // FILEWATCHER_AUTH_TOKEN_ENDPOINT
+	AuthRefreshToken  string `json:"authRefreshToken"`  // FILEWATCHER_AUTH_REFRESH_TOKEN
+	AuthClientID      string `json:"authClientID"`      // FILEWATCHER_AUTH_CLIENT_ID
+
+	// The verification of the certificate of the server (see tlsconfig.go): a PEM file of CA certificates to trust in
+	// addition to those of the system, or, for development only, no verification at all.
+	CAFile      string `json:"caFile"`      // FILEWATCHER_CA_FILE
+	TLSInsecure bool   `json:"tlsInsecure"` // FILEWATCHER_TLS_INSECURE
+
+	// The listen addresses of the status and pprof servers (see embeddedserver.go): each is only started if its
+	// address (host:port) or port is set.
+	StatusAddress string `json:"statusAddress"` // FILEWATCHER_STATUS_ADDRESS
+	StatusHost    string `json:"statusHost"`    // FILEWATCHER_STATUS_HOST
+	StatusPort    int    `json:"statusPort"`    // FILEWATCHER_STATUS_PORT
+	PprofAddress  string `json:"pprofAddress"`  // FILEWATCHER_PPROF_ADDRESS
+	PprofPort     int    `json:"pprofPort"`     // FILEWATCHER_PPROF_PORT
+}
+
+// BackoffConfig is the minimum and maximum delay of an exponential backoff.
+type BackoffConfig struct {
+	MinDelay time.Duration `json:"minDelay"`
+	MaxDelay time.Duration `json:"maxDelay"`
+}
+
+// newBackoff returns an exponential backoff with these delays, and the given jitter.
+func (backoffConfig BackoffConfig) newBackoff(jitterFraction float32) utils.ExponentialBackoff {
+	return utils.ExponentialBackoff{
+		MinFailureDelay: int(backoffConfig.MinDelay / time.Millisecond),
+		FailureDelay:    0,
+		MaxFailureDelay: int(backoffConfig.MaxDelay / time.Millisecond),
+		BackoffExponent: 1.5,
+		JitterFraction:  jitterFraction,
+	}
+}
+
+// DefaultConfig returns the configuration that is used if no settings are specified.
+func DefaultConfig() *Config {
+	return &Config{
+		CLI: CLIConfig{
+			QuietPeriod:             250 * time.Millisecond,
+			TimestampSafetyMargin:   2000 * time.Millisecond,
+			CircuitBreakerThreshold: 5,
+			CircuitBreakerCooldown:  300 * time.Second,
+			ChannelCapacity:         16,
+			MaxOutputBytes:          1024 * 1024,
+			MaxConcurrentProcesses:  4,
+			SyncJitter:              1000 * time.Millisecond,
+			SyncLagWarningThreshold: 60 * time.Second,
+			FailureWebhookTimeout:   10000 * time.Millisecond,
+			WorkspaceSyncWindow:     200 * time.Millisecond,
+			SyncCommand:             defaultCwctlSyncCommand,
+		},
+		Watch: WatchConfig{
+			Mode:                   WatchModeNative,
+			PollingInterval:        5000 * time.Millisecond,
+			SymlinkMode:            SymlinkModeFile,
+			IdleThreshold:          600 * time.Second,
+			SelfTestTimeout:        5000 * time.Millisecond,
+			BatchWindow:            defaultBatchWindowInMsecs * time.Millisecond,
+			MaxPendingEvents:       100000,
+			MaxChangesPerChunk:     625,
+			LogOversizedFiles:      true,
+			ClockSkewThreshold:     2000 * time.Millisecond,
+			ClockSkewCheckInterval: 10 * time.Minute,
+			CaseInsensitivePaths:   utils.IsCaseInsensitiveOS(),
+		},
+		Server: ServerConfig{
+			ReconcileInterval: 120 * time.Second,
+			GetMaxAttempts:    5,
+			GetRetry:          BackoffConfig{MinDelay: 500 * time.Millisecond, MaxDelay: 8000 * time.Millisecond},
+			WSPingInterval:    25000 * time.Millisecond,
+			WSPongTimeout:     10000 * time.Millisecond,
+			WSReconnect:       BackoffConfig{MinDelay: 200 * time.Millisecond, MaxDelay: 4000 * time.Millisecond},
+		},
+	}
+}
+
+// LoadConfig returns the configuration specified by the given configuration file (optional; if empty, the file
+// specified by FILEWATCHER_CONFIG_FILE is used, if any), overridden by the environment. An error describing every
+// invalid setting is returned if any are invalid.
+func LoadConfig(configFilePath string) (*Config, error) {
+
+	result := DefaultConfig()
+
+	if strings.TrimSpace(configFilePath) == "" {
+		configFilePath = strings.TrimSpace(os.Getenv("FILEWATCHER_CONFIG_FILE"))
+	}
+
+	if configFilePath != "" {
+		if err := loadConfigFile(configFilePath, result); err != nil {
+			return nil, err
+		}
+	}
+
+	loader := &configLoader{}
+
+	cli := &result.CLI
+	cli.MockInstallerPath = loader.string("MOCK_CWCTL_INSTALLER_PATH", cli.MockInstallerPath)
+	cli.DryRun = loader.bool("FILEWATCHER_DRY_RUN", cli.DryRun)
+	cli.WorkingDir = loader.string("CWCTL_WORKING_DIR", cli.WorkingDir)
+	cli.SyncTimeout = loader.duration("CWCTL_SYNC_TIMEOUT_SECS", time.Second, cli.SyncTimeout)
+	cli.QuietPeriod = loader.duration("CWCTL_SYNC_QUIET_PERIOD_MS", time.Millisecond, cli.QuietPeriod)
+	cli.MinSyncInterval = loader.duration("CWCTL_SYNC_MIN_INTERVAL_MS", time.Millisecond, cli.MinSyncInterval)
+	cli.TimestampSafetyMargin = loader.duration("CWCTL_SYNC_TIMESTAMP_MARGIN_MS", time.Millisecond, cli.TimestampSafetyMargin)
+	cli.DetectTimestampSafetyMargin = loader.bool("CWCTL_SYNC_TIMESTAMP_MARGIN_DETECT", cli.DetectTimestampSafetyMargin)
+	cli.TimestampSafetyMarginDetectDir = loader.string("CWCTL_SYNC_TIMESTAMP_MARGIN_DETECT_DIR", cli.TimestampSafetyMarginDetectDir)
+	cli.PinnedTimestamp = loader.string("CWCTL_SYNC_PINNED_TIMESTAMP", cli.PinnedTimestamp)
+	cli.CircuitBreakerThreshold = loader.int("CWCTL_CIRCUIT_BREAKER_THRESHOLD", cli.CircuitBreakerThreshold)
+	cli.CircuitBreakerCooldown = loader.duration("CWCTL_CIRCUIT_BREAKER_COOLDOWN_SECS", time.Second, cli.CircuitBreakerCooldown)
+	cli.ChannelCapacity = loader.int("CWCTL_SYNC_CHANNEL_CAPACITY", cli.ChannelCapacity)
+	cli.MaxOutputBytes = loader.int("CWCTL_MAX_OUTPUT_BYTES", cli.MaxOutputBytes)
+	cli.MaxConcurrentProcesses = loader.int("CWCTL_MAX_CONCURRENT_PROCESSES", cli.MaxConcurrentProcesses)
+	cli.SyncJitter = loader.duration("CWCTL_SYNC_JITTER_MS", time.Millisecond, cli.SyncJitter)
+	cli.SyncLagWarningThreshold = loader.duration("CWCTL_SYNC_LAG_WARNING_SECS", time.Second, cli.SyncLagWarningThreshold)
+	cli.AdaptiveBatchWindow = loader.bool("CWCTL_SYNC_LAG_ADAPTIVE_BATCH_WINDOW", cli.AdaptiveBatchWindow)
+	cli.FailureWebhookURL = loader.string("CWCTL_FAILURE_WEBHOOK_URL", cli.FailureWebhookURL)
+	cli.FailureWebhookThreshold = loader.int("CWCTL_FAILURE_WEBHOOK_THRESHOLD", cli.FailureWebhookThreshold)
+	cli.FailureWebhookTimeout = loader.duration("CWCTL_FAILURE_WEBHOOK_TIMEOUT_MS", time.Millisecond, cli.FailureWebhookTimeout)
+	cli.WorkspaceSync = loader.bool("CWCTL_WORKSPACE_SYNC", cli.WorkspaceSync)
+	cli.WorkspaceSyncWindow = loader.duration("CWCTL_WORKSPACE_SYNC_WINDOW_MS", time.Millisecond, cli.WorkspaceSyncWindow)
+	cli.SyncCommand = loader.string("CWCTL_SYNC_COMMAND", cli.SyncCommand)
+
+	watch := &result.Watch
+	if value := loader.string("FILEWATCHER_MODE", ""); value != "" {
+		if mode, ok := parseWatchMode(value); ok {
+			watch.Mode = mode
+		} else {
+			loader.addError("FILEWATCHER_MODE must be 'native' or 'polling': " + value)
+		}
+	}
+	watch.PollingInterval = loader.duration("FILEWATCHER_POLLING_INTERVAL_MS", time.Millisecond, watch.PollingInterval)
+	if value := loader.string("FILEWATCHER_SYMLINK_MODE", ""); value != "" {
+		if mode, ok := parseSymlinkMode(value); ok {
+			watch.SymlinkMode = mode
+		} else {
+			loader.addError("FILEWATCHER_SYMLINK_MODE must be 'file', 'follow', or 'ignore': " + value)
+		}
+	}
+	watch.IdleThreshold = loader.duration("FILEWATCHER_IDLE_THRESHOLD_SECS", time.Second, watch.IdleThreshold)
+	watch.IdlePollingInterval = loader.duration("FILEWATCHER_IDLE_POLLING_INTERVAL_MS", time.Millisecond, watch.IdlePollingInterval)
+	watch.MaxDepth = loader.int("FILEWATCHER_MAX_DEPTH", watch.MaxDepth)
+	watch.MaxWatchedFiles = loader.int("FILEWATCHER_MAX_WATCHED_FILES", watch.MaxWatchedFiles)
+	watch.SelfTest = loader.bool("FILEWATCHER_WATCH_SELF_TEST", watch.SelfTest)
+	watch.SelfTestTimeout = loader.duration("FILEWATCHER_WATCH_SELF_TEST_TIMEOUT_MS", time.Millisecond, watch.SelfTestTimeout)
+	watch.BatchWindow = loader.duration("FILEWATCHER_BATCH_WINDOW_MS", time.Millisecond, watch.BatchWindow)
+	watch.MaxPendingEvents = loader.int("FILEWATCHER_MAX_PENDING_EVENTS", watch.MaxPendingEvents)
+	watch.PostChangesToServer = loader.bool("FILEWATCHER_POST_FILE_CHANGES", watch.PostChangesToServer)
+	watch.MaxChangesPerChunk = loader.int("FILEWATCHER_MAX_CHANGES_PER_CHUNK", watch.MaxChangesPerChunk)
+	watch.HonorGitIgnore = loader.bool("FILEWATCHER_HONOR_GITIGNORE", watch.HonorGitIgnore)
+	watch.MaxFileSizeBytes = loader.int("FILEWATCHER_MAX_FILE_SIZE_BYTES", watch.MaxFileSizeBytes)
+	watch.LogOversizedFiles = loader.bool("FILEWATCHER_LOG_OVERSIZED_FILES", watch.LogOversizedFiles)
+	watch.ClockSkewDir = loader.string("FILEWATCHER_CLOCK_SKEW_DIR", watch.ClockSkewDir)
+	watch.ClockSkewThreshold = loader.duration("FILEWATCHER_CLOCK_SKEW_THRESHOLD_MS", time.Millisecond, watch.ClockSkewThreshold)
+	watch.ClockSkewCheckInterval = loader.duration("FILEWATCHER_CLOCK_SKEW_CHECK_INTERVAL_MINS", time.Minute, watch.ClockSkewCheckInterval)
+	watch.CompensateClockSkew = loader.bool("FILEWATCHER_COMPENSATE_CLOCK_SKEW", watch.CompensateClockSkew)
+	watch.CaseInsensitivePaths = loader.bool("FILEWATCHER_CASE_INSENSITIVE_PATHS", watch.CaseInsensitivePaths)
+
+	server := &result.Server
+	server.ReconcileInterval = loader.duration("FILEWATCHER_RECONCILE_INTERVAL_SECS", time.Second, server.ReconcileInterval)
+	server.GetMaxAttempts = loader.int("FILEWATCHER_GET_MAX_ATTEMPTS", server.GetMaxAttempts)
+	server.GetRetry = loader.backoff("FILEWATCHER_GET_RETRY", server.GetRetry)
+	server.WSPingInterval = loader.duration("FILEWATCHER_WS_PING_INTERVAL_MS", time.Millisecond, server.WSPingInterval)
+	server.WSPongTimeout = loader.duration("FILEWATCHER_WS_PONG_TIMEOUT_MS", time.Millisecond, server.WSPongTimeout)
+	server.WSReconnect = loader.backoff("FILEWATCHER_WS_RECONNECT", server.WSReconnect)
+	server.AuthToken = loader.string("FILEWATCHER_AUTH_TOKEN", server.AuthToken)
+	server.AuthTokenEndpoint = loader.string("FILEWATCHER_AUTH_TOKEN_ENDPOINT", server.AuthTokenEndpoint)
+	server.AuthRefreshToken = loader.string("FILEWATCHER_AUTH_REFRESH_TOKEN", server.AuthRefreshToken)
+	server.AuthClientID = loader.string("FILEWATCHER_AUTH_CLIENT_ID", server.AuthClientID)
+	server.CAFile = loader.string("FILEWATCHER_CA_FILE", server.CAFile)
+	server.TLSInsecure = loader.bool("FILEWATCHER_TLS_INSECURE", server.TLSInsecure)
+	server.StatusAddress = loader.string("FILEWATCHER_STATUS_ADDRESS", server.StatusAddress)
+	server.StatusHost = loader.string("FILEWATCHER_STATUS_HOST", server.StatusHost)
+	server.StatusPort = loader.int("FILEWATCHER_STATUS_PORT", server.StatusPort)
+	server.PprofAddress = loader.string("FILEWATCHER_PPROF_ADDRESS", server.PprofAddress)
+	server.PprofPort = loader.int("FILEWATCHER_PPROF_PORT", server.PprofPort)
+
+	if err := result.Validate(); err != nil {
+		loader.addError(err.Error())
+	}
+
+	if len(loader.errors) > 0 {
+		return nil, errors.New("Invalid configuration: " + strings.Join(loader.errors, "; "))
+	}
+
+	return result, nil
+}
+
+// Validate returns an error describing every setting that is out of range.
+func (config *Config) Validate() error {
+
+	problems := config.CLI.validate()
+	problems = append(problems, config.Watch.validate()...)
+	problems = append(problems, config.Server.validate()...)
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// configProblems accumulates a description of each setting that is out of range.
+type configProblems []string
+
+func (problems *configProblems) check(valid bool, problem string) {
+	if !valid {
+		*problems = append(*problems, problem)
+	}
+}
+
+func (cli CLIConfig) validate() []string {
+	problems := configProblems{}
+	check := problems.check
+
+	check(cli.SyncTimeout >= 0, "cli.syncTimeout (CWCTL_SYNC_TIMEOUT_SECS) must not be negative")
+	check(cli.QuietPeriod >= 0, "cli.quietPeriod (CWCTL_SYNC_QUIET_PERIOD_MS) must not be negative")
+	check(cli.MinSyncInterval >= 0, "cli.minSyncInterval (CWCTL_SYNC_MIN_INTERVAL_MS) must not be negative")
+	check(cli.TimestampSafetyMargin >= 0, "cli.timestampSafetyMargin (CWCTL_SYNC_TIMESTAMP_MARGIN_MS) must not be negative")
+	if _, _, err := cli.pinnedTimestamp(); err != nil {
+		check(false, "cli.pinnedTimestamp (CWCTL_SYNC_PINNED_TIMESTAMP) "+err.Error())
+	}
+	check(cli.CircuitBreakerThreshold >= 0, "cli.circuitBreakerThreshold (CWCTL_CIRCUIT_BREAKER_THRESHOLD) must not be negative")
+	check(cli.CircuitBreakerCooldown >= 0, "cli.circuitBreakerCooldown (CWCTL_CIRCUIT_BREAKER_COOLDOWN_SECS) must not be negative")
+	check(cli.ChannelCapacity >= 0, "cli.channelCapacity (CWCTL_SYNC_CHANNEL_CAPACITY) must not be negative: "+strconv.Itoa(cli.ChannelCapacity))
+	check(cli.MaxOutputBytes >= 0, "cli.maxOutputBytes (CWCTL_MAX_OUTPUT_BYTES) must not be negative")
+	check(cli.MaxConcurrentProcesses >= 1, "cli.maxConcurrentProcesses (CWCTL_MAX_CONCURRENT_PROCESSES) must be at least 1")
+	check(cli.SyncJitter >= 0, "cli.syncJitter (CWCTL_SYNC_JITTER_MS) must not be negative")
+	check(cli.SyncLagWarningThreshold >= 0, "cli.syncLagWarningThreshold (CWCTL_SYNC_LAG_WARNING_SECS) must not be negative")
+	check(cli.FailureWebhookThreshold >= 0, "cli.failureWebhookThreshold (CWCTL_FAILURE_WEBHOOK_THRESHOLD) must not be negative")
+	check(cli.FailureWebhookTimeout > 0, "cli.failureWebhookTimeout (CWCTL_FAILURE_WEBHOOK_TIMEOUT_MS) must be positive")
+	check(cli.WorkspaceSyncWindow >= 0, "cli.workspaceSyncWindow (CWCTL_WORKSPACE_SYNC_WINDOW_MS) must not be negative")
+
+	if cli.FailureWebhookURL != "" {
+		webhookURL, err := url.Parse(cli.FailureWebhookURL)
+		check(err == nil && (webhookURL.Scheme == "http" || webhookURL.Scheme == "https") && webhookURL.Host != "",
+			"cli.failureWebhookURL (CWCTL_FAILURE_WEBHOOK_URL) must be an http or https URL")
+	}
+
+	if _, err := parseCwctlSyncCommand(cli.SyncCommand); err != nil {
+		check(false, "cli.syncCommand (CWCTL_SYNC_COMMAND) is invalid: "+err.Error())
+	}
+
+	return problems
+}
+
+// pinnedTimestamp returns whether the timestamp of the syncs is pinned (see PinnedTimestamp), and the fixed timestamp
+// that it is pinned to (0 if pinned to the timestamp of the first sync).
+func (cli CLIConfig) pinnedTimestamp() (bool, int64, error) {
+	value := strings.TrimSpace(cli.PinnedTimestamp)
+
+	if value == "" {
+		return false, 0, nil
+	} else if strings.EqualFold(value, "creation") {
+		return true, 0, nil
+	}
+
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || timestamp <= 0 {
+		return false, 0, errors.New("must be 'creation', or a positive timestamp in absolute msecs")
+	}
+	return true, timestamp, nil
+}
+
+func (watch WatchConfig) validate() []string {
+	problems := configProblems{}
+	check := problems.check
+
+	check(watch.PollingInterval > 0, "watch.pollingInterval (FILEWATCHER_POLLING_INTERVAL_MS) must be positive")
+	check(watch.IdleThreshold >= 0, "watch.idleThreshold (FILEWATCHER_IDLE_THRESHOLD_SECS) must not be negative")
+	check(watch.IdlePollingInterval == 0 || watch.IdlePollingInterval >= watch.PollingInterval,
+		"watch.idlePollingInterval (FILEWATCHER_IDLE_POLLING_INTERVAL_MS) must be 0, or at least watch.pollingInterval")
+	check(watch.MaxDepth >= 0, "watch.maxDepth (FILEWATCHER_MAX_DEPTH) must not be negative")
+	check(watch.MaxWatchedFiles >= 0, "watch.maxWatchedFiles (FILEWATCHER_MAX_WATCHED_FILES) must not be negative")
+	check(watch.SelfTestTimeout > 0, "watch.selfTestTimeout (FILEWATCHER_WATCH_SELF_TEST_TIMEOUT_MS) must be positive")
+	check(watch.BatchWindow > 0, "watch.batchWindow (FILEWATCHER_BATCH_WINDOW_MS) must be positive")
+	check(watch.MaxPendingEvents >= 0, "watch.maxPendingEvents (FILEWATCHER_MAX_PENDING_EVENTS) must not be negative")
+	check(watch.MaxChangesPerChunk > 0, "watch.maxChangesPerChunk (FILEWATCHER_MAX_CHANGES_PER_CHUNK) must be positive")
+	check(watch.MaxFileSizeBytes >= 0, "watch.maxFileSizeBytes (FILEWATCHER_MAX_FILE_SIZE_BYTES) must not be negative")
+	check(watch.ClockSkewThreshold >= 0, "watch.clockSkewThreshold (FILEWATCHER_CLOCK_SKEW_THRESHOLD_MS) must not be negative")
+	check(watch.ClockSkewCheckInterval >= 0, "watch.clockSkewCheckInterval (FILEWATCHER_CLOCK_SKEW_CHECK_INTERVAL_MINS) must not be negative")
+
+	return problems
+}
+
+func (server ServerConfig) validate() []string {
+	problems := configProblems{}
+	check := problems.check
+
+	check(server.ReconcileInterval > 0, "server.reconcileInterval (FILEWATCHER_RECONCILE_INTERVAL_SECS) must be positive")
+	check(server.GetMaxAttempts >= 1, "server.getMaxAttempts (FILEWATCHER_GET_MAX_ATTEMPTS) must be at least 1")
+	check(server.WSPingInterval >= time.Second, "server.wsPingInterval (FILEWATCHER_WS_PING_INTERVAL_MS) must be at least 1 second")
+	check(server.WSPongTimeout >= time.Second, "server.wsPongTimeout (FILEWATCHER_WS_PONG_TIMEOUT_MS) must be at least 1 second")
+
+	checkBackoff := func(backoffConfig BackoffConfig, key string, envPrefix string) {
+		check(backoffConfig.MinDelay >= time.Millisecond, key+".minDelay ("+envPrefix+"_MIN_MS) must be at least 1 msec")
+		check(backoffConfig.MaxDelay >= backoffConfig.MinDelay, key+".maxDelay ("+envPrefix+"_MAX_MS) must not be less than the minimum delay")
+	}
+	checkBackoff(server.GetRetry, "server.getRetry", "FILEWATCHER_GET_RETRY")
+	checkBackoff(server.WSReconnect, "server.wsReconnect", "FILEWATCHER_WS_RECONNECT")
+
+	if server.AuthTokenEndpoint != "" {
+		endpointURL, err := url.Parse(server.AuthTokenEndpoint)
+		check(err == nil && (endpointURL.Scheme == "http" || endpointURL.Scheme == "https") && endpointURL.Host != "",
+			"server.authTokenEndpoint (FILEWATCHER_AUTH_TOKEN_ENDPOINT) must be an http or https URL")
+	}
+
+	check(server.StatusPort >= 0 && server.StatusPort <= 65535, "server.statusPort (FILEWATCHER_STATUS_PORT) must be between 0 and 65535")
+	check(server.PprofPort >= 0 && server.PprofPort <= 65535, "server.pprofPort (FILEWATCHER_PPROF_PORT) must be between 0 and 65535")
+
+	return problems
+}
+
+// configLoader reads settings from the environment, recording any that cannot be parsed.
+type configLoader struct {
+	errors []string
+}
+
+func (loader *configLoader) addError(problem string) {
+	loader.errors = append(loader.errors, problem)
+}
+
+func (loader *configLoader) string(name string, defaultValue string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func (loader *configLoader) bool(name string, defaultValue bool) bool {
+	value := loader.string(name, "")
+	if value == "" {
+		return defaultValue
+	}
+	return strings.EqualFold(value, "true")
+}
+
+func (loader *configLoader) int(name string, defaultValue int) int {
+	value := loader.string(name, "")
+	if value == "" {
+		return defaultValue
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		loader.addError(name + " must be an integer: " + value)
+		return defaultValue
+	}
+
+	return result
+}
+
+// duration reads an integer setting, in the given unit (eg time.Millisecond for a '_MS' setting). If the setting is
+// absent, the default is returned unchanged, so that a value from the configuration file (eg "syncTimeout": "500ms")
+// is not truncated to the unit of the environment variable.
+func (loader *configLoader) duration(name string, unit time.Duration, defaultValue time.Duration) time.Duration {
+	value := loader.string(name, "")
+	if value == "" {
+		return defaultValue
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		loader.addError(name + " must be an integer: " + value)
+		return defaultValue
+	}
+
+	return time.Duration(result) * unit
+}
+
+// backoff reads the '<envPrefix>_MIN_MS' and '<envPrefix>_MAX_MS' settings.
+func (loader *configLoader) backoff(envPrefix string, defaultValue BackoffConfig) BackoffConfig {
+	return BackoffConfig{
+		MinDelay: loader.duration(envPrefix+"_MIN_MS", time.Millisecond, defaultValue.MinDelay),
+		MaxDelay: loader.duration(envPrefix+"_MAX_MS", time.Millisecond, defaultValue.MaxDelay),
+	}
+}
@@ -0,0 +1,244 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setenv sets the environment variables for the duration of a test, returning a function that restores them.
+func setenv(t *testing.T, values map[string]string) func() {
+	t.Helper()
+
+	restore := []func(){}
+	for name, value := range values {
+		name := name
+		if original, exists := os.LookupEnv(name); exists {
+			restore = append(restore, func() { os.Setenv(name, original) })
+		} else {
+			restore = append(restore, func() { os.Unsetenv(name) })
+		}
+		os.Setenv(name, value)
+	}
+
+	return func() {
+		for _, restoreValue := range restore {
+			restoreValue()
+		}
+	}
+}
+
+func TestLoadConfigRejectsNegativeChannelCapacity(t *testing.T) {
+	defer setenv(t, map[string]string{"FILEWATCHER_CONFIG_FILE": "", "CWCTL_SYNC_CHANNEL_CAPACITY": "-5"})()
+
+	config, err := LoadConfig("")
+	if err == nil {
+		t.Fatalf("Expected a negative channel capacity to be rejected, but got a capacity of %d", config.CLI.ChannelCapacity)
+	}
+
+	// The invalid value is reported, rather than replaced
+	if !strings.Contains(err.Error(), "CWCTL_SYNC_CHANNEL_CAPACITY") || !strings.Contains(err.Error(), "-5") {
+		t.Fatalf("Expected the error to describe the invalid channel capacity, but got: %v", err)
+	}
+}
+
+// writeConfigFile writes a configuration file with the given name and contents to a new temporary directory, returning
+// its path and a function that removes it.
+func writeConfigFile(t *testing.T, name string, contents string) (string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "filewatcher-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadConfigFileRoundTrip(t *testing.T) {
+	defer setenv(t, map[string]string{"FILEWATCHER_CONFIG_FILE": "", "CWCTL_SYNC_TIMEOUT_SECS": "", "CWCTL_SYNC_QUIET_PERIOD_MS": ""})()
+
+	// Every setting differs from its default, and some durations are not whole multiples of the unit of their
+	// environment variable
+	expected := DefaultConfig()
+	expected.CLI.SyncTimeout = 500 * time.Millisecond
+	expected.CLI.QuietPeriod = 1500 * time.Microsecond
+	expected.CLI.MaxConcurrentProcesses = 3
+	expected.CLI.DryRun = true
+	expected.CLI.SyncCommand = "project sync -p {path} -i {id} -t {timestamp} --verbose"
+	expected.Watch.Mode = WatchModePolling
+	expected.Watch.PollingInterval = 1250 * time.Millisecond
+	expected.Server.ReconcileInterval = 90500 * time.Millisecond
+	expected.Server.GetRetry = BackoffConfig{MinDelay: 250 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+	contents, err := json.Marshal(map[string]interface{}{
+		"cli": map[string]interface{}{
+			"syncTimeout":            expected.CLI.SyncTimeout.String(),
+			"quietPeriod":            expected.CLI.QuietPeriod.String(),
+			"maxConcurrentProcesses": expected.CLI.MaxConcurrentProcesses,
+			"dryRun":                 expected.CLI.DryRun,
+			"syncCommand":            expected.CLI.SyncCommand,
+		},
+		"watch": map[string]interface{}{
+			"mode":            "polling",
+			"pollingInterval": expected.Watch.PollingInterval.String(),
+		},
+		"server": map[string]interface{}{
+			"reconcileInterval": expected.Server.ReconcileInterval.String(),
+			"getRetry": map[string]interface{}{
+				"minDelay": expected.Server.GetRetry.MinDelay.String(),
+				"maxDelay": expected.Server.GetRetry.MaxDelay.String(),
+			},
+			"futureSetting": "ignored",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Written by hand, with durations in other formats
+	handWritten := `{
+  "cli": {
+    "syncTimeout": "500ms",
+    "quietPeriod": "1.5ms",
+    "maxConcurrentProcesses": 3,
+    "dryRun": true,
+    "syncCommand": "project sync -p {path} -i {id} -t {timestamp} --verbose"
+  },
+  "watch": { "mode": "polling", "pollingInterval": "1.25s" },
+  "server": {
+    "reconcileInterval": "1m30.5s",
+    "getRetry": { "minDelay": "250ms", "maxDelay": "10s" },
+    "futureSetting": "ignored"
+  }
+}`
+
+	for name, contents := range map[string]string{"config.json": string(contents), "hand-written.json": handWritten} {
+		path, cleanup := writeConfigFile(t, name, contents)
+		defer cleanup()
+
+		actual, err := LoadConfig(path)
+		if err != nil {
+			t.Errorf("Unable to load %s: %v", name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %s to be loaded as %+v, but got %+v", name, *expected, *actual)
+		}
+	}
+}
+
+func TestLoadConfigEnvironmentOverridesFile(t *testing.T) {
+	path, cleanup := writeConfigFile(t, "config.json", `{"cli": {"syncTimeout": "500ms", "quietPeriod": "100ms", "maxOutputBytes": 10}, "watch": {"pollingInterval": "1250ms"}}`)
+	defer cleanup()
+
+	defer setenv(t, map[string]string{
+		"FILEWATCHER_CONFIG_FILE":         path,
+		"CWCTL_SYNC_TIMEOUT_SECS":         "2",
+		"CWCTL_MAX_OUTPUT_BYTES":          "20",
+		"CWCTL_SYNC_QUIET_PERIOD_MS":      "",
+		"FILEWATCHER_POLLING_INTERVAL_MS": "",
+	})()
+
+	config, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		actual      interface{}
+		expected    interface{}
+	}{
+		{"a duration set by both", config.CLI.SyncTimeout, 2 * time.Second},
+		{"an integer set by both", config.CLI.MaxOutputBytes, 20},
+		{"a duration set by the file only", config.CLI.QuietPeriod, 100 * time.Millisecond},
+		{"a duration of the file that is not a whole multiple of the unit", config.Watch.PollingInterval, 1250 * time.Millisecond},
+		{"a duration set by neither", config.CLI.MinSyncInterval, DefaultConfig().CLI.MinSyncInterval},
+	}
+
+	for _, test := range tests {
+		if test.actual != test.expected {
+			t.Errorf("Expected %s to be %v, but it was %v", test.description, test.expected, test.actual)
+		}
+	}
+}
+
+func TestLoadConfigRejectsInvalidDurations(t *testing.T) {
+	defer setenv(t, map[string]string{"FILEWATCHER_CONFIG_FILE": "", "CWCTL_SYNC_TIMEOUT_SECS": "5s"})()
+
+	if _, err := LoadConfig(""); err == nil || !strings.Contains(err.Error(), "CWCTL_SYNC_TIMEOUT_SECS must be an integer") {
+		t.Fatalf("Expected a duration that is not an integer to be rejected, but got: %v", err)
+	}
+
+	path, cleanup := writeConfigFile(t, "config.json", `{"cli": {"syncTimeout": 500}}`)
+	defer cleanup()
+
+	os.Setenv("CWCTL_SYNC_TIMEOUT_SECS", "")
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "cli.syncTimeout must be a duration") {
+		t.Fatalf("Expected a duration without a unit to be rejected, but got: %v", err)
+	}
+}
+
+func TestLoadConfigFileMustBeJSON(t *testing.T) {
+	defer setenv(t, map[string]string{"FILEWATCHER_CONFIG_FILE": ""})()
+
+	path, cleanup := writeConfigFile(t, "config.yaml", "cli:\n  syncTimeout: 500ms\n")
+	defer cleanup()
+
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "as JSON") {
+		t.Errorf("Expected a file that is not JSON to be rejected, but got: %v", err)
+	}
+
+	// Numbers and booleans must be of their JSON types
+	path, cleanup = writeConfigFile(t, "config.json", `{"cli": {"maxConcurrentProcesses": "3", "dryRun": "true"}}`)
+	defer cleanup()
+
+	_, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "cli.maxConcurrentProcesses must be an integer") || !strings.Contains(err.Error(), "cli.dryRun must be true or false") {
+		t.Errorf("Expected the strings to be rejected, but got: %v", err)
+	}
+}
+
+func TestLoadConfigMaxChangesPerChunk(t *testing.T) {
+	defer setenv(t, map[string]string{"FILEWATCHER_CONFIG_FILE": "", "FILEWATCHER_MAX_CHANGES_PER_CHUNK": "10"})()
+
+	config, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Watch.MaxChangesPerChunk != 10 {
+		t.Errorf("Expected a limit of 10 changes per chunk, but got %d", config.Watch.MaxChangesPerChunk)
+	}
+
+	// A chunk must contain at least one change
+	for _, value := range []string{"0", "-1"} {
+		os.Setenv("FILEWATCHER_MAX_CHANGES_PER_CHUNK", value)
+		if _, err := LoadConfig(""); err == nil || !strings.Contains(err.Error(), "FILEWATCHER_MAX_CHANGES_PER_CHUNK") {
+			t.Errorf("Expected a limit of %s changes per chunk to be rejected, but got: %v", value, err)
+		}
+	}
+}
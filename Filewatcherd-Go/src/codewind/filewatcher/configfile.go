@@ -0,0 +1,170 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/utils"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * The configuration file is JSON, whose fields mirror those of Config (see the json tags in config.go), for example:
+ *
+ *   {
+ *     "cli": { "syncTimeout": "5m", "maxConcurrentProcesses": 8 },
+ *     "watch": { "mode": "polling" },
+ *     "server": { "getRetry": { "maxDelay": "10s" } }
+ *   }
+ *
+ * Durations are strings in the format of time.ParseDuration (eg '250ms', '5m'). Fields that are not specified keep
+ * their default values. Unknown fields are logged as a warning and ignored, so that a file written for a later version
+ * of the filewatcher may still be used; fields with invalid values are an error.
+ */
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	watchModeType   = reflect.TypeOf(WatchMode(0))
+	symlinkModeType = reflect.TypeOf(SymlinkMode(0))
+)
+
+// loadConfigFile applies the settings of the configuration file to the given config.
+func loadConfigFile(path string, config *Config) error {
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.New("Unable to read the configuration file " + path + ": " + err.Error())
+	}
+
+	var settings map[string]interface{}
+	if err := json.Unmarshal(contents, &settings); err != nil {
+		return errors.New("Unable to parse the configuration file " + path + " as JSON: " + err.Error())
+	}
+
+	problems := []string{}
+	applyConfigFileSettings(reflect.ValueOf(config).Elem(), settings, "", &problems)
+
+	if len(problems) > 0 {
+		return errors.New("Invalid configuration file " + path + ": " + strings.Join(problems, "; "))
+	}
+
+	utils.LogInfo("Loaded configuration file " + path)
+
+	return nil
+}
+
+// applyConfigFileSettings sets each field of the target struct that has a setting (keyed by the json tag of the field),
+// recording a description of each invalid value in problems. The prefix is the key of the struct, eg 'server.'.
+func applyConfigFileSettings(target reflect.Value, settings map[string]interface{}, prefix string, problems *[]string) {
+
+	fieldsByKey := map[string]reflect.Value{}
+	for index := 0; index < target.NumField(); index++ {
+		if key := target.Type().Field(index).Tag.Get("json"); key != "" {
+			fieldsByKey[key] = target.Field(index)
+		}
+	}
+
+	// Sorted, so that the warnings and problems are deterministic
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field, exists := fieldsByKey[key]
+		if !exists {
+			utils.LogWarning("Unknown setting '" + prefix + key + "' in the configuration file will be ignored")
+			continue
+		}
+
+		value := settings[key]
+		if value == nil {
+			continue
+		}
+
+		if err := setConfigFileValue(field, value, prefix+key, problems); err != nil {
+			*problems = append(*problems, err.Error())
+		}
+	}
+}
+
+// setConfigFileValue sets the field to the value of the setting with the given key.
+func setConfigFileValue(field reflect.Value, value interface{}, key string, problems *[]string) error {
+
+	stringValue, isString := value.(string)
+
+	switch field.Type() {
+	case durationType:
+		duration, err := time.ParseDuration(strings.TrimSpace(stringValue))
+		if !isString || err != nil {
+			return errors.New(key + " must be a duration, eg '250ms' or '5m'")
+		}
+		field.SetInt(int64(duration))
+		return nil
+
+	case watchModeType:
+		mode, ok := parseWatchMode(stringValue)
+		if !isString || !ok {
+			return errors.New(key + " must be 'native' or 'polling'")
+		}
+		field.SetInt(int64(mode))
+		return nil
+
+	case symlinkModeType:
+		mode, ok := parseSymlinkMode(stringValue)
+		if !isString || !ok {
+			return errors.New(key + " must be 'file', 'follow', or 'ignore'")
+		}
+		field.SetInt(int64(mode))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Struct:
+		settings, ok := value.(map[string]interface{})
+		if !ok {
+			return errors.New(key + " must be an object")
+		}
+		applyConfigFileSettings(field, settings, key+".", problems)
+
+	case reflect.String:
+		if !isString {
+			return errors.New(key + " must be a string")
+		}
+		field.SetString(stringValue)
+
+	case reflect.Bool:
+		boolValue, ok := value.(bool)
+		if !ok {
+			return errors.New(key + " must be true or false")
+		}
+		field.SetBool(boolValue)
+
+	case reflect.Int:
+		floatValue, ok := value.(float64)
+		if !ok || floatValue != float64(int64(floatValue)) {
+			return errors.New(key + " must be an integer")
+		}
+		field.SetInt(int64(floatValue))
+
+	default:
+		return errors.New(key + " is not supported in the configuration file")
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"codewind/utils"
+	"context"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * The capabilities of the cwctl installer are probed once (on startup, via ProbeCwctlCapabilities, or otherwise on
+ * first use): its version is read from `cwctl --version`, and the arguments that `cwctl project sync` supports are
+ * read from `cwctl project sync --help` (or the help of the subcommand of the sync command template, see
+ * cwctlsynccommand.go).
+ *
+ * For example, newer versions of cwctl accept the ignore rules of the project as arguments to `cwctl project sync`,
+ * so that the files that cwctl enumerates match those that the filewatcher filters; older versions reject unknown
+ * arguments, so these are only passed if supported.
+ */
+
+const (
+	cwctlIgnoredFilenamesFlag = "--ignoredFilenames"
+	cwctlIgnoredPathsFlag     = "--ignoredPaths"
+	cwctlIgnoredPatternsFlag  = "--ignoredPatterns"
+	cwctlChangedFilesFlag     = "--changedFiles"
+	cwctlDeletedFilesFlag     = "--deletedFiles"
+	cwctlRenamedFromFlag      = "--renamedFrom"
+	cwctlRenamedToFlag        = "--renamedTo"
+)
+
+// maxCwctlChangeSetArgs is the maximum number of changed/deleted files passed as arguments, to stay well within the
+// command line length limits of each OS; if there are more, cwctl examines the entire project instead.
+const maxCwctlChangeSetArgs = 500
+
+// cwctlVersionRegex matches the version number in the `cwctl --version` output (eg 'cwctl version 0.9.0')
+var cwctlVersionRegex = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+// cwctlSyncCapabilities is the version of an installer, and the set of optional `cwctl project sync` arguments it supports.
+type cwctlSyncCapabilities struct {
+	version string // "" if the version could not be determined
+
+	syncSupported bool // False if `cwctl project sync` (or its flags in the sync command template) does not appear to be supported
+
+	ignoredFilenames bool
+	ignoredPaths     bool
+	ignoredPatterns  bool
+
+	changedFiles bool // True if both the changed and deleted files may be passed
+	renamedFiles bool // True if the old and new paths of renamed files may also be passed (see changeSetArgs)
+
+	workspaceSync bool // True if multiple projects of a workspace may be synced by a single call (see workspacesync.go)
+}
+
+var (
+	// cwctlCapabilitiesLock must be acquired before reading/writing cwctlCapabilitiesMap
+	cwctlCapabilitiesLock = &sync.Mutex{}
+
+	cwctlCapabilitiesMap = make(map[cwctlCapabilitiesKey]*cwctlSyncCapabilities)
+)
+
+// cwctlCapabilitiesKey identifies the capabilities of an installer, for a sync command template.
+type cwctlCapabilitiesKey struct {
+	installerPath       string
+	syncCommandTemplate string
+}
+
+// ProbeCwctlCapabilities determines (and logs) the version and capabilities of the installer (for the sync command of
+// the configuration), so that any incompatibility is reported on startup, rather than on the first sync.
+func ProbeCwctlCapabilities(installerPath string, config CLIConfig) {
+	getCwctlSyncCapabilities(installerPath, config.syncCommand())
+}
+
+// getCwctlSyncCapabilities returns the capabilities of the installer, probing them on first use.
+func getCwctlSyncCapabilities(installerPath string, syncCommand *cwctlSyncCommand) *cwctlSyncCapabilities {
+
+	// The lock is held during the probe, so that concurrent syncs only cause a single probe
+	cwctlCapabilitiesLock.Lock()
+	defer cwctlCapabilitiesLock.Unlock()
+
+	key := cwctlCapabilitiesKey{installerPath, syncCommand.template}
+
+	if result, exists := cwctlCapabilitiesMap[key]; exists {
+		return result
+	}
+
+	// The probe is not repeated on failure, as a failure here is unlikely to be transient
+	result := probeCwctlSyncCapabilities(installerPath, syncCommand)
+
+	cwctlCapabilitiesMap[key] = result
+
+	return result
+}
+
+func probeCwctlSyncCapabilities(installerPath string, syncCommand *cwctlSyncCommand) *cwctlSyncCapabilities {
+
+	result := &cwctlSyncCapabilities{}
+
+	versionOutput, err := runCwctlProbeCommand(installerPath, "--version")
+	if err != nil {
+		utils.LogSevereErr("Unable to determine the version of "+installerPath+"; it may be missing, or incompatible with this filewatcher", err)
+	} else if result.version = cwctlVersionRegex.FindString(versionOutput); result.version == "" {
+		utils.LogError("Unable to parse the version of " + installerPath + " from: " + strings.TrimSpace(versionOutput))
+	}
+
+	subcommand := syncCommand.subcommand()
+	subcommandDescription := strings.TrimSpace(installerPath + " " + strings.Join(subcommand, " "))
+
+	helpOutput, err := runCwctlProbeCommand(installerPath, append(subcommand, "--help")...)
+	if err != nil {
+		utils.LogSevereErr("Unable to determine the arguments supported by `"+subcommandDescription+"`; syncs may fail, as it may be incompatible with this filewatcher", err)
+		return result
+	}
+
+	requiredFlags := syncCommand.flags()
+	result.syncSupported = true
+	for _, flag := range requiredFlags {
+		result.syncSupported = result.syncSupported && strings.Contains(helpOutput, flag)
+	}
+	result.ignoredFilenames = strings.Contains(helpOutput, cwctlIgnoredFilenamesFlag)
+	result.ignoredPaths = strings.Contains(helpOutput, cwctlIgnoredPathsFlag)
+	result.ignoredPatterns = strings.Contains(helpOutput, cwctlIgnoredPatternsFlag)
+	result.changedFiles = strings.Contains(helpOutput, cwctlChangedFilesFlag) && strings.Contains(helpOutput, cwctlDeletedFilesFlag)
+	result.renamedFiles = result.changedFiles && strings.Contains(helpOutput, cwctlRenamedFromFlag) && strings.Contains(helpOutput, cwctlRenamedToFlag)
+	result.workspaceSync = strings.Contains(helpOutput, cwctlWorkspaceFlag)
+
+	if !result.syncSupported {
+		utils.LogSevere("`" + subcommandDescription + "` does not appear to support the required arguments (" + strings.Join(requiredFlags, ", ") +
+			"); syncs may fail, as it may be incompatible with this filewatcher")
+	}
+
+	utils.LogInfo("cwctl installer: " + installerPath + ", version: " + result.version + ", " + result.String())
+
+	return result
+}
+
+// runCwctlProbeCommand runs the installer with the given arguments, and returns its output. Some versions of cwctl
+// exit with a non-zero code after printing help, so an error is only returned if there is no output.
+func runCwctlProbeCommand(installerPath string, args ...string) (string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, installerPath, args...).CombinedOutput()
+	if err != nil && len(output) == 0 {
+		return "", err
+	}
+
+	return string(output), nil
+}
+
+func (capabilities *cwctlSyncCapabilities) String() string {
+	return "sync supported: " + strconv.FormatBool(capabilities.syncSupported) +
+		", ignore rule arguments supported: [filenames: " + strconv.FormatBool(capabilities.ignoredFilenames) +
+		", paths: " + strconv.FormatBool(capabilities.ignoredPaths) +
+		", patterns: " + strconv.FormatBool(capabilities.ignoredPatterns) + "]" +
+		", changed files arguments supported: " + strconv.FormatBool(capabilities.changedFiles) +
+		", renamed files arguments supported: " + strconv.FormatBool(capabilities.renamedFiles) +
+		", workspace sync supported: " + strconv.FormatBool(capabilities.workspaceSync)
+}
+
+// ignoreRuleArgs returns the `cwctl project sync` arguments for the ignore rules of the project, limited to those
+// that are supported by the installer. Each rule is passed as a separate instance of the argument.
+func (capabilities *cwctlSyncCapabilities) ignoreRuleArgs(ptw *models.ProjectToWatch) []string {
+
+	result := []string{}
+
+	if ptw == nil {
+		return result
+	}
+
+	addArgs := func(supported bool, flag string, values []string) {
+		if !supported {
+			return
+		}
+		for _, value := range values {
+			result = append(result, flag, value)
+		}
+	}
+
+	addArgs(capabilities.ignoredFilenames, cwctlIgnoredFilenamesFlag, ptw.IgnoredFilenames)
+	addArgs(capabilities.ignoredPaths, cwctlIgnoredPathsFlag, ptw.IgnoredPaths)
+	addArgs(capabilities.ignoredPatterns, cwctlIgnoredPatternsFlag, ptw.IgnoredPatterns)
+
+	return result
+}
+
+// changeSetArgs returns the `cwctl project sync` arguments for the files that were changed, deleted and renamed since
+// the previous sync, if supported by the installer. Each rename is passed as a --renamedFrom argument with the old path,
+// and a --renamedTo argument with the new path, in the same order; if renames are not supported, they are passed as
+// the deletion of the old path and the creation of the new one (see syncchangeset.go). No arguments are returned if the
+// changes are not fully known (in which case cwctl examines the entire project), or if there are too many of them.
+func (capabilities *cwctlSyncCapabilities) changeSetArgs(changes *syncChangeSet) []string {
+
+	result := []string{}
+
+	if !capabilities.changedFiles || changes == nil || !changes.isKnown() {
+		return result
+	}
+
+	if !capabilities.renamedFiles {
+		changes = changes.withRenamesExpanded()
+	}
+
+	changed := changes.sortedChanged()
+	deleted := changes.sortedDeleted()
+	renamed := changes.sortedRenamed()
+
+	if len(changed)+len(deleted)+len(renamed) > maxCwctlChangeSetArgs {
+		return result
+	}
+
+	for _, path := range renamed {
+		result = append(result, cwctlRenamedFromFlag, changes.renamed[path].oldPath, cwctlRenamedToFlag, path)
+	}
+	for _, path := range changed {
+		result = append(result, cwctlChangedFilesFlag, path)
+	}
+	for _, path := range deleted {
+		result = append(result, cwctlDeletedFilesFlag, path)
+	}
+
+	return result
+}
@@ -0,0 +1,127 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/**
+ * The output of `cwctl project sync` is not a stable interface, so the number of synced (uploaded) and deleted files
+ * is extracted on a best-effort basis: first from a JSON object in the output (if any), then from text such as
+ * '3 files synced'. If a count cannot be found, it is reported as unknown (-1), and the sync is otherwise unaffected.
+ */
+
+// unknownFileCount is the value of a file count that could not be parsed from the cwctl output.
+const unknownFileCount = -1
+
+// The JSON fields (compared case-insensitively) that may contain the synced/deleted files, either as a list or a count.
+var (
+	syncedFileCountJSONFields  = []string{"uploadedFileList", "uploadedFiles", "uploadedFileCount", "syncedFiles", "syncedFileCount"}
+	deletedFileCountJSONFields = []string{"deletedFileList", "deletedFiles", "deletedFileCount"}
+)
+
+var (
+	syncedFileCountRegexes = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(\d+)\s+files?\s+(?:were\s+)?(?:synced|synchronized|uploaded|transferred)`),
+		regexp.MustCompile(`(?i)(?:synced|synchronized|uploaded)(?:\s+files?)?\s*[:=]\s*(\d+)`),
+	}
+	deletedFileCountRegexes = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(\d+)\s+files?\s+(?:were\s+)?(?:deleted|removed)`),
+		regexp.MustCompile(`(?i)(?:deleted|removed)(?:\s+files?)?\s*[:=]\s*(\d+)`),
+	}
+)
+
+// parseSyncFileCounts returns the number of files synced and deleted, according to the output of `cwctl project
+// sync`; either may be unknownFileCount.
+func parseSyncFileCounts(output string) (int, int) {
+
+	synced := unknownFileCount
+	deleted := unknownFileCount
+
+	if jsonFields := parseJSONObjectFromOutput(output); jsonFields != nil {
+		synced = fileCountFromJSON(jsonFields, syncedFileCountJSONFields)
+		deleted = fileCountFromJSON(jsonFields, deletedFileCountJSONFields)
+	}
+
+	if synced == unknownFileCount {
+		synced = fileCountFromText(output, syncedFileCountRegexes)
+	}
+	if deleted == unknownFileCount {
+		deleted = fileCountFromText(output, deletedFileCountRegexes)
+	}
+
+	return synced, deleted
+}
+
+// parseJSONObjectFromOutput returns the fields of the outermost JSON object in the output, or nil if there is none.
+func parseJSONObjectFromOutput(output string) map[string]interface{} {
+
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start == -1 || end <= start {
+		return nil
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(output[start:end+1]), &result); err != nil {
+		return nil
+	}
+
+	return result
+}
+
+func fileCountFromJSON(jsonFields map[string]interface{}, fieldNames []string) int {
+
+	for key, value := range jsonFields {
+		for _, fieldName := range fieldNames {
+			if !strings.EqualFold(key, fieldName) {
+				continue
+			}
+
+			switch typedValue := value.(type) {
+			case []interface{}:
+				return len(typedValue)
+			case float64:
+				if typedValue >= 0 {
+					return int(typedValue)
+				}
+			}
+		}
+	}
+
+	return unknownFileCount
+}
+
+// fileCountToString returns the count, or 'an unknown number of' if it is unknownFileCount.
+func fileCountToString(count int) string {
+	if count == unknownFileCount {
+		return "an unknown number of"
+	}
+	return strconv.Itoa(count)
+}
+
+func fileCountFromText(output string, regexes []*regexp.Regexp) int {
+
+	for _, regex := range regexes {
+		if match := regex.FindStringSubmatch(output); match != nil {
+			if count, err := strconv.Atoi(match[1]); err == nil {
+				return count
+			}
+		}
+	}
+
+	return unknownFileCount
+}
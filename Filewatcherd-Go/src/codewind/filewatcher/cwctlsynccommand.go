@@ -0,0 +1,148 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/**
+ * The arguments that the installer is run with to sync a project are described by a template (the SyncCommand of the
+ * CLIConfig, or the CWCTL_SYNC_COMMAND environment variable), so that a renamed subcommand or flag of cwctl (or an
+ * alternative CLI) may be adapted to without rebuilding the filewatcher. The default template is:
+ *
+ *   project sync -p {path} -i {id} -t {timestamp}
+ *
+ * The template is split on whitespace; {path}, {id} and {timestamp} are then replaced by the path, ID, and timestamp
+ * of the sync of the project. Each placeholder must appear exactly once, either as an argument, or within one (for
+ * example, '--path={path}'). The ignore rule and change set arguments (see cwctlcapabilities.go) follow these.
+ *
+ * Syncs that combine multiple projects (see workspacesync.go), and the mock installer, are only supported with the
+ * default template.
+ */
+
+const defaultCwctlSyncCommand = "project sync -p {path} -i {id} -t {timestamp}"
+
+const (
+	syncCommandPathPlaceholder      = "{path}"
+	syncCommandIDPlaceholder        = "{id}"
+	syncCommandTimestampPlaceholder = "{timestamp}"
+)
+
+// syncCommandPlaceholderRegex matches anything that resembles a placeholder, so that misspelled ones are reported
+var syncCommandPlaceholderRegex = regexp.MustCompile(`\{[^{}\s]*\}`)
+
+// cwctlSyncCommand is a parsed template of the sync arguments.
+type cwctlSyncCommand struct {
+	template string
+	args     []string
+}
+
+// parseCwctlSyncCommand returns the parsed template, or an error describing why it is invalid.
+func parseCwctlSyncCommand(template string) (*cwctlSyncCommand, error) {
+
+	args := strings.Fields(template)
+
+	placeholderCounts := map[string]int{}
+	for _, arg := range args {
+		for _, placeholder := range syncCommandPlaceholderRegex.FindAllString(arg, -1) {
+			switch placeholder {
+			case syncCommandPathPlaceholder, syncCommandIDPlaceholder, syncCommandTimestampPlaceholder:
+				placeholderCounts[placeholder]++
+			default:
+				return nil, errors.New("Unknown placeholder " + placeholder + ", expected " + syncCommandPathPlaceholder +
+					", " + syncCommandIDPlaceholder + " or " + syncCommandTimestampPlaceholder)
+			}
+		}
+	}
+
+	for _, placeholder := range []string{syncCommandPathPlaceholder, syncCommandIDPlaceholder, syncCommandTimestampPlaceholder} {
+		if placeholderCounts[placeholder] != 1 {
+			return nil, errors.New("The placeholder " + placeholder + " must appear exactly once, but appears " +
+				strconv.Itoa(placeholderCounts[placeholder]) + " times")
+		}
+	}
+
+	return &cwctlSyncCommand{template, args}, nil
+}
+
+// isDefault returns true if the template is equivalent to the default.
+func (command *cwctlSyncCommand) isDefault() bool {
+	return strings.Join(command.args, " ") == defaultCwctlSyncCommand
+}
+
+// syncArgs returns the arguments of the template, with the placeholders replaced by the given values.
+func (command *cwctlSyncCommand) syncArgs(projectPath string, projectID string, timestamp int64) []string {
+
+	// A single pass, so that placeholders within the values are not themselves replaced
+	replacer := strings.NewReplacer(
+		syncCommandPathPlaceholder, projectPath,
+		syncCommandIDPlaceholder, projectID,
+		syncCommandTimestampPlaceholder, strconv.FormatInt(timestamp, 10))
+
+	result := make([]string, 0, len(command.args))
+	for _, arg := range command.args {
+		result = append(result, replacer.Replace(arg))
+	}
+
+	return result
+}
+
+// subcommand returns the leading arguments that are neither flags nor placeholders (eg 'project sync'); the help of
+// the subcommand is used to determine which arguments it supports.
+func (command *cwctlSyncCommand) subcommand() []string {
+
+	result := []string{}
+	for _, arg := range command.args {
+		if strings.HasPrefix(arg, "-") || syncCommandPlaceholderRegex.MatchString(arg) {
+			break
+		}
+		result = append(result, arg)
+	}
+
+	return result
+}
+
+// flags returns the flag of each placeholder (eg '-p'), that is, the argument preceding it, or the argument containing
+// it (up to the '='); placeholders that are positional arguments have no flag.
+func (command *cwctlSyncCommand) flags() []string {
+
+	result := []string{}
+	for index, arg := range command.args {
+		if !syncCommandPlaceholderRegex.MatchString(arg) {
+			continue
+		}
+
+		if equalsIndex := strings.Index(arg, "="); strings.HasPrefix(arg, "-") && equalsIndex > 0 {
+			result = append(result, arg[:equalsIndex])
+		} else if index > 0 && strings.HasPrefix(command.args[index-1], "-") {
+			result = append(result, command.args[index-1])
+		}
+	}
+
+	return result
+}
+
+// syncCommand returns the parsed SyncCommand of the configuration, or the default if it is invalid (which is reported
+// by validate).
+func (cli CLIConfig) syncCommand() *cwctlSyncCommand {
+
+	if result, err := parseCwctlSyncCommand(cli.SyncCommand); err == nil {
+		return result
+	}
+
+	result, _ := parseCwctlSyncCommand(defaultCwctlSyncCommand)
+	return result
+}
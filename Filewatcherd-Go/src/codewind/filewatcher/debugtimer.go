@@ -9,10 +9,11 @@
 *     IBM Corporation - initial API and implementation
 *******************************************************************************/
 
-package main
+package filewatcher
 
 import (
 	"codewind/utils"
+	"context"
 	"strings"
 	"time"
 )
@@ -25,18 +26,22 @@ import (
  * The goal of this timer is to identify bugs/performance issues that might only
  * be detectable when the workbench is open for long periods of time (memory
  * leaks, resources we aren't closing, etc).
+ *
+ * The timer is stopped when the context is cancelled.
  */
 type DebugTimer struct {
 	watchService    *WatchService
 	projectList     *ProjectList
-	postOutputQueue *HttpPostOutputQueue
+	postOutputQueue *HttpPostOutputQueue // Nil if the filewatcher is not connected to a server
+	ctx             context.Context
 }
 
-func NewDebugTimer(watchService *WatchService, projectList *ProjectList, postOutputQueue *HttpPostOutputQueue) *DebugTimer {
+func NewDebugTimer(ctx context.Context, watchService *WatchService, projectList *ProjectList, postOutputQueue *HttpPostOutputQueue) *DebugTimer {
 	result := &DebugTimer{
 		watchService,
 		projectList,
 		postOutputQueue,
+		ctx,
 	}
 
 	return result
@@ -48,10 +53,13 @@ func (debugTimer *DebugTimer) Start() {
 	// This is intentionally a timer, and not a ticker.
 	timer := time.NewTimer(30 * time.Minute)
 	go func() {
-		for range timer.C {
+		select {
+		case <-timer.C:
 			debugTimer.OutputDebug()
-			return // Exit the goroutine after one invocation, to terminate the thread/channel
+		case <-debugTimer.ctx.Done():
+			timer.Stop()
 		}
+		// Exit the goroutine after one invocation, to terminate the thread/channel
 	}()
 }
 
@@ -66,7 +74,9 @@ func (debugTimer *DebugTimer) OutputDebug() {
 
 	result += "Project List:\n" + strings.TrimSpace(<-debugTimer.projectList.RequestDebugMessage()) + "\n\n"
 
-	result += "HTTP Post Output Queue:\n" + strings.TrimSpace(<-debugTimer.postOutputQueue.RequestDebugMessage()) + "\n\n"
+	if debugTimer.postOutputQueue != nil {
+		result += "HTTP Post Output Queue:\n" + strings.TrimSpace(<-debugTimer.postOutputQueue.RequestDebugMessage()) + "\n\n"
+	}
 
 	result += "---------------------------------------------------------------------------------------\n"
 
@@ -0,0 +1,167 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/utils"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+/**
+ * The embedded HTTP servers (status and pprof) share the same listen address configuration (see ServerConfig), eg for
+ * the status server:
+ *
+ * - StatusAddress (`FILEWATCHER_STATUS_ADDRESS`): the full listen address, as host:port, eg '127.0.0.1:9191',
+ *   '[::1]:9191' (IPv6), or ':9191' (all interfaces).
+ * - Otherwise, StatusPort (`FILEWATCHER_STATUS_PORT`), and optionally StatusHost (`FILEWATCHER_STATUS_HOST`, a host
+ *   name or IP address).
+ *
+ * If no host is specified, the server binds to the loopback interface: IPv4 (127.0.0.1) if available, otherwise IPv6
+ * (::1), so that it also works in IPv6-only environments. The server is started synchronously, so that an invalid
+ * address, or a port that is already in use, is reported on startup.
+ */
+
+// embeddedServerConfig is the listen address configuration of an embedded server.
+type embeddedServerConfig struct {
+	name string // For logging, eg 'status server'
+
+	address string
+	host    string // Optional; "" if not specified, or the server does not have a host setting
+	port    int    // 0 if not specified
+
+	// The settings that the address and port were read from, for error messages
+	addressEnvVar string
+	portEnvVar    string
+}
+
+// loopbackHosts are the hosts that are tried, in order, if no host is specified.
+var loopbackHosts = []string{"127.0.0.1", "::1"}
+
+// resolveEmbeddedServerAddresses returns the addresses that the server should try to listen on (in order, until one
+// succeeds), nil if the server is not enabled, or an error if the configured address is invalid.
+func resolveEmbeddedServerAddresses(config embeddedServerConfig) ([]string, error) {
+
+	host := ""
+	port := 0
+	portEnvVar := config.addressEnvVar // The variable that the port was read from, for error messages
+
+	if address := strings.TrimSpace(config.address); address != "" {
+
+		addressHost, addressPort, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, errors.New(config.addressEnvVar + " must be of the form host:port (eg '127.0.0.1:9191', or '[::1]:9191' for IPv6): " + err.Error())
+		}
+
+		if port, err = strconv.Atoi(addressPort); err != nil {
+			return nil, errors.New(config.addressEnvVar + " has an invalid port: " + addressPort)
+		}
+
+		// An empty host (eg ':9191') explicitly requests all interfaces, so is not replaced by loopback
+		if addressHost == "" {
+			return validateEmbeddedServerPort(config.addressEnvVar, port, []string{address})
+		}
+
+		host = addressHost
+
+	} else {
+		if port = config.port; port <= 0 {
+			return nil, nil
+		}
+		portEnvVar = config.portEnvVar
+
+		host = strings.TrimSpace(config.host)
+	}
+
+	if host != "" {
+		return validateEmbeddedServerPort(portEnvVar, port, []string{net.JoinHostPort(host, strconv.Itoa(port))})
+	}
+
+	result := []string{}
+	for _, loopbackHost := range loopbackHosts {
+		result = append(result, net.JoinHostPort(loopbackHost, strconv.Itoa(port)))
+	}
+
+	return validateEmbeddedServerPort(portEnvVar, port, result)
+}
+
+func validateEmbeddedServerPort(envVar string, port int, addresses []string) ([]string, error) {
+	if port <= 0 || port > 65535 {
+		return nil, errors.New("The port of " + envVar + " must be between 1 and 65535: " + strconv.Itoa(port))
+	}
+	return addresses, nil
+}
+
+// startEmbeddedServer listens on the configured address of the server, and serves requests on a separate goroutine,
+// returning the server so that it may be closed. An error is returned if the address is invalid, or could not be
+// listened on (for example, the port is in use); if the server is not enabled, nothing is done, and nil is returned.
+func startEmbeddedServer(config embeddedServerConfig, handler http.Handler) (*http.Server, error) {
+
+	addresses, err := resolveEmbeddedServerAddresses(config)
+	if err != nil || addresses == nil {
+		return nil, err
+	}
+
+	var listener net.Listener
+
+	for _, address := range addresses {
+		listener, err = net.Listen("tcp", address)
+		if err == nil {
+			break
+		}
+
+		if isAddressInUseError(err) {
+			return nil, errors.New("Unable to start the " + config.name + " on " + address + ", as the port is already in use")
+		}
+
+		// For example, IPv4 is not available, in which case the next loopback address (IPv6) is tried
+		utils.LogWarning("Unable to start the " + config.name + " on " + address + ": " + err.Error())
+	}
+
+	if err != nil {
+		return nil, errors.New("Unable to start the " + config.name + " on " + strings.Join(addresses, " or ") + ": " + err.Error())
+	}
+
+	address := listener.Addr().String()
+
+	server := &http.Server{Handler: handler}
+
+	go func() {
+		utils.LogInfo("Started " + config.name + " on " + address)
+
+		err := server.Serve(listener)
+		if err == http.ErrServerClosed {
+			utils.LogInfo("The " + config.name + " on " + address + " has been closed")
+		} else {
+			utils.LogSevereErr("The "+config.name+" on "+address+" has terminated", err)
+		}
+	}()
+
+	return server, nil
+}
+
+// isAddressInUseError returns true if the error from net.Listen is because another process is listening on the port.
+func isAddressInUseError(err error) bool {
+
+	if opErr, ok := err.(*net.OpError); ok {
+		if syscallErr, ok := opErr.Err.(*os.SyscallError); ok {
+			return syscallErr.Err == syscall.EADDRINUSE
+		}
+	}
+
+	return false
+}
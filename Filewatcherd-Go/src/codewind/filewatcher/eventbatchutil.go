@@ -0,0 +1,703 @@
+/*******************************************************************************
+* Copyright (c) 2019, 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"bytes"
+	"codewind/models"
+	"codewind/utils"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileChangeEventBatchUtil implements an algorithm that groups together changes that occur
+// within X milliseconds of each other.
+//
+// When file/directory change events occur in quick succession (within
+// milliseconds of each other), it tends to imply that they are related. For
+// example, if you were refactoring Java code, that refactoring operation might
+// touch a bunch of source files at once. This means, in order to avoid
+// performing extra builds, we should batch together changes that occur within
+// close temporal proximity.
+//
+// However, we don't want to wait TOO long for new events, otherwise this
+// introduces latency between when the user makes a change, and when their build
+// actually starts.
+//
+// The algorithm is: After at least one event is received, wait for there to be
+// be no more events in the stream of events (within eg 1000 msecs) before
+// sending them to the server. If an event is seen within 1000 msecs, the timer
+// is reset and a new 1000 msec timer begins. Batch together events seen since
+// within a given timeframe, and send them as a single request.
+//
+// This code receives file change events from the watch service, and forwards
+// batched groups of events to the HTTP POST output queue.
+//
+// Each batch is given a correlation ID, which is logged with the batch summary and with the cwctl call that syncs its
+// changes, so that the logs of a change may be followed through to its sync (see syncchangeset.go).
+//
+// To bound memory use during very large bursts of changes (eg a git checkout of a
+// large branch), at most X events (the MaxPendingEvents of the WatchConfig: 100000 by default, or the value
+// of the FILEWATCHER_MAX_PENDING_EVENTS environment variable) are held per project. Once this is
+// exceeded, the individual events are discarded, and a single sync of the entire
+// project is requested once the burst ends.
+//
+// The batch window (1000 msecs in the example above) is the BatchWindow of the WatchConfig: 1000 msecs by default, or
+// the value of the FILEWATCHER_BATCH_WINDOW_MS environment variable. It may be overridden for individual projects by the
+// `batchWindowMs` field of the ProjectToWatch. A shorter window reduces the latency of single-file saves, while a
+// longer one groups more of the changes of a bulk operation into a single batch. Changing the window only affects
+// when a batch ends: batches are always processed one at a time, in the order they were received, and the events
+// of each batch are sorted by timestamp.
+//
+// If the syncs of the project are lagging behind its file changes, the batch window may be widened until they catch up
+// (see synclag.go).
+//
+// When the batch ends, the changes of files that have since grown beyond the maximum file size of the project (if any)
+// are discarded (see oversizedfiles.go).
+//
+// Once a project is no longer watched, Dispose() should be called to stop the listener goroutine of this object; any
+// events of the current batch are discarded.
+type FileChangeEventBatchUtil struct {
+	filesChangesChan       chan []ChangedFileEntry
+	flushChan              chan chan bool
+	debugState_synch_lock  string        // Lock 'lock' before reading/writing this
+	batchWindow_synch_lock time.Duration // Lock 'lock' before reading/writing this
+	projectList            *ProjectList
+	maxPendingEvents       int                  // 0 if there is no limit
+	maxChangesPerChunk     int                  // The maximum number of changes in each POST request to the server
+	oversizedFiles         *oversizedFileFilter // Nullable; shared with the project list
+	lock                   *sync.Mutex
+
+	ctx    context.Context    // Cancelled by Dispose(); this terminates fileChangeListener
+	cancel context.CancelFunc // Cancels ctx
+}
+
+// defaultBatchWindowInMsecs is the batch window used if neither FILEWATCHER_BATCH_WINDOW_MS nor the project set one.
+const defaultBatchWindowInMsecs = 1000
+
+// batchWindowForProject returns the batch window of the project: the value of its batchWindowMs field if set, otherwise
+// the given batch window (the BatchWindow of the WatchConfig).
+func batchWindowForProject(project *models.ProjectToWatch, configBatchWindow time.Duration) time.Duration {
+	if project != nil && project.BatchWindowMs > 0 {
+		return time.Duration(project.BatchWindowMs) * time.Millisecond
+	}
+
+	return configBatchWindow
+}
+
+// NewFileChangeEventBatchUtil ... At most maxPendingEvents (0 for no limit) events are held before the batch overflows.
+// The oversized file filter (which may be nil) removes the changes of files that exceed the maximum size of the project.
+// If the post output queue is non-nil, the changes of each batch are also sent to the server, in chunks of at most
+// maxChangesPerChunk changes.
+func NewFileChangeEventBatchUtil(projectID string, batchWindow time.Duration, maxPendingEvents int, maxChangesPerChunk int, oversizedFiles *oversizedFileFilter, postOutputQueue *HttpPostOutputQueue, projectList *ProjectList) *FileChangeEventBatchUtil {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	result := &FileChangeEventBatchUtil{
+		filesChangesChan:       make(chan []ChangedFileEntry),
+		flushChan:              make(chan chan bool),
+		ctx:                    ctx,
+		cancel:                 cancel,
+		batchWindow_synch_lock: batchWindow,
+		debugState_synch_lock:  "",
+		lock:                   &sync.Mutex{},
+		projectList:            projectList,
+		maxPendingEvents:       maxPendingEvents,
+		maxChangesPerChunk:     maxChangesPerChunk,
+		oversizedFiles:         oversizedFiles,
+	}
+
+	utils.LogInfoProject(projectID, "Batch window for project "+projectID+": "+batchWindow.String())
+
+	go result.fileChangeListener(projectID, postOutputQueue)
+
+	return result
+}
+
+// AddChangedFiles ... The changes are ignored if this object has been disposed.
+func (e *FileChangeEventBatchUtil) AddChangedFiles(changedFileEntries []ChangedFileEntry) {
+	select {
+	case e.filesChangesChan <- changedFileEntries:
+	case <-e.ctx.Done():
+	}
+}
+
+// Dispose stops the listener goroutine of this object, discarding the events of the current batch (if any). It is safe
+// to call this method multiple times.
+func (e *FileChangeEventBatchUtil) Dispose() {
+	e.cancel()
+}
+
+// SetBatchWindow changes the batch window; this applies from the next received event. This method does not block, as
+// it is called by the project list goroutine.
+func (e *FileChangeEventBatchUtil) SetBatchWindow(batchWindow time.Duration) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.batchWindow_synch_lock = batchWindow
+}
+
+func (e *FileChangeEventBatchUtil) getBatchWindow() time.Duration {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.batchWindow_synch_lock
+}
+
+// Flush discards the events of the current batch (if any), without waiting for the batch to end, and returns true if
+// there were any. This is used on shutdown, where the changes are instead synced by a final sync of the project.
+func (e *FileChangeEventBatchUtil) Flush() bool {
+	response := make(chan bool, 1)
+	select {
+	case e.flushChan <- response:
+		return <-response
+	case <-e.ctx.Done():
+		return false
+	}
+}
+
+// RequestDebugMessage ...
+func (e *FileChangeEventBatchUtil) RequestDebugMessage() string {
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.debugState_synch_lock
+}
+
+func (e *FileChangeEventBatchUtil) fileChangeListener(projectID string, postOutputQueue *HttpPostOutputQueue) {
+
+	utils.LogInfoProject(projectID, "EventBatchUtil listener started for "+projectID)
+
+	eventsReceivedSinceLastBatch := []ChangedFileEntry{}
+
+	maxPendingEvents := e.maxPendingEvents
+
+	// Whether more than maxPendingEvents were received in the current batch, and how many were discarded as a result
+	overflowed := false
+	discardedEventCount := 0
+
+	// Each timer sends its generation once it elapses; only the most recent generation ends the batch
+	timerChan := make(chan int)
+	timerGeneration := 0
+
+	debugTimeSinceLastFileChange := time.Now()
+
+	debugTimeSinceLastTimerReceived := time.Now()
+
+	var timer1 *time.Timer
+
+	for {
+
+		select {
+		case <-e.ctx.Done():
+			if timer1 != nil {
+				timer1.Stop()
+			}
+			utils.LogInfoProject(projectID, "EventBatchUtil listener terminated for "+projectID)
+			return
+
+		case generationReceived := <-timerChan:
+
+			// First, update our debug stats
+			debugTimeSinceLastTimerReceived = time.Now()
+			e.updateDebugState(debugTimeSinceLastFileChange, debugTimeSinceLastTimerReceived)
+
+			// Only process a timer elapsed event if the event is for the timer that is currently active (prevent race condition)
+			if timer1 != nil && generationReceived == timerGeneration {
+
+				if overflowed {
+					processOverflowedEvents(discardedEventCount, projectID, e.projectList)
+				} else if len(eventsReceivedSinceLastBatch) > 0 {
+					processAndSendEvents(eventsReceivedSinceLastBatch, projectID, e.oversizedFiles, e.maxChangesPerChunk, postOutputQueue, e.projectList)
+				}
+				eventsReceivedSinceLastBatch = []ChangedFileEntry{}
+				overflowed = false
+				discardedEventCount = 0
+				timer1 = nil
+			}
+
+		case response := <-e.flushChan:
+			response <- overflowed || len(eventsReceivedSinceLastBatch) > 0
+
+			if timer1 != nil {
+				timer1.Stop()
+			}
+			eventsReceivedSinceLastBatch = []ChangedFileEntry{}
+			overflowed = false
+			discardedEventCount = 0
+			timer1 = nil
+
+		case receivedFileChanges := <-e.filesChangesChan:
+			debugTimeSinceLastFileChange = time.Now()
+			e.updateDebugState(debugTimeSinceLastFileChange, debugTimeSinceLastTimerReceived)
+
+			if overflowed {
+				discardedEventCount += len(receivedFileChanges)
+			} else {
+				eventsReceivedSinceLastBatch = append(eventsReceivedSinceLastBatch, receivedFileChanges...)
+
+				if maxPendingEvents > 0 && len(eventsReceivedSinceLastBatch) > maxPendingEvents {
+					utils.LogWarning("More than " + strconv.Itoa(maxPendingEvents) + " file changes are pending for project " + projectID +
+						", so the individual changes will be discarded, and the entire project will be synced once the changes stop.")
+					overflowed = true
+					discardedEventCount = len(eventsReceivedSinceLastBatch)
+					eventsReceivedSinceLastBatch = []ChangedFileEntry{}
+				}
+			}
+
+			if timer1 != nil {
+				timer1.Stop()
+			}
+			// A stopped timer never calls its function, so no goroutine is left waiting for it
+			timerGeneration++
+			generation := timerGeneration
+			batchWindow := e.getBatchWindow() * time.Duration(syncStatusRegistry.batchWindowScale(projectID))
+			timer1 = time.AfterFunc(batchWindow, func() {
+				select {
+				case timerChan <- generation:
+				case <-e.ctx.Done():
+				}
+			})
+		}
+
+	} // end for
+
+}
+
+func (e *FileChangeEventBatchUtil) updateDebugState(debugTimeSinceLastFileChange time.Time, debugTimeSinceLastTimerReceived time.Time) {
+	result := "lastFileChangeSeen: " + utils.FormatTime(debugTimeSinceLastFileChange)
+	result += "   timeSinceLastTimer: " + utils.FormatTime(debugTimeSinceLastTimerReceived) + "\n"
+
+	e.lock.Lock()
+	e.debugState_synch_lock = result
+	e.lock.Unlock()
+}
+
+/** Process the event list, split it into chunks, then pass it to the HTTP POST output queue */
+func processAndSendEvents(eventsToSend []ChangedFileEntry, projectID string, oversizedFiles *oversizedFileFilter, maxChangesPerChunk int, postOutputQueue *HttpPostOutputQueue, projectList *ProjectList) {
+	sort.SliceStable(eventsToSend, func(i, j int) bool {
+
+		// Sort ascending by timestamp
+		return eventsToSend[i].timestamp < eventsToSend[j].timestamp
+
+	})
+
+	// Remove any files that were both created and deleted within the batch (eg editor swap files)
+	eventsToSend = removeTransientPathEvents(eventsToSend, projectID)
+
+	// Remove any contiguous create/delete/modify events
+	eventsToSend = removeDuplicateEventsOfType(eventsToSend, "CREATE", projectID)
+	eventsToSend = removeDuplicateEventsOfType(eventsToSend, "DELETE", projectID)
+	eventsToSend = removeDuplicateEventsOfType(eventsToSend, "MODIFY", projectID)
+
+	// Replace the DELETE and CREATE of each moved file with a RENAME
+	eventsToSend = correlateRenameEvents(eventsToSend, projectID)
+
+	// Remove the changes of files that grew beyond the maximum size after their changes were received
+	eventsToSend = removeOversizedFileEvents(eventsToSend, oversizedFiles)
+
+	if len(eventsToSend) == 0 {
+		return
+	}
+
+	// Split the entries into requests (chunks), to ensure that each request is no larger
+	// then a given size.
+	mostRecentTimestamp := eventsToSend[len(eventsToSend)-1]
+
+	recordExpvarFilesChanged(len(eventsToSend))
+
+	// Logged with the batch, and with the sync of its changes (see syncchangeset.go)
+	correlationID := newCorrelationID()
+
+	changeSummary := generateChangeListSummaryForDebug(eventsToSend)
+	utils.LogInfoFields("Batch change summary for "+projectID+"@ "+strconv.FormatInt(mostRecentTimestamp.timestamp, 10)+": "+changeSummary,
+		map[string]string{"projectID": projectID, "correlationID": correlationID})
+
+	// Inform CLI of changes, including their type, so that deleted files are distinguished from modified ones
+	projectList.CLIFileChangeUpdateWithChanges(projectID, eventsToSend, correlationID)
+
+	// Only projects that are not synced by cwctl have a post output queue, and only if PostChangesToServer is enabled
+	// (see newProjectObject)
+	if postOutputQueue != nil {
+		sendChangesToServer(eventsToSend, projectID, mostRecentTimestamp.timestamp, maxChangesPerChunk, postOutputQueue)
+	}
+
+}
+
+/** Split the changes into chunks, then pass them to the HTTP POST output queue, to be sent in order to the server. */
+func sendChangesToServer(eventsToSend []ChangedFileEntry, projectID string, timestamp int64, maxChangesPerChunk int, postOutputQueue *HttpPostOutputQueue) {
+
+	stringsToSend := encodeChunksForServer(splitIntoChunks(eventsToSend, maxChangesPerChunk))
+
+	utils.LogDebugProject(projectID, "Strings to send "+strconv.Itoa(len(stringsToSend)))
+	if len(stringsToSend) > 0 {
+		postOutputQueue.AddToQueue(projectID, timestamp, stringsToSend)
+	}
+}
+
+// encodeChunksForServer returns the JSON of each chunk, compressed and base64-encoded, in the same order as the chunks.
+func encodeChunksForServer(chunks [][]changedFileEntryJSON) []string {
+
+	var stringsToSend []string
+
+	for _, jsonArray := range chunks {
+		jaString, err := json.Marshal(jsonArray)
+
+		if err != nil {
+			utils.LogSevere("Unable to marshal JSON")
+			continue
+		}
+
+		compressedStr, err := compressAndConvertString(jaString)
+		if err != nil {
+			// We shouldn't ever get an error from compressing or conversion
+			utils.LogSevere("Unable to compress JSON")
+			continue
+		}
+
+		stringsToSend = append(stringsToSend, *compressedStr)
+	}
+
+	return stringsToSend
+}
+
+// splitIntoChunks splits the changes into consecutive chunks of at most maxEntriesPerChunk changes each (the
+// MaxChangesPerChunk of the WatchConfig, which is validated to be positive), preserving their order; no chunks are
+// returned if there are no changes. Each chunk is sent in a separate POST request, with its position and the total
+// number of chunks, so that the server may reassemble them (see HttpPostOutputQueue).
+func splitIntoChunks(entries []ChangedFileEntry, maxEntriesPerChunk int) [][]changedFileEntryJSON {
+
+	result := [][]changedFileEntryJSON{}
+
+	for start := 0; start < len(entries); start += maxEntriesPerChunk {
+		end := start + maxEntriesPerChunk
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		chunk := make([]changedFileEntryJSON, 0, end-start)
+		for _, cfe := range entries[start:end] {
+			chunk = append(chunk, *cfe.toJSON())
+		}
+		result = append(result, chunk)
+	}
+
+	return result
+}
+
+/** Called in place of processAndSendEvents when the batch exceeded the maximum number of pending events. */
+func processOverflowedEvents(discardedEventCount int, projectID string, projectList *ProjectList) {
+
+	recordExpvarFilesChanged(discardedEventCount)
+
+	correlationID := newCorrelationID()
+
+	utils.LogInfoFields("Batch change summary for "+projectID+": [ "+strconv.Itoa(discardedEventCount)+
+		" individual changes were discarded, as the maximum number of pending changes was exceeded; syncing the entire project ]",
+		map[string]string{"projectID": projectID, "correlationID": correlationID})
+
+	// The sync is not limited to the discarded changes: it includes every file changed since the previous sync, so it
+	// supersedes any sync of individual changes that is still running.
+	projectList.CLIFullResyncUpdate(projectID, correlationID)
+}
+
+func generateChangeListSummaryForDebug(eventsToSend []ChangedFileEntry) string {
+	result := "[ "
+
+	for _, val := range eventsToSend {
+
+		if val.eventType == "CREATE" {
+			result += "+"
+		} else if val.eventType == "MODIFY" {
+			result += ">"
+		} else if val.eventType == "DELETE" {
+			result += "-"
+		} else if val.eventType == "RENAME" {
+			result += "~"
+		} else {
+			result += "?" // if you see this, it's a bug ;)
+		}
+
+		filename := val.path
+		index := strings.LastIndex(filename, "/")
+		if index != -1 {
+			filename = filename[(index + 1):]
+		}
+
+		if len(filename) == 0 {
+			filename = "/" // Handle event on the root project directory as "/"
+		}
+
+		result += filename + " "
+
+		// Only output the first 256 chars of changes, to reduce log verbosity
+		if len(result) > 256 {
+			break
+		}
+	}
+
+	if len(result) > 256 {
+		result += " (...) "
+	}
+
+	result += "]"
+
+	return result
+}
+
+/**
+ * For any given path (compared case-insensitively on case-insensitive filesystems): If the first entry for the path is a CREATE, and the last is a DELETE, then the path did not
+ * exist before the batch and does not exist after it, so remove all of its entries. Entries must be sorted by timestamp.
+ */
+func removeTransientPathEvents(entries []ChangedFileEntry, projectID string) []ChangedFileEntry {
+
+	/* path -> event type of the first/last entry for that path */
+	firstEventType := make(map[string]string)
+	lastEventType := make(map[string]string)
+
+	for _, cfe := range entries {
+		path := utils.NormalizePathCase(cfe.path)
+		if _, exists := firstEventType[path]; !exists {
+			firstEventType[path] = cfe.eventType
+		}
+		lastEventType[path] = cfe.eventType
+	}
+
+	result := make([]ChangedFileEntry, 0, len(entries))
+
+	for _, cfe := range entries {
+		path := utils.NormalizePathCase(cfe.path)
+		if firstEventType[path] == "CREATE" && lastEventType[path] == "DELETE" {
+			utils.LogDebugProject(projectID, "Removing transient event: "+cfe.toDebugString())
+			continue
+		}
+		result = append(result, cfe)
+	}
+
+	return result
+}
+
+/**
+ * Where the watcher identified the files of DELETE and CREATE entries (see models.FileIdentity), replace the DELETE of
+ * each path that is followed by a CREATE of the same file at another path with a single RENAME entry (at the position
+ * of the CREATE), so that cwctl may move the file rather than sync it again. For a directory, the CREATE entries of the
+ * files and directories that moved with it (those found within the new directory with the identity that they had within
+ * the old one) are also replaced by the RENAME. A DELETE is not paired if there are any other entries for its path
+ * before the CREATE. Entries must be sorted by timestamp.
+ */
+func correlateRenameEvents(entries []ChangedFileEntry, projectID string) []ChangedFileEntry {
+
+	/* identity -> index of the most recent DELETE of a file with that identity, that is not yet paired */
+	deletesByIdentity := make(map[models.FileIdentity]int)
+	/* path -> index of the most recent DELETE of the path */
+	deletesByPath := make(map[string]int)
+
+	/* index of CREATE -> index of the DELETE with which it was paired */
+	pairedDeletes := make(map[int]int)
+
+	for x, cfe := range entries {
+		path := utils.NormalizePathCase(cfe.path)
+
+		// Any other entry for a deleted path means that it no longer refers to the same file
+		if index, exists := deletesByPath[path]; exists {
+			delete(deletesByPath, path)
+			if identity := entries[index].identity; identity != nil && deletesByIdentity[*identity] == index {
+				delete(deletesByIdentity, *identity)
+			}
+		}
+
+		if cfe.identity == nil {
+			continue
+		}
+
+		if cfe.eventType == "DELETE" {
+			deletesByIdentity[*cfe.identity] = x
+			deletesByPath[path] = x
+
+		} else if cfe.eventType == "CREATE" {
+			if index, exists := deletesByIdentity[*cfe.identity]; exists && entries[index].directory == cfe.directory {
+				pairedDeletes[x] = index
+				delete(deletesByIdentity, *cfe.identity)
+				delete(deletesByPath, utils.NormalizePathCase(entries[index].path))
+			}
+		}
+	}
+
+	if len(pairedDeletes) == 0 {
+		return entries
+	}
+
+	/* index of an entry that is replaced by a RENAME -> value not used */
+	replaced := make(map[int]bool)
+	/* index of the CREATE of a directory -> the paths that moved with it */
+	renamedChildren := make(map[int][]string)
+
+	for createIndex, deleteIndex := range pairedDeletes {
+		replaced[deleteIndex] = true
+
+		childIdentities := entries[deleteIndex].childIdentities
+		if !entries[createIndex].directory || len(childIdentities) == 0 {
+			continue
+		}
+
+		prefix := entries[createIndex].path + "/"
+		for x, cfe := range entries {
+			if cfe.eventType != "CREATE" || cfe.identity == nil || !strings.HasPrefix(cfe.path, prefix) {
+				continue
+			}
+			if _, paired := pairedDeletes[x]; paired {
+				continue
+			}
+			if identity, exists := childIdentities[cfe.path[len(prefix):]]; exists && identity == *cfe.identity {
+				replaced[x] = true
+				renamedChildren[createIndex] = append(renamedChildren[createIndex], cfe.path)
+			}
+		}
+	}
+
+	result := make([]ChangedFileEntry, 0, len(entries))
+
+	for x, cfe := range entries {
+		if replaced[x] {
+			continue
+		}
+
+		if deleteIndex, paired := pairedDeletes[x]; paired {
+			cfe.eventType = "RENAME"
+			cfe.oldPath = entries[deleteIndex].path
+			cfe.renamedChildren = renamedChildren[x]
+			utils.LogDebugProject(projectID, "Replacing DELETE and CREATE with: "+cfe.toDebugString())
+		}
+
+		result = append(result, cfe)
+	}
+
+	return result
+}
+
+/** For any given path: If there are multiple entries of the same type in a row, then remove all but the first. */
+func removeDuplicateEventsOfType(entries []ChangedFileEntry, changeType string, projectID string) []ChangedFileEntry {
+
+	/* path -> value not used */
+	containsPath := make(map[string]bool)
+
+	for x := 0; x < len(entries); x++ {
+		cfe := entries[x]
+
+		// Paths that differ only in case are the same file on case-insensitive filesystems
+		path := utils.NormalizePathCase(cfe.path)
+
+		if cfe.eventType == changeType {
+			_, exists := containsPath[path]
+			if exists {
+				utils.LogDebugProject(projectID, "Removing duplicate event: "+cfe.toDebugString())
+				entries = append(entries[:x], entries[x+1:]...)
+				x--
+			} else {
+				containsPath[path] = true
+			}
+
+		} else {
+			delete(containsPath, path)
+		}
+
+	}
+
+	return entries
+}
+
+func compressAndConvertString(strBytes []byte) (*string, error) {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	_, err := w.Write(strBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	toBase64 := base64.StdEncoding.EncodeToString(b.Bytes())
+
+	return &toBase64, nil
+}
+
+// ChangedFileEntry is a imple representation of a single change: the file/dir path that changed,
+// what type of change, and when. These are then consumed by the batch
+// processing utility.
+type ChangedFileEntry struct {
+	path      string
+	eventType string // CREATE, MODIFY, DELETE, or RENAME (see correlateRenameEvents)
+	timestamp int64
+	directory bool
+
+	identity        *models.FileIdentity           // The identity of the file, if known (see models.FileIdentity)
+	childIdentities map[string]models.FileIdentity // DELETE of a directory only: see models.WatchEventEntry
+
+	oldPath         string   // RENAME only: the path from which the file or directory was moved
+	renamedChildren []string // RENAME of a directory only: the paths of the files and directories that moved with it
+}
+
+type changedFileEntryJSON struct {
+	Path      string `json:"path"`
+	Timestamp int64  `json:"timestamp"`
+	Type      string `json:"type"`
+	Directory bool   `json:"directory"`
+	OldPath   string `json:"oldPath,omitempty"`
+}
+
+func (e *ChangedFileEntry) toJSON() *changedFileEntryJSON {
+
+	return &changedFileEntryJSON{
+		e.path,
+		e.timestamp,
+		e.eventType,
+		e.directory,
+		e.oldPath,
+	}
+}
+
+func (e *ChangedFileEntry) toDebugString() string {
+
+	result := e.path + " " + strconv.FormatInt(e.timestamp, 10) + " " + e.eventType + " " + strconv.FormatBool(e.directory)
+	if e.eventType == "RENAME" {
+		result += " from " + e.oldPath + " (with " + strconv.Itoa(len(e.renamedChildren)) + " children)"
+	}
+
+	return result
+}
+
+// NewChangedFileEntry ...
+func NewChangedFileEntry(path string, eventType string, timestamp int64, directory bool) (*ChangedFileEntry, error) {
+
+	if len(strings.TrimSpace(path)) == 0 || len(strings.TrimSpace(eventType)) == 0 || timestamp <= 0 {
+		return nil, errors.New("Invalid changed entry value: " + path + " " + eventType + " " + strconv.FormatInt(timestamp, 10))
+	}
+
+	return &ChangedFileEntry{
+		path:      path,
+		eventType: eventType,
+		timestamp: timestamp,
+		directory: directory,
+	}, nil
+
+}
@@ -0,0 +1,174 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestChangedFileEntries returns the given number of changes, of the files /0 to /<count-1>.
+func newTestChangedFileEntries(t *testing.T, count int) []ChangedFileEntry {
+	t.Helper()
+
+	result := []ChangedFileEntry{}
+	for index := 0; index < count; index++ {
+		entry, err := NewChangedFileEntry("/"+strconv.Itoa(index), "MODIFY", int64(index+1), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, *entry)
+	}
+	return result
+}
+
+func TestSplitIntoChunks(t *testing.T) {
+	for _, limit := range []int{3, DefaultConfig().Watch.MaxChangesPerChunk} {
+		tests := []struct {
+			count          int
+			expectedChunks int
+		}{
+			{0, 0},
+			{1, 1},
+			{limit - 1, 1},
+			{limit, 1},
+			{limit + 1, 2},
+			{2 * limit, 2},
+		}
+
+		for _, test := range tests {
+			chunks := splitIntoChunks(newTestChangedFileEntries(t, test.count), limit)
+			if len(chunks) != test.expectedChunks {
+				t.Errorf("%d changes, limit %d: expected %d chunks, but got %d", test.count, limit, test.expectedChunks, len(chunks))
+				continue
+			}
+
+			// Every chunk but the last is full, and the changes are in their original order
+			next := 0
+			for index, chunk := range chunks {
+				if len(chunk) == 0 || len(chunk) > limit || (index < len(chunks)-1 && len(chunk) != limit) {
+					t.Errorf("%d changes, limit %d: chunk %d has %d changes", test.count, limit, index, len(chunk))
+				}
+				for _, entry := range chunk {
+					if expected := "/" + strconv.Itoa(next); entry.Path != expected {
+						t.Errorf("%d changes, limit %d: expected %s, but got %s", test.count, limit, expected, entry.Path)
+					}
+					next++
+				}
+			}
+			if next != test.count {
+				t.Errorf("%d changes, limit %d: expected every change to be in a chunk, but got %d", test.count, limit, next)
+			}
+		}
+	}
+}
+
+// decodeChunkForServer reverses encodeChunksForServer.
+func decodeChunkForServer(t *testing.T, encoded string) []changedFileEntryJSON {
+	t.Helper()
+
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result []changedFileEntryJSON
+	if err := json.Unmarshal(contents, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestSendChangesToServerInChunks(t *testing.T) {
+	const limit = 4
+	entries := newTestChangedFileEntries(t, 2*limit+1)
+
+	// The server records the changes of each chunk, by its position
+	lock := &sync.Mutex{}
+	received := map[int]string{}
+	queries := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Msg string `json:"msg"`
+		}
+		contents, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(contents, &body)
+
+		chunk, _ := strconv.Atoi(r.URL.Query().Get("chunk"))
+
+		lock.Lock()
+		received[chunk] = body.Msg
+		queries = append(queries, r.URL.Path+"?"+r.URL.RawQuery)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	postOutputQueue, err := NewHttpPostOutputQueue(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendChangesToServer(entries, "chunked", 1234, limit, postOutputQueue)
+
+	waitFor(t, "each chunk to be sent", func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(received) >= 3
+	})
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	for _, query := range queries {
+		if !strings.HasPrefix(query, "/api/v1/projects/chunked/file-changes?") || !strings.Contains(query, "timestamp=1234") ||
+			!strings.Contains(query, "chunk_total=3") {
+			t.Errorf("Expected each chunk to be sent with the project, timestamp, and number of chunks, but got %s", query)
+		}
+	}
+
+	// Reassembled in order of position, the chunks contain every change, in order
+	reassembled := []changedFileEntryJSON{}
+	for chunk := 1; chunk <= 3; chunk++ {
+		encoded, exists := received[chunk]
+		if !exists {
+			t.Fatalf("Expected chunk %d to be sent, but got %v", chunk, queries)
+		}
+		reassembled = append(reassembled, decodeChunkForServer(t, encoded)...)
+	}
+
+	if len(reassembled) != len(entries) {
+		t.Fatalf("Expected %d changes, but got %d", len(entries), len(reassembled))
+	}
+	for index, entry := range entries {
+		if reassembled[index] != *entry.toJSON() {
+			t.Errorf("Expected change %d to be %+v, but got %+v", index, *entry.toJSON(), reassembled[index])
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"expvar"
+	"sync"
+)
+
+/**
+ * Statistics of the watches and syncs are published with the standard expvar package, under the 'filewatcher' key, so
+ * that they may be monitored without a metrics library (see SyncMetricsRecorder for that). They are returned as JSON by
+ * GET /debug/vars of the status server (see statusserver.go), along with the memory statistics of the Go runtime, eg:
+ *
+ *   curl http://localhost:(port)/debug/vars
+ *
+ * - syncs: the number of completed syncs (excluding those that were cancelled, as the project was no longer watched, or
+ *   a sync of the entire project superseded them).
+ * - syncFailures: the number of those syncs that failed.
+ * - filesChanged: the number of file changes received in batches (including those that were discarded, as there were
+ *   too many to track individually).
+ * - activeSyncs: the number of syncs that are currently running (or waiting for a cwctl process slot).
+ * - watchedProjects: the number of projects that are currently watched.
+ * - queueDepth: the number of events (file changes, sync results, timers) that the CLI states have yet to process.
+ *
+ * The counters are totals since the process started; as with the sync status, they are shared by all watchers in a
+ * process.
+ */
+
+var (
+	expvarStats = expvar.NewMap("filewatcher")
+
+	expvarSyncs        = new(expvar.Int)
+	expvarSyncFailures = new(expvar.Int)
+	expvarFilesChanged = new(expvar.Int)
+
+	// watchedProjectCountsLock must be acquired before reading/writing watchedProjectCounts
+	watchedProjectCountsLock = &sync.Mutex{}
+
+	// The number of projects watched by each project list that has not been shut down
+	watchedProjectCounts = map[*ProjectList]int{}
+)
+
+func init() {
+	expvarStats.Set("syncs", expvarSyncs)
+	expvarStats.Set("syncFailures", expvarSyncFailures)
+	expvarStats.Set("filesChanged", expvarFilesChanged)
+	expvarStats.Set("activeSyncs", expvar.Func(func() interface{} {
+		return syncStatusRegistry.activeSyncCount()
+	}))
+	expvarStats.Set("watchedProjects", expvar.Func(func() interface{} {
+		return getWatchedProjectCount()
+	}))
+	expvarStats.Set("queueDepth", expvar.Func(func() interface{} {
+		return syncStatusRegistry.queueDepth()
+	}))
+}
+
+// recordExpvarSyncResult counts a completed sync, unless it was cancelled.
+func recordExpvarSyncResult(result SyncResult) {
+	if result == SyncResultDisposed || result == SyncResultSuperseded {
+		return
+	}
+
+	expvarSyncs.Add(1)
+	if result != SyncResultSucceeded {
+		expvarSyncFailures.Add(1)
+	}
+}
+
+// recordExpvarFilesChanged counts the file changes of a batch.
+func recordExpvarFilesChanged(count int) {
+	expvarFilesChanged.Add(int64(count))
+}
+
+// setWatchedProjectCount records the number of projects watched by the project list; a negative count removes the
+// project list (for example, once it has been shut down).
+func setWatchedProjectCount(projectList *ProjectList, count int) {
+	watchedProjectCountsLock.Lock()
+	defer watchedProjectCountsLock.Unlock()
+
+	if count < 0 {
+		delete(watchedProjectCounts, projectList)
+	} else {
+		watchedProjectCounts[projectList] = count
+	}
+}
+
+func getWatchedProjectCount() int {
+	watchedProjectCountsLock.Lock()
+	defer watchedProjectCountsLock.Unlock()
+
+	result := 0
+	for _, count := range watchedProjectCounts {
+		result += count
+	}
+	return result
+}
@@ -0,0 +1,133 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"bytes"
+	"codewind/utils"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+/**
+ * If `CWCTL_FAILURE_WEBHOOK_URL` is set, a JSON payload (failureWebhookPayload) is POSTed to that URL when the syncs of a
+ * project fail persistently: each time its circuit breaker opens, and (if `CWCTL_FAILURE_WEBHOOK_THRESHOLD` is greater
+ * than 0) once that many consecutive syncs have failed. This allows teams to be actively notified of failures, rather
+ * than having to monitor the logs or the status server.
+ *
+ * Notifications are sent on a separate goroutine, and are limited by `CWCTL_FAILURE_WEBHOOK_TIMEOUT_MS` (default
+ * 10000), so that a slow or unavailable webhook never delays the syncs. At most maxConcurrentFailureWebhooks are sent
+ * at once; further notifications are dropped (and logged) until one completes. A notification that fails is logged,
+ * but not retried.
+ */
+
+// maxConcurrentFailureWebhooks is the maximum number of webhook notifications that may be in progress at once.
+const maxConcurrentFailureWebhooks = 4
+
+// maxFailureWebhookOutputLength is the maximum number of characters of the end of the sync output that are sent.
+const maxFailureWebhookOutputLength = 2048
+
+// failureWebhookSemaphore contains an entry for each webhook notification that is in progress.
+var failureWebhookSemaphore = make(chan struct{}, maxConcurrentFailureWebhooks)
+
+// failureWebhookPayload is the body of a webhook notification.
+type failureWebhookPayload struct {
+	ProjectID string `json:"projectID"`
+
+	// 'circuitBreakerOpened', or 'consecutiveFailures' if the failure threshold of the webhook was reached.
+	Reason string `json:"reason"`
+
+	// The kind of failure of the most recent sync (as for the LastErrorKind of the sync status), and its exit code.
+	Error    string `json:"error"`
+	ExitCode int    `json:"exitCode"`
+
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+
+	// The last maxFailureWebhookOutputLength characters of the output of the most recent sync.
+	OutputTail string `json:"outputTail"`
+
+	// When the most recent sync failed, in absolute msecs.
+	Timestamp int64 `json:"timestamp"`
+}
+
+// failureWebhookReason returns the reason that a webhook notification should be sent after a failed sync, or "" if none
+// should be sent: the circuit breaker has just opened, or the failure threshold of the webhook has just been reached.
+func failureWebhookReason(config CLIConfig, consecutiveFailures int, circuitOpened bool) string {
+	if config.FailureWebhookURL == "" {
+		return ""
+	}
+
+	if circuitOpened {
+		return "circuitBreakerOpened"
+	} else if config.FailureWebhookThreshold > 0 && consecutiveFailures == config.FailureWebhookThreshold {
+		return "consecutiveFailures"
+	}
+	return ""
+}
+
+// sendFailureWebhook POSTs the payload to the webhook on a separate goroutine, returning immediately; if too many
+// notifications are already in progress, the payload is dropped.
+func sendFailureWebhook(config CLIConfig, payload failureWebhookPayload) {
+
+	if len(payload.OutputTail) > maxFailureWebhookOutputLength {
+		payload.OutputTail = "..." + payload.OutputTail[len(payload.OutputTail)-maxFailureWebhookOutputLength:]
+	}
+
+	select {
+	case failureWebhookSemaphore <- struct{}{}:
+	default:
+		utils.LogWarning("Unable to send the failure webhook notification for project " + payload.ProjectID +
+			", as too many notifications are already in progress")
+		return
+	}
+
+	go func() {
+		defer func() { <-failureWebhookSemaphore }()
+
+		if err := postFailureWebhook(config, payload); err != nil {
+			utils.LogErrorErr("Unable to send the failure webhook notification for project "+payload.ProjectID, err)
+		} else {
+			utils.LogInfo("Sent the failure webhook notification for project " + payload.ProjectID + " (" + payload.Reason + ")")
+		}
+	}()
+}
+
+// postFailureWebhook POSTs the payload to the webhook, returning an error if it could not be sent, or a non-2xx status
+// code was returned.
+func postFailureWebhook(config CLIConfig, payload failureWebhookPayload) error {
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: config.FailureWebhookTimeout}
+
+	resp, err := client.Post(config.FailureWebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Read (and discard) the body, so that the connection may be reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("Unexpected status code from the webhook: " + strconv.Itoa(resp.StatusCode))
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// webhookRecorder is a webhook that records each notification it receives, and responds with the given status code.
+type webhookRecorder struct {
+	server        *httptest.Server
+	notifications chan *http.Request
+	payloads      chan failureWebhookPayload
+}
+
+func newWebhookRecorder(t *testing.T, statusCode int) *webhookRecorder {
+	t.Helper()
+
+	recorder := &webhookRecorder{
+		notifications: make(chan *http.Request, 10),
+		payloads:      make(chan failureWebhookPayload, 10),
+	}
+
+	recorder.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload failureWebhookPayload
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &payload)
+
+		recorder.notifications <- r
+		recorder.payloads <- payload
+		w.WriteHeader(statusCode)
+	}))
+
+	return recorder
+}
+
+// next waits for the next notification, returning its request and payload.
+func (recorder *webhookRecorder) next(t *testing.T) (*http.Request, failureWebhookPayload) {
+	t.Helper()
+
+	select {
+	case request := <-recorder.notifications:
+		return request, <-recorder.payloads
+	case <-time.After(mockCwctlTimeout):
+		t.Fatal("Timed out waiting for a webhook notification")
+		return nil, failureWebhookPayload{}
+	}
+}
+
+func TestFailureWebhookPayload(t *testing.T) {
+	defer replaceRetryBackoff(1, 1)()
+
+	webhook := newWebhookRecorder(t, http.StatusOK)
+	defer webhook.server.Close()
+
+	mock := newMockCwctl(t, 3, 3, 3)
+	defer mock.cleanup()
+
+	config := mock.config(t)
+	config.FailureWebhookURL = webhook.server.URL
+	config.FailureWebhookThreshold = 2
+
+	results := newResultRecorder()
+	state := mock.newCLIState(t, config, realClock{}, results.listener)
+	defer state.Dispose()
+
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+
+	if err := state.OnFileChangeEvent(0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The notification is sent once the threshold is reached: on the second failure, but not the first or third
+	first, second := results.next(t), results.next(t)
+	if first != second {
+		t.Fatalf("Expected both syncs to fail in the same way, but got %v and %v", first, second)
+	}
+
+	request, payload := webhook.next(t)
+
+	if request.Method != http.MethodPost {
+		t.Errorf("Expected a POST, but got a %s", request.Method)
+	}
+	if contentType := request.Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected a JSON payload, but the content type was %q", contentType)
+	}
+
+	expected := failureWebhookPayload{
+		ProjectID:           state.projectID,
+		Reason:              "consecutiveFailures",
+		Error:               second.String(),
+		ExitCode:            3,
+		ConsecutiveFailures: 2,
+		Timestamp:           payload.Timestamp,
+	}
+	if payload != expected {
+		t.Errorf("Expected the payload %+v, but got %+v", expected, payload)
+	}
+	if payload.Timestamp < before || payload.Timestamp > time.Now().UnixNano()/int64(time.Millisecond) {
+		t.Errorf("Expected the timestamp to be the time of the failure, but got %d", payload.Timestamp)
+	}
+
+	results.next(t)
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-webhook.notifications:
+		t.Fatalf("Expected a single notification, but got another: %+v", <-webhook.payloads)
+	default:
+	}
+}
+
+func TestFailureWebhookTruncatesOutput(t *testing.T) {
+	webhook := newWebhookRecorder(t, http.StatusOK)
+	defer webhook.server.Close()
+
+	config := DefaultConfig().CLI
+	config.FailureWebhookURL = webhook.server.URL
+
+	output := strings.Repeat("a", maxFailureWebhookOutputLength) + strings.Repeat("b", maxFailureWebhookOutputLength)
+	sendFailureWebhook(config, failureWebhookPayload{ProjectID: "truncated", Reason: "circuitBreakerOpened", OutputTail: output})
+
+	_, payload := webhook.next(t)
+	if expected := "..." + strings.Repeat("b", maxFailureWebhookOutputLength); payload.OutputTail != expected {
+		t.Errorf("Expected the output to be truncated to its last %d characters, but got %d characters", maxFailureWebhookOutputLength, len(payload.OutputTail))
+	}
+	if payload.ProjectID != "truncated" || payload.Reason != "circuitBreakerOpened" {
+		t.Errorf("Expected the other fields to be sent unchanged, but got %+v", payload)
+	}
+}
+
+func TestPostFailureWebhookReportsErrorStatus(t *testing.T) {
+	for _, statusCode := range []int{http.StatusOK, http.StatusNoContent, http.StatusNotFound, http.StatusInternalServerError} {
+		webhook := newWebhookRecorder(t, statusCode)
+
+		config := DefaultConfig().CLI
+		config.FailureWebhookURL = webhook.server.URL
+
+		err := postFailureWebhook(config, failureWebhookPayload{ProjectID: "status"})
+		if success := statusCode < 300; success != (err == nil) {
+			t.Errorf("Status code %d: expected success to be %v, but got the error: %v", statusCode, success, err)
+		}
+
+		webhook.server.Close()
+	}
+}
+
+func TestFailureWebhookReason(t *testing.T) {
+	config := DefaultConfig().CLI
+	config.FailureWebhookThreshold = 3
+
+	if reason := failureWebhookReason(config, 3, true); reason != "" {
+		t.Errorf("Expected no notification without a webhook URL, but got %q", reason)
+	}
+
+	config.FailureWebhookURL = "http://localhost/webhook"
+
+	tests := []struct {
+		consecutiveFailures int
+		circuitOpened       bool
+		expected            string
+	}{
+		{1, false, ""},
+		{2, false, ""},
+		{3, false, "consecutiveFailures"},
+		{4, false, ""},
+		{1, true, "circuitBreakerOpened"},
+		{3, true, "circuitBreakerOpened"},
+	}
+
+	for _, test := range tests {
+		if actual := failureWebhookReason(config, test.consecutiveFailures, test.circuitOpened); actual != test.expected {
+			t.Errorf("failureWebhookReason(%d, %v) = %q, expected %q", test.consecutiveFailures, test.circuitOpened, actual, test.expected)
+		}
+	}
+
+	config.FailureWebhookThreshold = 0
+	if reason := failureWebhookReason(config, 3, false); reason != "" {
+		t.Errorf("Expected no notification for consecutive failures with a threshold of 0, but got %q", reason)
+	}
+}
@@ -0,0 +1,100 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only changes when advanced by the test, so that timers fire deterministically.
+type fakeClock struct {
+	lock    *sync.Mutex
+	now     time.Time
+	waiters []*fakeClockWaiter
+}
+
+// fakeClockWaiter is a channel returned by After, which has not yet fired.
+type fakeClockWaiter struct {
+	deadline time.Time
+	duration time.Duration
+	channel  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{lock: &sync.Mutex{}, now: now}
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	return clock.now
+}
+
+func (clock *fakeClock) After(d time.Duration) <-chan time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	waiter := &fakeClockWaiter{deadline: clock.now.Add(d), duration: d, channel: make(chan time.Time, 1)}
+	if d <= 0 {
+		waiter.channel <- clock.now
+	} else {
+		clock.waiters = append(clock.waiters, waiter)
+	}
+	return waiter.channel
+}
+
+// Advance moves the time forward, firing each waiter whose deadline has been reached.
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	clock.now = clock.now.Add(d)
+
+	remaining := []*fakeClockWaiter{}
+	for _, waiter := range clock.waiters {
+		if waiter.deadline.After(clock.now) {
+			remaining = append(remaining, waiter)
+		} else {
+			waiter.channel <- clock.now
+		}
+	}
+	clock.waiters = remaining
+}
+
+// pendingDurations returns the duration of each waiter that has not yet fired, in the order they were created.
+func (clock *fakeClock) pendingDurations() []time.Duration {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	result := []time.Duration{}
+	for _, waiter := range clock.waiters {
+		result = append(result, waiter.duration)
+	}
+	return result
+}
+
+// waitForWaiter waits for a waiter of the given duration to be created (and not yet fired).
+func (clock *fakeClock) waitForWaiter(t *testing.T, d time.Duration) {
+	t.Helper()
+
+	waitFor(t, "a timer of "+d.String(), func() bool {
+		for _, duration := range clock.pendingDurations() {
+			if duration == d {
+				return true
+			}
+		}
+		return false
+	})
+}
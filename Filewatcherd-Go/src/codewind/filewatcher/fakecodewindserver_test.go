@@ -0,0 +1,395 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+/**
+ * fakeCodewindServer is an in-process stand-in for the Codewind server (the HTTP API, the file-changes WebSocket, and
+ * an OAuth2 token endpoint), for tests of the resilience of the filewatcher: WebSocket reconnection, token refresh,
+ * and reconciliation of the project list (see ws_test.go and auth_test.go).
+ *
+ * The server may be scripted to drop WebSocket connections (without a close frame), to reject requests (eg with 401
+ * or 503), to require a specific bearer token, and to push project watch changes over the WebSocket. The requests that
+ * it receives are recorded, so that tests may wait for (and assert on) the behaviour of the filewatcher.
+ *
+ * The Java integration tests (Tests/FilewatcherTests) remain the end-to-end tests of the filewatcher; this server
+ * allows individual components to be tested deterministically.
+ */
+type fakeCodewindServer struct {
+	server *httptest.Server
+
+	lock *sync.Mutex
+
+	// All of the following fields are protected by 'lock'; 'cond' is signalled whenever any of them change.
+	cond *sync.Cond
+
+	projects_synch_lock []models.ProjectToWatch // Returned by GET /api/v1/projects/watchlist
+
+	connections_synch_lock     []*websocket.Conn // The open WebSocket connections
+	connectionCount_synch_lock int               // The total number of WebSocket connections accepted
+
+	// If non-empty, requests without this bearer token are rejected with 401.
+	requiredToken_synch_lock string
+
+	// The next N requests (of any kind, including WebSocket upgrades and token requests) are rejected with the status code.
+	rejectedRequestCount_synch_lock int
+	rejectedStatusCode_synch_lock   int
+
+	// The access tokens returned by the token endpoint, in order; the last is repeated once the others are used.
+	issuedTokens_synch_lock []string
+
+	requests_synch_lock []fakeServerRequest // Every request received, in order
+}
+
+// fakeServerRequest is a request received by the fakeCodewindServer.
+type fakeServerRequest struct {
+	method     string
+	path       string // Excluding the query
+	query      string
+	token      string // The bearer token of the request, if any
+	statusCode int    // The status code of the response
+	body       []byte
+}
+
+const (
+	fakeServerWatchlistPath = "/api/v1/projects/watchlist"
+	fakeServerProjectsPath  = "/api/v1/projects/"
+	fakeServerWebSocketPath = "/websockets/file-changes/v1"
+	fakeServerTokenPath     = "/token"
+)
+
+// newFakeCodewindServer starts a fake server, with an empty project list; close() must be called once the test
+// has completed.
+func newFakeCodewindServer() *fakeCodewindServer {
+
+	result := &fakeCodewindServer{
+		lock:                &sync.Mutex{},
+		projects_synch_lock: []models.ProjectToWatch{},
+	}
+	result.cond = sync.NewCond(result.lock)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(fakeServerWatchlistPath, result.handleWatchlistRequest)
+	mux.HandleFunc(fakeServerProjectsPath, result.handleProjectRequest)
+	mux.HandleFunc(fakeServerWebSocketPath, result.handleWebSocketRequest)
+	mux.HandleFunc(fakeServerTokenPath, result.handleTokenRequest)
+
+	result.server = httptest.NewServer(mux)
+
+	return result
+}
+
+// url returns the base URL of the server (eg 'http://127.0.0.1:12345'), as passed to the filewatcher.
+func (fake *fakeCodewindServer) url() string {
+	return fake.server.URL
+}
+
+// tokenEndpointURL returns the URL of the token endpoint, for the authTokenEndpoint setting of the ServerConfig.
+func (fake *fakeCodewindServer) tokenEndpointURL() string {
+	return fake.server.URL + fakeServerTokenPath
+}
+
+// close closes all WebSocket connections, and stops the server.
+func (fake *fakeCodewindServer) close() {
+	fake.dropConnections()
+	fake.server.Close()
+}
+
+// setProjects replaces the project list that is returned by the watchlist GET request.
+func (fake *fakeCodewindServer) setProjects(projects []models.ProjectToWatch) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	fake.projects_synch_lock = append([]models.ProjectToWatch{}, projects...)
+	fake.cond.Broadcast()
+}
+
+// pushProjectChanges sends a watch change message, containing the projects, to every open WebSocket connection; the
+// project list is not updated (see setProjects). Returns the number of connections the message was written to.
+func (fake *fakeCodewindServer) pushProjectChanges(projects []models.ProjectToWatch) int {
+
+	message, err := json.Marshal(models.WatchChangeJson{Type: "watchChanged", Projects: projects})
+	if err != nil {
+		panic(err)
+	}
+
+	return fake.pushMessage(message)
+}
+
+// pushMessage sends the raw message to every open WebSocket connection, for example to test malformed messages.
+func (fake *fakeCodewindServer) pushMessage(message []byte) int {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	written := 0
+	for _, conn := range fake.connections_synch_lock {
+		// The lock also serializes writes to each connection, as required by gorilla/websocket
+		if err := conn.WriteMessage(websocket.TextMessage, message); err == nil {
+			written++
+		}
+	}
+
+	return written
+}
+
+// dropConnections abruptly closes every open WebSocket connection, without a close frame, as happens when the
+// network fails or the server is restarted.
+func (fake *fakeCodewindServer) dropConnections() {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	for _, conn := range fake.connections_synch_lock {
+		conn.UnderlyingConn().Close()
+	}
+	fake.connections_synch_lock = nil
+	fake.cond.Broadcast()
+}
+
+// rejectNextRequests rejects the next 'count' requests with the status code (for example, 401 or 503).
+func (fake *fakeCodewindServer) rejectNextRequests(count int, statusCode int) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	fake.rejectedRequestCount_synch_lock = count
+	fake.rejectedStatusCode_synch_lock = statusCode
+}
+
+// requireToken rejects (with 401) any request that does not have the bearer token; "" accepts any request.
+func (fake *fakeCodewindServer) requireToken(token string) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	fake.requiredToken_synch_lock = token
+}
+
+// issueTokens sets the access tokens that are returned by the token endpoint, in order.
+func (fake *fakeCodewindServer) issueTokens(tokens ...string) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	fake.issuedTokens_synch_lock = append([]string{}, tokens...)
+}
+
+// requests returns a copy of the requests received so far, optionally filtered by path prefix ("" for all).
+func (fake *fakeCodewindServer) requests(pathPrefix string) []fakeServerRequest {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	return fake.filterRequests(pathPrefix)
+}
+
+// filterRequests is the same as requests(); the caller must hold the lock.
+func (fake *fakeCodewindServer) filterRequests(pathPrefix string) []fakeServerRequest {
+	result := []fakeServerRequest{}
+	for _, request := range fake.requests_synch_lock {
+		if strings.HasPrefix(request.path, pathPrefix) {
+			result = append(result, request)
+		}
+	}
+	return result
+}
+
+// waitForRequests waits until at least 'count' requests with the path prefix have been received, and returns false if
+// the timeout elapsed first.
+func (fake *fakeCodewindServer) waitForRequests(pathPrefix string, count int, timeout time.Duration) bool {
+	return fake.waitFor(timeout, func() bool {
+		return len(fake.filterRequests(pathPrefix)) >= count
+	})
+}
+
+// waitForConnections waits until the server has accepted at least 'count' WebSocket connections in total (including
+// those that have since been dropped), and returns false if the timeout elapsed first.
+func (fake *fakeCodewindServer) waitForConnections(count int, timeout time.Duration) bool {
+	return fake.waitFor(timeout, func() bool {
+		return fake.connectionCount_synch_lock >= count
+	})
+}
+
+// waitFor waits until the condition (which is called with the lock held) is true, or the timeout elapses.
+func (fake *fakeCodewindServer) waitFor(timeout time.Duration, condition func() bool) bool {
+
+	// Wake the waiter once the timeout has elapsed, as sync.Cond has no timed wait
+	timer := time.AfterFunc(timeout, func() {
+		fake.lock.Lock()
+		defer fake.lock.Unlock()
+		fake.cond.Broadcast()
+	})
+	defer timer.Stop()
+
+	deadline := time.Now().Add(timeout)
+
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	for !condition() {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		fake.cond.Wait()
+	}
+
+	return true
+}
+
+// recordRequest records the request, and returns the status code with which it should be rejected (0 to accept it).
+func (fake *fakeCodewindServer) recordRequest(r *http.Request, body []byte, checkToken bool) int {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	statusCode := 0
+	if fake.rejectedRequestCount_synch_lock > 0 {
+		fake.rejectedRequestCount_synch_lock--
+		statusCode = fake.rejectedStatusCode_synch_lock
+	} else if checkToken && fake.requiredToken_synch_lock != "" && token != fake.requiredToken_synch_lock {
+		statusCode = http.StatusUnauthorized
+	}
+
+	recordedStatusCode := statusCode
+	if recordedStatusCode == 0 {
+		recordedStatusCode = http.StatusOK
+	}
+
+	fake.requests_synch_lock = append(fake.requests_synch_lock, fakeServerRequest{
+		method:     r.Method,
+		path:       r.URL.Path,
+		query:      r.URL.RawQuery,
+		token:      token,
+		statusCode: recordedStatusCode,
+		body:       body,
+	})
+	fake.cond.Broadcast()
+
+	return statusCode
+}
+
+func (fake *fakeCodewindServer) handleWatchlistRequest(w http.ResponseWriter, r *http.Request) {
+
+	if statusCode := fake.recordRequest(r, nil, true); statusCode != 0 {
+		w.WriteHeader(statusCode)
+		return
+	}
+
+	fake.lock.Lock()
+	body, err := json.Marshal(models.WatchlistEntryList{Projects: fake.projects_synch_lock})
+	fake.lock.Unlock()
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// handleProjectRequest accepts the file change POST requests, and the watch status PUT requests, of each project.
+func (fake *fakeCodewindServer) handleProjectRequest(w http.ResponseWriter, r *http.Request) {
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	if statusCode := fake.recordRequest(r, body, true); statusCode != 0 {
+		w.WriteHeader(statusCode)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (fake *fakeCodewindServer) handleWebSocketRequest(w http.ResponseWriter, r *http.Request) {
+
+	if statusCode := fake.recordRequest(r, nil, true); statusCode != 0 {
+		w.WriteHeader(statusCode)
+		return
+	}
+
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	fake.lock.Lock()
+	fake.connections_synch_lock = append(fake.connections_synch_lock, conn)
+	fake.connectionCount_synch_lock++
+	fake.cond.Broadcast()
+	fake.lock.Unlock()
+
+	// Messages from the filewatcher (keep-alives) are discarded; reading is also required for pings to be answered.
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				fake.removeConnection(conn)
+				return
+			}
+		}
+	}()
+}
+
+func (fake *fakeCodewindServer) removeConnection(conn *websocket.Conn) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	for index, curr := range fake.connections_synch_lock {
+		if curr == conn {
+			fake.connections_synch_lock = append(fake.connections_synch_lock[:index], fake.connections_synch_lock[index+1:]...)
+			break
+		}
+	}
+	conn.Close()
+	fake.cond.Broadcast()
+}
+
+// handleTokenRequest implements the refresh token grant of an OAuth2 token endpoint, returning the issued tokens in order.
+func (fake *fakeCodewindServer) handleTokenRequest(w http.ResponseWriter, r *http.Request) {
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	// Token requests do not have a bearer token
+	if statusCode := fake.recordRequest(r, body, false); statusCode != 0 {
+		w.WriteHeader(statusCode)
+		return
+	}
+
+	fake.lock.Lock()
+	token := ""
+	if len(fake.issuedTokens_synch_lock) > 0 {
+		token = fake.issuedTokens_synch_lock[0]
+		if len(fake.issuedTokens_synch_lock) > 1 {
+			fake.issuedTokens_synch_lock = fake.issuedTokens_synch_lock[1:]
+		}
+	}
+	fake.lock.Unlock()
+
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	responseBody, _ := json.Marshal(tokenEndpointResponse{AccessToken: token})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseBody)
+}
@@ -0,0 +1,122 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"sync"
+)
+
+/**
+ * The changes of the files within a watched project root are detected by a FileEventSource: either from the file
+ * system events of the OS (nativeEventSource, see fsnotify.go), or by polling the project tree (pollingEventSource, see
+ * pollingwatcher.go). A source reports each change as a watch event entry on its Events channel, from which it is
+ * forwarded to the project list to be filtered and batched (see forwardFileEvents). The rest of the pipeline does not
+ * depend on how the changes were detected, so it may equally be driven by another source (for example, a fake source
+ * in a test).
+ *
+ * The sources of a project root are started by its CodewindWatcher (see startWatcher), and are stopped when the
+ * watcher is closed. More than one source may run for the same root: if the native events of a root turn out to be
+ * unreliable, the root is polled as well, and the native events are ignored from then on (see startPollingFallback).
+ */
+type FileEventSource interface {
+	// Start establishes the watch (for example, by walking the project root), and begins to detect changes. If an
+	// error is returned, the watch could not be established, and the source has been stopped.
+	Start() error
+
+	// Stop stops detecting changes; the Events channel is closed once no further events will be sent. This does not
+	// block, and may be called multiple times.
+	Stop()
+
+	// Events returns the channel that receives each change that is detected, in the order it was detected.
+	Events() <-chan *models.WatchEventEntry
+}
+
+// fileEventChannel is the Events channel of a FileEventSource, and whether the source has been stopped. Events must
+// only be sent by a single goroutine of the source, which closes the channel once it has sent its last event.
+type fileEventChannel struct {
+	events   chan *models.WatchEventEntry
+	stopped  chan struct{} // Closed by stop()
+	stopOnce *sync.Once
+}
+
+func newFileEventChannel() fileEventChannel {
+	return fileEventChannel{
+		events:   make(chan *models.WatchEventEntry),
+		stopped:  make(chan struct{}),
+		stopOnce: &sync.Once{},
+	}
+}
+
+func (channel fileEventChannel) Events() <-chan *models.WatchEventEntry {
+	return channel.events
+}
+
+// send waits for the event to be received, returning false (without sending it) if the source is stopped first.
+func (channel fileEventChannel) send(entry *models.WatchEventEntry) bool {
+	select {
+	case channel.events <- entry:
+		return true
+	case <-channel.stopped:
+		return false
+	}
+}
+
+// stop marks the source as stopped, returning true if it was not already stopped.
+func (channel fileEventChannel) stop() bool {
+	result := false
+	channel.stopOnce.Do(func() {
+		close(channel.stopped)
+		result = true
+	})
+	return result
+}
+
+func (channel fileEventChannel) isStopped() bool {
+	select {
+	case <-channel.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeEvents is called by the goroutine that sends the events, once it will send no more.
+func (channel fileEventChannel) closeEvents() {
+	close(channel.events)
+}
+
+// startFileEventSource starts the source for the watcher of a project root, and forwards its events to the project
+// list until it is stopped, which happens when the watcher is closed.
+func startFileEventSource(source FileEventSource, cWatcher *CodewindWatcher, project *models.ProjectToWatch, projectList *ProjectList) error {
+
+	if err := source.Start(); err != nil {
+		return err
+	}
+
+	if !cWatcher.addEventSource(source) {
+		// The watcher was closed while the source was starting
+		source.Stop()
+		return nil
+	}
+
+	go forwardFileEvents(source, project, projectList)
+
+	return nil
+}
+
+// forwardFileEvents passes each event of the source to the project list, until the Events channel is closed.
+func forwardFileEvents(source FileEventSource, project *models.ProjectToWatch, projectList *ProjectList) {
+	for entry := range source.Events() {
+		projectList.ReceiveNewWatchEventEntries(entry, project)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+// +build !windows
+
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"os"
+	"syscall"
+)
+
+// getFileIdentity returns the device and inode of the file, and its size (if it is not a directory), or nil if these
+// are not available.
+func getFileIdentity(info os.FileInfo) *models.FileIdentity {
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat == nil {
+		return nil
+	}
+
+	result := &models.FileIdentity{
+		Device: uint64(stat.Dev),
+		Inode:  uint64(stat.Ino),
+	}
+
+	if !info.IsDir() {
+		result.Size = info.Size()
+	}
+
+	return result
+}
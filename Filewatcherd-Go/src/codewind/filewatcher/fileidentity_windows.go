@@ -0,0 +1,24 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"os"
+)
+
+// getFileIdentity always returns nil on Windows: the file index is only available from an open handle of the file
+// (rather than from the results of a directory listing), so moved files are instead reported as a DELETE of the old
+// path and a CREATE of the new one.
+func getFileIdentity(info os.FileInfo) *models.FileIdentity {
+	return nil
+}
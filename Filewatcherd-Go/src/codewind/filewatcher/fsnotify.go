@@ -0,0 +1,1579 @@
+/*******************************************************************************
+* Copyright (c) 2019, 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"bytes"
+	"codewind/models"
+	"codewind/utils"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+/**
+ * The WatchService class uses the directory/file monitoring functionality of the 3rd party
+ * fsnotify go library for file monitoring.
+ *
+ * The changes of each project root are detected by a FileEventSource (see fileeventsource.go): nativeEventSource
+ * (below) for the file system events of the OS, or pollingEventSource if the root is polled (see pollingwatcher.go).
+ *
+ * (Add/Remove)RootPath are called by the ProjectList goroutine whenever a new directory needs to be
+ * monitored, or no longer needs to be monitored, or the filters have changed.
+ *
+ * These requests are converted into channel messages and passed to the internal goroutine to ensure
+ * thread safety.
+ */
+type WatchService struct {
+	watchServiceChannel chan *WatchServiceChannelMessage
+	clientUUID          string
+	config              WatchConfig // Immutable; includes the symlink mode, watch mode, and whether to run the watch self-test
+}
+
+// SymlinkMode determines how symbolic links within a watched project are handled, and is set by the SymlinkMode of the
+// WatchConfig, from the `FILEWATCHER_SYMLINK_MODE` environment variable (one of: file, follow, ignore).
+type SymlinkMode int
+
+const (
+	// SymlinkModeFile reports changes to the links themselves, but does not watch the directories they point to (the default).
+	SymlinkModeFile SymlinkMode = iota + 1
+
+	// SymlinkModeFollow watches the directories that links point to. Each directory is only watched once per
+	// watched root (by real path), which prevents infinite recursion when links form a cycle.
+	SymlinkModeFollow
+
+	// SymlinkModeIgnore ignores links entirely: they are not followed, and changes to them are not reported.
+	SymlinkModeIgnore
+)
+
+func (mode SymlinkMode) String() string {
+	switch mode {
+	case SymlinkModeFile:
+		return "file"
+	case SymlinkModeFollow:
+		return "follow"
+	case SymlinkModeIgnore:
+		return "ignore"
+	}
+	return "unknown"
+}
+
+// parseSymlinkMode returns the mode with the given name (see String()), or false if the name is not recognized.
+func parseSymlinkMode(value string) (SymlinkMode, bool) {
+	for _, mode := range []SymlinkMode{SymlinkModeFile, SymlinkModeFollow, SymlinkModeIgnore} {
+		if strings.EqualFold(strings.TrimSpace(value), mode.String()) {
+			return mode, true
+		}
+	}
+	return 0, false
+}
+
+/** Only one of the fields of this struct should be non-nil per instance */
+type WatchServiceChannelMessage struct {
+	addOrRemove         *AddRemoveRootPathChannelMessage
+	directoryWaitResult *WatchDirectoryWaitResultMessage
+	debugMessage        *FsNotifyDebugMessage
+	rootDeleted         *WatchRootDeletedMessage
+	watchDetails        chan map[string]*ProjectWatchDetails // Receives the watch state of each project (see GetWatchDetails)
+	dispose             bool                                 // Close the watchers of all projects (see Dispose)
+}
+
+type FsNotifyDebugMessage struct {
+	responseChannel chan string
+}
+
+type AddRemoveRootPathChannelMessage struct {
+	isAdd   bool
+	path    string
+	project *models.ProjectToWatch
+	debug   string
+}
+
+type WatchDirectoryWaitResultMessage struct {
+	path      string
+	project   *models.ProjectToWatch
+	success   bool
+	watcherID string // The watcher that was waiting; the result is ignored if it has since been replaced
+}
+
+/** Sent by a watcher when the root directory of its project no longer exists. */
+type WatchRootDeletedMessage struct {
+	project   *models.ProjectToWatch
+	watcherID string
+}
+
+func NewWatchService(projectList *ProjectList, baseUrl string, clientUUID string, config WatchConfig) *WatchService {
+
+	result := &WatchService{
+		make(chan *WatchServiceChannelMessage),
+		clientUUID,
+		config,
+	}
+
+	go watchServiceEventLoop(result, projectList, baseUrl)
+
+	return result
+}
+
+func (service *WatchService) AddRootPath(path string, projectFromWS models.ProjectToWatch) {
+
+	debugStr := "Add " + projectFromWS.ProjectID + " @" + time.Now().String()
+
+	msg := &AddRemoveRootPathChannelMessage{
+		true,
+		path,
+		&projectFromWS,
+		debugStr,
+	}
+
+	msgPackage := &WatchServiceChannelMessage{
+		addOrRemove:         msg,
+		directoryWaitResult: nil,
+		debugMessage:        nil,
+	}
+
+	service.watchServiceChannel <- msgPackage
+
+}
+
+func (service *WatchService) RemoveRootPath(path string, projectFromWS models.ProjectToWatch) {
+	debugStr := "Remove " + projectFromWS.ProjectID + " @" + time.Now().String()
+	msg := &AddRemoveRootPathChannelMessage{
+		false,
+		path,
+		&projectFromWS,
+		debugStr,
+	}
+
+	msgPackage := &WatchServiceChannelMessage{
+		addOrRemove:         msg,
+		directoryWaitResult: nil,
+		debugMessage:        nil,
+	}
+
+	service.watchServiceChannel <- msgPackage
+}
+
+func (service *WatchService) RequestDebugMessage() chan string {
+	responseChannel := make(chan string)
+
+	msgPackage := &WatchServiceChannelMessage{
+		debugMessage: &FsNotifyDebugMessage{responseChannel},
+	}
+
+	service.watchServiceChannel <- msgPackage
+
+	return responseChannel
+}
+
+// GetWatchDetails returns the watch state of each project (key: project ID): the directories that are currently
+// watched, as sorted project-relative paths (eg '/' for the root, '/some-dir'), and the number of files and
+// directories within them. In polling mode, these are the directories and files that were found by the most recent
+// poll. The excluded path samples are not set, as these are recorded by the project list.
+func (service *WatchService) GetWatchDetails() map[string]*ProjectWatchDetails {
+	responseChannel := make(chan map[string]*ProjectWatchDetails, 1)
+
+	service.watchServiceChannel <- &WatchServiceChannelMessage{
+		watchDetails: responseChannel,
+	}
+
+	return <-responseChannel
+}
+
+// Dispose closes the watchers of all projects; subsequent requests to add a root path are ignored.
+func (service *WatchService) Dispose() {
+	service.watchServiceChannel <- &WatchServiceChannelMessage{dispose: true}
+}
+
+func watchServiceEventLoop(publicObject *WatchService, projectList *ProjectList, baseURL string) {
+
+	/* key: project ID */
+	watchedProjects := make(map[string]*CodewindWatcher)
+
+	// We intentionally don't exit on dispose, as that would block channel senders (eg a goroutine that is waiting for
+	// a project directory to exist); instead, new watchers are no longer created.
+	disposed := false
+
+	for {
+
+		select {
+		case watchServiceMessage := <-publicObject.watchServiceChannel:
+
+			// If we are receiving an add/remove from our public API
+			if watchServiceMessage.addOrRemove != nil {
+				addOrRemoveRootPathMsg := watchServiceMessage.addOrRemove
+				utils.LogInfo("Processing message: " + addOrRemoveRootPathMsg.debug)
+
+				if addOrRemoveRootPathMsg.isAdd && disposed {
+					utils.LogInfo("Ignoring request to add a root path, as the watch service has been disposed: " + addOrRemoveRootPathMsg.path)
+				} else if addOrRemoveRootPathMsg.isAdd {
+					addRootPathInternal_step1(addOrRemoveRootPathMsg, watchedProjects, projectList, baseURL, publicObject)
+				} else {
+					removeRootPathInternal(addOrRemoveRootPathMsg, watchedProjects)
+				}
+			}
+
+			// If a path we have previously added is reported as either succeeding or failing
+			if watchServiceMessage.directoryWaitResult != nil {
+				msg := watchServiceMessage.directoryWaitResult
+
+				utils.LogInfo("Processing directory wait result message: " + msg.path + " " + msg.project.ProjectID + " " + strconv.FormatBool(msg.success))
+
+				if existing, exists := watchedProjects[msg.project.ProjectID]; !exists || existing.id != msg.watcherID {
+					utils.LogInfo("Ignoring directory wait result, as the watcher has since been replaced or removed: " + msg.path + " " + msg.project.ProjectID)
+
+				} else if msg.success {
+					addRootPathInternal_step2(msg.path, msg.project, watchedProjects, projectList, baseURL, publicObject)
+				} else {
+					informWatchSuccessStatus(msg.project, false, "", baseURL, publicObject, projectList)
+				}
+
+			}
+
+			if watchServiceMessage.dispose {
+				utils.LogInfo("Disposing watch service, closing the watchers of " + strconv.Itoa(len(watchedProjects)) + " project(s)")
+				disposed = true
+				for projectID, watcher := range watchedProjects {
+					closeWatcherIfNeeded(watcher)
+					delete(watchedProjects, projectID)
+				}
+			}
+
+			// If the root directory of a watched project was deleted
+			if watchServiceMessage.rootDeleted != nil {
+				handleRootDeleted(watchServiceMessage.rootDeleted, watchedProjects, projectList, baseURL, publicObject)
+			}
+
+			if watchServiceMessage.watchDetails != nil {
+				result := make(map[string]*ProjectWatchDetails)
+				for projectID, watcher := range watchedProjects {
+					result[projectID] = watcher.getWatchDetails()
+				}
+				watchServiceMessage.watchDetails <- result
+			}
+
+			// If we receive a debug request, respond with the current status
+			if watchServiceMessage.debugMessage != nil {
+				responseChannel := watchServiceMessage.debugMessage.responseChannel
+
+				result := ""
+				utils.LogInfo("Processing debug message")
+
+				for key, val := range watchedProjects {
+					result += "- " + key + " | " + val.rootPath + " | "
+					if val.closed_synch_lock {
+						result += "(closed)"
+					} else {
+						result += "(open)"
+					}
+					result += "\n"
+
+					// If the watcher is open, then request debug data from it.
+					val.lock.Lock()
+					if val.open_synch_lock {
+						result += val.latest_debug_state_lock
+					}
+					val.lock.Unlock()
+
+				}
+
+				responseChannel <- result
+			}
+		}
+
+	}
+
+}
+
+/**
+ * First, we construct the CodewindWatcher in an unopened state, then start a new goroutine to wait for the project directory
+ * to exist. */
+func addRootPathInternal_step1(addMsg *AddRemoveRootPathChannelMessage, watchedProjects map[string]*CodewindWatcher, projectList *ProjectList,
+	baseURL string, service *WatchService) {
+
+	project := addMsg.project
+	projectID := project.ProjectID
+	utils.LogInfo("Starting to add root path " + addMsg.path + " for project " + projectID)
+
+	existing, exists := watchedProjects[projectID]
+	if exists {
+		// If the watcher exists in the map, then close it so we can start a new one
+		closeWatcherIfNeeded(existing)
+	}
+
+	watcher := newCodewindWatcher(addMsg.path, service)
+
+	watchedProjects[project.ProjectID] = watcher
+
+	go waitForWatchedPathSuccess(addMsg.path, project, service, watcher.id)
+
+}
+
+/** Construct a CodewindWatcher in an unopened state; it is opened by startWatcher once the directory exists. */
+func newCodewindWatcher(path string, service *WatchService) *CodewindWatcher {
+	return &CodewindWatcher{
+		nil,
+		path,
+		strconv.FormatUint(rand.Uint64(), 10),
+		false,
+		false,
+		"",
+		false,
+		false,
+		&sync.Mutex{},
+		make(map[string]bool),
+		make(map[string]bool),
+		make(map[string]map[string]*models.FileIdentity),
+		0,
+		false,
+		false,
+		service.config.SymlinkMode,
+		service.config.MaxDepth,
+		service.config.MaxWatchedFiles,
+		make(map[string]string),
+		make(map[string]string),
+		make(map[string]bool),
+		make(map[string]bool),
+		make(chan struct{}, 1),
+		nil,
+	}
+}
+
+/**
+ * The root directory of a project was deleted (or its volume was unmounted): stop the watcher, inform the project list
+ * and the server, and wait for the directory to be recreated. If the project is still being watched when the
+ * directory is recreated, the watch is re-established. */
+func handleRootDeleted(msg *WatchRootDeletedMessage, watchedProjects map[string]*CodewindWatcher, projectList *ProjectList,
+	baseURL string, service *WatchService) {
+
+	projectID := msg.project.ProjectID
+
+	existing, exists := watchedProjects[projectID]
+	if !exists || existing.id != msg.watcherID {
+		utils.LogInfo("Ignoring root deletion of project " + projectID + ", as the watcher has since been replaced or removed")
+		return
+	}
+
+	utils.LogWarning("The root directory of project " + projectID + " no longer exists, so it will not be watched until it is recreated: " + existing.rootPath)
+
+	closeWatcherIfNeeded(existing)
+
+	// Send on a separate goroutine, as the project list may itself be waiting on the watch service
+	go projectList.ProjectRootDeleted(projectID)
+
+	informWatchSuccessStatus(msg.project, false, watchStatusReasonProjectRootDeleted, baseURL, service, projectList)
+
+	watcher := newCodewindWatcher(existing.rootPath, service)
+
+	watchedProjects[projectID] = watcher
+
+	go waitForWatchedPathRecreation(watcher, msg.project, service)
+}
+
+/**
+ * Wait (without a time limit) for the deleted root directory of a project to be recreated, then proceed to step 2; this
+ * stops if the watcher is closed, because the project is no longer watched (or is being watched by a new watcher). */
+func waitForWatchedPathRecreation(cWatcher *CodewindWatcher, projectToWatch *models.ProjectToWatch, watchService *WatchService) {
+
+	for {
+		time.Sleep(1 * time.Second)
+
+		cWatcher.lock.Lock()
+		isClosed := cWatcher.closed_synch_lock
+		cWatcher.lock.Unlock()
+
+		if isClosed {
+			utils.LogDebug("No longer waiting for recreation of " + cWatcher.rootPath + ", as the watcher was closed")
+			return
+		}
+
+		if statVal, err := os.Stat(cWatcher.rootPath); err == nil && statVal.IsDir() {
+			break
+		}
+	}
+
+	utils.LogInfo("The root directory of project " + projectToWatch.ProjectID + " was recreated, so the watch will be re-established: " + cWatcher.rootPath)
+
+	watchService.watchServiceChannel <- &WatchServiceChannelMessage{
+		directoryWaitResult: &WatchDirectoryWaitResultMessage{
+			cWatcher.rootPath,
+			projectToWatch,
+			true,
+			cWatcher.id,
+		},
+	}
+}
+
+/** This function is called once the project directory exists, so we can now start the fsnotify watcher and report success */
+func addRootPathInternal_step2(path string, project *models.ProjectToWatch, watchedProjects map[string]*CodewindWatcher, projectList *ProjectList,
+	baseURL string, service *WatchService) {
+
+	cWatcher, exists := watchedProjects[project.ProjectID]
+	if !exists {
+		// If it doesn't exist, it has already been removed
+		return
+	}
+
+	err := startWatcher(cWatcher, path, projectList, service, project)
+
+	success := true
+
+	if err != nil {
+		utils.LogErrorErr("Error on establishing watch", err)
+		success = false
+	}
+
+	informWatchSuccessStatus(project, success, "", baseURL, service, projectList)
+
+}
+
+/**
+ * Wait up to X minutes for the project directory to exist; if it succeeds proceed to step 2, otherwise
+ * report an error back to the server. */
+func waitForWatchedPathSuccess(path string, projectToWatch *models.ProjectToWatch, watchService *WatchService, watcherID string) {
+	expireTime := time.Now().Add(time.Minute * 5)
+
+	var nextOutputTime *time.Time
+
+	watchSuccess := false
+
+	for {
+
+		if statVal, err := os.Stat(path); err == nil {
+
+			if statVal.IsDir() {
+				watchSuccess = true
+				break
+			}
+
+		} else {
+
+			if nextOutputTime == nil {
+				nextOutput := time.Now().Add(time.Second * 10)
+				nextOutputTime = &nextOutput
+			} else if time.Now().After(*nextOutputTime) {
+				nextOutputTime = nil
+				utils.LogInfo("Waiting for " + path + " to exist")
+			}
+
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		if time.Now().After(expireTime) {
+			watchSuccess = false
+			break
+		}
+	}
+
+	utils.LogInfo("waitForWatchedPathSuccess completed for projId " + projectToWatch.ProjectID + " with status of watchSuccess: " + strconv.FormatBool(watchSuccess))
+
+	result := &WatchDirectoryWaitResultMessage{
+		path,
+		projectToWatch,
+		watchSuccess,
+		watcherID,
+	}
+
+	msgPackage := &WatchServiceChannelMessage{
+		addOrRemove:         nil,
+		directoryWaitResult: result,
+		debugMessage:        nil,
+	}
+
+	watchService.watchServiceChannel <- msgPackage
+}
+
+/** Close an old watcher, either because the project is no longer being watched, or the filters have been updated. */
+func closeWatcherIfNeeded(existing *CodewindWatcher) {
+
+	var sourcesToStop []FileEventSource
+
+	existing.lock.Lock()
+	if !existing.closed_synch_lock {
+		sourcesToStop = existing.eventSources_synch_lock
+		existing.eventSources_synch_lock = nil
+		existing.latest_debug_state_lock = ""
+		existing.closed_synch_lock = true
+		existing.open_synch_lock = false
+		utils.LogInfo("Existing watcher found, so deleting old watcher " + existing.rootPath)
+	} else {
+		utils.LogSevere("A closed entry should not exist in the watcher map.")
+	}
+	existing.lock.Unlock()
+
+	// Stop the sources outside the lock
+	for _, source := range sourcesToStop {
+		source.Stop()
+	}
+}
+
+func removeRootPathInternal(removeMsg *AddRemoveRootPathChannelMessage, watchedProjects map[string]*CodewindWatcher) {
+
+	projectID := removeMsg.project.ProjectID
+
+	existing, exists := watchedProjects[projectID]
+	if exists {
+		utils.LogInfo("Removing project " + projectID + " with root path " + removeMsg.path)
+		closeWatcherIfNeeded(existing)
+		delete(watchedProjects, projectID)
+	} else {
+		utils.LogError("Attempted to remove project " + projectID + " with root path " + removeMsg.path + " but it was not found in watchedPaths")
+	}
+
+}
+
+/** Only immutable objects (id, rootPath), or lockable objects, should be accessed across threads */
+type CodewindWatcher struct {
+	fsnotifyWatcher *fsnotify.Watcher /* reference to notify api */
+	rootPath        string            /* root directory of the path*/
+	id              string
+
+	/* whether the watcher is closed, and therefore events can be ignored, lock on  */
+	closed_synch_lock bool
+
+	/* whether the watcher is open, and therefore the project directory exists */
+	open_synch_lock bool
+
+	/* every X minutes, the state of the watcher is stored in this string, for thread-safe use by the debug thread. */
+	latest_debug_state_lock string
+
+	/* whether the deletion of the root directory has been reported to the watch service */
+	root_deleted_synch_lock bool
+
+	/* whether the project root is polled for changes (see pollingwatcher.go), in which case events are ignored */
+	polled_synch_lock bool
+
+	/** Acquire this before reading/writing any of the above _lock variables. */
+	lock *sync.Mutex
+
+	/** A list of all the paths we have added to fsnotifyWatcher (or, in polling mode, that were walked by the most
+	 * recent poll); written only while holding 'lock', so that it may be read by other goroutines while holding it. */
+	watchedDirMap map[string] /*path -> */ bool
+
+	/** The last time we saw this existing, was it a file or a dir; used to handle directory deletion case*/
+	isDirMap map[string] /*path -> is directory */ bool
+
+	/** Every file and directory known to exist within the watched directories, with its identity (where supported, see
+	 * fileidentity.go), by parent directory; used to count the watched paths, and to recognize a moved file at its new
+	 * path. Acquire 'lock' before reading/writing, as it is written by the initial path walk. Not used in polling mode. */
+	knownPathMap map[string] /* parent directory path -> */ map[string] /* filename -> identity, or nil */ *models.FileIdentity
+
+	/** The number of paths in knownPathMap (in polling mode, the number found by the most recent poll); lock on 'lock' */
+	knownPathCount_synch_lock int
+
+	/** Whether any directory was not watched (or polled) due to the MaxDepth or MaxWatchedFiles of the WatchConfig
+	 * (see walkPathAndAddInternal); lock on 'lock' */
+	maxDepthReached_synch_lock         bool
+	maxWatchedFilesExceeded_synch_lock bool
+
+	symlinkMode SymlinkMode
+
+	maxDepth        int // 0 if there is no limit
+	maxWatchedFiles int // 0 if there is no limit
+
+	/** SymlinkModeFollow only: the real path of each watched directory, used to detect symlink cycles */
+	visitedRealPathMap map[string] /* real path -> watched path */ string
+	realPathMap        map[string] /* watched path -> real path */ string
+
+	/** SymlinkModeFollow only: symlinks that were not followed, as their target was already watched; each is only logged once */
+	reportedSymlinkCycleMap map[string] /* path -> */ bool
+
+	/** SymlinkModeIgnore only: symlinks that have been seen, so that their deletion can be ignored */
+	ignoredSymlinkMap map[string] /* path -> */ bool
+
+	/** Receives a value when an event is received for a self-test probe file */
+	probeEventChannel chan struct{}
+
+	/** The sources of the changes of the root (see fileeventsource.go), which are stopped once the watcher is closed;
+	 * lock on 'lock' */
+	eventSources_synch_lock []FileEventSource
+}
+
+/** Records a source of the changes of the root, returning false (in which case it should be stopped) if the watcher has been closed. */
+func (cWatcher *CodewindWatcher) addEventSource(source FileEventSource) bool {
+	cWatcher.lock.Lock()
+	defer cWatcher.lock.Unlock()
+
+	if cWatcher.closed_synch_lock {
+		return false
+	}
+
+	cWatcher.eventSources_synch_lock = append(cWatcher.eventSources_synch_lock, source)
+	return true
+}
+
+/**
+ * Records that the directory is about to be watched, returning false if it should not be: in SymlinkModeFollow, this is
+ * the case if the real path of the directory is already watched (via another path), as the directory is reachable
+ * through a symlink and following it again may recurse infinitely.
+ */
+func (cWatcher *CodewindWatcher) markDirectoryVisited(path string) bool {
+
+	if cWatcher.symlinkMode != SymlinkModeFollow {
+		return true
+	}
+
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		utils.LogDebug("Unable to resolve real path of " + path + ": " + err.Error())
+		return true
+	}
+
+	if existingPath, visited := cWatcher.visitedRealPathMap[realPath]; visited && existingPath != path {
+		if !cWatcher.reportedSymlinkCycleMap[path] {
+			cWatcher.reportedSymlinkCycleMap[path] = true
+			utils.LogInfo("Not watching " + path + ", as its real path " + realPath + " is already watched as " + existingPath + " (possible symlink cycle)")
+		}
+		return false
+	}
+
+	cWatcher.visitedRealPathMap[realPath] = path
+	cWatcher.realPathMap[path] = realPath
+
+	return true
+}
+
+/**
+ * Returns the watched directories, as sorted project-relative paths, and the number of files and directories within
+ * them (the excluded path samples are not set); this may be called from any goroutine. */
+func (cWatcher *CodewindWatcher) getWatchDetails() *ProjectWatchDetails {
+
+	details := &ProjectWatchDetails{}
+
+	cWatcher.lock.Lock()
+	paths := make([]string, 0, len(cWatcher.watchedDirMap))
+	for path := range cWatcher.watchedDirMap {
+		paths = append(paths, path)
+	}
+	details.WatchedFileCount = cWatcher.knownPathCount_synch_lock
+	details.MaxDepthReached = cWatcher.maxDepthReached_synch_lock
+	details.MaxWatchedFilesExceeded = cWatcher.maxWatchedFilesExceeded_synch_lock
+	details.Polled = cWatcher.polled_synch_lock
+	cWatcher.lock.Unlock()
+
+	result := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if relativePath := utils.ConvertEventPathToProjectRelativePath(path, cWatcher.rootPath); relativePath != nil {
+			result = append(result, *relativePath)
+		}
+	}
+	sort.Strings(result)
+
+	details.WatchedDirectoryCount = len(result)
+	details.WatchedDirectories = result
+
+	return details
+}
+
+/** Removes a deleted directory from the visited real paths, so that it may be watched again if it is recreated. */
+func (cWatcher *CodewindWatcher) forgetDirectoryVisited(path string) {
+
+	if realPath, exists := cWatcher.realPathMap[path]; exists {
+		delete(cWatcher.realPathMap, path)
+		if cWatcher.visitedRealPathMap[realPath] == path {
+			delete(cWatcher.visitedRealPathMap, realPath)
+		}
+	}
+	delete(cWatcher.reportedSymlinkCycleMap, path)
+}
+
+/** Returned by walkPathAndAddInternal if the maximum number of watched files and directories has been exceeded. */
+var errMaxWatchedFilesExceeded = errors.New("The maximum number of watched files and directories has been exceeded")
+
+/** Returned by walkPathAndAddInternal if a directory could not be watched, as the OS limit on watches was reached. */
+var errWatchLimitReached = errors.New("The maximum number of watches of the OS has been reached")
+
+/** Adds a watch of the directory; a variable, so that automated tests may simulate the errors of the OS (eg ENOSPC). */
+var addDirectoryWatch = func(watcher *fsnotify.Watcher, path string) error {
+	return watcher.Add(path)
+}
+
+/**
+ * Returns true if the directory is deeper within the root than the maximum depth, in which case it should not be
+ * watched; the first time, a warning is logged. */
+func (cWatcher *CodewindWatcher) isBeyondMaxDepth(path string) bool {
+
+	if cWatcher.maxDepth == 0 || !strings.HasPrefix(path, cWatcher.rootPath+string(os.PathSeparator)) {
+		return false
+	}
+
+	depth := strings.Count(path[len(cWatcher.rootPath)+1:], string(os.PathSeparator)) + 1
+	if depth <= cWatcher.maxDepth {
+		return false
+	}
+
+	cWatcher.lock.Lock()
+	alreadyReported := cWatcher.maxDepthReached_synch_lock
+	cWatcher.maxDepthReached_synch_lock = true
+	cWatcher.lock.Unlock()
+
+	if !alreadyReported {
+		utils.LogWarning("Directories more than " + strconv.Itoa(cWatcher.maxDepth) + " levels below " + cWatcher.rootPath +
+			" are not watched (FILEWATCHER_MAX_DEPTH), so changes within them are not synced; for example: " + path)
+	}
+
+	return true
+}
+
+/**
+ * Returns true if the number of known files and directories exceeds the maximum, in which case no more directories
+ * should be watched; the first time, a warning is logged. */
+func (cWatcher *CodewindWatcher) isMaxWatchedFilesExceeded() bool {
+
+	if cWatcher.maxWatchedFiles == 0 {
+		return false
+	}
+
+	cWatcher.lock.Lock()
+	exceeded := cWatcher.knownPathCount_synch_lock > cWatcher.maxWatchedFiles
+	cWatcher.lock.Unlock()
+
+	if exceeded {
+		cWatcher.reportMaxWatchedFilesExceeded("no further directories are watched")
+	}
+
+	return exceeded
+}
+
+/** Records that the maximum number of watched files and directories was exceeded; the first time, a warning is logged. */
+func (cWatcher *CodewindWatcher) reportMaxWatchedFilesExceeded(consequence string) {
+
+	cWatcher.lock.Lock()
+	alreadyReported := cWatcher.maxWatchedFilesExceeded_synch_lock
+	cWatcher.maxWatchedFilesExceeded_synch_lock = true
+	cWatcher.lock.Unlock()
+
+	if !alreadyReported {
+		utils.LogWarning("The number of files and directories within " + cWatcher.rootPath + " exceeds the maximum of " +
+			strconv.Itoa(cWatcher.maxWatchedFiles) + " (FILEWATCHER_MAX_WATCHED_FILES), so " + consequence)
+	}
+}
+
+/** The error returned when a project root is not watched, as it contains too many files and directories. */
+func (cWatcher *CodewindWatcher) newMaxWatchedFilesExceededError() error {
+	return errors.New("The project root " + cWatcher.rootPath + " contains more than " + strconv.Itoa(cWatcher.maxWatchedFiles) +
+		" files and directories (FILEWATCHER_MAX_WATCHED_FILES), so it is not watched; check that this is the correct" +
+		" path of the project, or increase the limit")
+}
+
+/**
+ * Records that the file or directory exists, with its identity (if available); the identity is returned, or nil if it
+ * is not available. */
+func (cWatcher *CodewindWatcher) recordKnownPath(path string, info os.FileInfo) *models.FileIdentity {
+
+	identity := getFileIdentity(info)
+
+	parent, name := filepath.Split(path)
+	parent = filepath.Clean(parent)
+
+	cWatcher.lock.Lock()
+	defer cWatcher.lock.Unlock()
+
+	children, exists := cWatcher.knownPathMap[parent]
+	if !exists {
+		children = make(map[string]*models.FileIdentity)
+		cWatcher.knownPathMap[parent] = children
+	}
+	if _, exists := children[name]; !exists {
+		cWatcher.knownPathCount_synch_lock++
+	}
+	children[name] = identity
+
+	return identity
+}
+
+/** Returns the last known identity of the file or directory, or nil if it is not known. */
+func (cWatcher *CodewindWatcher) lastKnownFileIdentity(path string) *models.FileIdentity {
+
+	parent, name := filepath.Split(path)
+	parent = filepath.Clean(parent)
+
+	cWatcher.lock.Lock()
+	defer cWatcher.lock.Unlock()
+
+	return cWatcher.knownPathMap[parent][name]
+}
+
+/**
+ * A file or directory was deleted (or moved away): forget it and, for a directory, everything within it. Returns the
+ * last known identity of the path (nil if not known) and, for a directory, the identities of the files and directories
+ * within it, by path relative to the directory. */
+func (cWatcher *CodewindWatcher) forgetKnownPath(path string, isDir bool) (*models.FileIdentity, map[string]models.FileIdentity) {
+
+	parent, name := filepath.Split(path)
+	parent = filepath.Clean(parent)
+
+	cWatcher.lock.Lock()
+	defer cWatcher.lock.Unlock()
+
+	var result *models.FileIdentity
+	if identity, exists := cWatcher.knownPathMap[parent][name]; exists {
+		result = identity
+		delete(cWatcher.knownPathMap[parent], name)
+		cWatcher.knownPathCount_synch_lock--
+	}
+
+	if !isDir {
+		return result, nil
+	}
+
+	childIdentities := make(map[string]models.FileIdentity)
+	prefix := path + string(os.PathSeparator)
+
+	for directory, children := range cWatcher.knownPathMap {
+		if directory != path && !strings.HasPrefix(directory, prefix) {
+			continue
+		}
+
+		relativeDirectory := ""
+		if directory != path {
+			relativeDirectory = filepath.ToSlash(directory[len(prefix):]) + "/"
+		}
+		for childName, identity := range children {
+			if identity != nil {
+				childIdentities[relativeDirectory+childName] = *identity
+			}
+		}
+		cWatcher.knownPathCount_synch_lock -= len(children)
+		delete(cWatcher.knownPathMap, directory)
+	}
+
+	return result, childIdentities
+}
+
+// isOwnedPath returns true if the absolute path is, or is within, a path owned by the filewatcher (see
+// utils.FilewatcherOwnedFilenamePrefix); only the part of the path within the root of the watcher is considered.
+func (cWatcher *CodewindWatcher) isOwnedPath(path string) bool {
+	if relativePath := utils.ConvertEventPathToProjectRelativePath(path, cWatcher.rootPath); relativePath != nil {
+		return utils.IsFilewatcherOwnedPath(*relativePath)
+	}
+	return strings.HasPrefix(filepath.Base(path), utils.FilewatcherOwnedFilenamePrefix)
+}
+
+/** SymlinkModeIgnore only: returns true if a watch event on the path should be ignored, as the path is a symlink. */
+func (cWatcher *CodewindWatcher) isIgnoredSymlink(path string) bool {
+
+	if cWatcher.symlinkMode != SymlinkModeIgnore {
+		return false
+	}
+
+	if stat, err := os.Lstat(path); err == nil {
+		if stat.Mode()&os.ModeSymlink != 0 {
+			cWatcher.ignoredSymlinkMap[path] = true
+			return true
+		}
+		delete(cWatcher.ignoredSymlinkMap, path)
+		return false
+	}
+
+	// The path no longer exists, so it was a symlink only if we previously saw it as one
+	if cWatcher.ignoredSymlinkMap[path] {
+		delete(cWatcher.ignoredSymlinkMap, path)
+		return true
+	}
+
+	return false
+}
+
+/**
+ * Inform the watch service that the root directory of the project no longer exists; this is only done once per
+ * watcher, as the watch service replaces the watcher in response. */
+func (cWatcher *CodewindWatcher) reportRootDeleted(project *models.ProjectToWatch, service *WatchService) {
+
+	cWatcher.lock.Lock()
+	alreadyReported := cWatcher.root_deleted_synch_lock
+	cWatcher.root_deleted_synch_lock = true
+	cWatcher.lock.Unlock()
+
+	if alreadyReported {
+		return
+	}
+
+	// Send on a separate goroutine, as the watch service may be waiting for this watcher to close
+	go func() {
+		service.watchServiceChannel <- &WatchServiceChannelMessage{
+			rootDeleted: &WatchRootDeletedMessage{project, cWatcher.id},
+		}
+	}()
+}
+
+/** Start detecting the changes of the project directory: from the file system events of the OS, or by polling it. */
+func startWatcher(cWatcher *CodewindWatcher, path string, projectList *ProjectList, service *WatchService, project *models.ProjectToWatch) error {
+
+	if service.config.Mode == WatchModePolling {
+		return startFileEventSource(newPollingEventSource(cWatcher, project, projectList, service, false), cWatcher, project, projectList)
+	}
+
+	err := startFileEventSource(newNativeEventSource(cWatcher, path, project, projectList, service), cWatcher, project, projectList)
+	if err == errWatchLimitReached {
+		// The watches were removed (so that they are available to other projects), and the root is polled instead
+		return startFileEventSource(newPollingEventSource(cWatcher, project, projectList, service, false), cWatcher, project, projectList)
+	}
+
+	return err
+}
+
+/** The FileEventSource of the file system events of the OS, for a project root (see fileeventsource.go). */
+type nativeEventSource struct {
+	fileEventChannel
+
+	cWatcher    *CodewindWatcher
+	path        string
+	project     *models.ProjectToWatch
+	projectList *ProjectList // For the polling fallback
+	service     *WatchService
+
+	watcher *fsnotify.Watcher // Set by Start()
+}
+
+func newNativeEventSource(cWatcher *CodewindWatcher, path string, project *models.ProjectToWatch, projectList *ProjectList, service *WatchService) *nativeEventSource {
+	return &nativeEventSource{
+		fileEventChannel: newFileEventChannel(),
+		cWatcher:         cWatcher,
+		path:             path,
+		project:          project,
+		projectList:      projectList,
+		service:          service,
+	}
+}
+
+/** Do an initial directory scan to add the new project directory, and kick off the goroutine to handle watcher events.  */
+func (source *nativeEventSource) Start() error {
+
+	cWatcher := source.cWatcher
+	path := source.path
+
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		source.stop()
+		source.closeEvents()
+		return err
+	}
+
+	cWatcher.lock.Lock()
+	cWatcher.open_synch_lock = true
+	cWatcher.lock.Unlock()
+
+	source.watcher = watcher
+	cWatcher.fsnotifyWatcher = watcher
+
+	go source.readEvents()
+
+	addedFiles, addedDirs, walkErr := walkPathAndAdd(path, cWatcher)
+
+	if walkErr == errMaxWatchedFilesExceeded || cWatcher.isMaxWatchedFilesExceeded() {
+		// Rather than partially watching the project, which would be misleading, it is not watched at all
+		removeWatchedDirectoryTree(path, cWatcher)
+		cWatcher.forgetKnownPath(path, true)
+		source.Stop()
+
+		return cWatcher.newMaxWatchedFilesExceededError()
+	}
+
+	if walkErr == errWatchLimitReached {
+		// Likewise, the watches are removed (so that they are available to other projects), and the root is polled
+		removeWatchedDirectoryTree(path, cWatcher)
+		cWatcher.forgetKnownPath(path, true)
+		source.Stop()
+
+		return errWatchLimitReached
+	}
+
+	if walkErr != nil {
+		source.Stop()
+		return walkErr
+	}
+
+	utils.LogInfo("Initial path walk complete for " + path + ", addedFiles: " + strconv.Itoa(len(addedFiles)) + ", addedDirs: " + strconv.Itoa(len(addedDirs)))
+
+	if source.service.config.SelfTest {
+		go runWatchSelfTest(cWatcher, source.project, source.projectList, source.service)
+	}
+
+	return nil
+}
+
+/** Stop receiving file system events; the goroutine of this source exits once the fsnotify watcher is closed. */
+func (source *nativeEventSource) Stop() {
+	if !source.stop() || source.watcher == nil {
+		return
+	}
+
+	if err := source.watcher.Close(); err != nil {
+		utils.LogSevereErr("Error on closing watcher", err)
+	}
+}
+
+/** Convert the events of the fsnotify watcher into watch event entries, until the watcher is closed. */
+func (source *nativeEventSource) readEvents() {
+
+	defer source.closeEvents()
+
+	cWatcher := source.cWatcher
+	watcher := source.watcher
+	project := source.project
+	projectList := source.projectList
+	service := source.service
+
+	watcherFuncID := strconv.FormatUint(rand.Uint64(), 10)
+
+	debugUpdateTimer := time.NewTicker(10 * time.Minute)
+
+	// Events are not received when the volume containing the project is unmounted, so also periodically check
+	// that the root directory still exists.
+	rootCheckTicker := time.NewTicker(30 * time.Second)
+	defer rootCheckTicker.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+
+			if utils.IsLogDebugProject(project.ProjectID) {
+				utils.LogDebugProject(project.ProjectID, "Raw fsnotify event: "+event.Name+" "+event.Op.String()+", id: "+cWatcher.id+", watcher func id: "+watcherFuncID+" watch state Id: "+project.ProjectWatchStateID)
+			}
+
+			if !ok {
+
+				// The fsnotify watcher is closed when this source is stopped (including when the watcher is closed)
+				if source.isStopped() {
+					utils.LogDebugProject(project.ProjectID, "Ignoring a !ok that was received after the watcher was closed.")
+					// Exit the channel read function, here
+					return
+				} else {
+					utils.LogSevere("!ok from watcher while the watcher was still open: " + event.Name + " " + event.Op.String() + " " + event.String() + " " + cWatcher.id)
+					continue
+				}
+			}
+
+			cWatcher.lock.Lock()
+			isClosed := cWatcher.closed_synch_lock
+			isPolled := cWatcher.polled_synch_lock
+			cWatcher.lock.Unlock()
+			if isClosed {
+				utils.LogDebugProject(project.ProjectID, "Ignoring event on closed watcher: "+event.Name+" "+event.Op.String())
+				continue
+			}
+
+			if isPolled {
+				// Changes are detected by polling, so the event would only duplicate them
+				utils.LogDebugProject(project.ProjectID, "Ignoring event on polled watcher: "+event.Name+" "+event.Op.String())
+				continue
+			}
+
+			if event.Name == "" {
+				// Received for a directory whose watch was removed after it was moved (see removeWatchedDirectoryTree)
+				utils.LogDebugProject(project.ProjectID, "Ignoring event without a path: "+event.Op.String())
+				continue
+			}
+
+			if isWatchProbeFile(event.Name) {
+				// Events for probe files are not reported, they only indicate that events are being received
+				select {
+				case cWatcher.probeEventChannel <- struct{}{}:
+				default:
+				}
+				continue
+			}
+
+			if cWatcher.isOwnedPath(event.Name) {
+				utils.LogDebugProject(project.ProjectID, "Ignoring event on a path owned by the filewatcher: "+event.Name+" "+event.Op.String())
+				continue
+			}
+
+			if cWatcher.isIgnoredSymlink(event.Name) {
+				utils.LogDebugProject(project.ProjectID, "Ignoring event on symlink: "+event.Name+" "+event.Op.String())
+				continue
+			}
+
+			changeType := ""
+			isDir := false
+
+			fileExists := false
+
+			stat, err := os.Stat(event.Name)
+
+			if err != nil {
+				fileExists = false
+
+				// File doesn't exist, so check our map of old paths
+				isDirMapVal, exists := cWatcher.isDirMap[event.Name]
+				if exists {
+					// fmt.Println("Exists in map: " + event.Name + " w/ val " + strconv.FormatBool(isDirMapVal))
+					// This is required for the delete directory case: a deleted directory cannot be stat-ed
+					isDir = isDirMapVal
+				} else {
+					// The directories found by the initial path walk are not in the map, but are watched
+					cWatcher.lock.Lock()
+					isDir = cWatcher.watchedDirMap[event.Name]
+					cWatcher.lock.Unlock()
+				}
+
+			} else {
+				fileExists = true
+
+				if stat.IsDir() {
+					// If it exists, and it's a directory
+					isDir = true
+				}
+
+			}
+
+			// A path that was moved away is reported as deleted; if it was moved within the project, the new path is
+			// reported as created, and the two are recognized as a rename by the batch utility (via the identity
+			// of the file, see eventbatchutil.go)
+			movedAway := event.Op&fsnotify.Rename == fsnotify.Rename && !fileExists
+
+			watchEventEntries := make([]*models.WatchEventEntry, 0)
+
+			if isDir {
+				// If is directory CREATE/DELETE, then we need to start/stop watching it
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					utils.LogDebugProject(project.ProjectID, "Adding new directory watch: "+event.Name)
+					// The new directory is itself reported by the walk
+					cWatcher.recordKnownPath(event.Name, stat)
+					newFilesFound, newDirsFound, err := walkPathAndAdd(event.Name, cWatcher)
+					if err == errWatchLimitReached {
+						// The new directory is only partially watched, so the whole project root is polled instead
+						removeWatchedDirectoryTree(cWatcher.rootPath, cWatcher)
+						startPollingFallback(cWatcher, project, projectList, service)
+					}
+
+					if err != nil && err != errMaxWatchedFilesExceeded && err != errWatchLimitReached {
+						utils.LogSevereErr("Unexpected error from file walk: "+event.Name, err)
+					} else {
+
+						// For any files that were found in new directories, create CREATE entries for them.
+						for _, val := range newFilesFound {
+							newEvent, err := newWatchEventEntry("CREATE", val, false)
+							cWatcher.isDirMap[val] = false
+
+							if err == nil {
+								newEvent.Identity = cWatcher.lastKnownFileIdentity(val)
+								watchEventEntries = append(watchEventEntries, newEvent)
+							} else {
+								utils.LogSevereErr("Unexpected watch event entry error", err)
+							}
+
+						}
+
+						for _, val := range newDirsFound {
+							newEvent, err := newWatchEventEntry("CREATE", val, true)
+							cWatcher.isDirMap[val] = true
+
+							if err == nil {
+								newEvent.Identity = cWatcher.lastKnownFileIdentity(val)
+								watchEventEntries = append(watchEventEntries, newEvent)
+							} else {
+								utils.LogSevereErr("Unexpected watch event entry error", err)
+							}
+
+						}
+
+					}
+					changeType = "CREATE"
+				} else if event.Op&fsnotify.Remove == fsnotify.Remove || movedAway {
+					utils.LogDebugProject(project.ProjectID, "Removing directory watch: "+event.Name)
+					removeWatchedDirectoryTree(event.Name, cWatcher)
+					changeType = "DELETE"
+
+					// If the directory being removed is the project directory itself, then stop the watcher
+					if event.Name == cWatcher.rootPath {
+
+						if fileExists {
+							utils.LogSevere("The watch service has nothing to watch, but the root file still exists. This shouldn't happen. Path: " + event.Name)
+						} else {
+							utils.LogInfoProject(project.ProjectID, "REMOVED - The watch service has nothing to watch, so the watcher is stopping:"+event.Name)
+						}
+
+					}
+				} else {
+					utils.LogDebugProject(project.ProjectID, "Ignoring: "+event.Name)
+				}
+			} else {
+
+				// Files
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					changeType = "CREATE"
+				} else if event.Op&fsnotify.Write == fsnotify.Write {
+					changeType = "MODIFY"
+				} else if event.Op&fsnotify.Remove == fsnotify.Remove || movedAway {
+					changeType = "DELETE"
+				}
+			}
+
+			if len(watchEventEntries) > 0 {
+				for _, val := range watchEventEntries {
+					utils.LogDebugProject(project.ProjectID, "WatchEventEntry (dir): "+val.EventType+" "+val.Path+" "+strconv.FormatBool(val.IsDir))
+					source.send(val)
+				}
+			}
+
+			if event.Name == cWatcher.rootPath && !fileExists && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				cWatcher.reportRootDeleted(project, service)
+			}
+
+			if changeType != "" {
+				newEvent, err := newWatchEventEntry(changeType, event.Name, isDir)
+
+				if changeType != "DELETE" {
+					cWatcher.isDirMap[event.Name] = isDir
+				}
+				if err == nil {
+					if changeType == "DELETE" {
+						newEvent.Identity, newEvent.ChildIdentities = cWatcher.forgetKnownPath(event.Name, isDir)
+					} else if fileExists {
+						newEvent.Identity = cWatcher.recordKnownPath(event.Name, stat)
+					}
+				}
+				if err != nil {
+					utils.LogSevereErr("Unexpected file path conversion error", err)
+				} else {
+					utils.LogDebugProject(project.ProjectID, "WatchEventEntry: "+changeType+" "+event.Name+" "+strconv.FormatBool(isDir)+" "+cWatcher.id)
+					source.send(newEvent)
+				}
+			}
+		case err, ok := <-watcher.Errors:
+
+			if source.isStopped() {
+				if err != nil {
+					utils.LogInfoProject(project.ProjectID, "Ignoring an error or !ok that was received after the watcher was closed, for project "+project.ProjectID+": "+err.Error())
+				} else {
+					utils.LogInfoProject(project.ProjectID, "Ignoring an error or !ok that was received after the watcher was closed, for project "+project.ProjectID)
+				}
+
+				// Exit the channel read function, here
+				return
+			}
+
+			if err != nil {
+				utils.LogSevereErr("Watcher error, ok: "+strconv.FormatBool(ok), err)
+			} else {
+				utils.LogSevere("Watcher error received, ok: " + strconv.FormatBool(ok))
+			}
+			if !ok {
+				continue
+			}
+
+		case <-rootCheckTicker.C:
+
+			cWatcher.lock.Lock()
+			isClosed := cWatcher.closed_synch_lock
+			cWatcher.lock.Unlock()
+
+			if !isClosed {
+				if _, err := os.Stat(cWatcher.rootPath); err != nil && os.IsNotExist(err) {
+					cWatcher.reportRootDeleted(project, service)
+				}
+			}
+
+		case _ = <-debugUpdateTimer.C: // Update the internal debug state every X minutes
+
+			// Print the first X paths in 'watchedDirMap'
+			count := 0
+			result := ""
+			for key := range cWatcher.watchedDirMap {
+				result += "  - " + key + "\n"
+				count++
+
+				if count >= 20 {
+					break
+				}
+			}
+
+			cWatcher.lock.Lock()
+			if !cWatcher.closed_synch_lock { // Only update if still open
+				cWatcher.latest_debug_state_lock = result
+			}
+			cWatcher.lock.Unlock()
+
+		}
+	} // end for
+}
+
+/** Begin to recursively scan pathParam */
+func walkPathAndAdd(pathParam string, cWatcher *CodewindWatcher) ([]string, []string, error) {
+	utils.LogDebug("Beginning to walk path " + pathParam)
+
+	newFilesFound := make([]string, 0)
+	newDirsFound := make([]string, 0)
+
+	// For every directory under (and inclusive of) pathParam:
+	// - Add a watch for the directory
+	// - List the files in the directory and add them as new changes to report
+	// - Based on handling inotify race conditions, described here: https://lwn.net/Articles/605128/
+
+	walkErr := walkPathAndAddInternal(pathParam, cWatcher, &newFilesFound, &newDirsFound)
+
+	if walkErr == errMaxWatchedFilesExceeded || walkErr == errWatchLimitReached {
+		// The paths that were found before the limit was reached are watched
+		utils.LogDebug("Path walk complete for " + pathParam + ", as a limit on the number of watches was reached: " + walkErr.Error())
+
+		return newFilesFound, newDirsFound, walkErr
+	}
+
+	if walkErr != nil {
+		utils.LogDebug("Path walk complete for " + pathParam + ", with error")
+
+		return nil, nil, walkErr
+	}
+	utils.LogDebug("Path walk complete for " + pathParam + ".")
+	return newFilesFound, newDirsFound, nil
+}
+
+/**
+ * Recursively scan pathParam, and add a new fsnotify watch for the path if it isn't already watched.
+ * For any files found in the directory, add them to newFilesFound (as these need to be CREATE entries).
+ *
+ * Directories deeper than the MaxDepth of the WatchConfig are not watched (or descended into), though they are
+ * themselves reported. Once the number of known files and directories exceeds the MaxWatchedFiles of the WatchConfig,
+ * no further directories are watched: the walk stops, and errMaxWatchedFilesExceeded is returned. Likewise, if the OS
+ * limit on the number of watches is reached, the walk stops, and errWatchLimitReached is returned. */
+func walkPathAndAddInternal(path string, cWatcher *CodewindWatcher, newFilesFound *[]string, newDirsFound *[]string) error {
+	_, exists := cWatcher.watchedDirMap[path]
+
+	if !exists {
+		if cWatcher.isBeyondMaxDepth(path) {
+			return nil
+		}
+
+		if cWatcher.isMaxWatchedFilesExceeded() {
+			return errMaxWatchedFilesExceeded
+		}
+
+		if !cWatcher.markDirectoryVisited(path) {
+			return nil
+		}
+
+		strList := make([]string, 0)
+		strList = append(strList, path)
+
+		cWatcher.lock.Lock()
+		cWatcher.watchedDirMap[path] = true
+		cWatcher.lock.Unlock()
+
+		err := addDirectoryWatch(cWatcher.fsnotifyWatcher, path)
+		utils.LogDebug("Added watch: " + path)
+		if err != nil {
+			if stat, statErr := os.Stat(path); statErr != nil || !stat.IsDir() {
+				// The directory was deleted (or replaced by a file) before we could watch it; this is expected when
+				// directories are rapidly created and deleted. The deletion is reported by the watch of the parent.
+				utils.LogDebug("Directory no longer exists, so it was not watched: " + path)
+				cWatcher.lock.Lock()
+				delete(cWatcher.watchedDirMap, path)
+				cWatcher.lock.Unlock()
+				cWatcher.forgetDirectoryVisited(path)
+				return nil
+			}
+
+			if err == syscall.ENOSPC {
+				utils.LogSevereErr("Unable to watch "+path+", as the maximum number of watches of the OS has been reached (on Linux, "+
+					"fs.inotify.max_user_watches, eg 'sysctl fs.inotify.max_user_watches=524288'), so "+cWatcher.rootPath+
+					" is polled for changes instead; increase the limit, or reduce the number of watched directories (see FILEWATCHER_MAX_DEPTH)", err)
+				cWatcher.lock.Lock()
+				delete(cWatcher.watchedDirMap, path)
+				cWatcher.lock.Unlock()
+				cWatcher.forgetDirectoryVisited(path)
+				return errWatchLimitReached
+			}
+
+			utils.LogSevereErr("Unable to walk path: "+path, err)
+		}
+
+		*newDirsFound = append(*newDirsFound, path)
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			utils.LogSevereErr("Unable to read directory: "+path, err)
+		} else {
+			// For each of the files in the directory, add them to 'new files found' array, otherwise recurse
+			for _, f := range files {
+
+				val := path + string(os.PathSeparator) + f.Name()
+
+				// Paths owned by the filewatcher are neither watched nor reported
+				if strings.HasPrefix(f.Name(), utils.FilewatcherOwnedFilenamePrefix) {
+					continue
+				}
+
+				if f.Mode()&os.ModeSymlink != 0 {
+					if cWatcher.symlinkMode == SymlinkModeIgnore {
+						cWatcher.ignoredSymlinkMap[val] = true
+						continue
+					}
+
+					if cWatcher.symlinkMode == SymlinkModeFollow {
+						if stat, err := os.Stat(val); err == nil && stat.IsDir() {
+							if err := walkPathAndAddInternal(val, cWatcher, newFilesFound, newDirsFound); err != nil {
+								return err
+							}
+							continue
+						}
+					}
+				}
+
+				cWatcher.recordKnownPath(val, f)
+
+				if !f.IsDir() {
+					*newFilesFound = append(*newFilesFound, val)
+				} else if err := walkPathAndAddInternal(val, cWatcher, newFilesFound, newDirsFound); err != nil {
+					return err
+				}
+
+			}
+		}
+	}
+
+	return nil
+}
+
+/**
+ * Stop watching a deleted directory and all of its subdirectories, so that they are watched again if they are recreated.
+ * (The OS removes the watches of deleted directories itself, so errors from removing them are expected and ignored.) */
+func removeWatchedDirectoryTree(path string, cWatcher *CodewindWatcher) {
+
+	prefix := path + string(os.PathSeparator)
+
+	for watchedPath := range cWatcher.watchedDirMap {
+		if watchedPath == path || strings.HasPrefix(watchedPath, prefix) {
+			cWatcher.fsnotifyWatcher.Remove(watchedPath)
+			cWatcher.lock.Lock()
+			delete(cWatcher.watchedDirMap, watchedPath)
+			cWatcher.lock.Unlock()
+			cWatcher.forgetDirectoryVisited(watchedPath)
+		}
+	}
+}
+
+func newWatchEventEntry(eventType string, path string, isDir bool) (*models.WatchEventEntry, error) {
+	path, err := utils.NormalizeEventPath(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WatchEventEntry{
+		EventType: eventType,
+		Path:      path,
+		IsDir:     isDir,
+	}, nil
+}
+
+/** The reason sent to the server when a project can no longer be watched because its root directory was deleted. */
+const watchStatusReasonProjectRootDeleted = "projectRootDeleted"
+
+/** The body of the watch status PUT request. */
+type watchStatusRequestBody struct {
+	Success bool   `json:"success"`
+	Reason  string `json:"reason,omitempty"` // Only set on failure, if the reason is known
+}
+
+/**
+ * Start a new goroutine to communicate to the server the success/failure of the watch (either the initial watch, or a
+ * subsequent failure, as described by failureReason). If the filewatcher is not connected to a server (the base URL is
+ * empty), only the project list is informed. */
+func informWatchSuccessStatus(ptw *models.ProjectToWatch, success bool, failureReason string, baseURL string, service *WatchService, projectList *ProjectList) {
+
+	go func() {
+
+		if success {
+			// Inform the CLI on watch success, if needed
+			projectList.ProjectWatchEstablished(ptw.ProjectID)
+		}
+
+		if baseURL == "" {
+			return
+		}
+
+		successVal := strconv.FormatBool(success)
+
+		backoffUtil := utils.NewExponentialBackoff()
+
+		body, err := json.Marshal(&watchStatusRequestBody{success, failureReason})
+		if err != nil {
+			utils.LogSevereErr("Unable to marshal watch status", err)
+			return
+		}
+
+		url := baseURL + "/api/v1/projects/" + ptw.ProjectID + "/file-changes/" + ptw.ProjectWatchStateID + "/status?clientUuid=" + service.clientUUID
+
+		passed := false
+
+		for !passed {
+			utils.LogDebug("Sending PUT request to " + url)
+
+			tr := newServerTransport()
+
+			client := &http.Client{Transport: tr}
+
+			buffer := bytes.NewBuffer(body)
+			req, err := http.NewRequest(http.MethodPut, url, buffer)
+
+			if err != nil {
+				utils.LogErrorErr("Error from PUT request ", err)
+				backoffUtil.SleepAfterFail()
+				backoffUtil.FailIncrease()
+				passed = false
+				continue
+			}
+
+			req.Header.Set("Content-Type", "application/json")
+
+			token, err := addAuthorizationHeader(req.Header)
+			if err != nil {
+				utils.LogErrorErr("Unable to authenticate PUT request ", err)
+				backoffUtil.SleepAfterFail()
+				backoffUtil.FailIncrease()
+				passed = false
+				continue
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				utils.LogErrorErr("Error from PUT request ", err)
+				backoffUtil.SleepAfterFail()
+				backoffUtil.FailIncrease()
+				passed = false
+				continue
+			}
+
+			resp.Body.Close()
+
+			if resp.StatusCode != 200 {
+				checkUnauthorizedResponse(resp, token)
+				utils.LogError("Status code request from PUT was not 200 - " + strconv.Itoa(resp.StatusCode))
+				backoffUtil.SleepAfterFail()
+				backoffUtil.FailIncrease()
+				passed = false
+				continue
+			}
+
+			passed = true
+
+		}
+
+		utils.LogInfo("Successfully informed server of watch state for " + ptw.ProjectID + ", watch-state-id: " + ptw.ProjectWatchStateID + ", success: " + successVal)
+
+	}()
+
+}
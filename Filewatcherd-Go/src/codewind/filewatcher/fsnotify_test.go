@@ -0,0 +1,80 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestWatchLimitFallsBackToPolling(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	writeTestFiles(t, mock.projectPath, "src/main.go")
+
+	// The OS refuses to watch any more directories once the root is watched
+	limitedDir := filepath.Join(mock.projectPath, "src")
+	defer func(previous func(*fsnotify.Watcher, string) error) { addDirectoryWatch = previous }(addDirectoryWatch)
+	addDirectoryWatch = func(watcher *fsnotify.Watcher, path string) error {
+		if path == limitedDir {
+			return syscall.ENOSPC
+		}
+		return watcher.Add(path)
+	}
+
+	projectList, shutdown := newTestProjectList(t, mock)
+	defer shutdown()
+
+	project := newTestProjectToWatch(t, "watch-limit", mock.projectPath)
+	projectList.UpdateProjectListFromGetRequest(&models.WatchlistEntries{project})
+
+	config := DefaultConfig().Watch
+	config.Mode = WatchModeNative
+	config.PollingInterval = 20 * time.Millisecond
+	service := &WatchService{config: config}
+
+	cWatcher := newCodewindWatcher(mock.projectPath, service)
+	if err := startWatcher(cWatcher, mock.projectPath, projectList, service, &project); err != nil {
+		t.Fatalf("Expected the root to be polled when the watch limit is reached, but got: %v", err)
+	}
+
+	cWatcher.lock.Lock()
+	sources := cWatcher.eventSources_synch_lock
+	polled := cWatcher.polled_synch_lock
+	cWatcher.lock.Unlock()
+
+	defer func() {
+		for _, source := range sources {
+			source.Stop()
+		}
+	}()
+
+	if len(sources) != 1 {
+		t.Fatalf("Expected a single source of changes, but found %d", len(sources))
+	}
+	if _, ok := sources[0].(*pollingEventSource); !ok {
+		t.Fatalf("Expected the root to be polled, but the source of changes is a %T", sources[0])
+	}
+	if !polled {
+		t.Error("Expected the watcher to be marked as polled")
+	}
+
+	// A change within the directory that could not be watched is detected by polling, and synced
+	writeTestFiles(t, limitedDir, "new.go")
+	mock.waitForCalls(t, 1)
+}
@@ -0,0 +1,286 @@
+/*******************************************************************************
+* Copyright (c) 2019, 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"codewind/utils"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * This file is responsible for issuing a GET request to the server in order to
+ * retrieve the latest list of projects to watch (including their path, and any
+ * filters).
+ *
+ * A new GET request will be sent by this class on startup, and after startup, a
+ * GET request will be sent either: whenever the WebSocket connection fails, or
+ * otherwise, once every X seconds (120 by default, or the value of the
+ * `FILEWATCHER_RECONCILE_INTERVAL_SECS` environment variable). These settings are read from the ServerConfig.
+ *
+ * Requests that fail with a retryable error (a connection error, or a 5xx response) are retried with an exponential
+ * backoff (between 500 msecs and 8 seconds by default, or `FILEWATCHER_GET_RETRY_MIN_MS`/`FILEWATCHER_GET_RETRY_MAX_MS`),
+ * up to X attempts (5 by default, or `FILEWATCHER_GET_MAX_ATTEMPTS`); if every attempt fails, the request is sent again
+ * after the maximum delay. Other errors (such as a 4xx response, which indicates a configuration or authentication
+ * problem) are not retried: the request is next sent on the next refresh.
+ *
+ * ws.go is responsible for informing this code when the WebSocket
+ * connection fails (input), and this class calls the Filewatcher
+ * class with the data from the GET request (containing any project watch
+ * updates received) as output.
+ *
+ * The thread (and its reconcile ticker) terminate when the context is cancelled.
+ */
+type HttpGetStatusThread struct {
+	refreshStatusChan chan interface{}
+	baseURL           string
+	config            ServerConfig // The reconcile interval and retry settings; immutable
+	ctx               context.Context
+}
+
+/**
+ * This function is called by other files whenever a new GET request should be sent to the server (for example, if
+ * the websocket connecion failed.) */
+func (hg *HttpGetStatusThread) SignalStatusRefreshNeeded() {
+	go func() {
+		utils.LogDebug("SignalStatusRefreshNeeded called.")
+		select {
+		case hg.refreshStatusChan <- nil:
+		case <-hg.ctx.Done():
+			// The thread has terminated, so there is nothing to refresh
+		}
+		utils.LogDebug("post SignalStatusRefreshNeeded called.")
+	}()
+}
+
+func NewHttpGetStatusThread(ctx context.Context, baseURL string, projectList *ProjectList, config ServerConfig) (*HttpGetStatusThread, error) {
+
+	baseURL = utils.StripTrailingForwardSlash(baseURL)
+
+	if !utils.IsValidURLBase(baseURL) {
+		return nil, errors.New("URL is invalid: " + baseURL)
+	}
+
+	reconnectNeeded := make(chan interface{})
+
+	result := &HttpGetStatusThread{
+		reconnectNeeded,
+		baseURL,
+		config,
+		ctx,
+	}
+
+	go runGetStatusThread(result, projectList)
+
+	result.SignalStatusRefreshNeeded()
+
+	// Every X seconds (120 by default), refresh the status, in case any WebSocket updates were missed
+	ticker := time.NewTicker(config.ReconcileInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				utils.LogDebug("GetStatus ticker ticked.")
+				result.SignalStatusRefreshNeeded()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return result, nil
+
+}
+
+func runGetStatusThread(data *HttpGetStatusThread, projectList *ProjectList) {
+	utils.LogInfo("Http GET status thread started.")
+
+	maxAttempts := data.config.GetMaxAttempts
+
+	for {
+		// Wait for at least one request
+		select {
+		case <-data.refreshStatusChan:
+		case <-data.ctx.Done():
+			utils.LogInfo("Http GET status thread terminated.")
+			return
+		}
+
+		backoff := data.config.GetRetry.newBackoff(0.5)
+
+		err := doGetRequest(data.baseURL, projectList, maxAttempts, &backoff)
+		if err != nil {
+			if isRetryableGetError(err) {
+				// The server may still be starting, so try again later, rather than waiting for the next reconcile
+				retryDelay := time.Duration(backoff.MaxFailureDelay) * time.Millisecond
+				utils.LogSevereErr("Unable to retrieve the project list after "+strconv.Itoa(maxAttempts)+" attempts; will try again in "+retryDelay.String(), err)
+				time.AfterFunc(retryDelay, data.SignalStatusRefreshNeeded)
+			} else {
+				utils.LogSevereErr("Unable to retrieve the project list, due to an error that will not be retried (check the server URL and credentials); "+
+					"the project list will be retrieved again on the next refresh", err)
+			}
+		}
+
+		// Drain the channel of any other requests that occurred during this time.
+		channelEmpty := false
+		for !channelEmpty {
+			select {
+			case <-data.refreshStatusChan:
+			default:
+				channelEmpty = true
+			}
+		}
+
+		if err == nil {
+			utils.LogDebug("GET request successfully sent and received.")
+		}
+
+	} // end for
+}
+
+// doGetRequest retrieves the project list, and passes it to the project list. Retryable errors (connection errors,
+// and 5xx responses) are retried, with the given backoff, up to the given number of attempts; other errors (such as
+// 4xx responses, which indicate a configuration or authentication problem) are returned immediately. The error of the
+// final attempt is returned on failure.
+func doGetRequest(baseURL string, projectList *ProjectList, maxAttempts int, backoff *utils.ExponentialBackoff) error {
+
+	var err error
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+
+		var result *models.WatchlistEntries
+		result, err = sendGet(baseURL)
+
+		if err == nil {
+			if result != nil {
+				projectList.UpdateProjectListFromGetRequest(result)
+			}
+			return nil
+		}
+
+		if !isRetryableGetError(err) {
+			utils.LogErrorErr("Non-retryable error from GET request (attempt "+strconv.Itoa(attempt)+" of "+strconv.Itoa(maxAttempts)+"):", err)
+			return err
+		}
+
+		utils.LogErrorErr("Retryable error from GET request (attempt "+strconv.Itoa(attempt)+" of "+strconv.Itoa(maxAttempts)+"):", err)
+
+		if attempt < maxAttempts {
+			backoff.SleepAfterFail()
+			backoff.FailIncrease()
+		}
+	}
+
+	return err
+
+}
+
+// getRequestError is returned by sendGet, and indicates whether the request may succeed if it is retried.
+type getRequestError struct {
+	msg        string
+	statusCode int // The status code of the response; 0 if no response was received
+	retryable  bool
+}
+
+func (e *getRequestError) Error() string {
+	return e.msg
+}
+
+func newGetRequestError(msg string, err error, statusCode int, retryable bool) *getRequestError {
+	if err != nil {
+		msg += ": " + err.Error()
+	}
+	return &getRequestError{msg, statusCode, retryable}
+}
+
+// isRetryableGetError returns true if the error is from a request that may succeed if it is retried.
+func isRetryableGetError(err error) bool {
+	if getErr, ok := err.(*getRequestError); ok {
+		return getErr.retryable
+	}
+	return false
+}
+
+// isRetryableStatusCode returns true for server errors (5xx), and client errors that are expected to be temporary:
+// request timeout, too many requests, and unauthorized (if the token was invalidated, a new one will be requested).
+func isRetryableStatusCode(statusCode int, tokenInvalidated bool) bool {
+	if statusCode >= 500 {
+		return true
+	}
+	if statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return statusCode == http.StatusUnauthorized && tokenInvalidated
+}
+
+func sendGet(baseURL string) (*models.WatchlistEntries, error) {
+
+	url := baseURL + "/api/v1/projects/watchlist"
+
+	utils.LogInfo("Initiating GET request to " + url)
+
+	tr := newServerTransport()
+
+	client := &http.Client{Transport: tr}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, newGetRequestError("Unable to create GET request for "+url, err, 0, false)
+	}
+
+	// The token may be requested from a separate authentication server, which may also be temporarily unavailable
+	token, err := addAuthorizationHeader(req.Header)
+	if err != nil {
+		return nil, newGetRequestError("Unable to authenticate GET request for "+url, err, 0, true)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil || resp == nil {
+		return nil, newGetRequestError("Get request failed for "+url+", with no response code", err, 0, true)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		checkUnauthorizedResponse(resp, token)
+		retryable := isRetryableStatusCode(resp.StatusCode, token != "")
+		return nil, newGetRequestError("Get response failed for "+url+", response code: "+strconv.Itoa(resp.StatusCode), nil, resp.StatusCode, retryable)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil || body == nil {
+		return nil, newGetRequestError("Get response failed for "+url+", unable to read body", err, resp.StatusCode, true)
+	}
+
+	// Strip EOL characters to ensure it fits on one log line.
+	bodyStr := string(body)
+	bodyStr = strings.ReplaceAll(bodyStr, "\r", "")
+	bodyStr = strings.ReplaceAll(bodyStr, "\n", "")
+
+	utils.LogInfo("GET request completed, for " + url + ". Response: " + bodyStr)
+
+	// A malformed project list will not be fixed by retrying (for example, the server is a different version)
+	entries, err := models.ParseWatchlistEntryList(body)
+	if err != nil {
+		return nil, newGetRequestError("Get response failed for "+url+", the response was rejected", err, resp.StatusCode, false)
+	}
+
+	return &entries.Projects, nil
+}
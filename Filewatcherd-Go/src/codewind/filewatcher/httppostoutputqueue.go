@@ -9,7 +9,7 @@
 *     IBM Corporation - initial API and implementation
 *******************************************************************************/
 
-package main
+package filewatcher
 
 import (
 	"bytes"
@@ -18,7 +18,6 @@ import (
 	"strconv"
 
 	"codewind/utils"
-	"crypto/tls"
 	"time"
 )
 
@@ -243,13 +242,22 @@ func (queue *HttpPostOutputQueue) sendPost(chunk *PostQueueChunk) error {
 
 	utils.LogInfo("Sending POST request to " + url + " with payload size " + strconv.Itoa(buffer.Len()))
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
+	tr := newServerTransport()
 
 	client := &http.Client{Transport: tr}
 
-	resp, err := client.Post(url, "application/json", buffer)
+	req, err := http.NewRequest(http.MethodPost, url, buffer)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	token, err := addAuthorizationHeader(req.Header)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -257,6 +265,8 @@ func (queue *HttpPostOutputQueue) sendPost(chunk *PostQueueChunk) error {
 	if resp == nil {
 		return errors.New("Response was nil")
 	} else if resp.StatusCode != 200 {
+		checkUnauthorizedResponse(resp, token)
+		resp.Body.Close()
 		return errors.New("Response code was != 200")
 	}
 
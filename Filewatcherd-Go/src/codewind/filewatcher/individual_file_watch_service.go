@@ -9,7 +9,7 @@
 *     IBM Corporation - initial API and implementation
 *******************************************************************************/
 
-package main
+package filewatcher
 
 import (
 	"codewind/utils"
@@ -22,7 +22,10 @@ import (
 // linked files defined in the 'refPaths' field of a watched project. For a
 // large number of files to watch, the watch service should be used instead.
 //
-// Files watched by this class do not need to exist.
+// Files watched by this class do not need to exist: a CREATE event is reported once a file appears. A file may be
+// referenced by multiple projects, in which case the change is reported to each of them, so that each project is
+// synced. Changes are passed to the project list, which forwards them to the batch utility (and thus the CLI state)
+// of the project, unless the file is within a watched project root (in which case the watch service reports it).
 //
 // A single instance of this class will exist per filewatcher (eg it is not per
 // project).
@@ -66,6 +69,11 @@ func (ifws *IndividualFileWatchService) SetFilesToWatch(projectID string, pathsF
 	ifws.cmdChannel <- indivFileWatchServiceCmd{cmdType: iwsSetFilesToWatchCmd, projectID: projectID, pathsFromPtw: pathsFromPtw}
 }
 
+// Dispose stops watching the files of all projects.
+func (ifws *IndividualFileWatchService) Dispose() {
+	ifws.cmdChannel <- indivFileWatchServiceCmd{cmdType: iwsWatchServiceDispose}
+}
+
 func (ifws *IndividualFileWatchService) commandReceiver() {
 	filesToWatchMap := make(map[string] /*project id*/ (map[string] /*absolute path*/ *pollEntry /*linked files*/))
 
@@ -146,7 +154,7 @@ func (ifws *IndividualFileWatchService) timerTick(filesToWatchMap map[string](ma
 						changedFiles = []ChangedFileEntry{}
 					}
 
-					changedFileEntry, err := NewChangedFileEntry(fileToWatch.absolutePath, eventType, time.Now().UnixNano()/1000000, false)
+					changedFileEntry, err := newIndividualChangedFileEntry(fileToWatch.absolutePath, eventType, time.Now().UnixNano()/1000000, false)
 					if err != nil {
 						utils.LogSevereErr("Unable to create changed file entry", err)
 						continue
@@ -167,7 +175,7 @@ func (ifws *IndividualFileWatchService) timerTick(filesToWatchMap map[string](ma
 						changedFiles = []ChangedFileEntry{}
 					}
 
-					changedFileEntry, err := NewChangedFileEntry(fileToWatch.absolutePath, "MODIFY", time.Now().UnixNano()/1000000, false)
+					changedFileEntry, err := newIndividualChangedFileEntry(fileToWatch.absolutePath, "MODIFY", time.Now().UnixNano()/1000000, false)
 					if err != nil {
 						utils.LogSevereErr("Unable to create changed file entry", err)
 						continue
@@ -224,6 +232,11 @@ func handleSetFilesToWatch(projectID string, pathsFromPtw []string, filesToWatch
 	}
 
 	if len(paths) == 0 {
+		// The project no longer has any files to watch (or is no longer watched)
+		if _, exists := filesToWatchMap[projectID]; exists {
+			utils.LogInfo("Files to watch - removing all files from watch list for project: " + projectID)
+			delete(filesToWatchMap, projectID)
+		}
 		return
 	}
 
@@ -301,3 +314,15 @@ type pollEntry struct {
 	absolutePath       string
 	lastModifiedTime   int64
 }
+
+// newIndividualChangedFileEntry creates a changed file entry for the local absolute path of a watched file, converted to
+// the same canonical form as the paths of file system events (see utils.NormalizeEventPath).
+func newIndividualChangedFileEntry(absolutePath string, eventType string, timestamp int64, directory bool) (*ChangedFileEntry, error) {
+
+	path, err := utils.NormalizeEventPath(absolutePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewChangedFileEntry(path, eventType, timestamp, directory)
+}
@@ -0,0 +1,80 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"sync"
+)
+
+// SyncMetricsRecorder is informed of the duration and result of each cwctl 'project sync' call, for example
+// to allow sync latency to be aggregated per project. Implementations must be safe to call from multiple goroutines,
+// and should return quickly, as they are called from the goroutine that ran the cwctl process.
+type SyncMetricsRecorder interface {
+	RecordSyncDuration(projectID string, millis int64, success bool)
+}
+
+// SyncFileCountRecorder may optionally be implemented by a SyncMetricsRecorder, to also be informed of the number of
+// files synced and deleted by each successful sync (as parsed from the cwctl output; -1 if unknown).
+type SyncFileCountRecorder interface {
+	RecordSyncFileCounts(projectID string, syncedFileCount int, deletedFileCount int)
+}
+
+// SyncSpawnFailureRecorder may optionally be implemented by a SyncMetricsRecorder, to also be informed when the cwctl
+// process could not be started at all (for example, the installer is missing or not executable). These failures are
+// not reported to RecordSyncDuration, as no sync was attempted.
+type SyncSpawnFailureRecorder interface {
+	RecordSyncSpawnFailure(projectID string, err error)
+}
+
+// noOpSyncMetricsRecorder is the default recorder, which discards all metrics.
+type noOpSyncMetricsRecorder struct{}
+
+func (noOpSyncMetricsRecorder) RecordSyncDuration(projectID string, millis int64, success bool) {}
+
+var (
+	// syncMetricsRecorderLock must be acquired before reading/writing syncMetricsRecorder
+	syncMetricsRecorderLock = &sync.RWMutex{}
+
+	syncMetricsRecorder SyncMetricsRecorder = noOpSyncMetricsRecorder{}
+)
+
+// SetSyncMetricsRecorder replaces the recorder that is called after each cwctl sync; a nil value restores the default
+// no-op recorder.
+func SetSyncMetricsRecorder(recorder SyncMetricsRecorder) {
+	if recorder == nil {
+		recorder = noOpSyncMetricsRecorder{}
+	}
+
+	syncMetricsRecorderLock.Lock()
+	defer syncMetricsRecorderLock.Unlock()
+	syncMetricsRecorder = recorder
+}
+
+func getSyncMetricsRecorder() SyncMetricsRecorder {
+	syncMetricsRecorderLock.RLock()
+	defer syncMetricsRecorderLock.RUnlock()
+	return syncMetricsRecorder
+}
+
+// recordSyncFileCounts informs the recorder of the file counts of a successful sync, if it implements SyncFileCountRecorder.
+func recordSyncFileCounts(projectID string, syncedFileCount int, deletedFileCount int) {
+	if recorder, ok := getSyncMetricsRecorder().(SyncFileCountRecorder); ok {
+		recorder.RecordSyncFileCounts(projectID, syncedFileCount, deletedFileCount)
+	}
+}
+
+// recordSyncSpawnFailure informs the recorder that cwctl could not be started, if it implements SyncSpawnFailureRecorder.
+func recordSyncSpawnFailure(projectID string, err error) {
+	if recorder, ok := getSyncMetricsRecorder().(SyncSpawnFailureRecorder); ok {
+		recorder.RecordSyncSpawnFailure(projectID, err)
+	}
+}
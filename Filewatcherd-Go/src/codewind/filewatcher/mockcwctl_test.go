@@ -0,0 +1,273 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * The CLIState tests run the test binary itself as a mock cwctl (see TestMain), so that they do not depend on a shell
+ * or Java. The mock is configured by environment variables, which are passed to it as the extra environment variables
+ * of the CLIState: each invocation is appended (as a line of JSON) to a log file, and its exit code is taken from a list.
+ */
+
+const (
+	// If 'true', the test binary behaves as a mock cwctl, rather than running the tests
+	mockCwctlEnvVar = "FILEWATCHER_TEST_MOCK_CWCTL"
+
+	// The file to which each invocation is appended
+	mockCwctlLogEnvVar = "FILEWATCHER_TEST_MOCK_CWCTL_LOG"
+
+	// A comma-separated list of the exit code of each invocation (in order); later invocations exit with 0
+	mockCwctlExitCodesEnvVar = "FILEWATCHER_TEST_MOCK_CWCTL_EXIT_CODES"
+
+	// If set, each invocation waits for this file to exist before exiting
+	mockCwctlWaitForEnvVar = "FILEWATCHER_TEST_MOCK_CWCTL_WAIT_FOR"
+)
+
+// mockCwctlTimeout is the longest time that the mock (or a test) waits for something to happen.
+const mockCwctlTimeout = 10 * time.Second
+
+func TestMain(m *testing.M) {
+	if os.Getenv(mockCwctlEnvVar) == "true" {
+		os.Exit(runMockCwctl())
+	}
+
+	os.Exit(m.Run())
+}
+
+// mockCwctlCall is an invocation of the mock cwctl.
+type mockCwctlCall struct {
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+}
+
+// runMockCwctl records the invocation, and returns its exit code.
+func runMockCwctl() int {
+
+	logPath := os.Getenv(mockCwctlLogEnvVar)
+
+	previous, _ := ioutil.ReadFile(logPath)
+	callIndex := bytes.Count(previous, []byte("\n"))
+
+	line, _ := json.Marshal(mockCwctlCall{Args: os.Args[1:], Env: os.Environ()})
+	file, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 100
+	}
+	file.Write(append(line, '\n'))
+	file.Close()
+
+	if waitFor := os.Getenv(mockCwctlWaitForEnvVar); waitFor != "" {
+		for deadline := time.Now().Add(mockCwctlTimeout); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if _, err := os.Stat(waitFor); err == nil {
+				break
+			}
+		}
+	}
+
+	exitCodes := strings.Split(os.Getenv(mockCwctlExitCodesEnvVar), ",")
+	if callIndex < len(exitCodes) {
+		if exitCode, err := strconv.Atoi(strings.TrimSpace(exitCodes[callIndex])); err == nil {
+			return exitCode
+		}
+	}
+	return 0
+}
+
+// mockCwctl is the mock cwctl of a test, and the temporary directory containing its log and the project.
+type mockCwctl struct {
+	dir         string
+	projectPath string
+	env         map[string]string
+}
+
+// newMockCwctl returns a mock whose invocations exit with the given codes (in order), and then with 0; the caller
+// must call cleanup() once the test is complete.
+func newMockCwctl(t *testing.T, exitCodes ...int) *mockCwctl {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "filewatcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	projectPath := filepath.Join(dir, "project")
+	if err := os.Mkdir(projectPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	codes := []string{}
+	for _, code := range exitCodes {
+		codes = append(codes, strconv.Itoa(code))
+	}
+
+	return &mockCwctl{
+		dir:         dir,
+		projectPath: projectPath,
+		env: map[string]string{
+			mockCwctlEnvVar:          "true",
+			mockCwctlLogEnvVar:       filepath.Join(dir, "calls.log"),
+			mockCwctlExitCodesEnvVar: strings.Join(codes, ","),
+		},
+	}
+}
+
+func (mock *mockCwctl) cleanup() {
+	os.RemoveAll(mock.dir)
+}
+
+// blockUntilReleased makes each invocation wait until release() is called.
+func (mock *mockCwctl) blockUntilReleased() {
+	mock.env[mockCwctlWaitForEnvVar] = filepath.Join(mock.dir, "release")
+}
+
+func (mock *mockCwctl) release(t *testing.T) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(filepath.Join(mock.dir, "release"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// config returns a CLIConfig that runs this mock, without a quiet period, circuit breaker, or timestamp safety margin.
+func (mock *mockCwctl) config(t *testing.T) CLIConfig {
+	t.Helper()
+
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig().CLI
+	config.MockInstallerPath = executable
+	config.QuietPeriod = 0
+	config.TimestampSafetyMargin = 0
+	config.DetectTimestampSafetyMargin = false
+	config.CircuitBreakerThreshold = 0
+	return config
+}
+
+// newCLIState returns a CLIState of the project of this mock, which the caller must dispose.
+func (mock *mockCwctl) newCLIState(t *testing.T, config CLIConfig, clock Clock, listener CLIStateResultListener) *CLIState {
+	t.Helper()
+
+	state, err := newCLIStateWithClock("project-"+filepath.Base(mock.dir), config.MockInstallerPath, mock.projectPath, config, listener, mock.env, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+// calls returns the invocations of the mock so far.
+func (mock *mockCwctl) calls(t *testing.T) []mockCwctlCall {
+	t.Helper()
+
+	contents, err := ioutil.ReadFile(mock.env[mockCwctlLogEnvVar])
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	// An invocation that is still being appended is not yet complete, so only lines that end in a newline are read
+	contents = contents[:bytes.LastIndexByte(contents, '\n')+1]
+	if len(contents) == 0 {
+		return nil
+	}
+
+	result := []mockCwctlCall{}
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		var call mockCwctlCall
+		if err := json.Unmarshal([]byte(line), &call); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, call)
+	}
+	return result
+}
+
+// waitForCalls waits for the mock to have been invoked (at least) the given number of times.
+func (mock *mockCwctl) waitForCalls(t *testing.T, count int) []mockCwctlCall {
+	t.Helper()
+
+	var calls []mockCwctlCall
+	waitFor(t, "cwctl to be invoked "+strconv.Itoa(count)+" times", func() bool {
+		calls = mock.calls(t)
+		return len(calls) >= count
+	})
+	return calls
+}
+
+// arg returns the value of the named argument of the call (eg '-t'), or "" if it has none.
+func (call mockCwctlCall) arg(name string) string {
+	for index := 0; index < len(call.Args)-1; index++ {
+		if call.Args[index] == name {
+			return call.Args[index+1]
+		}
+	}
+	return ""
+}
+
+// getenv returns the value of the environment variable of the call, and false if it was not set.
+func (call mockCwctlCall) getenv(name string) (string, bool) {
+	for _, entry := range call.Env {
+		if strings.HasPrefix(entry, name+"=") {
+			return entry[len(name)+1:], true
+		}
+	}
+	return "", false
+}
+
+// resultRecorder is a CLIStateResultListener that records the result of each sync.
+type resultRecorder chan SyncResult
+
+func newResultRecorder() resultRecorder {
+	return make(chan SyncResult, 100)
+}
+
+func (recorder resultRecorder) listener(projectID string, result SyncResult, exitCode int, output string, elapsedTimeInMsecs int64) {
+	recorder <- result
+}
+
+// next waits for the result of the next sync.
+func (recorder resultRecorder) next(t *testing.T) SyncResult {
+	t.Helper()
+
+	select {
+	case result := <-recorder:
+		return result
+	case <-time.After(mockCwctlTimeout):
+		t.Fatal("Timed out waiting for the result of a sync")
+		return SyncResultFailed
+	}
+}
+
+// waitFor polls the condition until it is true, failing the test if it does not become true in time.
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(mockCwctlTimeout); !condition(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for " + description)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"codewind/utils"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/**
+ * On success, the timestamp of the next sync of a project is the spawn time of the sync, minus a safety margin (see
+ * CLIConfig.TimestampSafetyMargin). Some file systems record modification times with a coarse resolution (2 seconds for
+ * FAT, 1 second for ext3 and HFS+, 10 msecs for exFAT), so a file that is modified during a sync may be recorded as
+ * having been modified before the spawn time of that sync; unless the margin is at least the resolution, that change
+ * would be missed by the next sync. The default margin (2 seconds) covers each of these.
+ *
+ * If CWCTL_SYNC_TIMESTAMP_MARGIN_DETECT is 'true' (it is off by default), a smaller margin may instead be used for
+ * projects on a file system with a finer resolution. The resolution is measured once, on a separate goroutine, by
+ * writing a file a few times to a directory created by the filewatcher within CWCTL_SYNC_TIMESTAMP_MARGIN_DETECT_DIR (by
+ * default, the OS temp directory); nothing is written to the project roots. The coarsest resolution that is consistent
+ * with each of the modification times is used, with a minimum of 100 msecs (the kernel may record the times from a clock
+ * that is only updated every few msecs). The measurement only applies to projects on the same file system as that
+ * directory (which requires file systems to be identified, see getFileIdentity); every other project, and every sync
+ * that starts before the measurement completes, uses the configured margin.
+ */
+
+const (
+	// minDetectedTimestampSafetyMargin is the smallest safety margin that is used when the resolution is detected
+	minDetectedTimestampSafetyMargin = 100 * time.Millisecond
+
+	// mtimeResolutionSamples is the number of times the file is written, so that a fine-grained modification time is
+	// unlikely to coincidentally be a multiple of a coarser resolution
+	mtimeResolutionSamples = 5
+
+	// mtimeResolutionDirPrefix is the name prefix of the directory that is created to measure the resolution; as for
+	// every path owned by the filewatcher, events for it are not reported.
+	mtimeResolutionDirPrefix = utils.FilewatcherOwnedFilenamePrefix + "mtime-resolution-"
+)
+
+// mtimeResolutionCandidates are the resolutions of common file systems, from coarsest to finest.
+var mtimeResolutionCandidates = []time.Duration{
+	2 * time.Second,       // FAT
+	time.Second,           // ext3, HFS+, some network file systems
+	10 * time.Millisecond, // exFAT
+	time.Millisecond,
+	time.Microsecond,
+	100 * time.Nanosecond, // NTFS
+	time.Nanosecond,       // ext4, XFS, APFS, btrfs
+}
+
+var (
+	// mtimeResolutionLock must be acquired before reading/writing the maps below
+	mtimeResolutionLock = &sync.Mutex{}
+
+	// The directories in which a measurement has been started (whether or not it has completed)
+	mtimeResolutionMeasuredDirs = map[string]bool{}
+
+	// The measured resolution of each file system, by device ID
+	mtimeResolutions = map[uint64]time.Duration{}
+)
+
+// getTimestampSafetyMargin returns the safety margin to use for the project (see mtimeresolution.go). This does not
+// block: if detection is enabled, and the resolution has not yet been measured, the measurement is started on a
+// separate goroutine, and the configured margin is returned until it completes.
+func getTimestampSafetyMargin(projectPath string, config CLIConfig) time.Duration {
+
+	if !config.DetectTimestampSafetyMargin || projectPath == "" {
+		return config.TimestampSafetyMargin
+	}
+
+	startModTimeResolutionMeasurement(config.TimestampSafetyMarginDetectDir)
+
+	info, err := os.Stat(projectPath)
+	if err != nil {
+		return config.TimestampSafetyMargin
+	}
+	identity := getFileIdentity(info)
+	if identity == nil {
+		return config.TimestampSafetyMargin
+	}
+
+	mtimeResolutionLock.Lock()
+	resolution, measured := mtimeResolutions[identity.Device]
+	mtimeResolutionLock.Unlock()
+
+	if !measured {
+		return config.TimestampSafetyMargin
+	}
+	if resolution < minDetectedTimestampSafetyMargin {
+		return minDetectedTimestampSafetyMargin
+	}
+	return resolution
+}
+
+// startModTimeResolutionMeasurement measures the resolution of the file system of the directory ("" for the OS temp
+// directory) on a separate goroutine, unless it has already been started.
+func startModTimeResolutionMeasurement(dir string) {
+
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	mtimeResolutionLock.Lock()
+	started := mtimeResolutionMeasuredDirs[dir]
+	mtimeResolutionMeasuredDirs[dir] = true
+	mtimeResolutionLock.Unlock()
+
+	if started {
+		return
+	}
+
+	go func() {
+		device, resolution, err := measureModTimeResolution(dir)
+		if err != nil {
+			utils.LogInfo("Unable to measure the modification time resolution of the file system containing " + dir +
+				", so the configured timestamp safety margin is used: " + err.Error())
+			return
+		}
+
+		mtimeResolutionLock.Lock()
+		mtimeResolutions[device] = resolution
+		mtimeResolutionLock.Unlock()
+
+		utils.LogInfo("Measured modification time resolution of the file system containing " + dir + ": " + resolution.String())
+	}()
+}
+
+// measureModTimeResolution writes a file several times, in a new directory within the given directory, and returns
+// the device ID of its file system, and the coarsest of mtimeResolutionCandidates of which each of its modification
+// times is a multiple.
+func measureModTimeResolution(dir string) (uint64, time.Duration, error) {
+
+	ownedDir, err := ioutil.TempDir(dir, mtimeResolutionDirPrefix)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.RemoveAll(ownedDir)
+
+	file, err := os.Create(filepath.Join(ownedDir, "probe"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	modTimes := []time.Time{}
+	var identity *models.FileIdentity
+
+	for sample := 0; sample < mtimeResolutionSamples; sample++ {
+		if sample > 0 {
+			// Uneven delays, so that the writes do not align with a periodic clock
+			time.Sleep(time.Duration(sample*3+1) * time.Millisecond)
+		}
+
+		if _, err := file.Write([]byte("modification time resolution check\n")); err != nil {
+			return 0, 0, err
+		}
+
+		info, err := file.Stat()
+		if err != nil {
+			return 0, 0, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+		identity = getFileIdentity(info)
+	}
+
+	if identity == nil {
+		return 0, 0, errors.New("the file system cannot be identified on this platform")
+	}
+
+	for _, candidate := range mtimeResolutionCandidates {
+		matches := true
+		for _, modTime := range modTimes {
+			if modTime.UnixNano()%int64(candidate) != 0 {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return identity.Device, candidate, nil
+		}
+	}
+
+	return identity.Device, time.Nanosecond, nil
+}
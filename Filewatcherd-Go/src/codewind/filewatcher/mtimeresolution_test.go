@@ -0,0 +1,69 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// The resolution is measured in a directory owned by the filewatcher, on a separate goroutine; until then, and for
+// projects on other file systems, the configured margin is used.
+func TestDetectedTimestampSafetyMarginDoesNotWriteToProjectRoot(t *testing.T) {
+
+	detectDir, err := ioutil.TempDir("", "filewatcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(detectDir)
+
+	projectRoot, err := ioutil.TempDir("", "filewatcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(projectRoot)
+
+	if info, err := os.Stat(detectDir); err != nil || getFileIdentity(info) == nil {
+		t.Skip("File systems cannot be identified on this platform")
+	}
+
+	config := DefaultConfig().CLI
+	config.DetectTimestampSafetyMargin = true
+	config.TimestampSafetyMarginDetectDir = detectDir
+
+	if margin := getTimestampSafetyMargin(projectRoot, config); margin != config.TimestampSafetyMargin {
+		t.Errorf("The configured margin should be used until the resolution is measured, but was %v", margin)
+	}
+
+	var margin time.Duration
+	waitFor(t, "the resolution to be measured", func() bool {
+		margin = getTimestampSafetyMargin(projectRoot, config)
+		return margin != config.TimestampSafetyMargin
+	})
+
+	if margin < minDetectedTimestampSafetyMargin {
+		t.Errorf("The detected margin should be at least %v, but was %v", minDetectedTimestampSafetyMargin, margin)
+	}
+
+	for _, dir := range []string{projectRoot, detectDir} {
+		if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 0 {
+			t.Errorf("%s should be empty, but contains %d files (%v)", dir, len(files), err)
+		}
+	}
+
+	config.DetectTimestampSafetyMargin = false
+	if margin := getTimestampSafetyMargin(projectRoot, config); margin != config.TimestampSafetyMargin {
+		t.Errorf("The configured margin should be used when detection is disabled, but was %v", margin)
+	}
+}
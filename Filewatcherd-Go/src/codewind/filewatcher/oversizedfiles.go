@@ -0,0 +1,169 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"codewind/utils"
+	"os"
+	"strconv"
+	"sync"
+)
+
+/**
+ * Large files (eg videos, datasets, or build outputs) sometimes land in a watched project, and would trigger an
+ * expensive sync. If a maximum file size is set (the MaxFileSizeBytes of the WatchConfig, or the `maxFileSizeBytes` of
+ * the ProjectToWatch), the creation or modification of a larger file does not trigger a sync, and is not passed to
+ * cwctl as a changed file; if enabled (LogOversizedFiles), this is logged once per file. Directories and deletions are
+ * unaffected. The file is not otherwise excluded from the project: a sync that examines the entire project (for
+ * example, as its changes are not known) may still include it.
+ *
+ * The size is checked once the ignore rules of the project have been applied to a change, before it is added to the
+ * batch of the project (see eventbatchutil.go). As a file that is being written may not yet exceed the maximum when
+ * its first change is received, the size of each changed file is checked again once the batch ends.
+ */
+
+// maxLoggedOversizedPaths is the maximum number of files per project whose changes are logged as ignored due to their
+// size; beyond this, no further files are logged.
+const maxLoggedOversizedPaths = 1000
+
+// oversizedFileFilter identifies the changes of files of a project that exceed its maximum size. It is shared by the
+// project list goroutine and the batch utility of the project, so may be used from any goroutine.
+type oversizedFileFilter struct {
+	projectID  string
+	logEnabled bool
+
+	lock *sync.Mutex
+
+	projectRoot_synch_lock string          // The absolute, normalized, Unix-style path of the project
+	maxFileSize_synch_lock int64           // 0 if there is no limit
+	loggedPaths_synch_lock map[string]bool // The files whose changes have been logged as ignored
+}
+
+func newOversizedFileFilter(project *models.ProjectToWatch, config WatchConfig) *oversizedFileFilter {
+	result := &oversizedFileFilter{
+		projectID:              project.ProjectID,
+		logEnabled:             config.LogOversizedFiles,
+		lock:                   &sync.Mutex{},
+		loggedPaths_synch_lock: make(map[string]bool),
+	}
+	result.update(project, config)
+
+	return result
+}
+
+// maxFileSizeForProject returns the maximum size of a changed file that triggers a sync of the project: the value of
+// its maxFileSizeBytes field if set (or 0 if that is negative), otherwise the MaxFileSizeBytes of the WatchConfig. 0
+// means there is no limit.
+func maxFileSizeForProject(project *models.ProjectToWatch, config WatchConfig) int64 {
+	if project.MaxFileSizeBytes < 0 {
+		return 0
+	} else if project.MaxFileSizeBytes > 0 {
+		return project.MaxFileSizeBytes
+	}
+	return int64(config.MaxFileSizeBytes)
+}
+
+// update applies the current settings of the project; this applies from the next change.
+func (filter *oversizedFileFilter) update(project *models.ProjectToWatch, config WatchConfig) {
+	filter.lock.Lock()
+	defer filter.lock.Unlock()
+
+	filter.projectRoot_synch_lock = project.PathToMonitor
+	filter.maxFileSize_synch_lock = maxFileSizeForProject(project, config)
+}
+
+// getMaxFileSize returns the maximum size of the project, or 0 if there is no limit.
+func (filter *oversizedFileFilter) getMaxFileSize() int64 {
+	filter.lock.Lock()
+	defer filter.lock.Unlock()
+
+	return filter.maxFileSize_synch_lock
+}
+
+// isOversized returns true if the change is the creation or modification of a file, within the project, that is larger
+// than the maximum size of the project; if so, this is logged (if enabled, and not already logged for the file).
+func (filter *oversizedFileFilter) isOversized(path string, eventType string, isDir bool) bool {
+
+	if isDir || (eventType != "CREATE" && eventType != "MODIFY") {
+		return false
+	}
+
+	filter.lock.Lock()
+	maxFileSize := filter.maxFileSize_synch_lock
+	projectRoot := filter.projectRoot_synch_lock
+	filter.lock.Unlock()
+
+	if maxFileSize <= 0 {
+		return false
+	}
+
+	// Files outside the project (eg the ref paths of the project) are not found within it, so are unaffected
+	localPath, err := utils.ConvertAbsoluteUnixStyleNormalizedPathToLocalFile(utils.StripTrailingForwardSlash(projectRoot) + path)
+	if err != nil {
+		return false
+	}
+
+	info, err := os.Stat(localPath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() <= maxFileSize {
+		return false
+	}
+
+	filter.logOversizedFile(path, info.Size(), maxFileSize)
+
+	return true
+}
+
+// logOversizedFile logs that a change of the file was ignored due to its size, unless this was already logged for the
+// file (or logging is disabled).
+func (filter *oversizedFileFilter) logOversizedFile(path string, size int64, maxFileSize int64) {
+
+	if !filter.logEnabled {
+		return
+	}
+
+	filter.lock.Lock()
+	alreadyLogged := filter.loggedPaths_synch_lock[path] || len(filter.loggedPaths_synch_lock) >= maxLoggedOversizedPaths
+	if !alreadyLogged {
+		filter.loggedPaths_synch_lock[path] = true
+	}
+	filter.lock.Unlock()
+
+	if !alreadyLogged {
+		utils.LogInfo("Changes of '" + path + "' in project " + filter.projectID + " do not trigger a sync, as its size of " +
+			strconv.FormatInt(size, 10) + " bytes exceeds the maximum of " + strconv.FormatInt(maxFileSize, 10) + " bytes")
+	}
+}
+
+// removeOversizedFileEvents returns the events, other than those of files that are now larger than the maximum size of
+// the project. The sizes of the files of a large batch are checked concurrently (see utils.ForEachConcurrently).
+func removeOversizedFileEvents(events []ChangedFileEntry, filter *oversizedFileFilter) []ChangedFileEntry {
+
+	if filter == nil || filter.getMaxFileSize() <= 0 {
+		return events
+	}
+
+	oversized := make([]bool, len(events))
+	utils.ForEachConcurrently(len(events), 0, func(index int) {
+		event := events[index]
+		oversized[index] = filter.isOversized(event.path, event.eventType, event.directory)
+	})
+
+	result := make([]ChangedFileEntry, 0, len(events))
+	for index, event := range events {
+		if !oversized[index] {
+			result = append(result, event)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,358 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"codewind/utils"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * File system events are unreliable on some network and virtualized file systems. As an alternative, the project root
+ * may be polled: every X msecs (5000 by default, or the value of the FILEWATCHER_POLLING_INTERVAL_MS environment
+ * variable), the project tree is walked, and the modification time and size of each file is compared against the
+ * previous walk; CREATE/MODIFY/DELETE events are then generated for any differences, which are processed in the same
+ * way as file system events.
+ *
+ * Directories that are excluded by the filters of the project are not walked, nor are those deeper than
+ * FILEWATCHER_MAX_DEPTH. Symbolic links are never followed. A project with more than FILEWATCHER_MAX_WATCHED_FILES
+ * files and directories is not polled (see scanProjectRoot).
+ *
+ * To reduce the cost of polling many dormant projects, a project with no changes for X seconds (600 by default, or
+ * FILEWATCHER_IDLE_THRESHOLD_SECS) is instead polled every FILEWATCHER_IDLE_POLLING_INTERVAL_MS (if set), until its
+ * next change is found.
+ *
+ * Polling is used for all projects if `FILEWATCHER_MODE` is 'polling', and for individual projects if the watch
+ * self-test fails (see watchselftest.go), or if the OS limit on the number of watches (on Linux,
+ * fs.inotify.max_user_watches) is reached while watching the project root.
+ */
+
+// WatchMode determines how changes to project files are detected, and is set by the Mode of the WatchConfig, from the
+// `FILEWATCHER_MODE` environment variable (one of: native, polling).
+type WatchMode int
+
+const (
+	// WatchModeNative uses the file system events of the OS (the default).
+	WatchModeNative WatchMode = iota + 1
+
+	// WatchModePolling periodically walks the project tree.
+	WatchModePolling
+)
+
+func (mode WatchMode) String() string {
+	switch mode {
+	case WatchModeNative:
+		return "native"
+	case WatchModePolling:
+		return "polling"
+	}
+	return "unknown"
+}
+
+// parseWatchMode returns the mode with the given name (see String()), or false if the name is not recognized.
+func parseWatchMode(value string) (WatchMode, bool) {
+	for _, mode := range []WatchMode{WatchModeNative, WatchModePolling} {
+		if strings.EqualFold(strings.TrimSpace(value), mode.String()) {
+			return mode, true
+		}
+	}
+	return 0, false
+}
+
+/** The FileEventSource that polls a project root (see fileeventsource.go). */
+type pollingEventSource struct {
+	fileEventChannel
+
+	cWatcher    *CodewindWatcher
+	project     *models.ProjectToWatch
+	projectList *ProjectList
+	service     *WatchService
+
+	fallback bool // True if the root was previously watched for file system events (see startPollingFallback)
+}
+
+func newPollingEventSource(cWatcher *CodewindWatcher, project *models.ProjectToWatch, projectList *ProjectList, service *WatchService, fallback bool) *pollingEventSource {
+	return &pollingEventSource{
+		fileEventChannel: newFileEventChannel(),
+		cWatcher:         cWatcher,
+		project:          project,
+		projectList:      projectList,
+		service:          service,
+		fallback:         fallback,
+	}
+}
+
+/** Do an initial scan of the project directory, and kick off the goroutine to poll for changes. */
+func (source *pollingEventSource) Start() error {
+
+	cWatcher := source.cWatcher
+
+	if source.fallback {
+		go func() {
+			defer source.closeEvents()
+
+			// If there are too many paths to poll, every path found by the first complete scan is reported as created
+			previousScan, _ := scanProjectRoot(cWatcher, source.project)
+
+			source.projectList.CLIFileChangeUpdate(source.project.ProjectID)
+
+			source.poll(previousScan)
+		}()
+
+		return nil
+	}
+
+	cWatcher.lock.Lock()
+	cWatcher.open_synch_lock = true
+	cWatcher.polled_synch_lock = true
+	cWatcher.lock.Unlock()
+
+	previousScan, exceeded := scanProjectRoot(cWatcher, source.project)
+	if exceeded {
+		source.stop()
+		source.closeEvents()
+		return cWatcher.newMaxWatchedFilesExceededError()
+	}
+
+	utils.LogInfo("Initial scan complete for " + cWatcher.rootPath + ", paths found: " + strconv.Itoa(len(previousScan)))
+
+	go func() {
+		defer source.closeEvents()
+		source.poll(previousScan)
+	}()
+
+	return nil
+}
+
+/** Stop polling; a scan that is in progress is completed, but its changes are not reported. */
+func (source *pollingEventSource) Stop() {
+	source.stop()
+}
+
+/**
+ * Poll a project root that was watched for file system events, as the events were found to be unreliable (see
+ * watchselftest.go), or not every directory could be watched; events are then ignored. As changes may have been missed
+ * before polling began, the project is synced.
+ */
+func startPollingFallback(cWatcher *CodewindWatcher, project *models.ProjectToWatch, projectList *ProjectList, service *WatchService) {
+
+	cWatcher.lock.Lock()
+	alreadyPolled := cWatcher.polled_synch_lock
+	cWatcher.polled_synch_lock = true
+	cWatcher.lock.Unlock()
+
+	if alreadyPolled {
+		return
+	}
+
+	// A fallback source starts polling on a separate goroutine, so this does not fail
+	startFileEventSource(newPollingEventSource(cWatcher, project, projectList, service, true), cWatcher, project, projectList)
+}
+
+/** The state of a path, as last observed by the poller. */
+type polledPathState struct {
+	isDir   bool
+	modTime time.Time
+	size    int64
+}
+
+/**
+ * Periodically scan the project root, and report any changes since the previous scan, until this source is stopped.
+ * Once the project has been idle (no changes) for the idle threshold, it is polled at the idle polling interval (if
+ * any), until the next change is found.
+ */
+func (source *pollingEventSource) poll(previousScan map[string]polledPathState) {
+
+	cWatcher := source.cWatcher
+	project := source.project
+	service := source.service
+
+	pollingInterval := service.config.PollingInterval
+	idlePollingInterval := service.config.IdlePollingInterval
+
+	utils.LogInfo("Polling project " + project.ProjectID + " every " + pollingInterval.String())
+
+	lastChangeTime := time.Now()
+	idle := false
+
+	timer := time.NewTimer(pollingInterval)
+	defer timer.Stop()
+
+	for {
+
+		select {
+		case <-timer.C:
+		case <-source.stopped:
+			utils.LogInfo("Polling of project " + project.ProjectID + " has stopped, as the watcher was closed")
+			return
+		}
+
+		if _, err := os.Stat(cWatcher.rootPath); err != nil && os.IsNotExist(err) {
+			cWatcher.reportRootDeleted(project, service)
+			return
+		}
+
+		currentScan, exceeded := scanProjectRoot(cWatcher, project)
+		if exceeded {
+			// Comparing an incomplete scan would report the paths that were not scanned as deleted
+			timer.Reset(pollingInterval)
+			continue
+		}
+
+		changed := false
+
+		for path, curr := range currentScan {
+			prev, exists := previousScan[path]
+
+			changeType := ""
+			if !exists {
+				changeType = "CREATE"
+			} else if !curr.isDir && (curr.modTime != prev.modTime || curr.size != prev.size) {
+				changeType = "MODIFY"
+			}
+
+			if changeType != "" {
+				source.reportChange(changeType, path, curr.isDir)
+				changed = true
+			}
+		}
+
+		for path, prev := range previousScan {
+			if _, exists := currentScan[path]; !exists {
+				source.reportChange("DELETE", path, prev.isDir)
+				changed = true
+			}
+		}
+
+		previousScan = currentScan
+
+		nextInterval := pollingInterval
+
+		if changed {
+			lastChangeTime = time.Now()
+			if idle {
+				idle = false
+				utils.LogInfo("Project " + project.ProjectID + " is no longer idle, so is polled every " + pollingInterval.String())
+			}
+
+		} else if idlePollingInterval > 0 && time.Since(lastChangeTime) >= service.config.IdleThreshold {
+			if !idle {
+				idle = true
+				utils.LogInfo("Project " + project.ProjectID + " has been idle for " + service.config.IdleThreshold.String() +
+					", so is polled every " + idlePollingInterval.String() + " until its next change")
+			}
+			nextInterval = idlePollingInterval
+		}
+
+		timer.Reset(nextInterval)
+	}
+}
+
+/**
+ * Return the state of every path under (but not including) the project root that is not filtered out; directories
+ * deeper than the MaxDepth of the WatchConfig are not scanned. If there are more paths than the MaxWatchedFiles of the
+ * WatchConfig, the scan is abandoned, and true is returned.
+ */
+func scanProjectRoot(cWatcher *CodewindWatcher, project *models.ProjectToWatch) (map[string]polledPathState, bool) {
+
+	result := make(map[string]polledPathState)
+
+	filter, err := utils.NewPathFilter(project)
+	if err != nil {
+		// Scan everything: events for filtered paths are still filtered out by the project list
+		utils.LogSevereErr("Could not create filter for "+project.ProjectID, err)
+		filter = nil
+	}
+
+	walkErr := filepath.Walk(cWatcher.rootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// The path may have been deleted during the scan
+			return nil
+		}
+
+		if path == cWatcher.rootPath {
+			return nil
+		}
+
+		// Includes the probe files of the watch self-test
+		if cWatcher.isOwnedPath(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 && cWatcher.symlinkMode == SymlinkModeIgnore {
+			return nil
+		}
+
+		if filter != nil {
+			if relativePath := utils.ConvertEventPathToProjectRelativePath(path, cWatcher.rootPath); relativePath != nil {
+				if filter.IsFilteredOut(*relativePath, info.IsDir()) {
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+			}
+		}
+
+		if cWatcher.maxWatchedFiles > 0 && len(result) >= cWatcher.maxWatchedFiles {
+			return errMaxWatchedFilesExceeded
+		}
+
+		result[path] = polledPathState{info.IsDir(), info.ModTime(), info.Size()}
+
+		if info.IsDir() && cWatcher.isBeyondMaxDepth(path) {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	if walkErr == errMaxWatchedFilesExceeded {
+		cWatcher.reportMaxWatchedFilesExceeded("its changes are not detected until some are removed")
+		return nil, true
+	}
+
+	// Record the directories that were walked (not those beyond the max depth), so that they may be reported as watched
+	walkedDirMap := map[string]bool{cWatcher.rootPath: true}
+	for path, state := range result {
+		if state.isDir && !cWatcher.isBeyondMaxDepth(path) {
+			walkedDirMap[path] = true
+		}
+	}
+	cWatcher.lock.Lock()
+	cWatcher.watchedDirMap = walkedDirMap
+	cWatcher.knownPathCount_synch_lock = len(result)
+	cWatcher.maxWatchedFilesExceeded_synch_lock = false
+	cWatcher.lock.Unlock()
+
+	return result, false
+}
+
+func (source *pollingEventSource) reportChange(changeType string, path string, isDir bool) {
+
+	newEvent, err := newWatchEventEntry(changeType, path, isDir)
+	if err != nil {
+		utils.LogSevereErr("Unexpected file path conversion error", err)
+		return
+	}
+
+	utils.LogDebugProject(source.project.ProjectID, "WatchEventEntry (polled): "+changeType+" "+path+" "+strconv.FormatBool(isDir))
+	source.send(newEvent)
+}
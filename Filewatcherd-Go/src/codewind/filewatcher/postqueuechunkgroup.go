@@ -9,7 +9,7 @@
 *     IBM Corporation - initial API and implementation
 *******************************************************************************/
 
-package main
+package filewatcher
 
 import (
 	"codewind/utils"
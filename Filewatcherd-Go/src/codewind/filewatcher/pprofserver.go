@@ -0,0 +1,56 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+/**
+ * An optional HTTP server which exposes the Go runtime profiles (goroutine, heap, CPU, etc) of the running
+ * filewatcher under /debug/pprof/, for diagnosing goroutine leaks and memory growth, eg:
+ *
+ *   go tool pprof http://localhost:(port)/debug/pprof/heap
+ *
+ * The server is only started if the PprofAddress (host:port) or PprofPort setting of the ServerConfig is set; it
+ * listens on loopback, unless a host is specified by PprofAddress (see
+ * embeddedserver.go). The profiles expose internal details of the filewatcher, so should not be served on a public
+ * interface.
+ */
+
+// pprofServerConfig returns the listen address configuration of the pprof server (see embeddedserver.go).
+func pprofServerConfig(config ServerConfig) embeddedServerConfig {
+	return embeddedServerConfig{
+		name:          "pprof server",
+		address:       config.PprofAddress,
+		port:          config.PprofPort,
+		addressEnvVar: "FILEWATCHER_PPROF_ADDRESS",
+		portEnvVar:    "FILEWATCHER_PPROF_PORT",
+	}
+}
+
+// StartPprofServer starts the profiling HTTP server on a separate goroutine, if enabled by PprofAddress or PprofPort,
+// returning the server (nil if not enabled); an error is returned if it could not be started.
+func StartPprofServer(config ServerConfig) (*http.Server, error) {
+
+	// The handlers are registered on a separate mux, rather than the default mux, so that they are never exposed
+	// by any other server.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return startEmbeddedServer(pprofServerConfig(config), mux)
+}
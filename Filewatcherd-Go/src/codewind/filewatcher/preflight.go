@@ -0,0 +1,211 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Before anything is watched, the setup of the filewatcher may be checked (via Watcher.Check, or the `--check` argument
+ * of the filewatcher binary): that cwctl can be run, that the TLS configuration and authentication are usable, and that
+ * the project list can be fetched from the server. Nothing is watched or synced, and each check is only attempted
+ * once (without the retries of the watcher), so that the report reflects the current state of the setup.
+ */
+
+// CheckStatus is the outcome of a single check of the setup.
+type CheckStatus string
+
+const (
+	CheckPassed  CheckStatus = "PASSED"
+	CheckFailed  CheckStatus = "FAILED"
+	CheckSkipped CheckStatus = "SKIPPED" // The check does not apply to the configuration
+)
+
+// CheckResult is the outcome of a single check of the setup, with a description of what was found.
+type CheckResult struct {
+	Name   string
+	Status CheckStatus
+	Detail string
+}
+
+// CheckReport is the outcome of each check of the setup, in the order in which they were run.
+type CheckReport struct {
+	Results []CheckResult
+}
+
+// Passed returns true if no check failed.
+func (report *CheckReport) Passed() bool {
+	for _, result := range report.Results {
+		if result.Status == CheckFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a summary of the report, with one line per check.
+func (report *CheckReport) String() string {
+
+	nameWidth := 0
+	for _, result := range report.Results {
+		if len(result.Name) > nameWidth {
+			nameWidth = len(result.Name)
+		}
+	}
+
+	var builder strings.Builder
+	for _, result := range report.Results {
+		builder.WriteString(result.Name + ":" + strings.Repeat(" ", nameWidth-len(result.Name)+1))
+		builder.WriteString(string(result.Status) + strings.Repeat(" ", len(CheckSkipped)-len(result.Status)+1))
+		builder.WriteString(result.Detail + "\n")
+	}
+
+	if report.Passed() {
+		builder.WriteString("All checks passed.\n")
+	} else {
+		builder.WriteString("One or more checks failed.\n")
+	}
+
+	return builder.String()
+}
+
+func (report *CheckReport) add(name string, status CheckStatus, detail string) {
+	report.Results = append(report.Results, CheckResult{name, status, detail})
+}
+
+// Check checks the setup of the watcher (see preflight.go), without watching anything; it may be called whether or
+// not the watcher has been started.
+func (watcher *Watcher) Check() *CheckReport {
+
+	report := &CheckReport{}
+
+	checkInstaller(report, watcher.installerPath, watcher.config.CLI)
+
+	if watcher.baseURL == "" {
+		report.add("TLS", CheckSkipped, "No server URL was given")
+		report.add("Authentication", CheckSkipped, "No server URL was given")
+		report.add("Server", CheckSkipped, "No server URL was given")
+		return report
+	}
+
+	watcher.applyServerConfig()
+
+	checkServerTLSConfig(report, watcher.config.Server, watcher.serverTLSConfigErr)
+
+	checkAuthentication(report)
+
+	checkServerProjectList(report, watcher.baseURL)
+
+	return report
+}
+
+// checkInstaller checks that the installer can be run, and that it supports `cwctl project sync` (or the sync command
+// of the configuration).
+func checkInstaller(report *CheckReport, installerPath string, config CLIConfig) {
+
+	const name = "cwctl"
+
+	if strings.TrimSpace(installerPath) == "" {
+		report.add(name, CheckSkipped, "No installer path was given, so cwctl is not run")
+		return
+	}
+
+	if _, err := runCwctlProbeCommand(installerPath, "--version"); err != nil {
+		report.add(name, CheckFailed, "Unable to run "+installerPath+": "+err.Error())
+		return
+	}
+
+	syncCommand := config.syncCommand()
+	capabilities := getCwctlSyncCapabilities(installerPath, syncCommand)
+	if !capabilities.syncSupported {
+		report.add(name, CheckFailed, "`"+strings.TrimSpace(installerPath+" "+strings.Join(syncCommand.subcommand(), " "))+
+			"` does not appear to support the required arguments ("+strings.Join(syncCommand.flags(), ", ")+")")
+		return
+	}
+
+	version := capabilities.version
+	if version == "" {
+		version = "unknown"
+	}
+
+	report.add(name, CheckPassed, installerPath+", version: "+version)
+}
+
+// checkServerTLSConfig reports the result of building the TLS configuration of the watcher (see newServerTLSConfig):
+// whether the CA certificates of the CA file (if any) could be read.
+func checkServerTLSConfig(report *CheckReport, config ServerConfig, tlsConfigErr error) {
+
+	const name = "TLS"
+
+	if config.TLSInsecure {
+		report.add(name, CheckPassed, "The certificate of the server is not verified (FILEWATCHER_TLS_INSECURE)")
+		return
+	}
+
+	caFile := strings.TrimSpace(config.CAFile)
+	if caFile == "" {
+		report.add(name, CheckPassed, "The system CA certificates are trusted")
+		return
+	}
+
+	if tlsConfigErr != nil {
+		report.add(name, CheckFailed, "Unable to use FILEWATCHER_CA_FILE: "+tlsConfigErr.Error())
+		return
+	}
+
+	report.add(name, CheckPassed, "The system CA certificates, and those in "+caFile+", are trusted")
+}
+
+// checkAuthentication checks that a token can be obtained, if authentication is configured; whether the server
+// accepts it is checked by checkServerProjectList.
+func checkAuthentication(report *CheckReport) {
+
+	const name = "Authentication"
+
+	token, err := getTokenProvider().GetToken()
+	if err != nil {
+		report.add(name, CheckFailed, "Unable to obtain an access token: "+err.Error())
+		return
+	}
+
+	if token == "" {
+		report.add(name, CheckSkipped, "Authentication is not configured (see FILEWATCHER_AUTH_TOKEN), so requests are unauthenticated")
+		return
+	}
+
+	report.add(name, CheckPassed, "An access token was obtained")
+}
+
+// checkServerProjectList checks that the server is reachable, and that the project list can be fetched from it.
+func checkServerProjectList(report *CheckReport, baseURL string) {
+
+	const name = "Server"
+
+	projects, err := sendGet(baseURL)
+	if err != nil {
+		detail := err.Error()
+		if getErr, ok := err.(*getRequestError); ok {
+			if getErr.statusCode == 0 {
+				detail = "The server is not reachable: " + detail
+			} else if getErr.statusCode == http.StatusUnauthorized || getErr.statusCode == http.StatusForbidden {
+				detail = "The server rejected the credentials: " + detail
+			}
+		}
+		report.add(name, CheckFailed, detail)
+		return
+	}
+
+	report.add(name, CheckPassed, baseURL+" is reachable, and returned "+strconv.Itoa(len(*projects))+" project(s)")
+}
@@ -0,0 +1,1180 @@
+/*******************************************************************************
+* Copyright (c) 2019, 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"codewind/utils"
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProjectList is the API entrypoint for other code in this application to perform operations against monitored projects:
+// - Update project list from a GET response
+// - Update project list from a WebSocket response
+// - Process a file update and pass it to batch utility
+//
+// Behind the scenes, the ProjectList API calls are translated into channel messages and placed on the projectOperationChannel.
+// This allows us to provide thread safety to the internal project list data, as that data will only ever be accessed
+// by a single goroutine.
+type ProjectList struct {
+	projectOperationChannel chan *projectListChannelMessage
+	pathToInstaller         string  // maybe be empty
+	config                  *Config // Immutable; if Watch.HonorGitIgnore, file changes ignored by the project's .gitignore files are filtered out
+}
+
+type receiveNewWatchEntriesMessage struct {
+	watchEventEntry *models.WatchEventEntry
+	project         *models.ProjectToWatch
+}
+
+// NewProjectList ... The config is used for the CLI state and batching of each project.
+func NewProjectList(postOutputQueue *HttpPostOutputQueue, pathToInstallerParam string, configParam *Config) *ProjectList {
+
+	result := &ProjectList{}
+	result.projectOperationChannel = make(chan *projectListChannelMessage)
+	result.pathToInstaller = pathToInstallerParam
+	result.config = configParam
+	go result.channelListener(postOutputQueue)
+
+	return result
+}
+
+type projectListMessageType int
+
+const (
+	setWatchServiceMsg = iota + 1
+	updateProjectListFromWebSocketMsg
+	updateProjectListFromGetRequestMsg
+	receiveNewWatchEventEntriesMsg
+	requestDebugMsg
+	cliFileChangeUpdate
+	receiveIndividualChangesFileListMsg
+	retryFailedSyncsMsg
+	projectRootDeletedMsg
+	projectWatchEstablishedMsg
+	setProjectPausedMsg
+	forceSyncMsg
+	shutdownMsg
+	watchDetailsMsg
+)
+
+// errProjectNotFound is returned by PauseProject/ResumeProject if the project is not watched.
+var errProjectNotFound = errors.New("Project is not being watched")
+
+type projectListChannelMessage struct {
+	msgType                                projectListMessageType
+	setWatchServiceMessage                 *WatchService
+	updateProjectListFromWebSocketMessage  *models.WatchChangeJson
+	updateProjectListFromGetRequestMessage *models.WatchlistEntries
+	receiveNewWatchEventEntriesMessage     *receiveNewWatchEntriesMessage
+	requestDebugMessage                    chan string
+	cliFileChangeUpdateMessage             string             // project id
+	cliFileChangeUpdateChanges             []ChangedFileEntry // nil if the changes are unknown
+	cliFileChangeUpdateFullResync          bool               // true if the entire project must be synced
+	cliFileChangeUpdateCorrelationID       string             // the correlation ID of the batch of changes, if any
+	receiveIndividualChangesMessage        *individualChangesMessage
+	projectWatchMessage                    string // project id
+	setProjectPausedMessage                *setProjectPausedMessage
+	shutdownMessage                        chan []shutdownProject
+	watchDetailsMessage                    chan *watchDetailsResponse
+}
+
+// shutdownProject is the state of a project that must be shut down, as returned by Shutdown.
+type shutdownProject struct {
+	projectID      string
+	eventBatchUtil *FileChangeEventBatchUtil
+	cliState       *CLIState // Nullable
+}
+
+type setProjectPausedMessage struct {
+	projectID string
+	paused    bool
+	response  chan error
+}
+
+type individualChangesMessage struct {
+	projectID string
+	entries   []ChangedFileEntry
+}
+
+// ReceiveIndividualChangesFileList ...
+func (projectList *ProjectList) ReceiveIndividualChangesFileList(projectID string, changedFiles []ChangedFileEntry) {
+
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:                         receiveIndividualChangesFileListMsg,
+		receiveIndividualChangesMessage: &individualChangesMessage{projectID, changedFiles},
+	}
+
+}
+
+// SetWatchService ...
+func (projectList *ProjectList) SetWatchService(watchService *WatchService) {
+
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:                setWatchServiceMsg,
+		setWatchServiceMessage: watchService,
+	}
+
+}
+
+// UpdateProjectListFromWebSocket ...
+func (projectList *ProjectList) UpdateProjectListFromWebSocket(watchChange *models.WatchChangeJson) {
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:                               updateProjectListFromWebSocketMsg,
+		updateProjectListFromWebSocketMessage: watchChange,
+	}
+}
+
+// UpdateProjectListFromGetRequest ...
+func (projectList *ProjectList) UpdateProjectListFromGetRequest(entries *models.WatchlistEntries) {
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:                                updateProjectListFromGetRequestMsg,
+		updateProjectListFromGetRequestMessage: entries,
+	}
+}
+
+// RequestDebugMessage ...
+func (projectList *ProjectList) RequestDebugMessage() chan string {
+	result := make(chan string)
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:             requestDebugMsg,
+		requestDebugMessage: result,
+	}
+	return result
+
+}
+
+// ReceiveNewWatchEventEntries ...
+func (projectList *ProjectList) ReceiveNewWatchEventEntries(entry *models.WatchEventEntry, project *models.ProjectToWatch) {
+
+	rnwem := &receiveNewWatchEntriesMessage{
+		entry,
+		project,
+	}
+
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:                            receiveNewWatchEventEntriesMsg,
+		receiveNewWatchEventEntriesMessage: rnwem,
+	}
+}
+
+// CLIFileChangeUpdate ...
+func (projectList *ProjectList) CLIFileChangeUpdate(projectID string) {
+	projectList.CLIFileChangeUpdateWithChanges(projectID, nil, "")
+}
+
+// CLIFileChangeUpdateWithChanges is the same as CLIFileChangeUpdate, but with the changes that were received (sorted by
+// timestamp), which are passed to the CLI state of the project; nil if the changes are unknown. The correlation ID of
+// the batch of changes (see syncchangeset.go) is logged with the sync of the changes; it may be empty.
+func (projectList *ProjectList) CLIFileChangeUpdateWithChanges(projectID string, changes []ChangedFileEntry, correlationID string) {
+
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:                          cliFileChangeUpdate,
+		cliFileChangeUpdateMessage:       projectID,
+		cliFileChangeUpdateChanges:       changes,
+		cliFileChangeUpdateCorrelationID: correlationID,
+	}
+}
+
+// CLIFullResyncUpdate is the same as CLIFileChangeUpdate, but the entire project must be synced (for example, as too
+// many changes were received to track them individually); this supersedes any active sync of individual changes.
+func (projectList *ProjectList) CLIFullResyncUpdate(projectID string, correlationID string) {
+
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:                          cliFileChangeUpdate,
+		cliFileChangeUpdateMessage:       projectID,
+		cliFileChangeUpdateFullResync:    true,
+		cliFileChangeUpdateCorrelationID: correlationID,
+	}
+}
+
+// RetryFailedSyncs immediately retries the most recent sync of each project, if it failed (rather than waiting for
+// its scheduled retry); this is called once the connection to the server is re-established. The retries are
+// staggered, in order of project ID (see staggerSyncs).
+func (projectList *ProjectList) RetryFailedSyncs() {
+
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType: retryFailedSyncsMsg,
+	}
+}
+
+// ProjectRootDeleted is called by the watch service when the root directory of a project no longer exists: the
+// project is not synced until its watch is re-established.
+func (projectList *ProjectList) ProjectRootDeleted(projectID string) {
+
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:             projectRootDeletedMsg,
+		projectWatchMessage: projectID,
+	}
+}
+
+// ProjectWatchEstablished is called by the watch service when the watch of a project is established (or
+// re-established after its root directory was recreated).
+func (projectList *ProjectList) ProjectWatchEstablished(projectID string) {
+
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:             projectWatchEstablishedMsg,
+		projectWatchMessage: projectID,
+	}
+}
+
+// PauseProject stops cwctl from being run for the project until ResumeProject is called; file changes are still
+// received while paused. Returns errProjectNotFound if the project is not watched.
+func (projectList *ProjectList) PauseProject(projectID string) error {
+	return projectList.setProjectPaused(projectID, true)
+}
+
+// ResumeProject resumes syncing of a paused project, running a single sync for any changes received while paused.
+// Returns errProjectNotFound if the project is not watched.
+func (projectList *ProjectList) ResumeProject(projectID string) error {
+	return projectList.setProjectPaused(projectID, false)
+}
+
+// ForceSync runs cwctl for every watched project, whether or not any file changes were detected; this allows
+// changes that may have been missed by the watcher to be synced promptly. The syncs are staggered, in order of project
+// ID (see staggerSyncs).
+func (projectList *ProjectList) ForceSync() {
+
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType: forceSyncMsg,
+	}
+}
+
+// Shutdown stops the project list from accepting new file changes and project list updates, and returns the projects
+// that were being watched, so that they may be shut down by the caller.
+func (projectList *ProjectList) Shutdown() []shutdownProject {
+	response := make(chan []shutdownProject, 1)
+
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:         shutdownMsg,
+		shutdownMessage: response,
+	}
+
+	return <-response
+}
+
+func (projectList *ProjectList) setProjectPaused(projectID string, paused bool) error {
+	response := make(chan error, 1)
+
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:                 setProjectPausedMsg,
+		setProjectPausedMessage: &setProjectPausedMessage{projectID, paused, response},
+	}
+
+	return <-response
+}
+
+func (projectList *ProjectList) channelListener(postOutputQueue *HttpPostOutputQueue) {
+
+	/** projectId -> most recent watch list for a project */
+	var projectsMap map[string]*projectObject
+	projectsMap = make(map[string]*projectObject)
+
+	individualFileWatchService := NewIndividualFileWatchService(projectList)
+
+	var watchService *WatchService
+
+	// Once true, new file changes and project list updates are ignored
+	shuttingDown := false
+
+	for {
+
+		select {
+		case projectOperationMessage := <-projectList.projectOperationChannel:
+			if shuttingDown && isIgnoredOnShutdown(projectOperationMessage.msgType) {
+				utils.LogDebug("Ignoring project list message of type " + strconv.Itoa(int(projectOperationMessage.msgType)) + ", as the filewatcher is shutting down")
+
+			} else if projectOperationMessage.msgType == setWatchServiceMsg {
+				watchService = projectOperationMessage.setWatchServiceMessage
+
+			} else if projectOperationMessage.msgType == updateProjectListFromWebSocketMsg {
+				projectList.handleUpdateProjectListFromWebSocket(projectOperationMessage.updateProjectListFromWebSocketMessage, projectsMap, watchService, individualFileWatchService, postOutputQueue)
+
+			} else if projectOperationMessage.msgType == updateProjectListFromGetRequestMsg {
+				projectList.handleUpdateProjectListFromGetRequest(projectOperationMessage.updateProjectListFromGetRequestMessage, projectsMap, watchService, individualFileWatchService, postOutputQueue)
+
+			} else if projectOperationMessage.msgType == receiveNewWatchEventEntriesMsg {
+				msg := projectOperationMessage.receiveNewWatchEventEntriesMessage
+				projectList.handleReceiveNewWatchEventEntries(msg.project, msg.watchEventEntry, projectsMap)
+
+			} else if projectOperationMessage.msgType == requestDebugMsg {
+				responseChan := projectOperationMessage.requestDebugMessage
+				responseChan <- projectList.handleRequestDebugMsg(projectsMap)
+
+			} else if projectOperationMessage.msgType == cliFileChangeUpdate {
+				projectList.handleCliFileChangeUpdate(projectOperationMessage.cliFileChangeUpdateMessage, projectOperationMessage.cliFileChangeUpdateChanges, projectOperationMessage.cliFileChangeUpdateFullResync, projectOperationMessage.cliFileChangeUpdateCorrelationID, projectsMap)
+
+			} else if projectOperationMessage.msgType == receiveIndividualChangesFileListMsg {
+				msg := projectOperationMessage.receiveIndividualChangesMessage
+				projectList.handleReceiveIndividualChangesFileList(msg.projectID, msg.entries, projectsMap)
+
+			} else if projectOperationMessage.msgType == retryFailedSyncsMsg {
+				syncFuncs := []func() error{}
+				for _, projectID := range sortedProjectIDs(projectsMap) {
+					if value := projectsMap[projectID]; value != nil && value.cliState != nil {
+						syncFuncs = append(syncFuncs, value.cliState.RetryFailedSync)
+					}
+				}
+				projectList.staggerSyncs(syncFuncs)
+
+			} else if projectOperationMessage.msgType == projectRootDeletedMsg {
+				projectList.handleProjectRootDeleted(projectOperationMessage.projectWatchMessage, projectsMap)
+
+			} else if projectOperationMessage.msgType == projectWatchEstablishedMsg {
+				projectList.handleProjectWatchEstablished(projectOperationMessage.projectWatchMessage, projectsMap)
+
+			} else if projectOperationMessage.msgType == setProjectPausedMsg {
+				msg := projectOperationMessage.setProjectPausedMessage
+				msg.response <- handleSetProjectPaused(msg.projectID, msg.paused, projectsMap)
+
+			} else if projectOperationMessage.msgType == forceSyncMsg {
+				utils.LogInfo("Forcing a sync of all " + strconv.Itoa(len(projectsMap)) + " watched project(s), staggered over up to " +
+					projectList.config.CLI.SyncJitter.String())
+				syncFuncs := []func() error{}
+				for _, projectID := range sortedProjectIDs(projectsMap) {
+					projectID := projectID
+					syncFuncs = append(syncFuncs, func() error {
+						projectList.CLIFileChangeUpdate(projectID)
+						return nil
+					})
+				}
+				projectList.staggerSyncs(syncFuncs)
+
+			} else if projectOperationMessage.msgType == shutdownMsg {
+				shuttingDown = true
+
+				// File changes are no longer accepted, so the individual files need no longer be watched. This is
+				// done on a separate goroutine, as the service may itself be blocked sending changes to this one.
+				go individualFileWatchService.Dispose()
+
+				result := []shutdownProject{}
+				for projectID, value := range projectsMap {
+					if value != nil {
+						result = append(result, shutdownProject{projectID, value.eventBatchUtil, value.cliState})
+					}
+				}
+				projectOperationMessage.shutdownMessage <- result
+
+			} else if projectOperationMessage.msgType == watchDetailsMsg {
+				projectOperationMessage.watchDetailsMessage <- projectList.handleWatchDetailsRequest(projectsMap, watchService)
+			}
+		}
+
+		// Published as a statistic (see expvarstats.go); the projects are no longer watched once shutting down
+		if shuttingDown {
+			setWatchedProjectCount(projectList, -1)
+		} else {
+			setWatchedProjectCount(projectList, len(projectsMap))
+		}
+
+	}
+}
+
+func (projectList *ProjectList) handleReceiveIndividualChangesFileList(projectID string, changedFiles []ChangedFileEntry, projectsMaps map[string]*projectObject) {
+
+	projectRootPaths := []string{}
+
+	for _, projectObject := range projectsMaps {
+		projectRootPaths = append(projectRootPaths, (*projectObject).project.PathToMonitor)
+	}
+
+	filteredChanges := []ChangedFileEntry{}
+
+	for _, cfParam := range changedFiles {
+
+		match := false
+
+		for _, projectRoot := range projectRootPaths {
+
+			// The changes of files under a project root are already reported by the watch service
+			if utils.IsEventPathWithinProjectRoot(cfParam.path, projectRoot) {
+				utils.LogInfo("Ignoring file change that was under a project root: " + cfParam.path + ", project root: " + projectRoot)
+				match = true
+				break
+			}
+		}
+
+		if !match {
+			filteredChanges = append(filteredChanges, cfParam)
+		}
+	}
+
+	if len(filteredChanges) == 0 {
+		utils.LogInfo("No remaining individual file changes to transmit")
+		return
+	}
+
+	po, exists := projectsMaps[projectID]
+	if exists {
+		for _, change := range filteredChanges {
+			po.recordFileChangeObserved(change.timestamp)
+		}
+		po.eventBatchUtil.AddChangedFiles(filteredChanges)
+	} else {
+		utils.LogSevere("Could not locate event processing for project id " + projectID)
+	}
+
+}
+
+/** Inform the CLI of a file change on the specified project. */
+func (projectList *ProjectList) handleCliFileChangeUpdate(projectID string, changes []ChangedFileEntry, fullResync bool, correlationID string, projectsMap map[string]*projectObject) {
+
+	value, exists := projectsMap[projectID]
+
+	if strings.TrimSpace(projectList.pathToInstaller) == "" {
+		utils.LogDebug("Skipping invocation of CLI command due to no installer path.")
+		return
+	}
+
+	if !exists || value == nil {
+		utils.LogSevere("Asked to invoke CLI on a project that wasn't in the projects map: " + projectID)
+		return
+	}
+
+	if value.rootDeleted {
+		utils.LogDebug("Skipping invocation of CLI command, as the root directory of the project was deleted: " + projectID)
+		return
+	}
+
+	if value.cliState != nil {
+		if fullResync {
+			value.cliState.OnFullResyncRequested(value.project.ProjectCreationTime, value.project.Clone(), correlationID)
+		} else {
+			value.cliState.OnFileChangeEventWithChanges(value.project.ProjectCreationTime, value.project.Clone(), changes, correlationID)
+		}
+	}
+
+}
+
+// staggerSyncs calls each syncFunc in turn on a separate goroutine, each after a random delay of up to the sync jitter
+// of the config (no delay, if the jitter is 0). When every project is synced at once, this spreads the start of their
+// cwctl processes over the jitter, rather than spawning them all simultaneously (and then waiting on the concurrent
+// process limit); as the delay is bounded, every sync still starts promptly. The delays are sorted, so that the syncs
+// are always started in the given order (eg of project ID, see sortedProjectIDs), which keeps the logs predictable. As
+// the syncFuncs are never called on the project list goroutine, they may send messages to the project list.
+func (projectList *ProjectList) staggerSyncs(syncFuncs []func() error) {
+
+	if len(syncFuncs) == 0 {
+		return
+	}
+
+	delays := make([]time.Duration, len(syncFuncs))
+	if jitter := projectList.config.CLI.SyncJitter; jitter > 0 {
+		for index := range delays {
+			delays[index] = time.Duration(rand.Int63n(int64(jitter) + 1))
+		}
+		sort.Slice(delays, func(i, j int) bool {
+			return delays[i] < delays[j]
+		})
+	}
+
+	go func() {
+		start := time.Now()
+		for index, syncFunc := range syncFuncs {
+			if remaining := delays[index] - time.Since(start); remaining > 0 {
+				time.Sleep(remaining)
+			}
+			syncFunc()
+		}
+	}()
+}
+
+// sortedProjectIDs returns the IDs of the projects of the map, in sorted order.
+func sortedProjectIDs(projectsMap map[string]*projectObject) []string {
+	result := make([]string, 0, len(projectsMap))
+	for projectID := range projectsMap {
+		result = append(result, projectID)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+/** Dispose of the CLI state of a project whose root directory was deleted, so that no further syncs are attempted. */
+func (projectList *ProjectList) handleProjectRootDeleted(projectID string, projectsMap map[string]*projectObject) {
+
+	value, exists := projectsMap[projectID]
+	if !exists || value == nil || value.rootDeleted {
+		return
+	}
+
+	utils.LogInfo("Suspending syncs of project " + projectID + " until its root directory is recreated")
+
+	value.rootDeleted = true
+	disposeProjectObject(value)
+	value.cliState = nil
+}
+
+/**
+ * Inform the CLI of the newly established watch; if the watch was re-established after the root directory of the
+ * project was deleted, a new CLI state is created first. */
+func (projectList *ProjectList) handleProjectWatchEstablished(projectID string, projectsMap map[string]*projectObject) {
+
+	value, exists := projectsMap[projectID]
+	if !exists || value == nil {
+		utils.LogSevere("Watch established for a project that wasn't in the projects map: " + projectID)
+		return
+	}
+
+	if value.rootDeleted {
+		value.rootDeleted = false
+
+		cliState, err := projectList.newCLIStateForProject(value.project)
+		if err != nil {
+			utils.LogSevereErr("Unable to create CLI state for project "+projectID, err)
+		} else {
+			value.cliState = cliState
+			if cliState != nil && value.paused {
+				cliState.Pause()
+			}
+		}
+	}
+
+	projectList.handleCliFileChangeUpdate(projectID, nil, false, "", projectsMap)
+}
+
+/** Returns true for the messages which may lead to new syncs or watches, which are ignored on shutdown. */
+func isIgnoredOnShutdown(msgType projectListMessageType) bool {
+	switch msgType {
+	case updateProjectListFromWebSocketMsg, updateProjectListFromGetRequestMsg, receiveNewWatchEventEntriesMsg,
+		receiveIndividualChangesFileListMsg, retryFailedSyncsMsg, projectWatchEstablishedMsg, forceSyncMsg:
+		return true
+	}
+	return false
+}
+
+/** Pause or resume syncing of the project; the paused state is kept if the CLI state is later recreated. */
+func handleSetProjectPaused(projectID string, paused bool, projectsMap map[string]*projectObject) error {
+
+	value, exists := projectsMap[projectID]
+	if !exists || value == nil {
+		return errProjectNotFound
+	}
+
+	value.paused = paused
+
+	if value.cliState == nil {
+		return nil
+	}
+
+	if paused {
+		return value.cliState.Pause()
+	}
+	return value.cliState.Resume()
+}
+
+/** Generate an overview of the state of the project list, including the projects being watched. */
+func (projectList *ProjectList) handleRequestDebugMsg(projectsMap map[string]*projectObject) string {
+	result := ""
+	for projectID, obj := range projectsMap {
+
+		if obj == nil {
+			continue
+		}
+
+		result += "- " + projectID + " -> " + obj.project.PathToMonitor
+		if obj.paused {
+			result += " | paused"
+		}
+		if obj.eventBatchUtil != nil {
+			result += " | " + strings.TrimSpace(obj.eventBatchUtil.RequestDebugMessage())
+		}
+
+		if len(obj.project.IgnoredPaths) > 0 {
+
+			result += " | ignoredPaths: "
+
+			for _, val := range obj.project.IgnoredPaths {
+				result += "'" + val + "' "
+			}
+		}
+
+		if len(obj.project.IgnoredPatterns) > 0 {
+
+			result += " | ignoredPatterns: "
+
+			for _, val := range obj.project.IgnoredPatterns {
+				result += "'" + val + "' "
+			}
+		}
+
+		if len(obj.project.IncludedPatterns) > 0 {
+
+			result += " | includedPatterns: "
+
+			for _, val := range obj.project.IncludedPatterns {
+				result += "'" + val + "' "
+			}
+		}
+
+		result += "\n"
+
+	}
+	return result
+
+}
+
+/**
+ * This function processes data that is from the GET API response; we use this to synchronize the list of projects
+ * that we are watching with what the server wants us to watch.  */
+func (projectList *ProjectList) handleUpdateProjectListFromGetRequest(entries *models.WatchlistEntries, projectsMap map[string]*projectObject, watchService *WatchService, indivFileWatchService *IndividualFileWatchService, postOutputQueue *HttpPostOutputQueue) {
+
+	// The GET result is the authoritative list of projects, so reconcile our state against it: this also
+	// corrects for any WebSocket updates that were missed.
+
+	/** project id -> true*/
+	projectIDInHTTPResult := make(map[string]bool)
+
+	for _, project := range *entries {
+
+		_, exists := projectIDInHTTPResult[project.ProjectID]
+		if exists {
+			utils.LogSevere("Multiple projects in the project list share the same project ID: " + project.ProjectID)
+		}
+
+		projectIDInHTTPResult[project.ProjectID] = true
+	}
+
+	currentProjects := make([]models.ProjectToWatch, 0, len(projectsMap))
+	for _, val := range projectsMap {
+		currentProjects = append(currentProjects, *val.project)
+	}
+
+	diff := models.DiffProjectLists(currentProjects, *entries)
+
+	if !diff.IsEmpty() {
+		utils.LogInfo("Project list from GET differs from the watched projects: added " + strconv.Itoa(len(diff.Added)) + ", removed " + strconv.Itoa(len(diff.Removed)) + ", changed " + strconv.Itoa(len(diff.Changed)))
+	}
+
+	// Delete projects that are not in the entries list
+	// - We do delete first, so as not to interfere with the 'create projects' step below it,
+	//   that may share the same path.
+
+	removedProjects := make([]*projectObject, 0)
+
+	for _, removed := range diff.Removed {
+		removedProject := projectsMap[removed.ProjectID]
+
+		utils.LogInfo("Removing project from watch list from GET: " + removedProject.project.ProjectID + " " + removedProject.project.PathToMonitor)
+		delete(projectsMap, removedProject.project.ProjectID)
+		disposeProjectObject(removedProject)
+		indivFileWatchService.SetFilesToWatch(removedProject.project.ProjectID, []string{})
+
+		removedProjects = append(removedProjects, removedProject)
+	}
+
+	for _, removedProject := range removedProjects {
+		fileToMonitor, err := utils.ConvertAbsoluteUnixStyleNormalizedPathToLocalFile(removedProject.project.PathToMonitor)
+		if err != nil {
+			utils.LogSevereErr("Unable to convert path after project remove", err)
+			continue
+		}
+		utils.LogDebug("Calling watch service removePath with file: " + fileToMonitor)
+
+		watchService.RemoveRootPath(fileToMonitor, *(removedProject.project))
+	}
+
+	// Next, create new projects, or update existing ones that have changed
+	for _, project := range diff.Added {
+		projectList.processProject(project, projectsMap, postOutputQueue, watchService, indivFileWatchService)
+	}
+	for _, project := range diff.Changed {
+		projectList.processProject(project, projectsMap, postOutputQueue, watchService, indivFileWatchService)
+	}
+
+}
+
+/** Release the resources (the goroutines of the CLI state and batch utility) of a project that is no longer watched. */
+func disposeProjectObject(po *projectObject) {
+	if po.cliState != nil {
+		po.cliState.Dispose()
+	}
+	if po.eventBatchUtil != nil {
+		po.eventBatchUtil.Dispose()
+	}
+}
+
+/**
+ * This function processes data that is from the WebSocket endpoint event; we use this to add/remove/update the list of projects
+ * that we are watching with what the server wants us to watch.
+ *
+ * The difference between 'update from GET' and 'update from WebSocket' is that 'update from GET' does not indicate
+ * how the project list changes, whereas 'update from WebSocket' does via the 'ChangeType'
+ */
+func (projectList *ProjectList) handleUpdateProjectListFromWebSocket(webSocketUpdates *models.WatchChangeJson, projectsMap map[string]*projectObject, watchService *WatchService, indivFileWatchService *IndividualFileWatchService, postOutputQueue *HttpPostOutputQueue) {
+
+	utils.LogInfo("Processing a received file watch state from WebSocket")
+
+	for _, projectFromWS := range webSocketUpdates.Projects {
+
+		if projectFromWS.ChangeType == "delete" {
+			currProjWatchState, exists := projectsMap[projectFromWS.ProjectID]
+			if exists {
+				utils.LogInfo("Removing project from watch list: " + currProjWatchState.project.ProjectID + " " + currProjWatchState.project.PathToMonitor)
+
+				delete(projectsMap, projectFromWS.ProjectID)
+				disposeProjectObject(currProjWatchState)
+
+				pathToRemove, err := utils.ConvertAbsoluteUnixStyleNormalizedPathToLocalFile(currProjWatchState.project.PathToMonitor)
+				if err != nil {
+					utils.LogSevere("Unable to convert path to absolute unix style path" + pathToRemove)
+				} else {
+					utils.LogDebug("Calling watch service removePath with file: " + pathToRemove)
+					if watchService != nil {
+						watchService.RemoveRootPath(pathToRemove, projectFromWS)
+					} else {
+						utils.LogSevere("Watch service is not set in project list and a RemoveRootPath was missed: " + pathToRemove)
+					}
+				}
+
+				indivFileWatchService.SetFilesToWatch(projectFromWS.ProjectID, []string{})
+
+			} else {
+				utils.LogError("Unable to find deleted project from WebSocket in project map: " + projectFromWS.ProjectID)
+			}
+
+		} else {
+			projectList.processProject(projectFromWS, projectsMap, postOutputQueue, watchService, indivFileWatchService)
+		}
+	}
+
+}
+
+// Synchronize the project in our projectsMap (if it exists), with the new 'projectToProcess' from the server.
+// If it doesn't exist, create it.
+func (projectList *ProjectList) processProject(projectToProcess models.ProjectToWatch, projectsMap map[string]*projectObject, postOutputQueue *HttpPostOutputQueue, watchService *WatchService, indivFileWatchService *IndividualFileWatchService) {
+
+	currProjWatchState, exists := projectsMap[projectToProcess.ProjectID]
+	if exists {
+		// If we have previously monitored this project...
+
+		wasProjectObjectUpdatedInThisBlock := false
+
+		oldProjectToWatch := currProjWatchState.project
+
+		// This method may receive ProjectToWatch objects with either null or non-null
+		// values for the `projectCreationTimeInAbsoluteMsecs` field. However, under no
+		// circumstances should we ever replace a non-null value for this field with a
+		// null field.
+		//
+		// For this reason, we carefully compare these values in this if block and
+		// update accordingly.
+		{
+			pctUpdated := false
+
+			pctOldProjectToWatch := oldProjectToWatch.ProjectCreationTime
+			pctNewProjectToWatch := projectToProcess.ProjectCreationTime
+
+			newPct := int64(0)
+
+			// If both the old and new values are not null, but the value has changed, then
+			// use the new value.
+			if pctNewProjectToWatch != 0 && pctOldProjectToWatch != 0 && pctNewProjectToWatch != pctOldProjectToWatch {
+
+				newPct = pctNewProjectToWatch
+
+				utils.LogInfo("The project creation time has changed, when both values were non-null. Old: " + timestampToString(pctOldProjectToWatch) + " New: " + timestampToString(pctNewProjectToWatch) + " for project " + projectToProcess.ProjectID)
+
+				pctUpdated = true
+			}
+
+			// If old is not-null, and new is null, then DON'T overwrite the old one with
+			// the new one.
+			if pctOldProjectToWatch != 0 && pctNewProjectToWatch == 0 {
+
+				newPct = pctOldProjectToWatch
+
+				utils.LogInfo(
+					"Internal project creation state was preserved, despite receiving a project update w/o this value. Current: " + timestampToString(pctOldProjectToWatch) + " Received: " + timestampToString(pctNewProjectToWatch) + " for project " + projectToProcess.ProjectID)
+
+				newPtw := *(projectToProcess.Clone())
+				newPtw.ProjectCreationTime = newPct
+
+				if newPtw.ProjectCreationTime != pctOldProjectToWatch {
+					utils.LogSevere("Updated PTW field did not have correct projectCreationTime, for project " + projectToProcess.ProjectID)
+				}
+
+				// Update the ptw, in case it is used by the following if block, but DONT call
+				// po.updatePTW(...) with it.
+				projectToProcess = newPtw
+				pctUpdated = false // this is false so that updatePTW(...) is not called.
+			}
+
+			// If the old is null, and the new is not null, then overwrite the old with the
+			// new.
+			if pctOldProjectToWatch == 0 && pctNewProjectToWatch != 0 {
+
+				newPct = pctNewProjectToWatch
+
+				utils.LogInfo("The project creation time has changed. Old: " + timestampToString(pctOldProjectToWatch) + " New: " + timestampToString(pctNewProjectToWatch) + ", for project " + projectToProcess.ProjectID)
+
+				pctUpdated = true
+
+			}
+
+			if pctUpdated {
+
+				newPtw := *(projectToProcess.Clone())
+				newPtw.ProjectCreationTime = newPct
+
+				// Update the object itself, in case the if-branch below this one is executed.
+				projectToProcess = newPtw
+
+				// This logic may cause the PO to be updated twice (once here, and once below,
+				// but this is fine)
+				currProjWatchState.project = &projectToProcess
+
+				wasProjectObjectUpdatedInThisBlock = true
+			}
+
+		}
+
+		if currProjWatchState.project.PathToMonitor == projectToProcess.PathToMonitor {
+
+			fileToMonitor, err := utils.ConvertAbsoluteUnixStyleNormalizedPathToLocalFile(projectToProcess.PathToMonitor)
+			if err != nil {
+				utils.LogSevereErr("Unable to convert from absolute unix style normalized path: "+projectToProcess.PathToMonitor, err)
+				return
+			}
+
+			// If the watch (or its ignore rules) has changed, then remove the path and update the PTW
+			watchStateChanged := oldProjectToWatch.ProjectWatchStateID != projectToProcess.ProjectWatchStateID
+			if watchStateChanged || !models.IgnoreRulesEqual(oldProjectToWatch, &projectToProcess) {
+
+				if watchStateChanged {
+					utils.LogInfo("The project watch state has changed: " + oldProjectToWatch.ProjectWatchStateID + " " + projectToProcess.ProjectWatchStateID + " for project " + projectToProcess.ProjectID)
+				} else {
+					utils.LogInfo("The ignore rules have changed for project " + projectToProcess.ProjectID)
+				}
+
+				// Update the map with the value from the web socket
+				projectToProcess.ChangeType = "" // TODO: the only non-immutable line
+				currProjWatchState.project = &projectToProcess
+				wasProjectObjectUpdatedInThisBlock = true
+
+				// The paths excluded by the previous rules may no longer be excluded
+				currProjWatchState.excludedPathSamples = nil
+
+				// We remove, then add, the watcher here, because the filters may have changed.
+
+				// Remove the old path
+				watchService.RemoveRootPath(fileToMonitor, projectToProcess)
+				utils.LogInfo("From update, removed project with path '" + projectToProcess.PathToMonitor + "' from watch list, with watch directory: '" + fileToMonitor + "'")
+
+				// Added the new path and PTW
+				watchService.AddRootPath(fileToMonitor, projectToProcess)
+				utils.LogInfo("From update, added new project with path '" + projectToProcess.PathToMonitor + "' to watch list, with watch directory: '" + fileToMonitor + "'")
+			} else {
+				utils.LogInfo("The project watch state has not changed for project " + projectToProcess.ProjectID)
+			}
+
+		} else {
+			utils.LogSevere("The path to monitor of a project cannot be changed once it set, for a particular project id")
+		}
+
+		// Compare new filesToWatch value with old, and update if different.
+		{
+
+			newPtwRefPaths := models.ConvertRefPathsToFromStrings(&projectToProcess)
+			oldPtwRefPaths := models.ConvertRefPathsToFromStrings(oldProjectToWatch)
+
+			reduceFn := func(strarr []string) string {
+				sort.Strings(strarr)
+				result := ""
+				for _, entry := range strarr {
+					result += entry + "//"
+				}
+				return result
+			}
+
+			newPtwFtw := reduceFn(newPtwRefPaths)
+			oldPtwFtw := reduceFn(oldPtwRefPaths)
+
+			if newPtwFtw != oldPtwFtw {
+				utils.LogInfo("filesToWatch value updated in " + projectToProcess.ProjectID)
+
+				// We only need to update project object if we didn't previously update it in the method)
+				if !wasProjectObjectUpdatedInThisBlock {
+					currProjWatchState.project = &projectToProcess
+				}
+
+				indivFileWatchService.SetFilesToWatch(projectToProcess.ProjectID, models.ConvertRefPathsToFromStrings(&projectToProcess))
+
+			}
+		}
+
+		if !models.ProjectsEqual(oldProjectToWatch, currProjWatchState.project) {
+
+			// Ensure that the next sync uses the new settings, even if it is already pending (or is the retry of a failed
+			// sync), rather than waiting for the next file change to pass them.
+			if currProjWatchState.cliState != nil {
+				currProjWatchState.cliState.UpdateProjectToWatch(currProjWatchState.project.Clone())
+			}
+
+			currProjWatchState.eventBatchUtil.SetBatchWindow(batchWindowForProject(currProjWatchState.project, projectList.config.Watch.BatchWindow))
+			currProjWatchState.oversizedFiles.update(currProjWatchState.project, projectList.config.Watch)
+		}
+
+	} else {
+		// This is the first time we are hearing about this project
+
+		currProjWatchState, err := projectList.newProjectObject(projectToProcess, postOutputQueue)
+		if err != nil {
+			utils.LogSevereErr("Error on creation of new project object", err)
+			return
+		}
+		projectsMap[projectToProcess.ProjectID] = currProjWatchState
+
+		indivFileWatchService.SetFilesToWatch(projectToProcess.ProjectID, models.ConvertRefPathsToFromStrings(&projectToProcess))
+
+		// For Windows, the server will give us path in the form of '/c/Users/Administrator',
+		// which we need to convert to 'c:\Users\Administrator', below.
+		fileToMonitor, err := utils.ConvertAbsoluteUnixStyleNormalizedPathToLocalFile(currProjWatchState.project.PathToMonitor)
+		if err != nil {
+			utils.LogSevereErr("Unable to convert from absolute unix style normalized path: "+currProjWatchState.project.PathToMonitor, err)
+		} else {
+			if watchService != nil {
+				watchService.AddRootPath(fileToMonitor, projectToProcess)
+				utils.LogDebug("Added new project with path '" + projectToProcess.PathToMonitor + "' to watch list, with watch directory: '" + fileToMonitor + "'")
+			} else {
+				utils.LogSevere("Watch service is not set in project list and an AddRootPath was missed: " + fileToMonitor)
+			}
+		}
+	}
+
+}
+
+func timestampToString(ts int64) string {
+	return strconv.FormatInt(ts, 10)
+}
+
+/** This function is called with a new file change entry, which is filtered (if necessary) then patched to the project's batch utility object.  */
+func (projectList *ProjectList) handleReceiveNewWatchEventEntries(projectMatch *models.ProjectToWatch, entry *models.WatchEventEntry, projectsMap map[string]*projectObject) {
+
+	utils.LogDebugProject(projectMatch.ProjectID, "Received new watch entry: "+entry.EventType+" "+entry.Path+" "+projectMatch.ProjectID)
+
+	filter, err := utils.NewPathFilter(projectMatch)
+	if err != nil {
+		utils.LogSevere("Could not create filter for " + projectMatch.ProjectID)
+		return
+	}
+
+	path := utils.ConvertEventPathToProjectRelativePath(entry.Path, projectMatch.PathToMonitor)
+
+	if path == nil || len(*path) == 0 {
+		return
+	}
+
+	// Regardless of the filters of the project, the writes of the filewatcher itself must never trigger a sync
+	if utils.IsFilewatcherOwnedPath(*path) {
+		utils.LogDebugProject(projectMatch.ProjectID, "Filtered out '"+*path+"', as it is owned by the filewatcher")
+		return
+	}
+
+	// Records the rule that excluded the path, for the status server
+	recordExcludedPath := func(rule string) {
+		if projObj, exists := projectsMap[projectMatch.ProjectID]; exists {
+			projObj.recordExcludedPath(rule, *path)
+		}
+	}
+
+	if projectMatch.IgnoredPaths != nil {
+
+		if rule := filter.MatchingPathRule(*path); rule != "" {
+			utils.LogDebugProject(projectMatch.ProjectID, "Filtered out '"+*path+"' due to path filter")
+			recordExcludedPath("ignoredPaths: " + rule)
+			return
+		}
+
+		// Apply the path filter against parent paths as well (if path is /a/b/c, then also try to match against /a/b and /a)
+		pathsToProcess := utils.SplitRelativeProjectPathIntoComponentPaths(*path)
+		for _, val := range pathsToProcess {
+			if rule := filter.MatchingPathRule(val); rule != "" {
+				recordExcludedPath("ignoredPaths: " + rule)
+				return
+			}
+		}
+
+	}
+
+	if projectMatch.IgnoredFilenames != nil {
+		if rule := filter.MatchingFilenameRule(*path); rule != "" {
+			utils.LogDebugProject(projectMatch.ProjectID, "Filtered out '"+*path+"' due to filename filter")
+			recordExcludedPath("ignoredFilenames: " + rule)
+			return
+		}
+	}
+
+	if projObj, exists := projectsMap[projectMatch.ProjectID]; exists && projObj.gitIgnoreMatcher != nil {
+
+		if strings.HasSuffix(*path, "/"+utils.GitIgnoreFilename) {
+			// An ignore file was added/changed/deleted, so the patterns must be re-read
+			utils.LogInfoProject(projectMatch.ProjectID, "Reloading .gitignore files for project "+projectMatch.ProjectID+", due to change of "+*path)
+			if gitIgnoreMatcher := loadGitIgnoreMatcher(projectMatch); gitIgnoreMatcher != nil {
+				projObj.gitIgnoreMatcher = gitIgnoreMatcher
+				projObj.excludedPathSamples = nil
+			}
+		}
+
+		if pattern := projObj.gitIgnoreMatcher.IgnoringPattern(*path, entry.IsDir); pattern != "" {
+			utils.LogDebugProject(projectMatch.ProjectID, "Filtered out '"+*path+"' due to .gitignore")
+			recordExcludedPath(".gitignore: " + pattern)
+			return
+		}
+	}
+
+	if pattern := filter.MatchingIgnorePattern(*path, entry.IsDir); pattern != "" {
+		utils.LogDebugProject(projectMatch.ProjectID, "Filtered out '"+*path+"' due to ignore pattern")
+		recordExcludedPath("ignoredPatterns: " + pattern)
+		return
+	}
+
+	// The included patterns only apply to the changes that are not excluded by the ignore rules (see utils.PathFilter)
+	if filter.IsFilteredOutByIncludePatterns(*path, entry.IsDir) {
+		utils.LogDebugProject(projectMatch.ProjectID, "Filtered out '"+*path+"', as it does not match an included pattern")
+		recordExcludedPath("includedPatterns: (no match)")
+		return
+	}
+
+	val, exists := projectsMap[projectMatch.ProjectID]
+	if exists && val.oversizedFiles.isOversized(*path, entry.EventType, entry.IsDir) {
+		utils.LogDebugProject(projectMatch.ProjectID, "Filtered out '"+*path+"', as it exceeds the maximum file size")
+		recordExcludedPath("maxFileSizeBytes: " + strconv.FormatInt(val.oversizedFiles.getMaxFileSize(), 10))
+		return
+	}
+
+	if exists {
+		changedFileEntry, err := NewChangedFileEntry(*path, entry.EventType, time.Now().UnixNano()/1000000, entry.IsDir)
+		if err != nil {
+			utils.LogSevereErr("Error in creating new changed file entry", err)
+			return
+		}
+		changedFileEntry.identity = entry.Identity
+		changedFileEntry.childIdentities = entry.ChildIdentities
+
+		changedFileEntries := []ChangedFileEntry{*changedFileEntry}
+
+		val.recordFileChangeObserved(changedFileEntry.timestamp)
+		val.eventBatchUtil.AddChangedFiles(changedFileEntries)
+	} else {
+		utils.LogSevere("Could not locate event processing for project id " + projectMatch.ProjectID)
+		return
+	}
+
+}
+
+// Information maintained for each project that is being monitored by the
+// watcher. This includes information on what to watch/filter (the
+// ProjectToWatch), the batch util (one batch util object exists per project),
+// and which watch service (internal/external) is being used for this project.
+type projectObject struct {
+	project        *models.ProjectToWatch
+	eventBatchUtil *FileChangeEventBatchUtil
+	cliState       *CLIState // Nullable
+
+	gitIgnoreMatcher *utils.IgnoreMatcher // Nullable; only set if the project's .gitignore files are honored
+
+	rootDeleted bool // True from when the root directory of the project is deleted, until it is watched again
+
+	paused bool // True if syncing of the project has been paused (see PauseProject)
+
+	excludedPathSamples map[string][]string // Nullable; paths excluded by each ignore rule (see watchdetails.go)
+
+	oversizedFiles *oversizedFileFilter // Identifies the changes of files that exceed the maximum size (see oversizedfiles.go)
+}
+
+// recordFileChangeObserved records that a file change of the project was observed at the given time, in absolute msecs
+// (see ProjectSyncStatus.IdleSince).
+func (po *projectObject) recordFileChangeObserved(timestamp int64) {
+	if po.cliState != nil {
+		syncStatusRegistry.fileChangeObserved(po.cliState, timestamp)
+	}
+}
+
+func (projectList *ProjectList) newProjectObject(project models.ProjectToWatch, postOutputQueue *HttpPostOutputQueue) (*projectObject, error) {
+
+	// Project root paths are redacted from log statements, if enabled
+	utils.RegisterRedactedPath(project.PathToMonitor)
+
+	cliState, err := projectList.newCLIStateForProject(&project)
+	if err != nil {
+		return nil, err
+	}
+
+	var gitIgnoreMatcher *utils.IgnoreMatcher
+	if projectList.config.Watch.HonorGitIgnore {
+		gitIgnoreMatcher = loadGitIgnoreMatcher(&project)
+		if gitIgnoreMatcher == nil {
+			// Start with no patterns; the files will be re-read if a .gitignore is subsequently changed
+			gitIgnoreMatcher, _ = utils.NewIgnoreMatcher([]string{})
+		}
+	}
+
+	oversizedFiles := newOversizedFileFilter(&project, projectList.config.Watch)
+
+	// The changes are only sent to the server if enabled, and they are not synced by cwctl
+	var changesOutputQueue *HttpPostOutputQueue
+	if projectList.config.Watch.PostChangesToServer && cliState == nil {
+		changesOutputQueue = postOutputQueue
+	}
+
+	return &projectObject{
+		&project,
+		NewFileChangeEventBatchUtil(project.ProjectID, batchWindowForProject(&project, projectList.config.Watch.BatchWindow),
+			projectList.config.Watch.MaxPendingEvents, projectList.config.Watch.MaxChangesPerChunk, oversizedFiles, changesOutputQueue, projectList),
+		cliState,         // May be null
+		gitIgnoreMatcher, // May be null
+		false,
+		false,
+		nil,
+		oversizedFiles,
+	}, nil
+}
+
+// newCLIStateForProject returns a new CLI state for the project, or nil if there is no installer path.
+func (projectList *ProjectList) newCLIStateForProject(project *models.ProjectToWatch) (*CLIState, error) {
+
+	if strings.TrimSpace(projectList.pathToInstaller) == "" {
+		return nil, nil
+	}
+
+	// Here we convert the path to an absolute, canonical OS path for use by cwctl
+	path, err := utils.ConvertAbsoluteUnixStyleNormalizedPathToLocalFile(project.PathToMonitor)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCLIState(project.ProjectID, projectList.pathToInstaller, path, projectList.config.CLI, nil, nil)
+}
+
+// loadGitIgnoreMatcher reads the .gitignore files of the project, returning nil if they could not be read.
+func loadGitIgnoreMatcher(project *models.ProjectToWatch) *utils.IgnoreMatcher {
+
+	projectRoot, err := utils.ConvertAbsoluteUnixStyleNormalizedPathToLocalFile(project.PathToMonitor)
+	if err != nil {
+		utils.LogSevereErr("Unable to convert from absolute unix style normalized path: "+project.PathToMonitor, err)
+		return nil
+	}
+
+	result, err := utils.LoadGitIgnoreMatcher(projectRoot)
+	if err != nil {
+		utils.LogErrorErr("Unable to read .gitignore files of project "+project.ProjectID, err)
+		return nil
+	}
+
+	return result
+}
@@ -0,0 +1,322 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"codewind/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestProjectList returns a project list that runs the mock cwctl for each project, and a function that shuts it
+// down. As the project list creates the CLI state of each project, the mock is configured by the environment of the
+// test process (which cwctl inherits) until then.
+func newTestProjectList(t *testing.T, mock *mockCwctl) (*ProjectList, func()) {
+	t.Helper()
+
+	restoreEnv := setenv(t, mock.env)
+
+	config := DefaultConfig()
+	config.CLI = mock.config(t)
+	config.Watch.BatchWindow = 10 * time.Millisecond
+
+	projectList := NewProjectList(nil, config.CLI.MockInstallerPath, config)
+
+	return projectList, func() {
+		for _, project := range projectList.Shutdown() {
+			if project.cliState != nil {
+				project.cliState.Dispose()
+			}
+		}
+		restoreEnv()
+	}
+}
+
+// newTestProjectToWatch returns a project whose root is the given local path.
+func newTestProjectToWatch(t *testing.T, projectID string, localPath string) models.ProjectToWatch {
+	t.Helper()
+
+	pathToMonitor, err := utils.NormalizeEventPath(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return models.ProjectToWatch{
+		ProjectID:           projectID,
+		PathToMonitor:       pathToMonitor,
+		ProjectWatchStateID: "1",
+		IgnoredFilenames:    []string{},
+		IgnoredPaths:        []string{},
+	}
+}
+
+// writeTestFiles creates each of the files (and their parent directories), at paths relative to the root.
+func writeTestFiles(t *testing.T, root string, relativePaths ...string) {
+	t.Helper()
+
+	for _, relativePath := range relativePaths {
+		path := filepath.Join(root, filepath.FromSlash(relativePath))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("contents"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// ownedTestFiles are the paths (relative to the project root) of files that are owned by the filewatcher.
+var ownedTestFiles = []string{
+	utils.FilewatcherOwnedFilenamePrefix + "state.json",
+	utils.FilewatcherOwnedFilenamePrefix + "tmp/file.txt",
+	"src/" + utils.FilewatcherOwnedFilenamePrefix + "state.json",
+}
+
+func TestOwnedFilesDoNotTriggerSync(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	projectList, shutdown := newTestProjectList(t, mock)
+	defer shutdown()
+
+	project := newTestProjectToWatch(t, "owned-files", mock.projectPath)
+	projectList.UpdateProjectListFromGetRequest(&models.WatchlistEntries{project})
+
+	// A project that is added is not synced until it has changes
+	time.Sleep(200 * time.Millisecond)
+	if calls := mock.calls(t); len(calls) != 0 {
+		t.Fatalf("Expected no sync before any changes, but cwctl was run %d times", len(calls))
+	}
+
+	// The state files are written, and reported, even though the project has no rules that exclude them
+	writeTestFiles(t, mock.projectPath, ownedTestFiles...)
+	for _, relativePath := range ownedTestFiles {
+		for _, eventType := range []string{"CREATE", "MODIFY"} {
+			entry, err := newWatchEventEntry(eventType, filepath.Join(mock.projectPath, filepath.FromSlash(relativePath)), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			projectList.ReceiveNewWatchEventEntries(entry, &project)
+		}
+	}
+
+	// Far longer than the batch window
+	time.Sleep(500 * time.Millisecond)
+	if calls := mock.calls(t); len(calls) != 0 {
+		t.Fatalf("Expected the changes of the files owned by the filewatcher not to trigger a sync, but cwctl was run %d times", len(calls))
+	}
+
+	// Whereas a change of any other file does
+	writeTestFiles(t, mock.projectPath, "src/main.go")
+	entry, err := newWatchEventEntry("MODIFY", filepath.Join(mock.projectPath, "src", "main.go"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectList.ReceiveNewWatchEventEntries(entry, &project)
+	mock.waitForCalls(t, 1)
+}
+
+func TestPollingScanSkipsOwnedFiles(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	writeTestFiles(t, mock.projectPath, ownedTestFiles...)
+	writeTestFiles(t, mock.projectPath, "src/main.go")
+
+	project := newTestProjectToWatch(t, "owned-files", mock.projectPath)
+	cWatcher := newCodewindWatcher(mock.projectPath, &WatchService{config: DefaultConfig().Watch})
+
+	scan, exceeded := scanProjectRoot(cWatcher, &project)
+	if exceeded {
+		t.Fatal("Expected the scan to complete")
+	}
+
+	for path := range scan {
+		if strings.Contains(path, utils.FilewatcherOwnedFilenamePrefix) {
+			t.Errorf("Expected the paths owned by the filewatcher not to be scanned, but found %s", path)
+		}
+	}
+	if _, exists := scan[filepath.Join(mock.projectPath, "src", "main.go")]; !exists {
+		t.Errorf("Expected the other files to be scanned, but found %v", scan)
+	}
+}
+
+func TestStaggeredSyncsStartInOrderOfProjectID(t *testing.T) {
+	config := DefaultConfig()
+	config.CLI.SyncJitter = 50 * time.Millisecond
+	projectList := &ProjectList{config: config}
+
+	// The projects are registered out of order
+	projectIDs := []string{"project-c", "project-a", "project-e", "project-b", "project-d"}
+	expected := []string{"project-a", "project-b", "project-c", "project-d", "project-e"}
+
+	projectsMap := map[string]*projectObject{}
+	for _, projectID := range projectIDs {
+		projectsMap[projectID] = &projectObject{project: &models.ProjectToWatch{ProjectID: projectID}}
+	}
+
+	// As the delays are random, each of several rounds must start the syncs in the same order
+	for round := 0; round < 10; round++ {
+		started := make(chan string, len(projectIDs))
+
+		syncFuncs := []func() error{}
+		for _, projectID := range sortedProjectIDs(projectsMap) {
+			projectID := projectID
+			syncFuncs = append(syncFuncs, func() error {
+				started <- projectID
+				return nil
+			})
+		}
+
+		startTime := time.Now()
+		projectList.staggerSyncs(syncFuncs)
+
+		for index, expectedID := range expected {
+			select {
+			case projectID := <-started:
+				if projectID != expectedID {
+					t.Fatalf("Round %d: expected sync %d to be of %s, but it was of %s", round, index, expectedID, projectID)
+				}
+			case <-time.After(mockCwctlTimeout):
+				t.Fatalf("Round %d: timed out waiting for the sync of %s", round, expectedID)
+			}
+		}
+
+		// Every sync starts within the jitter (with a margin for scheduling)
+		if elapsed := time.Since(startTime); elapsed > config.CLI.SyncJitter+time.Second {
+			t.Errorf("Round %d: expected the syncs to start within %v, but they took %v", round, config.CLI.SyncJitter, elapsed)
+		}
+	}
+}
+
+func TestStaggeredSyncsWithoutJitterStartImmediately(t *testing.T) {
+	config := DefaultConfig()
+	config.CLI.SyncJitter = 0
+	projectList := &ProjectList{config: config}
+
+	const count = 100
+	started := make(chan int, count)
+
+	syncFuncs := []func() error{}
+	for index := 0; index < count; index++ {
+		index := index
+		syncFuncs = append(syncFuncs, func() error {
+			started <- index
+			return nil
+		})
+	}
+
+	projectList.staggerSyncs(syncFuncs)
+
+	for expected := 0; expected < count; expected++ {
+		select {
+		case index := <-started:
+			if index != expected {
+				t.Fatalf("Expected sync %d to start, but sync %d did", expected, index)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for sync %d, which should start without a delay", expected)
+		}
+	}
+
+	// Staggering no syncs does nothing
+	projectList.staggerSyncs(nil)
+}
+
+// runningGoroutinesOf returns the number of goroutines whose stack includes the given function.
+func runningGoroutinesOf(function string) int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return strings.Count(string(buf[:n]), function+"(")
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// The goroutines of the CLI state and the event batch util of each project exit once the project is removed from the
+// project list, including those of projects that are removed while a sync is pending.
+func TestRemovedProjectsDoNotLeakGoroutines(t *testing.T) {
+	const projectCount = 50
+	const batchListener = "filewatcher.(*FileChangeEventBatchUtil).fileChangeListener"
+	const cliStateListener = "filewatcher.(*CLIState).readChannel"
+	const pollTimer = "filewatcher.(*IndividualFileWatchService).timerTick.func1"
+
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	projectList, shutdown := newTestProjectList(t, mock)
+	defer shutdown()
+
+	// The goroutines of the logger, and of the timer of the individual file watch service, are started on first use,
+	// rather than by a project, so are included in the baseline
+	<-projectList.RequestDebugMessage()
+	utils.LogInfo("Adding the projects of TestRemovedProjectsDoNotLeakGoroutines")
+	baseline := 0
+	waitFor(t, "the timer of the individual file watch service to start", func() bool {
+		baseline = runtime.NumGoroutine()
+		return runningGoroutinesOf(pollTimer) == 1
+	})
+	baselineBatchListeners := runningGoroutinesOf(batchListener)
+	baselineCLIStateListeners := runningGoroutinesOf(cliStateListener)
+
+	projects := models.WatchlistEntries{}
+	for index := 0; index < projectCount; index++ {
+		root := filepath.Join(mock.dir, "project-"+strconv.Itoa(index))
+		writeTestFiles(t, root, "src/main.go")
+		projects = append(projects, newTestProjectToWatch(t, "project-"+strconv.Itoa(index), root))
+	}
+	projectList.UpdateProjectListFromGetRequest(&projects)
+	<-projectList.RequestDebugMessage()
+
+	waitFor(t, "an event batch util and CLI state goroutine to start for each project", func() bool {
+		return runningGoroutinesOf(batchListener)-baselineBatchListeners == projectCount &&
+			runningGoroutinesOf(cliStateListener)-baselineCLIStateListeners == projectCount
+	})
+
+	// Half of the projects are removed while a sync is pending
+	for index := 0; index < projectCount; index += 2 {
+		entry, err := newWatchEventEntry("MODIFY", filepath.Join(mock.dir, "project-"+strconv.Itoa(index), "src", "main.go"), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		projectList.ReceiveNewWatchEventEntries(entry, &projects[index])
+	}
+
+	// The projects are removed by a watch change (as the project list has no watch service, of which a removal from the
+	// GET would remove their root paths)
+	deletions := models.WatchlistEntries{}
+	for _, project := range projects {
+		project.ChangeType = "delete"
+		deletions = append(deletions, project)
+	}
+	projectList.UpdateProjectListFromWebSocket(&models.WatchChangeJson{Type: "watchChanged", Projects: deletions})
+	if debugMessage := <-projectList.RequestDebugMessage(); strings.Contains(debugMessage, "project-") {
+		t.Fatalf("Expected every project to be removed, but the project list is:\n%s", debugMessage)
+	}
+
+	waitFor(t, "the event batch util and CLI state goroutines of the removed projects to exit", func() bool {
+		return runningGoroutinesOf(batchListener) <= baselineBatchListeners &&
+			runningGoroutinesOf(cliStateListener) <= baselineCLIStateListeners
+	})
+	waitFor(t, "the goroutines of the removed projects to exit", func() bool {
+		return runtime.NumGoroutine() <= baseline
+	})
+}
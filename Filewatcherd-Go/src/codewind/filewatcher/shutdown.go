@@ -0,0 +1,83 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/utils"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/**
+ * When the filewatcher is shut down (see Watcher.Shutdown), a project is not left mid-sync:
+ * - New file changes and project list updates are no longer accepted.
+ * - Any running cwctl processes are allowed to complete, and a final sync is run for each project with changes that
+ *   have not yet been synced (including those in a pending batch).
+ * - The CLI state of each project is disposed, and the WebSocket connection is closed.
+ *
+ * If this does not complete within the grace period (30 seconds by default, or FILEWATCHER_SHUTDOWN_GRACE_PERIOD_SECS),
+ * any running cwctl processes are killed.
+ */
+
+// GetShutdownGracePeriod returns how long the final syncs of a shutdown are allowed to run, before any running cwctl
+// processes are killed.
+func GetShutdownGracePeriod() time.Duration {
+	gracePeriod := time.Duration(utils.GetEnvInt("FILEWATCHER_SHUTDOWN_GRACE_PERIOD_SECS", 30)) * time.Second
+	if gracePeriod < 0 {
+		gracePeriod = 0
+	}
+	return gracePeriod
+}
+
+// shutdownProjects runs a final sync of each project (in parallel) with changes that have not yet been synced.
+func shutdownProjects(projects []shutdownProject) {
+
+	utils.LogInfo("Shutting down " + strconv.Itoa(len(projects)) + " project(s)")
+
+	var waitGroup sync.WaitGroup
+
+	for _, project := range projects {
+
+		waitGroup.Add(1)
+
+		go func(project shutdownProject) {
+			defer waitGroup.Done()
+
+			// The pending batch is discarded, and instead included in the final sync
+			batchPending := project.eventBatchUtil != nil && project.eventBatchUtil.Flush()
+
+			if project.cliState == nil {
+				return
+			}
+
+			if err := project.cliState.Shutdown(batchPending); err != nil {
+				utils.LogErrorErr("Unable to shut down CLI state for project "+project.projectID, err)
+			}
+		}(project)
+	}
+
+	waitGroup.Wait()
+}
+
+// disposeShutdownProjects disposes the CLI state (killing any cwctl process that is still running) and batch utility of
+// each project.
+func disposeShutdownProjects(projects []shutdownProject) {
+	for _, project := range projects {
+		if project.cliState != nil {
+			project.cliState.Dispose()
+		}
+		if project.eventBatchUtil != nil {
+			project.eventBatchUtil.Dispose()
+		}
+	}
+}
@@ -0,0 +1,487 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/utils"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * An optional embedded HTTP server which allows operators to determine whether the filewatcher is healthy, and
+ * what the sync state of each project is. The server is only started if the StatusAddress (host:port) or StatusPort
+ * setting of the ServerConfig is set; it listens on loopback, unless a host is specified (by StatusAddress or
+ * StatusHost, see embeddedserver.go).
+ *
+ * - GET /health: returns 200, with a body of 'OK'.
+ * - GET /debug/vars: returns the statistics of the watches and syncs, as JSON (see expvarstats.go).
+ * - GET /status: returns a JSON array containing the sync state (ProjectSyncStatus) of each watched project. If the
+ *   'details' query parameter is 'true', the watch state of each project is also returned (see watchdetails.go).
+ * - POST /sync: runs cwctl for every watched project, whether or not any file changes were detected.
+ * - POST /projects/{projectID}/pause: stops cwctl from being run for the project, until it is resumed; file changes
+ *   are still received while paused. Returns 404 if the project is not watched.
+ * - POST /projects/{projectID}/resume: resumes syncing of the project, running a single sync for any changes that
+ *   were received while paused. Returns 404 if the project is not watched.
+ * - POST /projects/{projectID}/loglevel?level=(level)[&durationSecs=(secs)]: overrides the log level of the project
+ *   (debug, info, warning, error, or severe), so that eg debug logs may be collected for just that project; if
+ *   durationSecs is specified, the override expires after that many seconds. A level of 'default' removes the override.
+ *   The project need not yet be watched. Returns 400 if the level or duration is invalid (see projectloglevel.go).
+ */
+
+// ProjectSyncStatus is the sync state of a single project, as returned by /status.
+type ProjectSyncStatus struct {
+	ProjectID string `json:"projectID"`
+	Path      string `json:"path"`
+
+	// Completion time of the most recent successful sync, in absolute msecs; 0 if no sync has succeeded.
+	LastSuccessfulSyncTimestamp int64 `json:"lastSuccessfulSyncTimestamp"`
+
+	// Output of the most recent sync, if it failed; empty if the most recent sync succeeded.
+	LastError string `json:"lastError,omitempty"`
+
+	// The kind of failure of the most recent sync, if it failed: 'spawnFailed' if cwctl could not be started (eg it
+	// is not installed correctly), 'timeout', 'projectPathMissing', 'invalidArguments', or otherwise 'syncFailed'.
+	LastErrorKind string `json:"lastErrorKind,omitempty"`
+
+	// The number of files synced and deleted by the most recent successful sync; omitted if unknown.
+	LastSyncedFileCount  *int `json:"lastSyncedFileCount,omitempty"`
+	LastDeletedFileCount *int `json:"lastDeletedFileCount,omitempty"`
+
+	SyncActive bool `json:"syncActive"`
+
+	// True if there are file changes that have not yet been synced, other than those of the active sync (see
+	// CLIState.HasPendingChanges()).
+	ChangesPending bool `json:"changesPending"`
+
+	// The correlation IDs of the most recent (or active) sync: those of the batches of changes that it syncs, as logged
+	// with the batch summaries and the cwctl call (see syncchangeset.go).
+	LastSyncCorrelationIDs []string `json:"lastSyncCorrelationIDs,omitempty"`
+
+	// The number of consecutive failed syncs, and whether the circuit breaker is open as a result (in which case
+	// cwctl is not run until the cool-down has elapsed).
+	ConsecutiveFailures int  `json:"consecutiveFailures"`
+	CircuitBreakerOpen  bool `json:"circuitBreakerOpen"`
+
+	// True if syncing of the project has been paused.
+	Paused bool `json:"paused"`
+
+	// If file changes are arriving faster than cwctl can sync them, the time at which the syncs began to lag behind the
+	// changes (in absolute msecs), and how long they have lagged since then; 0 if the syncs are keeping up. The batch
+	// window of a lagging project may be widened by the given factor, so that cwctl may catch up (see synclag.go).
+	SyncLaggingSince int64 `json:"syncLaggingSince"`
+	SyncLagMs        int64 `json:"syncLagMs"`
+	BatchWindowScale int   `json:"batchWindowScale"`
+
+	// Time of the most recent file change observed for the project (or when it began to be watched, if none), in
+	// absolute msecs: the project has been idle since then.
+	IdleSince int64 `json:"idleSince"`
+
+	// The log level of the project, if overridden (see POST /projects/{projectID}/loglevel).
+	LogLevel string `json:"logLevel,omitempty"`
+
+	// The watched directories and excluded paths of the project; only returned if requested.
+	Watch *ProjectWatchDetails `json:"watch,omitempty"`
+
+	owner *CLIState // The CLIState that registered this entry
+}
+
+// maxLastErrorLength is the maximum number of characters of the sync output that are kept in LastError.
+const maxLastErrorLength = 2048
+
+// SyncStatusRegistry contains the sync state of each project that has a CLIState. CLIState objects register
+// themselves on creation, update their state from their channel goroutine, and unregister on disposal.
+type SyncStatusRegistry struct {
+	lock     *sync.Mutex
+	projects map[string]*ProjectSyncStatus // lock must be acquired before reading/writing
+}
+
+var syncStatusRegistry = &SyncStatusRegistry{
+	lock:     &sync.Mutex{},
+	projects: make(map[string]*ProjectSyncStatus),
+}
+
+func (registry *SyncStatusRegistry) register(state *CLIState) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	registry.projects[state.projectID] = &ProjectSyncStatus{
+		ProjectID:        state.projectID,
+		Path:             state.projectPath,
+		IdleSince:        nowInMsecs(state.clock),
+		BatchWindowScale: 1,
+		owner:            state,
+	}
+}
+
+func (registry *SyncStatusRegistry) unregister(state *CLIState) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	// A new CLIState for the same project may have been registered before the old one was disposed
+	if status, exists := registry.projects[state.projectID]; exists && status.owner == state {
+		delete(registry.projects, state.projectID)
+	}
+}
+
+func (registry *SyncStatusRegistry) syncStarted(state *CLIState, correlationIDs []string) {
+	registry.update(state, func(status *ProjectSyncStatus) {
+		status.SyncActive = true
+		status.LastSyncCorrelationIDs = append([]string{}, correlationIDs...)
+	})
+}
+
+func (registry *SyncStatusRegistry) syncCompleted(state *CLIState, rpr *RunProjectReturn, completionTimeInMsecs int64) {
+	registry.update(state, func(status *ProjectSyncStatus) {
+		status.SyncActive = false
+
+		// A superseded sync neither succeeded nor failed; the full sync that superseded it is started immediately
+		if rpr.result == SyncResultSuperseded {
+			return
+		}
+
+		if rpr.result == SyncResultSucceeded {
+			status.LastSuccessfulSyncTimestamp = completionTimeInMsecs
+			status.LastError = ""
+			status.LastErrorKind = ""
+			status.LastSyncedFileCount = knownFileCountOrNil(rpr.syncedFileCount)
+			status.LastDeletedFileCount = knownFileCountOrNil(rpr.deletedFileCount)
+			return
+		}
+
+		lastError := strings.TrimSpace(rpr.output)
+		if rpr.exitCode != exitCodeUnknown {
+			lastError = "Error code " + strconv.Itoa(rpr.exitCode) + ": " + lastError
+		}
+		if len(lastError) > maxLastErrorLength {
+			lastError = lastError[0:maxLastErrorLength] + "..."
+		}
+		status.LastError = lastError
+		status.LastErrorKind = rpr.result.String()
+	})
+}
+
+func (registry *SyncStatusRegistry) changesPendingChanged(state *CLIState, changesPending bool) {
+	registry.update(state, func(status *ProjectSyncStatus) {
+		status.ChangesPending = changesPending
+	})
+}
+
+// syncState returns whether the CLIState has changes pending, and whether a sync is active; both are false if it is no
+// longer registered (eg as it was disposed).
+func (registry *SyncStatusRegistry) syncState(state *CLIState) (bool, bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if status, exists := registry.projects[state.projectID]; exists && status.owner == state {
+		return status.ChangesPending, status.SyncActive
+	}
+	return false, false
+}
+
+func (registry *SyncStatusRegistry) pausedChanged(state *CLIState, paused bool) {
+	registry.update(state, func(status *ProjectSyncStatus) {
+		status.Paused = paused
+	})
+}
+
+func (registry *SyncStatusRegistry) circuitBreakerChanged(state *CLIState, open bool, consecutiveFailures int) {
+	registry.update(state, func(status *ProjectSyncStatus) {
+		status.CircuitBreakerOpen = open
+		status.ConsecutiveFailures = consecutiveFailures
+	})
+}
+
+// syncLagChanged records the time at which the syncs of the project began to lag behind its file changes (0 if they
+// are keeping up), and the factor by which its batch window is widened as a result.
+func (registry *SyncStatusRegistry) syncLagChanged(state *CLIState, laggingSinceInMsecs int64, batchWindowScale int) {
+	registry.update(state, func(status *ProjectSyncStatus) {
+		status.SyncLaggingSince = laggingSinceInMsecs
+		status.BatchWindowScale = batchWindowScale
+	})
+}
+
+// batchWindowScale returns the factor by which the batch window of the project is widened, as its syncs are lagging
+// behind its file changes; 1 if they are not (or the project has no CLIState).
+func (registry *SyncStatusRegistry) batchWindowScale(projectID string) int {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if status, exists := registry.projects[projectID]; exists && status.BatchWindowScale > 1 {
+		return status.BatchWindowScale
+	}
+	return 1
+}
+
+// fileChangeObserved records a file change of the project, which is no longer idle.
+func (registry *SyncStatusRegistry) fileChangeObserved(state *CLIState, timeInMsecs int64) {
+	registry.update(state, func(status *ProjectSyncStatus) {
+		if timeInMsecs > status.IdleSince {
+			status.IdleSince = timeInMsecs
+		}
+	})
+}
+
+func knownFileCountOrNil(count int) *int {
+	if count == unknownFileCount {
+		return nil
+	}
+	return &count
+}
+
+func (registry *SyncStatusRegistry) update(state *CLIState, updateFunc func(*ProjectSyncStatus)) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if status, exists := registry.projects[state.projectID]; exists && status.owner == state {
+		updateFunc(status)
+	}
+}
+
+// activeSyncCount returns the number of projects with an active sync.
+func (registry *SyncStatusRegistry) activeSyncCount() int {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	result := 0
+	for _, status := range registry.projects {
+		if status.SyncActive {
+			result++
+		}
+	}
+	return result
+}
+
+// queueDepth returns the number of entries in the channels of the CLI states, that have yet to be processed.
+func (registry *SyncStatusRegistry) queueDepth() int {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	result := 0
+	for _, status := range registry.projects {
+		result += len(status.owner.channel)
+	}
+	return result
+}
+
+// snapshot returns a copy of the state of each project, sorted by project ID.
+func (registry *SyncStatusRegistry) snapshot() []ProjectSyncStatus {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	result := make([]ProjectSyncStatus, 0, len(registry.projects))
+	for _, status := range registry.projects {
+		statusCopy := *status
+		if statusCopy.SyncLaggingSince != 0 {
+			statusCopy.SyncLagMs = nowInMsecs(status.owner.clock) - statusCopy.SyncLaggingSince
+		}
+		if level, overridden := utils.GetProjectLogLevel(statusCopy.ProjectID); overridden {
+			statusCopy.LogLevel = strings.ToLower(level.String())
+		}
+		result = append(result, statusCopy)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ProjectID < result[j].ProjectID
+	})
+
+	return result
+}
+
+// statusServerConfig returns the listen address configuration of the status server (see embeddedserver.go).
+func statusServerConfig(config ServerConfig) embeddedServerConfig {
+	return embeddedServerConfig{
+		name:          "status server",
+		address:       config.StatusAddress,
+		host:          config.StatusHost,
+		port:          config.StatusPort,
+		addressEnvVar: "FILEWATCHER_STATUS_ADDRESS",
+		portEnvVar:    "FILEWATCHER_STATUS_PORT",
+	}
+}
+
+// StartStatusServer starts the status HTTP server on a separate goroutine, if enabled by StatusAddress or StatusPort,
+// returning the server (nil if not enabled); an error is returned if it could not be started.
+func StartStatusServer(projectList *ProjectList, config ServerConfig) (*http.Server, error) {
+	return startEmbeddedServer(statusServerConfig(config), newStatusServerHandler(projectList))
+}
+
+// newStatusServerHandler returns the handler of the routes of the status server. Pause/resume and sync requests are
+// passed to the project list.
+func newStatusServerHandler(projectList *ProjectList) http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", handleHealthRequest)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		handleStatusRequest(w, r, projectList)
+	})
+	mux.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
+		handleForceSyncRequest(w, r, projectList)
+	})
+	mux.HandleFunc(projectsPathPrefix, func(w http.ResponseWriter, r *http.Request) {
+		handleProjectActionRequest(w, r, projectList)
+	})
+
+	return mux
+}
+
+func handleHealthRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("OK"))
+}
+
+func handleStatusRequest(w http.ResponseWriter, r *http.Request, projectList *ProjectList) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses := syncStatusRegistry.snapshot()
+
+	if strings.EqualFold(r.URL.Query().Get("details"), "true") {
+		watchDetails := projectList.GetWatchDetails()
+		for index := range statuses {
+			statuses[index].Watch = watchDetails[statuses[index].ProjectID]
+		}
+	}
+
+	body, err := json.Marshal(statuses)
+	if err != nil {
+		utils.LogSevereErr("Unable to marshal status JSON", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func handleForceSyncRequest(w http.ResponseWriter, r *http.Request, projectList *ProjectList) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	utils.LogInfo("Received sync request from the status server")
+	projectList.ForceSync()
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("OK"))
+}
+
+// projectsPathPrefix is the path prefix of the project actions, eg '/projects/(project id)/pause'
+const projectsPathPrefix = "/projects/"
+
+func handleProjectActionRequest(w http.ResponseWriter, r *http.Request, projectList *ProjectList) {
+
+	// Expected: (project id)/(action)
+	pathComponents := strings.Split(strings.TrimPrefix(r.URL.Path, projectsPathPrefix), "/")
+	if len(pathComponents) != 2 || pathComponents[0] == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	projectID := pathComponents[0]
+	action := pathComponents[1]
+
+	if action == "loglevel" {
+		handleProjectLogLevelRequest(w, r, projectID)
+		return
+	}
+
+	if action != "pause" && action != "resume" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	utils.LogInfo("Received " + action + " request for project " + projectID + " from the status server")
+
+	var err error
+	if action == "pause" {
+		err = projectList.PauseProject(projectID)
+	} else {
+		err = projectList.ResumeProject(projectID)
+	}
+
+	if err == errProjectNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		utils.LogSevereErr("Unable to "+action+" project "+projectID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("OK"))
+}
+
+func handleProjectLogLevelRequest(w http.ResponseWriter, r *http.Request, projectID string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	levelParam := strings.TrimSpace(r.URL.Query().Get("level"))
+
+	if strings.EqualFold(levelParam, "default") {
+		utils.LogInfo("Received request to remove the log level override of project " + projectID + " from the status server")
+		utils.ClearProjectLogLevel(projectID)
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("OK"))
+		return
+	}
+
+	level, valid := utils.ParseLogLevel(levelParam)
+	if !valid {
+		http.Error(w, "Invalid log level: '"+levelParam+"'", http.StatusBadRequest)
+		return
+	}
+
+	var duration time.Duration
+	if durationParam := strings.TrimSpace(r.URL.Query().Get("durationSecs")); durationParam != "" {
+		durationSecs, err := strconv.Atoi(durationParam)
+		if err != nil || durationSecs <= 0 {
+			http.Error(w, "Invalid duration: '"+durationParam+"'", http.StatusBadRequest)
+			return
+		}
+		duration = time.Duration(durationSecs) * time.Second
+	}
+
+	msg := "Received request to set the log level of project " + projectID + " to " + level.String() + " from the status server"
+	if duration > 0 {
+		msg += ", for " + duration.String()
+	}
+	utils.LogInfo(msg)
+	utils.SetProjectLogLevel(projectID, level, duration)
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("OK"))
+}
@@ -0,0 +1,215 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"codewind/utils"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// requestStatusServer sends a request with the given method to the path of the status server, returning the status
+// code of the response.
+func requestStatusServer(t *testing.T, server *httptest.Server, method string, path string) int {
+	t.Helper()
+
+	request, err := http.NewRequest(method, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	return response.StatusCode
+}
+
+// projectStatusOf returns the sync state of the project, as returned by GET /status, or nil if it is not listed.
+func projectStatusOf(t *testing.T, server *httptest.Server, projectID string) *ProjectSyncStatus {
+	t.Helper()
+
+	response, err := server.Client().Get(server.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	statuses := []ProjectSyncStatus{}
+	if err := json.NewDecoder(response.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+
+	for index := range statuses {
+		if statuses[index].ProjectID == projectID {
+			return &statuses[index]
+		}
+	}
+	return nil
+}
+
+func TestStatusServerRejectsUnsupportedMethods(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	projectList, shutdown := newTestProjectList(t, mock)
+	defer shutdown()
+
+	server := httptest.NewServer(newStatusServerHandler(projectList))
+	defer server.Close()
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/sync"},
+		{http.MethodGet, "/projects/a-project/pause"},
+		{http.MethodGet, "/projects/a-project/resume"},
+		{http.MethodGet, "/projects/a-project/loglevel?level=debug"},
+		{http.MethodPost, "/health"},
+		{http.MethodPost, "/status"},
+	}
+
+	for _, test := range tests {
+		if statusCode := requestStatusServer(t, server, test.method, test.path); statusCode != http.StatusMethodNotAllowed {
+			t.Errorf("Expected %s %s to return %d, but got %d", test.method, test.path, http.StatusMethodNotAllowed, statusCode)
+		}
+	}
+
+	if calls := mock.calls(t); len(calls) != 0 {
+		t.Errorf("Expected the rejected requests not to run cwctl, but it was run %d times", len(calls))
+	}
+}
+
+func TestStatusServerReturnsNotFoundForUnknownProjects(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	projectList, shutdown := newTestProjectList(t, mock)
+	defer shutdown()
+
+	server := httptest.NewServer(newStatusServerHandler(projectList))
+	defer server.Close()
+
+	for _, path := range []string{"/projects/unknown-project/pause", "/projects/unknown-project/resume", "/projects/unknown-project/unknown-action", "/projects//pause", "/projects/unknown-project"} {
+		if statusCode := requestStatusServer(t, server, http.MethodPost, path); statusCode != http.StatusNotFound {
+			t.Errorf("Expected POST %s to return %d, but got %d", path, http.StatusNotFound, statusCode)
+		}
+	}
+}
+
+func TestStatusServerPauseAndResumeGateSync(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	projectList, shutdown := newTestProjectList(t, mock)
+	defer shutdown()
+
+	server := httptest.NewServer(newStatusServerHandler(projectList))
+	defer server.Close()
+
+	project := newTestProjectToWatch(t, "paused-project", mock.projectPath)
+	projectList.UpdateProjectListFromGetRequest(&models.WatchlistEntries{project})
+	waitFor(t, "the project to be listed by the status server", func() bool {
+		return projectStatusOf(t, server, project.ProjectID) != nil
+	})
+
+	if statusCode := requestStatusServer(t, server, http.MethodPost, "/projects/paused-project/pause"); statusCode != http.StatusOK {
+		t.Fatalf("Expected the project to be paused, but got %d", statusCode)
+	}
+	waitFor(t, "the project to be reported as paused", func() bool {
+		return projectStatusOf(t, server, project.ProjectID).Paused
+	})
+
+	// Changes are received, but not synced, while the project is paused
+	writeTestFiles(t, mock.projectPath, "src/main.go")
+	entry, err := newWatchEventEntry("MODIFY", filepath.Join(mock.projectPath, "src", "main.go"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectList.ReceiveNewWatchEventEntries(entry, &project)
+
+	// Far longer than the batch window
+	time.Sleep(500 * time.Millisecond)
+	if calls := mock.calls(t); len(calls) != 0 {
+		t.Fatalf("Expected no sync while the project is paused, but cwctl was run %d times", len(calls))
+	}
+
+	if statusCode := requestStatusServer(t, server, http.MethodPost, "/projects/paused-project/resume"); statusCode != http.StatusOK {
+		t.Fatalf("Expected the project to be resumed, but got %d", statusCode)
+	}
+	mock.waitForCalls(t, 1)
+
+	if status := projectStatusOf(t, server, project.ProjectID); status.Paused {
+		t.Error("Expected the project not to be reported as paused once resumed")
+	}
+
+	// A forced sync runs cwctl, even though there are no changes
+	if statusCode := requestStatusServer(t, server, http.MethodPost, "/sync"); statusCode != http.StatusOK {
+		t.Fatalf("Expected the sync to be requested, but got %d", statusCode)
+	}
+	mock.waitForCalls(t, 2)
+}
+
+func TestStatusServerLogLevelOverrideExpires(t *testing.T) {
+	mock := newMockCwctl(t)
+	defer mock.cleanup()
+
+	projectList, shutdown := newTestProjectList(t, mock)
+	defer shutdown()
+
+	server := httptest.NewServer(newStatusServerHandler(projectList))
+	defer server.Close()
+
+	const projectID = "log-level-project"
+	defer utils.ClearProjectLogLevel(projectID)
+
+	for _, path := range []string{"/projects/" + projectID + "/loglevel?level=verbose", "/projects/" + projectID + "/loglevel?level=debug&durationSecs=0", "/projects/" + projectID + "/loglevel?level=debug&durationSecs=x"} {
+		if statusCode := requestStatusServer(t, server, http.MethodPost, path); statusCode != http.StatusBadRequest {
+			t.Errorf("Expected POST %s to return %d, but got %d", path, http.StatusBadRequest, statusCode)
+		}
+	}
+	if _, overridden := utils.GetProjectLogLevel(projectID); overridden {
+		t.Fatal("The invalid requests should not override the log level of the project")
+	}
+
+	// The project need not be watched
+	if statusCode := requestStatusServer(t, server, http.MethodPost, "/projects/"+projectID+"/loglevel?level=debug&durationSecs=1"); statusCode != http.StatusOK {
+		t.Fatalf("Expected the log level to be overridden, but got %d", statusCode)
+	}
+	if level, overridden := utils.GetProjectLogLevel(projectID); !overridden || level != utils.DEBUG {
+		t.Fatalf("Expected the log level of the project to be overridden to debug, but was %v (%v)", level, overridden)
+	}
+
+	waitFor(t, "the log level override to expire", func() bool {
+		_, overridden := utils.GetProjectLogLevel(projectID)
+		return !overridden
+	})
+
+	// An override without a duration does not expire, until it is removed
+	if statusCode := requestStatusServer(t, server, http.MethodPost, "/projects/"+projectID+"/loglevel?level=info"); statusCode != http.StatusOK {
+		t.Fatalf("Expected the log level to be overridden, but got %d", statusCode)
+	}
+	if statusCode := requestStatusServer(t, server, http.MethodPost, "/projects/"+projectID+"/loglevel?level=default"); statusCode != http.StatusOK {
+		t.Fatalf("Expected the log level override to be removed, but got %d", statusCode)
+	}
+	if _, overridden := utils.GetProjectLogLevel(projectID); overridden {
+		t.Error("Expected the log level override to be removed")
+	}
+}
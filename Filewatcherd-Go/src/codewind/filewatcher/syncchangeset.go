@@ -0,0 +1,358 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * The type of each file change event (CREATE/MODIFY/DELETE) is preserved from the watcher, through the batch utility,
+ * to the CLI state of the project, which maintains the set of files that have been changed and deleted since the
+ * most recent successful sync. If supported by the installer, these are passed to `cwctl project sync`, so that cwctl
+ * does not need to rescan the project to distinguish deleted files from unchanged ones.
+ *
+ * If a sync fails, its changes are merged back into the pending changes, so that they are passed to the retry.
+ *
+ * Files and directories that were moved within the project are tracked as renames (see correlateRenameEvents), which
+ * cwctl applies before the changed and deleted files, if it supports them. A rename is only tracked while it is
+ * independent of the other changes: if a later change involves its old path (or its new path, other than to modify
+ * it or the files within it), or the rename involves a path that was already changed, it is instead tracked as the
+ * deletion of the old path and the creation of the new one (and of the files within it). Renames are always tracked
+ * this way once the changes of a failed sync are merged, or if cwctl does not support them.
+ *
+ * Each batch of changes (see eventbatchutil.go) is given a correlation ID, which is logged with the batch, and tracked
+ * with its changes, so that it is also logged with the cwctl call that syncs them (and returned for the most recent
+ * sync by /status). A sync whose changes were not received in a batch (for example, a forced sync) is given its own ID.
+ * A sync may include the changes of several batches (and those of a failed sync), so has the IDs of each of them.
+ */
+
+// maxSyncChangeSetSize is the maximum number of paths tracked per sync; beyond this the change set is marked
+// incomplete, and cwctl examines the entire project instead.
+const maxSyncChangeSetSize = 10000
+
+// maxSyncCorrelationIDs is the maximum number of correlation IDs tracked per sync; beyond this only the most recent are kept.
+const maxSyncCorrelationIDs = 10
+
+// syncChangeSet is the set of files (project-relative paths, or absolute paths for files outside of the project)
+// that have changed since the most recent successful sync of a project, by type of change.
+type syncChangeSet struct {
+	changed map[string]bool // Created or modified
+	deleted map[string]bool
+	renamed map[string] /* new path -> */ *syncRename
+
+	// True if the changes are not fully known (for example, a sync was requested without a list of changes, or too
+	// many files were changed), in which case cwctl must examine the entire project.
+	incomplete bool
+
+	// The correlation IDs of the batches of the changes, oldest first; these are retained when the changes are not
+	// fully known.
+	correlationIDs []string
+}
+
+// syncRename is the path from which a file or directory was moved, and, for a directory, the paths of the files and
+// directories that moved with it.
+type syncRename struct {
+	oldPath  string
+	children []string
+}
+
+func newSyncChangeSet() *syncChangeSet {
+	return &syncChangeSet{
+		changed: make(map[string]bool),
+		deleted: make(map[string]bool),
+		renamed: make(map[string]*syncRename),
+	}
+}
+
+// addChanges applies the changes (which must be sorted by timestamp) to the set; a later change of a path supersedes
+// an earlier one. A nil list means that the changes are not known.
+func (set *syncChangeSet) addChanges(changes []ChangedFileEntry) {
+
+	if changes == nil {
+		set.markIncomplete()
+		return
+	}
+
+	if set.incomplete {
+		return
+	}
+
+	for _, change := range changes {
+		if change.eventType == "RENAME" {
+			set.addRename(change.oldPath, change.path, change.renamedChildren)
+			continue
+		}
+
+		// Modifying the new path of a rename (or the files within it) does not affect the rename
+		for newPath, rename := range set.renamed {
+			if isRelatedPath(change.path, rename.oldPath) ||
+				(isSameOrWithinPath(newPath, change.path) && (newPath != change.path || change.eventType == "DELETE")) {
+				set.expandRename(newPath)
+			}
+		}
+
+		if change.eventType == "DELETE" {
+			set.addDeleted(change.path)
+		} else {
+			set.addChanged(change.path)
+		}
+	}
+
+	if set.size() > maxSyncChangeSetSize {
+		set.markIncomplete()
+	}
+}
+
+// addRename applies the move of a file or directory from the old path to the new path (see the top of this file).
+func (set *syncChangeSet) addRename(oldPath string, newPath string, children []string) {
+
+	// A file that is moved again is tracked as a single rename, from its original path
+	if previous, exists := set.renamed[oldPath]; exists {
+		delete(set.renamed, oldPath)
+		oldPath = previous.oldPath
+
+		if oldPath == newPath {
+			// Moved back to where it was
+			return
+		}
+	}
+
+	for otherNewPath, rename := range set.renamed {
+		if isRelatedPath(oldPath, rename.oldPath) || isRelatedPath(oldPath, otherNewPath) ||
+			isRelatedPath(newPath, rename.oldPath) || isRelatedPath(newPath, otherNewPath) {
+			set.expandRename(otherNewPath)
+		}
+	}
+
+	for _, paths := range []map[string]bool{set.changed, set.deleted} {
+		for path := range paths {
+			if isRelatedPath(path, oldPath) || isRelatedPath(path, newPath) {
+				set.addDeleted(oldPath)
+				set.addChanged(newPath)
+				for _, child := range children {
+					set.addChanged(child)
+				}
+				return
+			}
+		}
+	}
+
+	set.renamed[newPath] = &syncRename{oldPath, children}
+}
+
+// expandRename replaces the rename of the new path with the deletion of the old path and the creation of the new path
+// (and of the files within it).
+func (set *syncChangeSet) expandRename(newPath string) {
+
+	rename := set.renamed[newPath]
+	delete(set.renamed, newPath)
+
+	set.addDeleted(rename.oldPath)
+	set.addChanged(newPath)
+	for _, child := range rename.children {
+		// A file that was since deleted remains deleted
+		if !set.deleted[child] {
+			set.addChanged(child)
+		}
+	}
+}
+
+// expandRenames replaces all of the renames, as expandRename.
+func (set *syncChangeSet) expandRenames() {
+	for newPath := range set.renamed {
+		set.expandRename(newPath)
+	}
+}
+
+func (set *syncChangeSet) addChanged(path string) {
+	delete(set.deleted, path)
+	set.changed[path] = true
+}
+
+func (set *syncChangeSet) addDeleted(path string) {
+	delete(set.changed, path)
+	set.deleted[path] = true
+}
+
+// size returns the number of paths in the set.
+func (set *syncChangeSet) size() int {
+	result := len(set.changed) + len(set.deleted)
+	for _, rename := range set.renamed {
+		result += 1 + len(rename.children)
+	}
+	return result
+}
+
+// merge adds the changes of an older set (for example, that of a failed sync) to this one; the changes of this set
+// supersede those of the older set.
+func (set *syncChangeSet) merge(older *syncChangeSet) {
+
+	if older == nil {
+		return
+	}
+
+	// The IDs of the older changes precede those of this set
+	correlationIDs := set.correlationIDs
+	set.correlationIDs = nil
+	for _, correlationID := range older.correlationIDs {
+		set.addCorrelationID(correlationID)
+	}
+	for _, correlationID := range correlationIDs {
+		set.addCorrelationID(correlationID)
+	}
+
+	if older.incomplete {
+		set.markIncomplete()
+	}
+
+	if set.incomplete {
+		return
+	}
+
+	// The paths of the renames of either set may since have changed, so these are tracked as changes of the paths
+	set.expandRenames()
+	older.expandRenames()
+
+	for path := range older.changed {
+		if !set.deleted[path] {
+			set.changed[path] = true
+		}
+	}
+
+	for path := range older.deleted {
+		if !set.changed[path] {
+			set.deleted[path] = true
+		}
+	}
+
+	if set.size() > maxSyncChangeSetSize {
+		set.markIncomplete()
+	}
+}
+
+// markIncomplete discards the individual changes, as cwctl must examine the entire project.
+func (set *syncChangeSet) markIncomplete() {
+	set.incomplete = true
+	set.changed = make(map[string]bool)
+	set.deleted = make(map[string]bool)
+	set.renamed = make(map[string]*syncRename)
+}
+
+// isKnown returns true if the set contains all of the changes, and there is at least one.
+func (set *syncChangeSet) isKnown() bool {
+	return !set.incomplete && (len(set.changed) > 0 || len(set.deleted) > 0 || len(set.renamed) > 0)
+}
+
+// withRenamesExpanded returns a copy of the set in which the renames are replaced, as expandRename.
+func (set *syncChangeSet) withRenamesExpanded() *syncChangeSet {
+
+	result := newSyncChangeSet()
+	result.incomplete = set.incomplete
+	result.correlationIDs = append([]string{}, set.correlationIDs...)
+
+	for path := range set.changed {
+		result.changed[path] = true
+	}
+	for path := range set.deleted {
+		result.deleted[path] = true
+	}
+	for newPath, rename := range set.renamed {
+		result.renamed[newPath] = rename
+	}
+
+	result.expandRenames()
+
+	return result
+}
+
+// addCorrelationID adds the ID of a batch of changes to the set, if it is not empty or already present.
+func (set *syncChangeSet) addCorrelationID(correlationID string) {
+
+	if correlationID == "" {
+		return
+	}
+
+	for _, existing := range set.correlationIDs {
+		if existing == correlationID {
+			return
+		}
+	}
+
+	set.correlationIDs = append(set.correlationIDs, correlationID)
+	if len(set.correlationIDs) > maxSyncCorrelationIDs {
+		set.correlationIDs = set.correlationIDs[len(set.correlationIDs)-maxSyncCorrelationIDs:]
+	}
+}
+
+// correlationIDString returns the correlation IDs of the set, separated by commas.
+func (set *syncChangeSet) correlationIDString() string {
+	return strings.Join(set.correlationIDs, ",")
+}
+
+// newCorrelationID returns a new random ID, with which the logs of a batch of changes and of its sync are correlated.
+func newCorrelationID() string {
+	if uuid := utils.GenerateUuid(); uuid != nil {
+		// The first 12 hex characters are sufficiently unique to correlate the logs of a single process
+		return (*uuid)[0:12]
+	}
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+func (set *syncChangeSet) sortedChanged() []string {
+	return sortedKeys(set.changed)
+}
+
+func (set *syncChangeSet) sortedDeleted() []string {
+	return sortedKeys(set.deleted)
+}
+
+// sortedRenamed returns the new paths of the renames, sorted.
+func (set *syncChangeSet) sortedRenamed() []string {
+	result := make([]string, 0, len(set.renamed))
+	for newPath := range set.renamed {
+		result = append(result, newPath)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (set *syncChangeSet) String() string {
+	if set.incomplete {
+		return "changes: unknown"
+	}
+	return "changed: " + strconv.Itoa(len(set.changed)) + ", deleted: " + strconv.Itoa(len(set.deleted)) +
+		", renamed: " + strconv.Itoa(len(set.renamed))
+}
+
+// isSameOrWithinPath returns true if the path is the parent path, or is within it.
+func isSameOrWithinPath(path string, parent string) bool {
+	return path == parent || strings.HasPrefix(path, strings.TrimSuffix(parent, "/")+"/")
+}
+
+// isRelatedPath returns true if either path is the same as, or is within, the other.
+func isRelatedPath(path1 string, path2 string) bool {
+	return isSameOrWithinPath(path1, path2) || isSameOrWithinPath(path2, path1)
+}
+
+func sortedKeys(values map[string]bool) []string {
+	result := make([]string, 0, len(values))
+	for key := range values {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,147 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/utils"
+	"strconv"
+	"time"
+)
+
+/**
+ * If file changes arrive faster than cwctl can sync them, each sync is immediately followed by another (for the
+ * changes received while it ran), and the project never catches up. A project is lagging from the time that file
+ * changes are received while a sync of the project is active, until a sync completes without any further changes
+ * having been received while it ran. The lag is how long the project has been lagging.
+ *
+ * If the lag exceeds `CWCTL_SYNC_LAG_WARNING_SECS` (default 60; 0 to disable), a warning is logged, and the lag is
+ * returned by the /status endpoint of the status server (along with the time at which the project began to lag). Once
+ * the project catches up, this is logged.
+ *
+ * If `CWCTL_SYNC_LAG_ADAPTIVE_BATCH_WINDOW` is 'true', the batch window of a lagging project (see eventbatchutil.go) is
+ * also widened, so that more of its changes are combined into each batch, and cwctl may catch up: it is doubled each
+ * time the lag exceeds another multiple of the warning threshold, up to maxBatchWindowScale times the batch window of
+ * the project. The batch window is restored once the project catches up.
+ */
+
+// maxBatchWindowScale is the maximum factor by which the batch window of a lagging project is widened.
+const maxBatchWindowScale = 8
+
+// syncLagTracker determines whether the syncs of a project are lagging behind its file changes. It is owned by the
+// readChannel goroutine of the CLIState, and publishes its state to the sync status registry.
+type syncLagTracker struct {
+	state *CLIState
+
+	laggingSince     time.Time // Zero if the project is not lagging
+	warned           bool      // True if the current lag has been logged as exceeding the threshold
+	batchWindowScale int       // The factor by which the batch window of the project is widened; 1 if not widened
+}
+
+func newSyncLagTracker(state *CLIState) *syncLagTracker {
+	return &syncLagTracker{
+		state:            state,
+		batchWindowScale: 1,
+	}
+}
+
+// changesReceived is called when file changes are received; the project begins to lag if a sync is active.
+func (tracker *syncLagTracker) changesReceived(syncActive bool) {
+
+	now := tracker.state.clock.Now()
+
+	if syncActive && tracker.laggingSince.IsZero() {
+		tracker.laggingSince = now
+		tracker.publish()
+	}
+
+	tracker.checkLag(now)
+}
+
+// syncCompleted is called when a sync completes; the project has caught up if no changes were received while it ran.
+func (tracker *syncLagTracker) syncCompleted(changesWaiting bool) {
+
+	now := tracker.state.clock.Now()
+
+	if changesWaiting {
+		tracker.checkLag(now)
+		return
+	}
+
+	tracker.reset("Syncs of project " + tracker.state.projectID + " have caught up with its file changes, after lagging for " +
+		now.Sub(tracker.laggingSince).Round(time.Second).String())
+}
+
+// reset is called once the project is no longer lagging (or no longer syncing, eg as it is paused); the message is
+// logged if the lag was previously logged.
+func (tracker *syncLagTracker) reset(msg string) {
+
+	if tracker.laggingSince.IsZero() {
+		return
+	}
+
+	if tracker.warned {
+		utils.LogInfo(msg)
+	}
+
+	tracker.laggingSince = time.Time{}
+	tracker.warned = false
+	tracker.batchWindowScale = 1
+	tracker.publish()
+}
+
+// checkLag logs a warning (once) if the lag exceeds the threshold, and widens the batch window if enabled.
+func (tracker *syncLagTracker) checkLag(now time.Time) {
+
+	threshold := tracker.state.config.SyncLagWarningThreshold
+	if tracker.laggingSince.IsZero() || threshold <= 0 {
+		return
+	}
+
+	lag := now.Sub(tracker.laggingSince)
+	if lag < threshold {
+		return
+	}
+
+	if !tracker.warned {
+		tracker.warned = true
+		utils.LogWarning("Syncs of project " + tracker.state.projectID + " have lagged behind its file changes for " +
+			lag.Round(time.Second).String() + ", as the changes are arriving faster than cwctl can sync them")
+	}
+
+	if !tracker.state.config.AdaptiveBatchWindow {
+		return
+	}
+
+	// Doubled for each multiple of the threshold: 2x at the threshold, 4x at twice the threshold, (...)
+	scale := 1
+	for multiple := lag / threshold; multiple > 0 && scale < maxBatchWindowScale; multiple-- {
+		scale *= 2
+	}
+
+	if scale != tracker.batchWindowScale {
+		tracker.batchWindowScale = scale
+		utils.LogInfo("Widening the batch window of project " + tracker.state.projectID + " by a factor of " + strconv.Itoa(scale) +
+			", so that cwctl may catch up with its file changes")
+		tracker.publish()
+	}
+}
+
+// publish updates the sync status of the project with the time at which it began to lag (0 if it is not lagging), and
+// the scale of its batch window.
+func (tracker *syncLagTracker) publish() {
+	var laggingSinceInMsecs int64
+	if !tracker.laggingSince.IsZero() {
+		laggingSinceInMsecs = tracker.laggingSince.UnixNano() / int64(time.Millisecond)
+	}
+
+	syncStatusRegistry.syncLagChanged(tracker.state, laggingSinceInMsecs, tracker.batchWindowScale)
+}
@@ -0,0 +1,136 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/utils"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+/**
+ * The TLS configuration used by all HTTP and WebSocket connections to the server (and to the token endpoint).
+ *
+ * By default, the server certificate is verified against the system CA certificates. This may be changed by the
+ * ServerConfig:
+ * - CAFile (FILEWATCHER_CA_FILE): path to a PEM file of additional CA certificates to trust (for example, a
+ *   self-signed or corporate CA).
+ * - TLSInsecure (FILEWATCHER_TLS_INSECURE): the server certificate is not verified. This should only be used for
+ *   development, as it allows the connection to be intercepted.
+ *
+ * The configuration is built once by the watcher (see newServerTLSConfig), which reports any problem with it on
+ * startup (and in the preflight check), and then used by every connection.
+ *
+ * Connections are made through the proxy specified by the HTTP_PROXY/HTTPS_PROXY environment variables (if any),
+ * except for hosts matched by NO_PROXY, and localhost.
+ */
+
+var (
+	// serverTLSConfigLock must be acquired before reading/writing serverTLSConfig
+	serverTLSConfigLock = &sync.Mutex{}
+
+	serverTLSConfig = &tls.Config{} // Replaced by setServerTLSConfig when a watcher is started
+)
+
+// getServerTLSConfig returns a copy of the TLS configuration for connections to the server.
+func getServerTLSConfig() *tls.Config {
+	serverTLSConfigLock.Lock()
+	defer serverTLSConfigLock.Unlock()
+
+	return serverTLSConfig.Clone()
+}
+
+func setServerTLSConfig(config *tls.Config) {
+	serverTLSConfigLock.Lock()
+	defer serverTLSConfigLock.Unlock()
+
+	serverTLSConfig = config
+}
+
+// newServerTLSConfig returns the TLS configuration described by the configuration. If the CA file cannot be used, an
+// error is returned along with a configuration that trusts only the system CA certificates.
+func newServerTLSConfig(config ServerConfig) (*tls.Config, error) {
+
+	result := &tls.Config{}
+
+	if config.TLSInsecure {
+		result.InsecureSkipVerify = true
+		return result, nil
+	}
+
+	caFile := strings.TrimSpace(config.CAFile)
+	if caFile == "" {
+		// Use the system CA certificates
+		return result, nil
+	}
+
+	certPool, err := loadServerCAFile(caFile)
+	if err != nil {
+		return result, err
+	}
+
+	result.RootCAs = certPool
+
+	return result, nil
+}
+
+// logServerTLSConfig logs how the certificate of the server will be verified, and the error (if any) of
+// newServerTLSConfig.
+func logServerTLSConfig(config ServerConfig, tlsConfigErr error) {
+
+	if config.TLSInsecure {
+		utils.LogWarning("**************************************************************************************")
+		utils.LogWarning("FILEWATCHER_TLS_INSECURE is set: the TLS certificate of the server will NOT be verified.")
+		utils.LogWarning("This is insecure, and should only be used for development.")
+		utils.LogWarning("**************************************************************************************")
+	} else if tlsConfigErr != nil {
+		utils.LogSevereErr("Unable to use FILEWATCHER_CA_FILE, so only the system CA certificates will be trusted", tlsConfigErr)
+	} else if caFile := strings.TrimSpace(config.CAFile); caFile != "" {
+		utils.LogInfo("Trusting the CA certificates in " + caFile)
+	}
+}
+
+// loadServerCAFile returns the system CA certificates (where available), with the addition of those in the PEM file.
+func loadServerCAFile(caFile string) (*x509.CertPool, error) {
+
+	pemBytes, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool, err := x509.SystemCertPool()
+	if err != nil || certPool == nil {
+		// The system pool is not available on all platforms
+		utils.LogDebug("System CA certificates are not available, so only FILEWATCHER_CA_FILE will be trusted")
+		certPool = x509.NewCertPool()
+	}
+
+	if !certPool.AppendCertsFromPEM(pemBytes) {
+		return nil, errors.New("No PEM certificates could be parsed from " + caFile)
+	}
+
+	return certPool, nil
+}
+
+// newServerTransport returns a transport for HTTP requests to the server (and to the token endpoint), which uses
+// the server TLS configuration and the proxy from the environment.
+func newServerTransport() *http.Transport {
+	return &http.Transport{
+		TLSClientConfig: getServerTLSConfig(),
+		Proxy:           http.ProxyFromEnvironment,
+	}
+}
@@ -0,0 +1,161 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"sort"
+)
+
+/**
+ * To help diagnose why a file is not being synced, the status server may return (via 'GET /status?details=true') the
+ * directories that are watched for each project (with the number of files within them, which may be compared against
+ * FILEWATCHER_MAX_WATCHED_FILES), and a sample of the paths that were excluded by each ignore rule.
+ *
+ * Excluded paths are recorded by the project list as file change events are filtered out, so a path only appears once
+ * it has been changed. In polling mode, directories that are excluded by the ignored paths, filenames and patterns of
+ * the project are not walked, so changes within them are never seen (or recorded); those excluded by .gitignore files
+ * are still recorded.
+ */
+
+// ProjectWatchDetails is the watch state of a single project, as returned by 'GET /status?details=true'.
+type ProjectWatchDetails struct {
+
+	// The number of watched directories, and their project-relative paths (at most maxWatchedDirectoriesInStatus)
+	WatchedDirectoryCount int      `json:"watchedDirectoryCount"`
+	WatchedDirectories    []string `json:"watchedDirectories"`
+
+	// The number of files and directories within the watched directories, and whether any directories were not watched
+	// as a result of the MaxDepth (FILEWATCHER_MAX_DEPTH) or MaxWatchedFiles (FILEWATCHER_MAX_WATCHED_FILES) of the
+	// WatchConfig; in the latter case, the project root may not be watched at all.
+	WatchedFileCount        int  `json:"watchedFileCount"`
+	MaxDepthReached         bool `json:"maxDepthReached"`
+	MaxWatchedFilesExceeded bool `json:"maxWatchedFilesExceeded"`
+
+	// Whether the project root is polled for changes, either in polling mode, or as it could not be watched (see
+	// pollingwatcher.go)
+	Polled bool `json:"polled"`
+
+	// Key: the ignore rule, eg 'ignoredPaths: /node_modules*', value: project-relative paths that it excluded
+	ExcludedPathSamples map[string][]string `json:"excludedPathSamples"`
+}
+
+const (
+	// maxWatchedDirectoriesInStatus is the maximum number of watched directories that are returned per project.
+	maxWatchedDirectoriesInStatus = 1000
+
+	// maxExcludedPathSamplesPerRule is the maximum number of excluded paths that are recorded per ignore rule.
+	maxExcludedPathSamplesPerRule = 10
+
+	// maxExcludedPathRules is the maximum number of ignore rules for which excluded paths are recorded per project.
+	maxExcludedPathRules = 100
+)
+
+// recordExcludedPath records that the path was excluded by the rule, if there is room for another sample. This is
+// only called by the project list goroutine.
+func (po *projectObject) recordExcludedPath(rule string, path string) {
+
+	if po.excludedPathSamples == nil {
+		po.excludedPathSamples = make(map[string][]string)
+	}
+
+	samples, exists := po.excludedPathSamples[rule]
+	if !exists && len(po.excludedPathSamples) >= maxExcludedPathRules {
+		return
+	}
+
+	if len(samples) >= maxExcludedPathSamplesPerRule {
+		return
+	}
+
+	for _, sample := range samples {
+		if sample == path {
+			return
+		}
+	}
+
+	po.excludedPathSamples[rule] = append(samples, path)
+}
+
+// copyExcludedPathSamples returns a deep copy of the excluded path samples of the project, with each list sorted.
+func (po *projectObject) copyExcludedPathSamples() map[string][]string {
+
+	result := make(map[string][]string)
+
+	for rule, samples := range po.excludedPathSamples {
+		samplesCopy := make([]string, len(samples))
+		copy(samplesCopy, samples)
+		sort.Strings(samplesCopy)
+		result[rule] = samplesCopy
+	}
+
+	return result
+}
+
+// watchDetailsResponse is the response of the project list goroutine to a request for watch details.
+type watchDetailsResponse struct {
+	excludedPathSamples map[string]map[string][]string // Key: project ID
+	watchService        *WatchService                  // Nullable
+}
+
+// GetWatchDetails returns the watch state of each watched project (key: project ID). This blocks until the project
+// list and watch service goroutines have responded, so it must not be called from either of them.
+func (projectList *ProjectList) GetWatchDetails() map[string]*ProjectWatchDetails {
+
+	responseChannel := make(chan *watchDetailsResponse, 1)
+
+	projectList.projectOperationChannel <- &projectListChannelMessage{
+		msgType:             watchDetailsMsg,
+		watchDetailsMessage: responseChannel,
+	}
+
+	response := <-responseChannel
+
+	watchDetails := map[string]*ProjectWatchDetails{}
+	if response.watchService != nil {
+		watchDetails = response.watchService.GetWatchDetails()
+	}
+
+	result := make(map[string]*ProjectWatchDetails)
+
+	for projectID, samples := range response.excludedPathSamples {
+
+		details := watchDetails[projectID]
+		if details == nil {
+			details = &ProjectWatchDetails{WatchedDirectories: []string{}}
+		}
+		details.ExcludedPathSamples = samples
+
+		if len(details.WatchedDirectories) > maxWatchedDirectoriesInStatus {
+			details.WatchedDirectories = details.WatchedDirectories[0:maxWatchedDirectoriesInStatus]
+		}
+
+		result[projectID] = details
+	}
+
+	return result
+}
+
+func (projectList *ProjectList) handleWatchDetailsRequest(projectsMap map[string]*projectObject, watchService *WatchService) *watchDetailsResponse {
+
+	result := &watchDetailsResponse{
+		excludedPathSamples: make(map[string]map[string][]string),
+		watchService:        watchService,
+	}
+
+	for projectID, po := range projectsMap {
+		if po != nil {
+			result.excludedPathSamples[projectID] = po.copyExcludedPathSamples()
+		}
+	}
+
+	return result
+}
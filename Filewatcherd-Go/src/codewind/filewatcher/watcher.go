@@ -0,0 +1,349 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"codewind/utils"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+/**
+ * Watcher is the entrypoint for programs that embed the filewatcher, rather than running it as a separate process (the
+ * filewatcher binary is a thin wrapper around it, see clientmain.go). For example:
+ *
+ *   watcher, err := filewatcher.NewWatcher("http://localhost:9090", "/path/to/cwctl", filewatcher.DefaultConfig())
+ *   (...)
+ *   err = watcher.Start(ctx)
+ *   (...)
+ *   watcher.Stop()
+ *
+ * The watcher either connects to a Codewind server, which provides the list of projects to watch (and to which file
+ * changes are reported), or, if no server URL is given, watches only the projects that are added with AddProject. In
+ * the former case, the list of projects from the server is authoritative: a project that was added with AddProject is
+ * removed by the next reconciliation, unless the server also knows of it.
+ *
+ * Some state is shared by all watchers in a process: the sync status of each project (see statusserver.go), the limit
+ * on concurrent cwctl processes, the authentication token, the TLS configuration, the case sensitivity of paths, and
+ * the measured clock skew; these are taken from the configuration of the most recently started watcher.
+ */
+
+// Watcher watches the files of a set of projects, and syncs their changes with cwctl. A watcher may only be started
+// once; once stopped, a new watcher must be created.
+type Watcher struct {
+	baseURL       string // Empty if not connected to a Codewind server
+	installerPath string // The installer (or mock installer) that syncs projects; may be empty, in which case cwctl is not run
+	config        *Config
+
+	// The TLS configuration of the connections to the server, and the error (if any) of the CA file it was built from
+	serverTLSConfig    *tls.Config
+	serverTLSConfigErr error
+
+	lock  *sync.Mutex
+	state watcherState // lock must be acquired before reading/writing
+
+	// Set by Start; immutable thereafter
+	cancel       context.CancelFunc
+	projectList  *ProjectList
+	watchService *WatchService
+	servers      []*http.Server // The status and pprof servers, if enabled
+
+	stopped chan struct{} // Closed once the watcher has been stopped
+	stopErr error         // The result of the shutdown; only read once stopped is closed
+}
+
+type watcherState int
+
+const (
+	watcherCreated watcherState = iota
+	watcherStarted
+	watcherStopping
+	watcherStopped
+)
+
+var (
+	errWatcherAlreadyStarted = errors.New("The watcher has already been started")
+	errWatcherNotRunning     = errors.New("The watcher is not running")
+)
+
+// NewWatcher returns a watcher that has not yet been started. The base URL is that of the Codewind server (eg
+// 'http://localhost:9090'), or empty if the watcher should not connect to a server. The installer path is that of
+// cwctl; if it is empty, file changes are only reported to the server. If the config is nil, DefaultConfig() is used;
+// it must not be modified once passed.
+func NewWatcher(baseURL string, installerPath string, config *Config) (*Watcher, error) {
+
+	if config == nil {
+		config = DefaultConfig()
+	} else if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if baseURL != "" {
+		baseURL = utils.StripTrailingForwardSlash(baseURL)
+		if !utils.IsValidURLBase(baseURL) {
+			return nil, errors.New("URL is invalid: " + baseURL)
+		}
+	}
+
+	if config.CLI.MockInstallerPath != "" {
+		installerPath = config.CLI.MockInstallerPath
+	}
+
+	serverTLSConfig, serverTLSConfigErr := newServerTLSConfig(config.Server)
+
+	return &Watcher{
+		baseURL:            baseURL,
+		installerPath:      installerPath,
+		config:             config,
+		serverTLSConfig:    serverTLSConfig,
+		serverTLSConfigErr: serverTLSConfigErr,
+		lock:               &sync.Mutex{},
+		state:              watcherCreated,
+		stopped:            make(chan struct{}),
+	}, nil
+}
+
+// applyServerConfig installs the TLS configuration and the token provider of the watcher, which are shared by every
+// connection to the server in the process.
+func (watcher *Watcher) applyServerConfig() {
+	setServerTLSConfig(watcher.serverTLSConfig)
+	initTokenProvider(watcher.config.Server)
+}
+
+// Start starts watching projects (and, if configured, the status and pprof servers) on separate goroutines. The
+// watcher is stopped (as Stop) when the context is cancelled.
+func (watcher *Watcher) Start(ctx context.Context) error {
+
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	if watcher.state != watcherCreated {
+		return errWatcherAlreadyStarted
+	}
+
+	if watcher.config.CLI.MockInstallerPath == "" && strings.TrimSpace(watcher.installerPath) != "" {
+		ProbeCwctlCapabilities(watcher.installerPath, watcher.config.CLI)
+	}
+
+	utils.SetCaseInsensitiveFileSystem(watcher.config.Watch.CaseInsensitivePaths)
+
+	if watcher.config.CLI.DryRun {
+		utils.LogInfo("FILEWATCHER_DRY_RUN is set, so cwctl syncs will be logged rather than run")
+	}
+
+	var postOutputQueue *HttpPostOutputQueue
+	if watcher.baseURL != "" {
+		// Problems with the TLS configuration are reported on startup, rather than on the first failed connection
+		logServerTLSConfig(watcher.config.Server, watcher.serverTLSConfigErr)
+		watcher.applyServerConfig()
+
+		var err error
+		postOutputQueue, err = NewHttpPostOutputQueue(watcher.baseURL)
+		if err != nil {
+			return errors.New("Unable to create HTTP POST output queue: " + err.Error())
+		}
+	}
+
+	projectList := NewProjectList(postOutputQueue, watcher.installerPath, watcher.config)
+
+	// These are only started if explicitly configured, so a failure to start either is treated as fatal
+	statusServer, err := StartStatusServer(projectList, watcher.config.Server)
+	if err != nil {
+		return err
+	}
+	pprofServer, err := StartPprofServer(watcher.config.Server)
+	if err != nil {
+		closeEmbeddedServers(statusServer)
+		return err
+	}
+
+	watcherCtx, cancel := context.WithCancel(ctx)
+
+	StartClockSkewMonitor(watcherCtx, watcher.config.Watch)
+
+	watchService := NewWatchService(projectList, watcher.baseURL, *utils.GenerateUuid(), watcher.config.Watch)
+	projectList.SetWatchService(watchService)
+
+	if watcher.baseURL != "" {
+		httpGetStatusThread, err := NewHttpGetStatusThread(watcherCtx, watcher.baseURL, projectList, watcher.config.Server)
+		if err == nil {
+			err = StartWSConnectionManager(watcherCtx, watcher.baseURL, projectList, httpGetStatusThread, watcher.config.Server)
+		}
+		if err != nil {
+			cancel()
+			watchService.Dispose()
+			closeEmbeddedServers(statusServer, pprofServer)
+			return err
+		}
+	}
+
+	NewDebugTimer(watcherCtx, watchService, projectList, postOutputQueue).Start()
+
+	watcher.cancel = cancel
+	watcher.projectList = projectList
+	watcher.watchService = watchService
+	watcher.servers = []*http.Server{statusServer, pprofServer}
+	watcher.state = watcherStarted
+
+	go func() {
+		<-watcherCtx.Done()
+		watcher.Stop()
+	}()
+
+	return nil
+}
+
+// Stop stops the watcher, as Shutdown, allowing up to the shutdown grace period (see GetShutdownGracePeriod) for the
+// final syncs to complete.
+func (watcher *Watcher) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), GetShutdownGracePeriod())
+	defer cancel()
+
+	return watcher.Shutdown(ctx)
+}
+
+// Shutdown stops the watcher (see shutdown.go): file changes are no longer accepted, and a final sync of each project
+// with unsynced changes is run. If the context is done before the final syncs complete, any running cwctl processes
+// are killed, and an error is returned. The watcher's goroutines, file watchers, connections and servers are then
+// closed. If the watcher is already stopping, this waits for it to stop.
+func (watcher *Watcher) Shutdown(ctx context.Context) error {
+
+	watcher.lock.Lock()
+	switch watcher.state {
+	case watcherCreated:
+		watcher.state = watcherStopped
+		close(watcher.stopped)
+		watcher.lock.Unlock()
+		return nil
+
+	case watcherStopping, watcherStopped:
+		watcher.lock.Unlock()
+		<-watcher.stopped
+		return watcher.stopErr
+	}
+	watcher.state = watcherStopping
+	watcher.lock.Unlock()
+
+	projects := watcher.projectList.Shutdown()
+
+	shutdownComplete := make(chan struct{})
+	go func() {
+		shutdownProjects(projects)
+		close(shutdownComplete)
+	}()
+
+	var err error
+
+	select {
+	case <-shutdownComplete:
+	case <-ctx.Done():
+		err = errors.New("The shutdown did not complete in time, so any running syncs were killed")
+		utils.LogSevere(err.Error())
+	}
+
+	disposeShutdownProjects(projects)
+	watcher.watchService.Dispose()
+
+	// Stops the HTTP GET status thread, closes the WebSocket connection, and stops the timers
+	watcher.cancel()
+
+	closeEmbeddedServers(watcher.servers...)
+
+	if err == nil {
+		utils.LogInfo("Shutdown complete")
+	}
+
+	watcher.lock.Lock()
+	watcher.state = watcherStopped
+	watcher.stopErr = err
+	close(watcher.stopped)
+	watcher.lock.Unlock()
+
+	return err
+}
+
+// AddProject starts watching the project, or updates it if it is already watched, as if it had been received from the
+// WebSocket of the server. The project ID and path (in absolute, normalized, Unix-style form) are required.
+func (watcher *Watcher) AddProject(project models.ProjectToWatch) error {
+
+	projectList, err := watcher.getRunningProjectList()
+	if err != nil {
+		return err
+	}
+
+	project.ChangeType = ""
+	if err := project.Validate(); err != nil {
+		return err
+	}
+
+	projectList.UpdateProjectListFromWebSocket(&models.WatchChangeJson{Projects: models.WatchlistEntries{project}})
+
+	return nil
+}
+
+// RemoveProject stops watching the project, as if its deletion had been received from the WebSocket of the server.
+// If the project is not watched, this is logged, and otherwise ignored.
+func (watcher *Watcher) RemoveProject(projectID string) error {
+
+	projectList, err := watcher.getRunningProjectList()
+	if err != nil {
+		return err
+	}
+
+	project := models.ProjectToWatch{ProjectID: projectID, ChangeType: "delete"}
+	if err := project.Validate(); err != nil {
+		return err
+	}
+
+	projectList.UpdateProjectListFromWebSocket(&models.WatchChangeJson{Projects: models.WatchlistEntries{project}})
+
+	return nil
+}
+
+// ForceSync runs cwctl for every watched project, whether or not any file changes were detected.
+func (watcher *Watcher) ForceSync() error {
+
+	projectList, err := watcher.getRunningProjectList()
+	if err != nil {
+		return err
+	}
+
+	projectList.ForceSync()
+
+	return nil
+}
+
+// getRunningProjectList returns the project list, or an error if the watcher has not been started, or is stopping.
+func (watcher *Watcher) getRunningProjectList() (*ProjectList, error) {
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	if watcher.state != watcherStarted {
+		return nil, errWatcherNotRunning
+	}
+
+	return watcher.projectList, nil
+}
+
+// closeEmbeddedServers closes each of the servers that is not nil (that is, that was enabled).
+func closeEmbeddedServers(servers ...*http.Server) {
+	for _, server := range servers {
+		if server != nil {
+			server.Close()
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// resetServerConnectionState restores the TLS configuration and token provider that are shared by every watcher in the
+// process, so that they are created from the configuration of the next watcher.
+func resetServerConnectionState() {
+	setServerTLSConfig(&tls.Config{})
+
+	tokenProviderLock.Lock()
+	tokenProvider = nil
+	tokenProviderLock.Unlock()
+}
+
+// The TLS and authentication settings of a Config that is constructed directly (rather than loaded from the
+// environment) are used by the HTTP requests to the server.
+func TestCheckUsesServerConfigOfDirectlyConstructedConfig(t *testing.T) {
+	defer resetServerConnectionState()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer config-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"projects":[]}`))
+	}))
+	defer server.Close()
+
+	serverCheckOf := func(config *Config) CheckResult {
+		resetServerConnectionState()
+
+		watcher, err := NewWatcher(server.URL, "", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, result := range watcher.Check().Results {
+			if result.Name == "Server" {
+				return result
+			}
+		}
+		t.Fatal("The report has no server check")
+		return CheckResult{}
+	}
+
+	config := DefaultConfig()
+	config.Server.AuthToken = "config-token"
+	if result := serverCheckOf(config); result.Status != CheckFailed || !strings.Contains(result.Detail, "not reachable") {
+		t.Errorf("The certificate of the server should not be trusted without the CA file: %v", result)
+	}
+
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	caFile, removeCAFile := writeConfigFile(t, "ca.pem", string(pemBytes))
+	defer removeCAFile()
+
+	config = DefaultConfig()
+	config.Server.AuthToken = "config-token"
+	config.Server.CAFile = caFile
+	if result := serverCheckOf(config); result.Status != CheckPassed {
+		t.Errorf("The server should be trusted, and accept the token, of the config: %v", result)
+	}
+
+	config = DefaultConfig()
+	config.Server.AuthToken = "wrong-token"
+	config.Server.TLSInsecure = true
+	if result := serverCheckOf(config); result.Status != CheckFailed || !strings.Contains(result.Detail, "rejected the credentials") {
+		t.Errorf("The server should be reached without verification, and reject the token of the config: %v", result)
+	}
+}
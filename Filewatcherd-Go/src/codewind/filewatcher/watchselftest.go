@@ -0,0 +1,76 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"codewind/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/**
+ * On some file systems (overlayfs, some bind mounts, Docker Desktop file sharing), file system events are never
+ * delivered, so changes would silently be missed. If the FILEWATCHER_WATCH_SELF_TEST environment variable is 'true',
+ * once the watch of a project root is established, a hidden probe file is written to (and deleted from) the root. If
+ * no event is received for it within X seconds (5 by default, or FILEWATCHER_WATCH_SELF_TEST_TIMEOUT_MS), the
+ * project root is instead polled for changes (see pollingwatcher.go).
+ */
+
+// watchProbeFilePrefix is the filename prefix of the probe files; as for every path owned by the filewatcher, events
+// for these files are not reported.
+const watchProbeFilePrefix = utils.FilewatcherOwnedFilenamePrefix + "probe-"
+
+/** Returns true if the path is a probe file written by the self-test. */
+func isWatchProbeFile(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), watchProbeFilePrefix)
+}
+
+/** Write and delete a probe file in the project root, and fall back to polling if no event is received for it. */
+func runWatchSelfTest(cWatcher *CodewindWatcher, project *models.ProjectToWatch, projectList *ProjectList, service *WatchService) {
+
+	timeout := service.config.SelfTestTimeout
+
+	probeFile, err := ioutil.TempFile(cWatcher.rootPath, watchProbeFilePrefix)
+	if err != nil {
+		utils.LogErrorErr("Unable to write watch self-test file to "+cWatcher.rootPath+", so the self-test was skipped", err)
+		return
+	}
+	probeFile.Close()
+	os.Remove(probeFile.Name())
+
+	select {
+	case <-cWatcher.probeEventChannel:
+		utils.LogInfo("Watch self-test succeeded for project " + project.ProjectID + ": " + cWatcher.rootPath)
+		return
+	case <-time.After(timeout):
+	}
+
+	cWatcher.lock.Lock()
+	isClosed := cWatcher.closed_synch_lock
+	cWatcher.lock.Unlock()
+	if isClosed {
+		// The project is no longer watched by this watcher, so there is nothing to fall back from
+		return
+	}
+
+	utils.LogSevere("**************************************************************************************")
+	utils.LogSevere("No file system events were received for project " + project.ProjectID + " within " + timeout.String() + ".")
+	utils.LogSevere("The file system of " + cWatcher.rootPath + " does not appear to support file change events,")
+	utils.LogSevere("so the project will be polled for changes instead; changes may take longer to be detected.")
+	utils.LogSevere("**************************************************************************************")
+
+	startPollingFallback(cWatcher, project, projectList, service)
+}
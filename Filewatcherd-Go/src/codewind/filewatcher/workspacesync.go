@@ -0,0 +1,314 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/utils"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * In a large workspace, many projects may need to be synced at around the same time (for example, after a branch
+ * switch, or on startup), each of which would otherwise spawn a separate cwctl process. If the `CWCTL_WORKSPACE_SYNC`
+ * environment variable is 'true', and the installer supports syncing multiple projects of a workspace in a single call
+ * (`cwctl project sync --workspace`, see cwctlcapabilities.go), the syncs of projects that share the same workspace
+ * root (the parent directory of the project) are instead grouped into a single cwctl call.
+ *
+ * A sync that is eligible for grouping waits up to `CWCTL_WORKSPACE_SYNC_WINDOW_MS` (default 200) msecs for the
+ * syncs of other projects of the same workspace; the group is then synced by a single call, using the earliest
+ * timestamp of the group (re-examining files that were modified since a later timestamp is harmless). If no other
+ * project joined the group, the sync is run for the project alone, as usual.
+ *
+ * A sync is only eligible if cwctl would be passed no arguments specific to the project, other than its ID, path and
+ * timestamp: that is, the project has no ignore rules that are passed to cwctl, its individual changes are not passed
+ * to cwctl, it does not use a different installer, and no extra environment variables are set for cwctl. The sync
+ * command template (CWCTL_SYNC_COMMAND, see cwctlsynccommand.go) must also be the default.
+ */
+
+const cwctlWorkspaceFlag = "--workspace"
+
+// workspaceSyncKey identifies the syncs that may be combined into a single cwctl call.
+type workspaceSyncKey struct {
+	installerPath string
+	workspaceRoot string
+	workingDir    string
+}
+
+// workspaceSyncRequest is the sync of a single project, waiting for its group to be synced.
+type workspaceSyncRequest struct {
+	state     *CLIState
+	timestamp int64
+	spawnTime int64
+
+	// Receives the result of the group sync, or nil if the project should be synced alone; buffered, so that the
+	// group sync never blocks on a request that is no longer waiting.
+	resultChan chan *RunProjectReturn
+
+	group *workspaceSyncGroup
+}
+
+// workspaceSyncGroup is the set of syncs that will be run by a single cwctl call, once the window has elapsed.
+type workspaceSyncGroup struct {
+	members  []*workspaceSyncRequest // lock of the WorkspaceSyncBatcher must be acquired before reading/writing
+	launched bool                    // lock of the WorkspaceSyncBatcher must be acquired before reading/writing
+}
+
+// WorkspaceSyncBatcher groups the pending syncs of projects that share the same workspace root.
+type WorkspaceSyncBatcher struct {
+	enabled bool
+	window  time.Duration
+
+	lock    *sync.Mutex
+	pending map[workspaceSyncKey]*workspaceSyncGroup // lock must be acquired before reading/writing
+}
+
+var (
+	workspaceSyncBatcher     *WorkspaceSyncBatcher
+	workspaceSyncBatcherOnce sync.Once
+)
+
+// getWorkspaceSyncBatcher returns the batcher, creating it on first use; the batcher is shared by all projects, so is
+// configured by the config of the first call.
+func getWorkspaceSyncBatcher(config CLIConfig) *WorkspaceSyncBatcher {
+
+	workspaceSyncBatcherOnce.Do(func() {
+		workspaceSyncBatcher = &WorkspaceSyncBatcher{
+			enabled: config.WorkspaceSync,
+			window:  config.WorkspaceSyncWindow,
+			lock:    &sync.Mutex{},
+			pending: make(map[workspaceSyncKey]*workspaceSyncGroup),
+		}
+	})
+
+	return workspaceSyncBatcher
+}
+
+// isEligible returns true if the sync of the project may be combined with those of other projects, given the
+// project-specific arguments that would otherwise be passed to cwctl.
+func (batcher *WorkspaceSyncBatcher) isEligible(state *CLIState, installerPath string, projectSpecificArgs []string) bool {
+
+	if !batcher.enabled || state.mockInstallerPath != "" || state.dryRun || len(state.extraEnv) > 0 {
+		return false
+	}
+
+	if len(projectSpecificArgs) > 0 || installerPath != state.installerPath || !state.syncCommand.isDefault() {
+		return false
+	}
+
+	return getCwctlSyncCapabilities(installerPath, state.syncCommand).workspaceSync
+}
+
+// sync adds the sync of the project to the group of its workspace, and waits for the group to be synced. The result
+// of the group sync is returned, or nil if the project should instead be synced alone (no other project joined the
+// group), or if the sync context was cancelled while waiting (in which case the sync was superseded).
+func (batcher *WorkspaceSyncBatcher) sync(syncCtx context.Context, state *CLIState, workingDir string, timestamp int64, spawnTime int64) *RunProjectReturn {
+
+	key := workspaceSyncKey{
+		installerPath: state.installerPath,
+		workspaceRoot: filepath.Dir(state.projectPath),
+		workingDir:    workingDir,
+	}
+
+	request := &workspaceSyncRequest{
+		state:      state,
+		timestamp:  timestamp,
+		spawnTime:  spawnTime,
+		resultChan: make(chan *RunProjectReturn, 1),
+	}
+
+	batcher.lock.Lock()
+	group, exists := batcher.pending[key]
+	if !exists {
+		group = &workspaceSyncGroup{}
+		batcher.pending[key] = group
+		time.AfterFunc(batcher.window, func() {
+			batcher.launch(key, group)
+		})
+	}
+	group.members = append(group.members, request)
+	request.group = group
+	batcher.lock.Unlock()
+
+	select {
+	case result := <-request.resultChan:
+		return result
+	case <-syncCtx.Done():
+		batcher.remove(request)
+		return nil
+	}
+}
+
+// remove removes the request from its group, if the group has not yet been synced.
+func (batcher *WorkspaceSyncBatcher) remove(request *workspaceSyncRequest) {
+	batcher.lock.Lock()
+	defer batcher.lock.Unlock()
+
+	if request.group.launched {
+		return
+	}
+
+	for index, member := range request.group.members {
+		if member == request {
+			request.group.members = append(request.group.members[:index], request.group.members[index+1:]...)
+			return
+		}
+	}
+}
+
+// launch is called once the window of the group has elapsed: the group is synced by a single cwctl call, unless it
+// has fewer than two members, in which case each member is synced alone.
+func (batcher *WorkspaceSyncBatcher) launch(key workspaceSyncKey, group *workspaceSyncGroup) {
+
+	batcher.lock.Lock()
+	if batcher.pending[key] == group {
+		delete(batcher.pending, key)
+	}
+	group.launched = true
+	members := group.members
+	batcher.lock.Unlock()
+
+	if len(members) < 2 {
+		for _, member := range members {
+			member.resultChan <- nil
+		}
+		return
+	}
+
+	go batcher.runWorkspaceSync(key, members)
+}
+
+// runWorkspaceSync runs a single cwctl call for every member of the group, and passes the result to each of them.
+func (batcher *WorkspaceSyncBatcher) runWorkspaceSync(key workspaceSyncKey, members []*workspaceSyncRequest) {
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].state.projectID < members[j].state.projectID
+	})
+
+	timestamp := members[0].timestamp
+	projectIDs := []string{}
+	for _, member := range members {
+		if member.timestamp < timestamp {
+			timestamp = member.timestamp
+		}
+		projectIDs = append(projectIDs, member.state.projectID)
+	}
+
+	args := []string{"project", "sync", cwctlWorkspaceFlag, key.workspaceRoot, "-t", strconv.FormatInt(timestamp, 10)}
+	for _, member := range members {
+		args = append(args, "-p", member.state.projectPath, "-i", member.state.projectID)
+	}
+
+	installerPwd := filepath.Dir(key.installerPath)
+	if key.workingDir != "" {
+		installerPwd = key.workingDir
+	}
+
+	utils.LogInfo("Calling cwctl project sync for workspace " + key.workspaceRoot + " with timestamp " + strconv.FormatInt(timestamp, 10) +
+		", for projects: " + strings.Join(projectIDs, ", "))
+	utils.LogDebug("Calling cwctl project sync for workspace with: { [ " + strings.Join(args, "] [ ") + "] }")
+
+	workspaceDescription := "workspace " + key.workspaceRoot
+	// The process is not killed if a member is superseded or disposed (nor is its wait for a slot cancelled), as the
+	// sync is still required by the others
+	acquireCwctlProcessSlot(context.Background(), workspaceDescription, members[0].state.config.MaxConcurrentProcesses)
+	syncTimeout := members[0].state.syncTimeout
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if syncTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), syncTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	processStartTimeInMsecs := nowInMsecs(members[0].state.clock)
+
+	cmd := exec.CommandContext(ctx, key.installerPath, args...)
+	cmd.Dir = installerPwd
+
+	stdout, stderr, combinedOutput := newCwctlOutputWriters(members[0].state.maxOutputBytes)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	syncResult := SyncResultSucceeded
+	exitCode := 0
+
+	if err := cmd.Start(); err != nil {
+		releaseCwctlProcessSlot()
+
+		msg := "Unable to start '" + key.installerPath + "': " + err.Error()
+		utils.LogSevere(msg)
+
+		for _, member := range members {
+			recordSyncSpawnFailure(member.state.projectID, err)
+			member.resultChan <- &RunProjectReturn{
+				result:           SyncResultSpawnFailed,
+				exitCode:         exitCodeUnknown,
+				output:           msg,
+				stderr:           msg,
+				spawnTime:        member.spawnTime,
+				syncedFileCount:  unknownFileCount,
+				deletedFileCount: unknownFileCount,
+			}
+		}
+		return
+	}
+
+	err := cmd.Wait()
+
+	releaseCwctlProcessSlot()
+
+	elapsedTimeInMsecs := nowInMsecs(members[0].state.clock) - processStartTimeInMsecs
+
+	if err != nil {
+		syncResult = SyncResultFailed
+		exitCode = exitCodeUnknown
+		if exitErr, castable := err.(*exec.ExitError); castable {
+			exitCode = exitErr.ExitCode()
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			syncResult = SyncResultTimeout
+			utils.LogError("'project sync' installer command for workspace " + key.workspaceRoot + " did not complete within " + syncTimeout.String() + ", and was killed.")
+		}
+
+		utils.LogError("Error running 'project sync' installer command for workspace " + key.workspaceRoot + ", for projects: " + strings.Join(projectIDs, ", "))
+		utils.LogError("Out: " + stdout.String())
+		utils.LogError("Err: " + stderr.String())
+	} else {
+		utils.LogInfo("Successfully ran installer command for workspace " + key.workspaceRoot + ", elapsed time: " + strconv.FormatInt(elapsedTimeInMsecs, 10))
+		utils.LogDebug("Output:" + stdout.String())
+	}
+
+	for _, member := range members {
+		getSyncMetricsRecorder().RecordSyncDuration(member.state.projectID, elapsedTimeInMsecs, syncResult == SyncResultSucceeded)
+
+		// The file counts in the output are for the entire workspace, so are not attributed to any one project
+		member.resultChan <- &RunProjectReturn{
+			result:           syncResult,
+			exitCode:         exitCode,
+			output:           combinedOutput.String(),
+			stdout:           stdout.String(),
+			stderr:           stderr.String(),
+			spawnTime:        member.spawnTime,
+			elapsedTime:      elapsedTimeInMsecs,
+			syncedFileCount:  unknownFileCount,
+			deletedFileCount: unknownFileCount,
+		}
+	}
+}
@@ -0,0 +1,386 @@
+/*******************************************************************************
+* Copyright (c) 2019 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"codewind/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+/**
+ * The purpose of the WebSocket Connection Manager is to initiate and maintain the WebSocket
+ * connection between the filewatcher and the server.
+ *
+ * After queueEstablishConnection(...) is called, we will keep trying to connect
+ * to the server until it succeeds. If that connection ever goes down for any
+ * reason, queueEstablishConnection() still start the reconnection process over
+ * again.
+ *
+ * This class also sends a simple "keep alive" packet, and a WebSocket ping, every X seconds (25 by default, or
+ * `FILEWATCHER_WS_PING_INTERVAL_MS`). If no pong (or other message) is received from the server within
+ * `FILEWATCHER_WS_PONG_TIMEOUT_MS` (10 seconds by default) of the expected time, the connection is assumed to be
+ * stale (for example, a half-open connection after a silent network drop), and is closed and reconnected.
+ *
+ * Reconnection attempts use an exponential backoff with jitter, between 200 msecs and 4 seconds by default; these
+ * bounds may be changed with the `FILEWATCHER_WS_RECONNECT_MIN_MS` and `FILEWATCHER_WS_RECONNECT_MAX_MS`
+ * environment variables. These settings are read from the ServerConfig.
+ *
+ * When the context of the connection manager is cancelled (on shutdown of the filewatcher), the connection is closed,
+ * and any further reconnection attempts are stopped.
+ */
+
+type ReconnectMessage int
+
+// wsKeepAliveSettings are the interval between pings, and how long to wait for the corresponding pong.
+type wsKeepAliveSettings struct {
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+}
+
+func newWSKeepAliveSettings(config ServerConfig) wsKeepAliveSettings {
+	return wsKeepAliveSettings{
+		pingInterval: config.WSPingInterval,
+		pongTimeout:  config.WSPongTimeout,
+	}
+}
+
+// readDeadline returns the time by which the next message (or pong) must be received from the server, for the
+// connection to be considered alive.
+func (settings wsKeepAliveSettings) readDeadline() time.Time {
+	return time.Now().Add(settings.pingInterval + settings.pongTimeout)
+}
+
+const (
+	Reconnect = iota + 1
+	Terminate
+)
+
+// wsShutdownState is the state of the current WebSocket connection of a connection manager, and whether the
+// filewatcher is shutting down.
+type wsShutdownState struct {
+	lock         *sync.Mutex
+	shuttingDown bool            // lock must be acquired before reading/writing
+	conn         *websocket.Conn // The current connection, if connected; lock must be acquired before reading/writing
+}
+
+// closeForShutdown closes the WebSocket connection (if connected), and stops any further reconnection attempts.
+func (state *wsShutdownState) closeForShutdown() {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.shuttingDown = true
+
+	if state.conn != nil {
+		utils.LogInfo("Closing WebSocket connection for shutdown")
+		state.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		state.conn.Close()
+		state.conn = nil
+	}
+}
+
+// setConnection records the current connection, returning false (without recording it) if shutting down.
+func (state *wsShutdownState) setConnection(c *websocket.Conn) bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	if state.shuttingDown {
+		return false
+	}
+	state.conn = c
+	return true
+}
+
+func (state *wsShutdownState) isShuttingDown() bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	return state.shuttingDown
+}
+
+// StartWSConnectionManager connects to the WebSocket of the server on a separate goroutine, reconnecting whenever the
+// connection is lost, until the context is cancelled.
+func StartWSConnectionManager(ctx context.Context, baseURL string, projectList *ProjectList, httpGetStatusThread *HttpGetStatusThread, config ServerConfig) error {
+	baseURL = utils.StripTrailingForwardSlash(baseURL)
+
+	if !utils.IsValidURLBase(baseURL) {
+		return errors.New("URL is invalid: " + baseURL)
+	}
+
+	wsURLType := "ws"
+	if strings.HasPrefix(baseURL, "https:") {
+		wsURLType = "wss"
+	}
+
+	lastSlash := strings.LastIndex(baseURL, "/")
+	if lastSlash == -1 {
+		return errors.New("Invalid URL format, no slash found: " + baseURL)
+	}
+
+	hostnameAndPort := baseURL[lastSlash+1:]
+
+	shutdownState := &wsShutdownState{lock: &sync.Mutex{}}
+
+	go func() {
+		<-ctx.Done()
+		shutdownState.closeForShutdown()
+	}()
+
+	go eventLoop(wsURLType, hostnameAndPort, projectList, httpGetStatusThread, config, shutdownState)
+
+	return nil
+}
+
+func eventLoop(wsURLType string, hostnameAndPort string, projectList *ProjectList, httpGetStatusThread *HttpGetStatusThread, config ServerConfig,
+	shutdownState *wsShutdownState) {
+
+	for {
+
+		reconnectNeeded := make(chan ReconnectMessage)
+
+		// Kick off websocket using channel
+		startWebSocketThread(wsURLType, hostnameAndPort, reconnectNeeded, projectList, httpGetStatusThread, config, shutdownState)
+
+		// We only read the first message from this channel, to avoid duplicates
+		v := <-reconnectNeeded
+
+		if v == Reconnect {
+			// Ignore and loop to top
+			utils.LogInfo("WebSocket thread received reconnect message.")
+
+			// We lost the WebSocket connection, and theoretically might have missed
+			// a watch refresh, so reacquire the latest watches.
+			httpGetStatusThread.SignalStatusRefreshNeeded()
+
+		} else if v == Terminate {
+			utils.LogInfo("WebSocket thread received terminate message.")
+			return
+		}
+	}
+
+}
+
+func startWebSocketThread(wsURLType string, hostnameAndPort string, triggerRetry chan ReconnectMessage, projectList *ProjectList,
+	httpGetStatusThread *HttpGetStatusThread, config ServerConfig, shutdownState *wsShutdownState) {
+
+	u := url.URL{Scheme: wsURLType, Host: hostnameAndPort, Path: "/websockets/file-changes/v1"}
+
+	backoff := config.WSReconnect.newBackoff(0.5)
+
+	var c *websocket.Conn
+
+	// The event loop reads triggerRetry after this function returns, so the terminate message is sent asynchronously
+	terminate := func() {
+		go func() {
+			triggerRetry <- Terminate
+		}()
+	}
+
+	// Keep trying to connect on the WebSocket thread, until success
+	for {
+
+		if shutdownState.isShuttingDown() {
+			terminate()
+			return
+		}
+
+		utils.LogInfo("Connecting to " + u.String())
+
+		dialer := &websocket.Dialer{}
+		dialer.TLSClientConfig = getServerTLSConfig()
+		dialer.Proxy = http.ProxyFromEnvironment
+
+		header := http.Header{}
+		token, err := addAuthorizationHeader(header)
+		if err != nil {
+			utils.LogErrorErr("Unable to authenticate WebSocket connection:", err)
+			backoff.SleepAfterFail()
+			backoff.FailIncrease()
+			continue
+		}
+
+		innerC, resp, err := dialer.Dial(u.String(), header)
+
+		c = innerC
+
+		if err != nil {
+			checkUnauthorizedResponse(resp, token)
+			utils.LogErrorErr("Error on connecting:", err)
+			if innerC != nil {
+				innerC.Close() // Unnecessary?
+			}
+		} else {
+			// Success, so stop trying to connect
+			break
+		}
+
+		// On failure, sleep
+		backoff.SleepAfterFail()
+		backoff.FailIncrease()
+	}
+
+	if !shutdownState.setConnection(c) {
+		c.Close()
+		terminate()
+		return
+	}
+
+	utils.LogInfo("Successfully connected to " + u.String())
+
+	// On success, issue a GET request in case we missed anything.
+	httpGetStatusThread.SignalStatusRefreshNeeded()
+
+	// Syncs that failed while we were disconnected (for example, because the server was restarting) can now be retried.
+	projectList.RetryFailedSyncs()
+
+	keepAlive := newWSKeepAliveSettings(config)
+
+	// Any pong (or other message) from the server extends the read deadline; if the deadline passes, ReadMessage()
+	// returns an error, and the connection is closed and reconnected below.
+	c.SetReadDeadline(keepAlive.readDeadline())
+	c.SetPongHandler(func(string) error {
+		return c.SetReadDeadline(keepAlive.readDeadline())
+	})
+
+	ticker := time.NewTicker(keepAlive.pingInterval)
+	tickerClosedChan := make(chan struct{})
+
+	startWriteEmptyMessageTickerHandler(ticker, c, tickerClosedChan, keepAlive)
+
+	// Both the close handler and the listening thread may detect that the connection is closed (the close handler is
+	// called from within ReadMessage(), which then returns an error), but the event loop only reads a single message
+	// from triggerRetry, so the connection must only be cleaned up, and the reconnect triggered, once.
+	var closeOnce sync.Once
+	closeConnection := func() {
+		closeOnce.Do(func() {
+			c.Close()
+			ticker.Stop()
+			close(tickerClosedChan)
+			if shutdownState.isShuttingDown() {
+				triggerRetry <- Terminate
+			} else {
+				triggerRetry <- Reconnect
+			}
+		})
+	}
+
+	c.SetCloseHandler(func(code int, text string) error {
+		utils.LogInfo("Close handler called with values: " + strconv.Itoa(code) + " " + text)
+		closeConnection()
+		return nil
+	})
+
+	// Start a new listening thread, which informs us on failure
+	go func() {
+		for {
+			_, message, err := c.ReadMessage()
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					utils.LogError("No WebSocket pong received within " + keepAlive.pongTimeout.String() + " of the expected time, so the connection is assumed to be stale")
+				}
+				utils.LogErrorErr("Read error:", err)
+				closeConnection()
+				return
+			}
+
+			c.SetReadDeadline(keepAlive.readDeadline())
+
+			var emptyInterface interface{}
+			err = json.Unmarshal(message, &emptyInterface)
+			m, ok := emptyInterface.(map[string]interface{})
+			if err != nil || !ok {
+				utils.LogError("Ignoring unrecognized WebSocket message: " + string(message))
+				continue
+			}
+			if m["type"] == "debug" {
+				// This string is sent only by automated tests
+				if str, ok := m["msg"].(string); ok {
+					utils.LogInfo("------------------------------------------------------------")
+					utils.LogInfo("[Server-Debug] " + str)
+					utils.LogInfo("------------------------------------------------------------")
+				}
+				continue
+			}
+
+			watchChangeJSON, err := models.ParseWatchChangeJSON(message)
+			if err != nil {
+				utils.LogSevereErr("Rejected watch change message from WebSocket: "+string(message), err)
+				continue
+			}
+
+			projectUpdatesReceived := ""
+
+			projectList.UpdateProjectListFromWebSocket(watchChangeJSON)
+
+			utils.LogInfo("Received watch change message from WebSocket: " + string(message))
+
+			for x := 0; x < len(watchChangeJSON.Projects); x++ {
+
+				entry := watchChangeJSON.Projects[x]
+				projectUpdatesReceived += "[" + entry.ProjectID + " in " + entry.PathToMonitor + "], "
+			}
+
+			// Trim whitespace and trailing comma
+			projectUpdatesReceived = strings.TrimSpace(projectUpdatesReceived)
+			if strings.HasSuffix(projectUpdatesReceived, ",") {
+				projectUpdatesReceived = projectUpdatesReceived[:len(projectUpdatesReceived)-1]
+			}
+
+			utils.LogInfo("Watch list change message received for { " + projectUpdatesReceived + " }")
+
+		}
+	}()
+
+}
+
+func startWriteEmptyMessageTickerHandler(ticker *time.Ticker, c *websocket.Conn, tickerClosedChan chan struct{}, keepAlive wsKeepAliveSettings) {
+
+	// Start a new goroutine to send an empty json string, and a ping, every ping interval
+	go func() {
+		t := "{}"
+
+		for {
+			select {
+			case <-ticker.C:
+				// On ticker (every ping interval), send an empty string to the socket
+				err := c.WriteMessage(websocket.TextMessage, []byte(t))
+				if err != nil {
+					utils.LogErrorErr("Unable to write empty WebSocket message", err)
+					return
+				}
+
+				// The pong is received by the listening thread, which closes the connection if it does not arrive
+				err = c.WriteControl(websocket.PingMessage, nil, time.Now().Add(keepAlive.pongTimeout))
+				if err != nil {
+					utils.LogErrorErr("Unable to write WebSocket ping", err)
+					return
+				}
+			case <-tickerClosedChan:
+				// If the ticker is closed, terminate the thread
+				return
+			}
+
+		}
+	}()
+
+}
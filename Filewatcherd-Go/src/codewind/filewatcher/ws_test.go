@@ -0,0 +1,146 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package filewatcher
+
+import (
+	"codewind/models"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServerTimeout is the time allowed for the filewatcher to make an expected request of the fake server.
+const fakeServerTimeout = 10 * time.Second
+
+// newFakeServerConfig returns the default configuration, with the short retry delays of a test.
+func newFakeServerConfig() *Config {
+	config := DefaultConfig()
+	config.Server.GetRetry = BackoffConfig{MinDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	config.Server.WSReconnect = BackoffConfig{MinDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	config.Watch.BatchWindow = 10 * time.Millisecond
+	return config
+}
+
+// startTestWSConnectionManager connects the WebSocket of a new project list (with a watch service, but without cwctl)
+// to the fake server. Rather than sending GET requests, which would race with the watch changes that are pushed over
+// the WebSocket, each refresh of the project list that is requested is sent to the returned channel. The returned
+// function disconnects, and disposes of the project list.
+func startTestWSConnectionManager(t *testing.T, fake *fakeCodewindServer, config *Config) (*ProjectList, chan interface{}, func()) {
+	t.Helper()
+
+	resetServerConnectionState()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	projectList := NewProjectList(nil, "", config)
+	watchService := NewWatchService(projectList, fake.url(), "test-client", config.Watch)
+	projectList.SetWatchService(watchService)
+
+	refreshes := make(chan interface{})
+	httpGetStatusThread := &HttpGetStatusThread{refreshStatusChan: refreshes, baseURL: fake.url(), config: config.Server, ctx: ctx}
+
+	if err := StartWSConnectionManager(ctx, fake.url(), projectList, httpGetStatusThread, config.Server); err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+
+	return projectList, refreshes, func() {
+		cancel()
+		watchService.Dispose()
+		projectList.Shutdown()
+		resetServerConnectionState()
+	}
+}
+
+// expectRefreshes waits for the given number of requests to refresh the project list.
+func expectRefreshes(t *testing.T, refreshes chan interface{}, count int, description string) {
+	t.Helper()
+
+	timeout := time.After(fakeServerTimeout)
+	for received := 0; received < count; received++ {
+		select {
+		case <-refreshes:
+		case <-timeout:
+			t.Fatalf("Only %d of %d refreshes of the project list were requested %s", received, count, description)
+		}
+	}
+}
+
+func TestWebSocketReconnectsAfterConnectionIsDropped(t *testing.T) {
+	fake := newFakeCodewindServer()
+	defer fake.close()
+
+	_, refreshes, disconnect := startTestWSConnectionManager(t, fake, newFakeServerConfig())
+	defer disconnect()
+
+	if !fake.waitForConnections(1, fakeServerTimeout) {
+		t.Fatal("The WebSocket did not connect")
+	}
+	expectRefreshes(t, refreshes, 1, "once connected")
+
+	fake.dropConnections()
+
+	if !fake.waitForConnections(2, fakeServerTimeout) {
+		t.Fatal("The WebSocket did not reconnect once the connection was dropped")
+	}
+
+	// A watch change may have been missed while disconnected, so the project list is refreshed both when the connection
+	// is lost, and once reconnected
+	expectRefreshes(t, refreshes, 2, "once reconnected")
+}
+
+func TestWebSocketWatchChangeUpdatesProjectList(t *testing.T) {
+	fake := newFakeCodewindServer()
+	defer fake.close()
+
+	root, err := ioutil.TempDir("", "filewatcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	projectList, refreshes, disconnect := startTestWSConnectionManager(t, fake, newFakeServerConfig())
+	defer disconnect()
+
+	if !fake.waitForConnections(1, fakeServerTimeout) {
+		t.Fatal("The WebSocket did not connect")
+	}
+	expectRefreshes(t, refreshes, 1, "once connected")
+
+	projectInList := func() bool {
+		return strings.Contains(<-projectList.RequestDebugMessage(), "- pushed-project ->")
+	}
+
+	if projectInList() {
+		t.Fatal("The project should not be watched before the server pushes it")
+	}
+
+	project := newTestProjectToWatch(t, "pushed-project", root)
+	if written := fake.pushProjectChanges([]models.ProjectToWatch{project}); written != 1 {
+		t.Fatalf("The watch change was written to %d connections, rather than 1", written)
+	}
+
+	waitFor(t, "the pushed project to be added to the project list", projectInList)
+
+	// Once watched, the watch status of the project is reported to the server
+	if !fake.waitForRequests(fakeServerProjectsPath+"pushed-project/", 1, fakeServerTimeout) {
+		t.Error("The watch status of the pushed project was not reported to the server")
+	}
+
+	project.ChangeType = "delete"
+	fake.pushProjectChanges([]models.ProjectToWatch{project})
+
+	waitFor(t, "the deleted project to be removed from the project list", func() bool { return !projectInList() })
+}
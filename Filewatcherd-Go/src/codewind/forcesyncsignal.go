@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package main
+
+import (
+	"codewind/filewatcher"
+	"codewind/utils"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// startForceSyncSignalHandler forces a sync of all watched projects (see Watcher.ForceSync) each time the process
+// receives SIGUSR1, for example: 'kill -USR1 (pid)'.
+func startForceSyncSignalHandler(watcher *filewatcher.Watcher) {
+
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, syscall.SIGUSR1)
+
+	go func() {
+		for range signalChannel {
+			utils.LogInfo("Received SIGUSR1, forcing a sync of all projects")
+			watcher.ForceSync()
+		}
+	}()
+}
@@ -0,0 +1,18 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package main
+
+import "codewind/filewatcher"
+
+// startForceSyncSignalHandler does nothing on Windows, which has no SIGUSR1; use POST /sync of the status server instead.
+func startForceSyncSignalHandler(watcher *filewatcher.Watcher) {
+}
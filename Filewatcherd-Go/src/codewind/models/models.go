@@ -15,6 +15,8 @@ package models
 type ProjectToWatch struct {
 	IgnoredFilenames    []string       `json:"ignoredFilenames"`
 	IgnoredPaths        []string       `json:"ignoredPaths"`
+	IgnoredPatterns     []string       `json:"ignoredPatterns"`            // gitignore-style patterns; see utils.IgnoreMatcher
+	IncludedPatterns    []string       `json:"includedPatterns,omitempty"` // Optional gitignore-style patterns; if set, only the changes of matching files are watched (see utils.PathFilter)
 	PathToMonitor       string         `json:"pathToMonitor"`
 	ProjectID           string         `json:"projectID"`
 	ChangeType          string         `json:"changeType"`
@@ -22,6 +24,10 @@ type ProjectToWatch struct {
 	Type                string         `json:"type"`
 	ProjectCreationTime int64          `json:"projectCreationTime"`
 	RefPaths            []RefPathEntry `json:"refPaths"`
+	InstallerPath       string         `json:"installerPath,omitempty"`     // Optional; overrides the cwctl installer path for this project
+	MinSyncIntervalMs   int            `json:"minSyncIntervalMs,omitempty"` // Optional; overrides the minimum interval between syncs of this project
+	BatchWindowMs       int            `json:"batchWindowMs,omitempty"`     // Optional; overrides the file change event batch window of this project
+	MaxFileSizeBytes    int64          `json:"maxFileSizeBytes,omitempty"`  // Optional; overrides the maximum size of a changed file that triggers a sync (-1 for no limit)
 }
 
 // RefPathEntry ...
@@ -58,6 +64,22 @@ func (entry *ProjectToWatch) Clone() *ProjectToWatch {
 		}
 	}
 
+	var newIgnoredPatterns []string
+	if entry.IgnoredPatterns != nil {
+		newIgnoredPatterns = make([]string, 0)
+		for _, val := range entry.IgnoredPatterns {
+			newIgnoredPatterns = append(newIgnoredPatterns, val)
+		}
+	}
+
+	var newIncludedPatterns []string
+	if entry.IncludedPatterns != nil {
+		newIncludedPatterns = make([]string, 0)
+		for _, val := range entry.IncludedPatterns {
+			newIncludedPatterns = append(newIncludedPatterns, val)
+		}
+	}
+
 	var newRefPaths []RefPathEntry
 	if entry.RefPaths != nil {
 		newRefPaths = []RefPathEntry{}
@@ -69,6 +91,8 @@ func (entry *ProjectToWatch) Clone() *ProjectToWatch {
 	return &ProjectToWatch{
 		newIgnoredFilenames,
 		newIgnoredPaths,
+		newIgnoredPatterns,
+		newIncludedPatterns,
 		entry.PathToMonitor,
 		entry.ProjectID,
 		entry.ChangeType,
@@ -76,6 +100,10 @@ func (entry *ProjectToWatch) Clone() *ProjectToWatch {
 		entry.Type,
 		entry.ProjectCreationTime,
 		newRefPaths,
+		entry.InstallerPath,
+		entry.MinSyncIntervalMs,
+		entry.BatchWindowMs,
+		entry.MaxFileSizeBytes,
 	}
 }
 
@@ -92,6 +120,22 @@ type WatchEventEntry struct {
 	EventType string
 	Path      string
 	IsDir     bool
+
+	// The identity of the file (or, for a DELETE, its last known identity); nil if unknown
+	Identity *FileIdentity
+
+	// DELETE of a directory only: the last known identity of each file and directory within it, by path relative to
+	// the directory (eg 'some-dir/some-file.txt')
+	ChildIdentities map[string]FileIdentity
+}
+
+// FileIdentity identifies a file independently of its path, so that a file that was moved may be recognized at its
+// new path. This is only available on platforms where the file system provides it (eg the device and inode on Linux
+// and macOS).
+type FileIdentity struct {
+	Device uint64
+	Inode  uint64
+	Size   int64 // 0 for directories
 }
 
 // WatchChangeJson ...
@@ -0,0 +1,130 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package models
+
+import (
+	"sort"
+)
+
+// ProjectListDiff is the difference between two project lists, as returned by DiffProjectLists. Each list is
+// sorted by project ID.
+type ProjectListDiff struct {
+	Added     []ProjectToWatch // In the new list, but not the old
+	Removed   []ProjectToWatch // In the old list, but not the new (the old value)
+	Changed   []ProjectToWatch // In both lists, but with a different value (the new value)
+	Unchanged []ProjectToWatch // In both lists, with the same value
+}
+
+// IsEmpty returns true if no projects were added, removed, or changed.
+func (diff *ProjectListDiff) IsEmpty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+// DiffProjectLists compares the old and new project lists by project ID. If a list contains multiple projects
+// with the same ID, the last one is used.
+func DiffProjectLists(oldProjects []ProjectToWatch, newProjects []ProjectToWatch) ProjectListDiff {
+
+	oldByID := make(map[string]ProjectToWatch)
+	for _, project := range oldProjects {
+		oldByID[project.ProjectID] = project
+	}
+
+	newByID := make(map[string]ProjectToWatch)
+	for _, project := range newProjects {
+		newByID[project.ProjectID] = project
+	}
+
+	result := ProjectListDiff{
+		Added:     []ProjectToWatch{},
+		Removed:   []ProjectToWatch{},
+		Changed:   []ProjectToWatch{},
+		Unchanged: []ProjectToWatch{},
+	}
+
+	for projectID, newProject := range newByID {
+		oldProject, exists := oldByID[projectID]
+		if !exists {
+			result.Added = append(result.Added, newProject)
+		} else if ProjectsEqual(&oldProject, &newProject) {
+			result.Unchanged = append(result.Unchanged, newProject)
+		} else {
+			result.Changed = append(result.Changed, newProject)
+		}
+	}
+
+	for projectID, oldProject := range oldByID {
+		if _, exists := newByID[projectID]; !exists {
+			result.Removed = append(result.Removed, oldProject)
+		}
+	}
+
+	for _, list := range [][]ProjectToWatch{result.Added, result.Removed, result.Changed, result.Unchanged} {
+		sortProjectsByID(list)
+	}
+
+	return result
+}
+
+// ProjectsEqual returns true if the two projects have the same watch-related values: ChangeType and Type, which
+// describe the message the project was received in, are not compared.
+func ProjectsEqual(one *ProjectToWatch, two *ProjectToWatch) bool {
+	return one.ProjectID == two.ProjectID &&
+		one.PathToMonitor == two.PathToMonitor &&
+		one.ProjectWatchStateID == two.ProjectWatchStateID &&
+		one.ProjectCreationTime == two.ProjectCreationTime &&
+		one.InstallerPath == two.InstallerPath &&
+		one.MinSyncIntervalMs == two.MinSyncIntervalMs &&
+		one.BatchWindowMs == two.BatchWindowMs &&
+		one.MaxFileSizeBytes == two.MaxFileSizeBytes &&
+		IgnoreRulesEqual(one, two) &&
+		refPathsEqual(one.RefPaths, two.RefPaths)
+}
+
+// IgnoreRulesEqual returns true if the two projects have the same ignored filenames, paths, and patterns, and the same
+// included patterns (in the same order).
+func IgnoreRulesEqual(one *ProjectToWatch, two *ProjectToWatch) bool {
+	return stringsEqual(one.IgnoredFilenames, two.IgnoredFilenames) &&
+		stringsEqual(one.IgnoredPaths, two.IgnoredPaths) &&
+		stringsEqual(one.IgnoredPatterns, two.IgnoredPatterns) &&
+		stringsEqual(one.IncludedPatterns, two.IncludedPatterns)
+}
+
+/** A nil slice is equal to an empty slice. */
+func stringsEqual(one []string, two []string) bool {
+	if len(one) != len(two) {
+		return false
+	}
+	for index := range one {
+		if one[index] != two[index] {
+			return false
+		}
+	}
+	return true
+}
+
+func refPathsEqual(one []RefPathEntry, two []RefPathEntry) bool {
+	if len(one) != len(two) {
+		return false
+	}
+	for index := range one {
+		if one[index] != two[index] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortProjectsByID(projects []ProjectToWatch) {
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].ProjectID < projects[j].ProjectID
+	})
+}
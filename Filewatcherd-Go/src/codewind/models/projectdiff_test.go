@@ -0,0 +1,170 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestProject(projectID string, watchStateID string) ProjectToWatch {
+	return ProjectToWatch{
+		ProjectID:           projectID,
+		PathToMonitor:       "/projects/" + projectID,
+		ProjectWatchStateID: watchStateID,
+		ProjectCreationTime: 1000,
+		IgnoredFilenames:    []string{".DS_Store"},
+		IgnoredPaths:        []string{"/load-test/*"},
+		RefPaths:            []RefPathEntry{{From: "/a/file.txt", To: "/file.txt"}},
+	}
+}
+
+// projectIDs returns the IDs of the projects, in order, separated by commas.
+func projectIDs(projects []ProjectToWatch) string {
+	result := []string{}
+	for _, project := range projects {
+		result = append(result, project.ProjectID)
+	}
+	return strings.Join(result, ",")
+}
+
+func TestDiffProjectLists(t *testing.T) {
+
+	changedIgnoredPaths := newTestProject("c", "1")
+	changedIgnoredPaths.IgnoredPaths = []string{"/load-test/*", "/target"}
+
+	changedRefPaths := newTestProject("d", "1")
+	changedRefPaths.RefPaths = []RefPathEntry{{From: "/a/file.txt", To: "/other.txt"}}
+
+	// The type of message the project was received in is not a change
+	changedMessageType := newTestProject("e", "1")
+	changedMessageType.ChangeType = "update"
+	changedMessageType.Type = "project-watch"
+
+	oldProjects := []ProjectToWatch{
+		newTestProject("e", "1"),
+		newTestProject("a", "1"),
+		newTestProject("b", "1"),
+		newTestProject("c", "1"),
+		newTestProject("d", "1"),
+		newTestProject("removed-2", "1"),
+		newTestProject("removed-1", "1"),
+	}
+
+	newProjects := []ProjectToWatch{
+		newTestProject("added-2", "1"),
+		newTestProject("b", "2"),
+		changedIgnoredPaths,
+		changedMessageType,
+		newTestProject("a", "1"),
+		changedRefPaths,
+		newTestProject("added-1", "1"),
+	}
+
+	diff := DiffProjectLists(oldProjects, newProjects)
+
+	tests := []struct {
+		description string
+		actual      []ProjectToWatch
+		expected    string
+	}{
+		{"added", diff.Added, "added-1,added-2"},
+		{"removed", diff.Removed, "removed-1,removed-2"},
+		{"changed", diff.Changed, "b,c,d"},
+		{"unchanged", diff.Unchanged, "a,e"},
+	}
+
+	for _, test := range tests {
+		if actual := projectIDs(test.actual); actual != test.expected {
+			t.Errorf("Expected the %s projects to be %q, but they were %q", test.description, test.expected, actual)
+		}
+	}
+
+	// A changed project has its new value
+	if diff.Changed[0].ProjectWatchStateID != "2" {
+		t.Errorf("Expected the new value of a changed project, but got the watch state ID %q", diff.Changed[0].ProjectWatchStateID)
+	}
+
+	if diff.IsEmpty() {
+		t.Error("Expected the diff not to be empty")
+	}
+}
+
+func TestDiffProjectListsUnchanged(t *testing.T) {
+
+	// A nil slice is equal to an empty slice
+	withNilSlices := newTestProject("a", "1")
+	withNilSlices.IgnoredPatterns = nil
+	withEmptySlices := newTestProject("a", "1")
+	withEmptySlices.IgnoredPatterns = []string{}
+
+	diff := DiffProjectLists([]ProjectToWatch{withNilSlices}, []ProjectToWatch{withEmptySlices})
+	if !diff.IsEmpty() || projectIDs(diff.Unchanged) != "a" {
+		t.Errorf("Expected no change, but got %+v", diff)
+	}
+
+	diff = DiffProjectLists(nil, nil)
+	if !diff.IsEmpty() || len(diff.Unchanged) != 0 {
+		t.Errorf("Expected no change between empty lists, but got %+v", diff)
+	}
+}
+
+func TestDiffProjectListsDuplicateIDs(t *testing.T) {
+
+	// The last project with the same ID is used
+	newProjects := []ProjectToWatch{newTestProject("a", "2"), newTestProject("a", "1")}
+
+	diff := DiffProjectLists([]ProjectToWatch{newTestProject("a", "1")}, newProjects)
+	if !diff.IsEmpty() {
+		t.Errorf("Expected no change, but got %+v", diff)
+	}
+
+	diff = DiffProjectLists(nil, newProjects)
+	if len(diff.Added) != 1 || diff.Added[0].ProjectWatchStateID != "1" {
+		t.Errorf("Expected the last project with the ID to be added, but got %+v", diff.Added)
+	}
+}
+
+func TestProjectsEqual(t *testing.T) {
+
+	tests := []struct {
+		description string
+		change      func(project *ProjectToWatch)
+		expected    bool
+	}{
+		{"the same project", func(project *ProjectToWatch) {}, true},
+		{"a different change type", func(project *ProjectToWatch) { project.ChangeType = "delete" }, true},
+		{"a different path", func(project *ProjectToWatch) { project.PathToMonitor = "/other" }, false},
+		{"a different creation time", func(project *ProjectToWatch) { project.ProjectCreationTime = 2000 }, false},
+		{"a different installer path", func(project *ProjectToWatch) { project.InstallerPath = "/cwctl" }, false},
+		{"a different sync interval", func(project *ProjectToWatch) { project.MinSyncIntervalMs = 100 }, false},
+		{"a different batch window", func(project *ProjectToWatch) { project.BatchWindowMs = 100 }, false},
+		{"a different maximum file size", func(project *ProjectToWatch) { project.MaxFileSizeBytes = -1 }, false},
+		{"a different ignored filename", func(project *ProjectToWatch) { project.IgnoredFilenames = []string{"other"} }, false},
+		{"no ignored paths", func(project *ProjectToWatch) { project.IgnoredPaths = nil }, false},
+		{"an ignored pattern", func(project *ProjectToWatch) { project.IgnoredPatterns = []string{"*.log"} }, false},
+		{"an included pattern", func(project *ProjectToWatch) { project.IncludedPatterns = []string{"src/"} }, false},
+		{"an extra ref path", func(project *ProjectToWatch) {
+			project.RefPaths = append(project.RefPaths, RefPathEntry{From: "/b", To: "/b"})
+		}, false},
+	}
+
+	for _, test := range tests {
+		one := newTestProject("a", "1")
+		two := newTestProject("a", "1")
+		test.change(&two)
+
+		if actual := ProjectsEqual(&one, &two); actual != test.expected {
+			t.Errorf("Expected projects with %s to be equal: %v, but got %v", test.description, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ParseWatchChangeJSON parses and validates a project watch change message received from the WebSocket. An error
+// describing the problem is returned if the message is malformed, or if any of its projects are invalid (see
+// Validate()); in this case, the entire message should be rejected.
+func ParseWatchChangeJSON(data []byte) (*WatchChangeJson, error) {
+
+	var result WatchChangeJson
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, describeUnmarshalError("watch change message", err)
+	}
+
+	if err := validateProjects(result.Projects); err != nil {
+		return nil, errors.New("Invalid watch change message: " + err.Error())
+	}
+
+	return &result, nil
+}
+
+// ParseWatchlistEntryList parses and validates the project watch list returned by the server. An error describing
+// the problem is returned if the list is malformed, or if any of its projects are invalid (see Validate()).
+func ParseWatchlistEntryList(data []byte) (*WatchlistEntryList, error) {
+
+	var result WatchlistEntryList
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, describeUnmarshalError("project watch list", err)
+	}
+
+	// Otherwise, every watched project would be removed
+	if result.Projects == nil {
+		return nil, errors.New("Invalid project watch list: the 'projects' field is missing")
+	}
+
+	if err := validateProjects(result.Projects); err != nil {
+		return nil, errors.New("Invalid project watch list: " + err.Error())
+	}
+
+	return &result, nil
+}
+
+func validateProjects(projects WatchlistEntries) error {
+	for index, project := range projects {
+		if err := project.Validate(); err != nil {
+			return errors.New("project at index " + strconv.Itoa(index) + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the fields of the project that are required to watch it are missing or invalid. A
+// project that is being deleted only requires a project ID.
+func (entry *ProjectToWatch) Validate() error {
+
+	if strings.TrimSpace(entry.ProjectID) == "" {
+		return errors.New("the 'projectID' field is missing or empty")
+	}
+
+	if entry.ChangeType == "delete" {
+		return nil
+	}
+
+	if strings.TrimSpace(entry.PathToMonitor) == "" {
+		return errors.New("the 'pathToMonitor' field of project '" + entry.ProjectID + "' is missing or empty")
+	}
+
+	// Paths are always in absolute, normalized, Unix-style form, eg '/c/Users/Administrator' on Windows
+	if !strings.HasPrefix(entry.PathToMonitor, "/") {
+		return errors.New("the 'pathToMonitor' field of project '" + entry.ProjectID + "' is not an absolute path: " + entry.PathToMonitor)
+	}
+
+	for index, refPath := range entry.RefPaths {
+		if strings.TrimSpace(refPath.From) == "" {
+			return errors.New("the 'from' field of ref path " + strconv.Itoa(index) + " of project '" + entry.ProjectID + "' is missing or empty")
+		}
+	}
+
+	return nil
+}
+
+// describeUnmarshalError converts the error from json.Unmarshal into one that identifies the offending field or
+// position, for example a field with the wrong type (eg 'ignoredPaths' as a string rather than an array).
+func describeUnmarshalError(description string, err error) error {
+
+	switch unmarshalErr := err.(type) {
+	case *json.UnmarshalTypeError:
+		field := unmarshalErr.Field
+		if field == "" {
+			field = "(top level)"
+		}
+		return errors.New("Unable to parse " + description + ": field '" + field + "' has a value of type " + unmarshalErr.Value +
+			", but " + unmarshalErr.Type.String() + " was expected")
+
+	case *json.SyntaxError:
+		return errors.New("Unable to parse " + description + ": malformed JSON at offset " + strconv.FormatInt(unmarshalErr.Offset, 10) + ": " + unmarshalErr.Error())
+	}
+
+	// For example, truncated JSON
+	return errors.New("Unable to parse " + description + ": " + err.Error())
+}
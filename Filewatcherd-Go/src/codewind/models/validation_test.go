@@ -0,0 +1,118 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+const validWatchChangeJSON = `{"type": "project-watch", "projects": [{"projectID": "a", "pathToMonitor": "/c/Users/a",
+	"projectWatchStateId": "1", "ignoredPaths": ["/load-test/*"], "ignoredFilenames": [".DS_Store"],
+	"refPaths": [{"from": "/c/Users/b/file.txt", "to": "/file.txt"}], "changeType": "add"}]}`
+
+func TestParseWatchChangeJSON(t *testing.T) {
+
+	result, err := ParseWatchChangeJSON([]byte(validWatchChangeJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Projects) != 1 || result.Projects[0].ProjectID != "a" || result.Projects[0].PathToMonitor != "/c/Users/a" ||
+		strings.Join(result.Projects[0].IgnoredPaths, ",") != "/load-test/*" || result.Projects[0].RefPaths[0].To != "/file.txt" {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+}
+
+func TestParseWatchChangeJSONRejectsInvalidMessages(t *testing.T) {
+
+	tests := []struct {
+		description string
+		json        string
+		expected    string // A fragment of the error
+	}{
+		// Truncated
+		{"an empty message", ``, "Unable to parse"},
+		{"a truncated message", validWatchChangeJSON[:len(validWatchChangeJSON)/2], "Unable to parse"},
+		{"a message without its closing brace", validWatchChangeJSON[:len(validWatchChangeJSON)-1], "Unable to parse"},
+		{"malformed JSON", `{"type": "project-watch", "projects": [}`, "malformed JSON at offset"},
+
+		// Type mismatches
+		{"a message that is not an object", `[1, 2]`, "(top level)"},
+		{"projects that are not an array", `{"projects": {"projectID": "a"}}`, "'projects'"},
+		{"ignored paths that are a string", `{"projects": [{"projectID": "a", "pathToMonitor": "/a", "ignoredPaths": "/load-test"}]}`, "ignoredPaths"},
+		{"ignored filenames that are numbers", `{"projects": [{"projectID": "a", "pathToMonitor": "/a", "ignoredFilenames": [1]}]}`, "ignoredFilenames"},
+		{"a project ID that is a number", `{"projects": [{"projectID": 1, "pathToMonitor": "/a"}]}`, "projectID"},
+		{"a creation time that is a string", `{"projects": [{"projectID": "a", "pathToMonitor": "/a", "projectCreationTime": "1000"}]}`, "projectCreationTime"},
+		{"ref paths that are strings", `{"projects": [{"projectID": "a", "pathToMonitor": "/a", "refPaths": ["/b"]}]}`, "refPaths"},
+
+		// Missing or invalid required fields
+		{"a missing project ID", `{"projects": [{"pathToMonitor": "/a"}]}`, "'projectID' field is missing"},
+		{"an empty project ID", `{"projects": [{"projectID": " ", "pathToMonitor": "/a"}]}`, "'projectID' field is missing"},
+		{"a missing path", `{"projects": [{"projectID": "a"}]}`, "'pathToMonitor' field of project 'a' is missing"},
+		{"a relative path", `{"projects": [{"projectID": "a", "pathToMonitor": "c:\\a"}]}`, "not an absolute path"},
+		{"a ref path without a 'from'", `{"projects": [{"projectID": "a", "pathToMonitor": "/a", "refPaths": [{"to": "/b"}]}]}`, "'from' field of ref path 0"},
+		{"an invalid second project", `{"projects": [{"projectID": "a", "pathToMonitor": "/a"}, {"projectID": "b"}]}`, "project at index 1"},
+	}
+
+	for _, test := range tests {
+		result, err := ParseWatchChangeJSON([]byte(test.json))
+		if err == nil {
+			t.Errorf("Expected %s to be rejected, but got %+v", test.description, result)
+		} else if !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Expected the error for %s to contain %q, but got: %v", test.description, test.expected, err)
+		}
+	}
+}
+
+func TestParseWatchChangeJSONDeletedProject(t *testing.T) {
+
+	// A project that is being deleted only requires its ID
+	result, err := ParseWatchChangeJSON([]byte(`{"projects": [{"projectID": "a", "changeType": "delete"}]}`))
+	if err != nil || len(result.Projects) != 1 {
+		t.Fatalf("Expected the deletion to be accepted, but got %+v (%v)", result, err)
+	}
+
+	if _, err := ParseWatchChangeJSON([]byte(`{"projects": [{"changeType": "delete"}]}`)); err == nil {
+		t.Fatal("Expected a deletion without a project ID to be rejected")
+	}
+}
+
+func TestParseWatchlistEntryList(t *testing.T) {
+
+	result, err := ParseWatchlistEntryList([]byte(`{"projects": []}`))
+	if err != nil || result.Projects == nil || len(result.Projects) != 0 {
+		t.Fatalf("Expected an empty watch list to be accepted, but got %+v (%v)", result, err)
+	}
+
+	tests := []struct {
+		description string
+		json        string
+		expected    string
+	}{
+		// Otherwise, every watched project would be removed
+		{"a missing project list", `{}`, "'projects' field is missing"},
+		{"a null project list", `{"projects": null}`, "'projects' field is missing"},
+		{"a truncated list", `{"projects": [{"projectID": "a", "pathTo`, "Unable to parse project watch list"},
+		{"a type-mismatched list", `{"projects": "a"}`, "'projects'"},
+		{"an invalid project", `{"projects": [{"projectID": "a"}]}`, "Invalid project watch list"},
+	}
+
+	for _, test := range tests {
+		result, err := ParseWatchlistEntryList([]byte(test.json))
+		if err == nil {
+			t.Errorf("Expected %s to be rejected, but got %+v", test.description, result)
+		} else if !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Expected the error for %s to contain %q, but got: %v", test.description, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package main
+
+import (
+	"codewind/filewatcher"
+	"codewind/utils"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+/**
+ * On SIGTERM or SIGINT (for example, when the filewatcher is stopped by the Codewind CLI), the filewatcher shuts down
+ * cleanly, so that a project is not left mid-sync (see Watcher.Shutdown), and the process exits with code 0.
+ *
+ * If this does not complete within X seconds (30 by default, or FILEWATCHER_SHUTDOWN_GRACE_PERIOD_SECS), or a second
+ * signal is received, any running cwctl processes are killed, and the process exits with code 1.
+ */
+
+// startShutdownSignalHandler shuts down the filewatcher on SIGTERM/SIGINT.
+func startShutdownSignalHandler(watcher *filewatcher.Watcher) {
+
+	signalChannel := make(chan os.Signal, 2)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signalChannel
+
+		gracePeriod := filewatcher.GetShutdownGracePeriod()
+
+		utils.LogInfo("Received " + sig.String() + ", shutting down (grace period: " + gracePeriod.String() + ")")
+
+		ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+
+		go func() {
+			select {
+			case sig := <-signalChannel:
+				utils.LogSevere("Received " + sig.String() + " during shutdown, so any running syncs will be killed")
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		err := watcher.Shutdown(ctx)
+		cancel()
+
+		utils.FlushLog(logFlushTimeout)
+
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+}
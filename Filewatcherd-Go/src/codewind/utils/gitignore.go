@@ -0,0 +1,86 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitIgnoreFilename is the name of the ignore files that are read by LoadGitIgnoreMatcher.
+const GitIgnoreFilename = ".gitignore"
+
+// LoadGitIgnoreMatcher reads the .gitignore file at the root of the project (given as a local OS path), and those
+// in any subdirectories, and returns a matcher containing their patterns. As with git, the patterns of a nested
+// .gitignore are relative to its directory and take precedence over those of its parents, and the .gitignore files of
+// ignored directories (and of .git directories) are not read.
+func LoadGitIgnoreMatcher(projectRoot string) (*IgnoreMatcher, error) {
+
+	result, err := NewIgnoreMatcher([]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	// filepath.Walk visits directories in lexical order, and a directory is always visited before its contents,
+	// so the patterns of a parent .gitignore are always added before those of its children.
+	err = filepath.Walk(projectRoot, func(path string, info os.FileInfo, err error) error {
+
+		if err != nil {
+			// Skip files/directories we can't read (for example, those deleted during the walk)
+			LogDebug("Unable to read path while searching for .gitignore files: " + path + " - " + err.Error())
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(projectRoot, path)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		if relativePath == "." {
+			relativePath = ""
+		}
+
+		if relativePath != "" && (info.Name() == ".git" || result.IsIgnored("/"+relativePath, true)) {
+			return filepath.SkipDir
+		}
+
+		contents, err := ioutil.ReadFile(filepath.Join(path, GitIgnoreFilename))
+		if err != nil {
+			// No .gitignore in this directory (or it is unreadable)
+			return nil
+		}
+
+		patterns := strings.Split(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n")
+
+		if err := result.AddPatterns(relativePath, patterns); err != nil {
+			// A single invalid pattern should not prevent the rest of the project from being filtered
+			LogErrorErr("Unable to parse "+filepath.Join(path, GitIgnoreFilename), err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
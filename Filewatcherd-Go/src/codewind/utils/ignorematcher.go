@@ -0,0 +1,312 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// IgnoreMatcher determines whether a project-relative path is ignored by a list of patterns, using the same
+// semantics as a .gitignore file:
+//
+//   - Blank lines, and lines beginning with '#', are ignored. Use '\#' for a pattern beginning with '#'.
+//   - A pattern beginning with '!' negates the pattern: a matching path that was ignored by a previous pattern is
+//     included again. Use '\!' for a pattern beginning with '!'.
+//   - A pattern ending with '/' only matches directories.
+//   - A pattern containing a '/' at the beginning or middle is anchored to the project root; otherwise it may
+//     match at any level (eg '*.tmp' matches both '/a.tmp' and '/b/c.tmp').
+//   - '*' matches anything except '/', '?' matches any single character except '/', and '[a-z]' matches one character
+//     in the range ('[!a-z]' for a character not in the range).
+//   - A leading '**/' matches in all directories, a trailing '/**' matches everything inside, and '/**/' matches
+//     zero or more directories.
+//   - As with git, a path cannot be re-included by a negated pattern if one of its parent directories is ignored.
+//
+// The last pattern which matches a path determines whether the path is ignored. On case-insensitive filesystems (see
+// IsCaseInsensitiveFileSystem), patterns are matched case-insensitively.
+type IgnoreMatcher struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	pattern string // The original pattern, for debugging purposes
+	baseDir string // The base directory of the pattern (no leading or trailing slash), for debugging purposes
+	regex   *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// NewIgnoreMatcher compiles the given gitignore-style patterns; an error is returned if any pattern is invalid.
+func NewIgnoreMatcher(patterns []string) (*IgnoreMatcher, error) {
+
+	result := &IgnoreMatcher{
+		rules: make([]ignoreRule, 0),
+	}
+
+	if err := result.AddPatterns("", patterns); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// AddPatterns compiles the given gitignore-style patterns, relative to baseDir: the project-relative directory
+// that contains the ignore file the patterns were read from (eg '/a/b'), or "" for the project root. The new
+// patterns take precedence over all previously added patterns.
+func (m *IgnoreMatcher) AddPatterns(baseDir string, patterns []string) error {
+
+	baseDir = strings.Trim(baseDir, "/")
+	if strings.Contains(baseDir, "\\") {
+		return errors.New("Base directory may not contain Windows-style path separators: " + baseDir)
+	}
+
+	newRules := make([]ignoreRule, 0)
+	for _, pattern := range patterns {
+		rule, err := compileIgnoreRule(pattern, baseDir)
+		if err != nil {
+			return err
+		}
+		if rule != nil {
+			newRules = append(newRules, *rule)
+		}
+	}
+
+	m.rules = append(m.rules, newRules...)
+
+	return nil
+}
+
+// IsEmpty returns true if the matcher contains no patterns, and thus will never ignore a path.
+func (m *IgnoreMatcher) IsEmpty() bool {
+	return len(m.rules) == 0
+}
+
+// IsIgnored returns true if the project-relative path (eg '/a/b/c.txt', using forward slashes) is ignored. isDir
+// indicates whether the path itself is a directory; all parent paths are assumed to be directories.
+func (m *IgnoreMatcher) IsIgnored(path string, isDir bool) bool {
+	return m.IgnoringPattern(path, isDir) != ""
+}
+
+// IgnoringPattern returns the pattern that causes the path (or one of its parent directories) to be ignored, or "" if
+// the path is not ignored. The pattern is prefixed by its base directory, if any (eg '/a/b: *.tmp').
+func (m *IgnoreMatcher) IgnoringPattern(path string, isDir bool) string {
+
+	if len(m.rules) == 0 {
+		return ""
+	}
+
+	if strings.Contains(path, "\\") {
+		LogSevere("Parameter cannot contain Window-style file paths")
+		return ""
+	}
+
+	path = strings.Trim(path, "/")
+	if path == "" {
+		// The project root itself is never ignored
+		return ""
+	}
+
+	// If a parent directory is ignored, then so is everything within it (and this cannot be negated)
+	for index := strings.Index(path, "/"); index != -1; {
+		if rule := m.matches(path[0:index], true); rule != nil {
+			return rule.description()
+		}
+
+		nextIndex := strings.Index(path[index+1:], "/")
+		if nextIndex == -1 {
+			break
+		}
+		index += nextIndex + 1
+	}
+
+	if rule := m.matches(path, isDir); rule != nil {
+		return rule.description()
+	}
+	return ""
+}
+
+// matches returns the last rule that matches the path (which has no leading or trailing slash), if that rule ignores
+// the path; nil if no rules match, or the last matching rule is negated.
+func (m *IgnoreMatcher) matches(path string, isDir bool) *ignoreRule {
+	for index := len(m.rules) - 1; index >= 0; index-- {
+		rule := &m.rules[index]
+
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		if rule.regex.MatchString(path) {
+			if rule.negate {
+				return nil
+			}
+			return rule
+		}
+	}
+
+	return nil
+}
+
+func (rule *ignoreRule) description() string {
+	if rule.baseDir == "" {
+		return rule.pattern
+	}
+	return "/" + rule.baseDir + ": " + rule.pattern
+}
+
+// compileIgnoreRule converts a single gitignore-style pattern to a rule; nil is returned for blank lines and comments.
+// The pattern only matches paths within baseDir (which has no leading or trailing slash; "" for the project root).
+func compileIgnoreRule(pattern string, baseDir string) (*ignoreRule, error) {
+
+	result := ignoreRule{pattern: pattern, baseDir: baseDir}
+
+	// Trailing spaces are ignored, unless they are escaped with a backslash
+	text := strings.TrimRight(pattern, " \t\r\n")
+	if strings.HasSuffix(text, "\\") && len(text) < len(pattern) {
+		text += " "
+	}
+
+	if text == "" || strings.HasPrefix(text, "#") {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(text, "!") {
+		result.negate = true
+		text = text[1:]
+	}
+
+	if strings.HasSuffix(text, "/") {
+		result.dirOnly = true
+		text = strings.TrimRight(text, "/")
+	}
+
+	if text == "" {
+		return nil, errors.New("Invalid ignore pattern: " + pattern)
+	}
+
+	// A slash at the beginning or middle of the pattern anchors it to the project root
+	anchored := strings.Contains(text, "/")
+	text = strings.TrimPrefix(text, "/")
+
+	regexStr, err := convertIgnorePatternToRegex(text)
+	if err != nil {
+		return nil, errors.New("Invalid ignore pattern: " + pattern + " - " + err.Error())
+	}
+
+	prefix := ""
+	if baseDir != "" {
+		prefix = regexp.QuoteMeta(baseDir) + "/"
+	}
+
+	if anchored {
+		regexStr = caseInsensitiveRegexFlag() + "^" + prefix + regexStr + "$"
+	} else {
+		regexStr = caseInsensitiveRegexFlag() + "^" + prefix + "(?:.*/)?" + regexStr + "$"
+	}
+
+	re, err := regexp.Compile(regexStr)
+	if err != nil {
+		return nil, errors.New("Unable to compile ignore pattern: " + pattern + " - " + err.Error())
+	}
+	result.regex = re
+
+	return &result, nil
+}
+
+// convertIgnorePatternToRegex converts the glob syntax of a gitignore pattern (without a leading or trailing slash)
+// to the equivalent regular expression.
+func convertIgnorePatternToRegex(text string) (string, error) {
+
+	runes := []rune(text)
+
+	result := ""
+
+	for index := 0; index < len(runes); index++ {
+		c := runes[index]
+
+		switch c {
+		case '*':
+			if index+1 < len(runes) && runes[index+1] == '*' {
+				atStart := index == 0 || runes[index-1] == '/'
+				atEnd := index+2 == len(runes) || runes[index+2] == '/'
+
+				if atStart && atEnd {
+					if index+2 == len(runes) {
+						// Trailing '/**' (or a pattern of just '**'): everything inside
+						result += ".*"
+					} else {
+						// Leading '**/' or middle '/**/': zero or more directories
+						result += "(?:.*/)?"
+						index++ // Skip the slash following the asterisks
+					}
+					index++
+					continue
+				}
+
+				// Other consecutive asterisks are treated as a regular asterisk
+				for index+1 < len(runes) && runes[index+1] == '*' {
+					index++
+				}
+			}
+			result += "[^/]*"
+
+		case '?':
+			result += "[^/]"
+
+		case '[':
+			end := index + 1
+			if end < len(runes) && (runes[end] == '!' || runes[end] == '^') {
+				end++
+			}
+			if end < len(runes) && runes[end] == ']' {
+				// A ']' immediately after the opening bracket is part of the class
+				end++
+			}
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+
+			if end >= len(runes) {
+				// No closing bracket, so treat the bracket as a literal
+				result += regexp.QuoteMeta(string(c))
+				continue
+			}
+
+			class := runes[index+1 : end]
+			classStr := "["
+			if len(class) > 0 && (class[0] == '!' || class[0] == '^') {
+				classStr += "^/"
+				class = class[1:]
+			}
+			for _, classRune := range class {
+				if classRune == '\\' || classRune == '[' || classRune == ']' {
+					classStr += "\\"
+				}
+				classStr += string(classRune)
+			}
+			result += classStr + "]"
+			index = end
+
+		case '\\':
+			if index+1 >= len(runes) {
+				return "", errors.New("pattern ends with an unescaped backslash")
+			}
+			index++
+			result += regexp.QuoteMeta(string(runes[index]))
+
+		default:
+			result += regexp.QuoteMeta(string(c))
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,212 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+
+	tests := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		// An unanchored pattern matches at any level
+		{[]string{"*.tmp"}, "/a.tmp", false, true},
+		{[]string{"*.tmp"}, "/b/c.tmp", false, true},
+		{[]string{"*.tmp"}, "/a.tmpx", false, false},
+		{[]string{"*.tmp"}, "/b/c.tmp/d.txt", false, true}, // Within an ignored directory
+
+		// A pattern with a leading or middle slash is anchored to the project root
+		{[]string{"/build"}, "/build", true, true},
+		{[]string{"/build"}, "/a/build", true, false},
+		{[]string{"doc/frotz"}, "/doc/frotz", false, true},
+		{[]string{"doc/frotz"}, "/a/doc/frotz", false, false},
+
+		// A trailing slash only matches directories (and so everything within them)
+		{[]string{"build/"}, "/build", true, true},
+		{[]string{"build/"}, "/build", false, false},
+		{[]string{"build/"}, "/a/build", true, true},
+		{[]string{"build/"}, "/build/out.o", false, true},
+		{[]string{"/build/"}, "/a/build", true, false},
+
+		// Double asterisks
+		{[]string{"**/node_modules/**"}, "/node_modules/a.js", false, true},
+		{[]string{"**/node_modules/**"}, "/a/b/node_modules/c/d.js", false, true},
+		{[]string{"**/node_modules/**"}, "/node_modules", true, false},
+		{[]string{"**/foo"}, "/foo", false, true},
+		{[]string{"**/foo"}, "/x/y/foo", false, true},
+		{[]string{"a/**/b"}, "/a/b", false, true},
+		{[]string{"a/**/b"}, "/a/x/y/b", false, true},
+		{[]string{"a/**/b"}, "/c/a/b", false, false},
+		{[]string{"a**b"}, "/axxb", false, true},
+		{[]string{"a**b"}, "/ax/b", false, false},
+
+		// Single character wildcards, and character classes
+		{[]string{"?.txt"}, "/a.txt", false, true},
+		{[]string{"?.txt"}, "/ab.txt", false, false},
+		{[]string{"a?b"}, "/a/b", false, false},
+		{[]string{"[a-c].log"}, "/b.log", false, true},
+		{[]string{"[a-c].log"}, "/d.log", false, false},
+		{[]string{"[!a-c].log"}, "/d.log", false, true},
+		{[]string{"[!a-c].log"}, "/b.log", false, false},
+		{[]string{"[abc"}, "/[abc", false, true}, // No closing bracket, so a literal
+
+		// Regular expression metacharacters are literals
+		{[]string{"a+b.(c)"}, "/a+b.(c)", false, true},
+		{[]string{"a+b.(c)"}, "/aab.(c)", false, false},
+
+		// Comments, blank lines, escapes, and trailing spaces
+		{[]string{"#file", "", "   "}, "/#file", false, false},
+		{[]string{"\\#file"}, "/#file", false, true},
+		{[]string{"\\!important"}, "/!important", false, true},
+		{[]string{"foo.txt  "}, "/foo.txt", false, true},
+		{[]string{"foo\\ "}, "/foo ", false, true},
+
+		// Negation: the last matching pattern wins
+		{[]string{"*.log", "!keep.log"}, "/a.log", false, true},
+		{[]string{"*.log", "!keep.log"}, "/keep.log", false, false},
+		{[]string{"*.log", "!keep.log"}, "/x/keep.log", false, false},
+		{[]string{"!keep.log", "*.log"}, "/keep.log", false, true},
+		{[]string{"/build/*", "!/build/keep.txt"}, "/build/keep.txt", false, false},
+		{[]string{"/build/*", "!/build/keep.txt"}, "/build/other.txt", false, true},
+
+		// A path cannot be re-included if its parent directory is ignored
+		{[]string{"build/", "!build/keep.txt"}, "/build/keep.txt", false, true},
+		{[]string{"build", "!build/keep.txt"}, "/build/keep.txt", false, true},
+
+		// The project root is never ignored
+		{[]string{"*"}, "/", true, false},
+		{[]string{"*"}, "/a", false, true},
+	}
+
+	for _, test := range tests {
+		matcher, err := NewIgnoreMatcher(test.patterns)
+		if err != nil {
+			t.Errorf("Unable to compile %q: %v", test.patterns, err)
+			continue
+		}
+
+		if actual := matcher.IsIgnored(test.path, test.isDir); actual != test.expected {
+			t.Errorf("%q: IsIgnored(%q, %v) = %v, expected %v", test.patterns, test.path, test.isDir, actual, test.expected)
+		}
+	}
+}
+
+func TestIgnoreMatcherInvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{"!", "/", "foo\\"} {
+		if _, err := NewIgnoreMatcher([]string{pattern}); err == nil {
+			t.Errorf("Expected an error for the pattern %q", pattern)
+		}
+	}
+}
+
+func TestIgnoreMatcherCase(t *testing.T) {
+	matcher, err := NewIgnoreMatcher([]string{"*.TMP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual, expected := matcher.IsIgnored("/a.tmp", false), IsCaseInsensitiveFileSystem(); actual != expected {
+		t.Errorf("Expected a pattern to match a path of a different case only on a case-insensitive file system")
+	}
+}
+
+func TestIgnoreMatcherBaseDirectory(t *testing.T) {
+	matcher, err := NewIgnoreMatcher([]string{"*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The patterns of a nested ignore file are relative to its directory, and take precedence
+	if err := matcher.AddPatterns("/a/b", []string{"*.tmp", "/x", "!keep.log"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/a/b/c.tmp", "/a/b: *.tmp"},
+		{"/a/b/d/c.tmp", "/a/b: *.tmp"},
+		{"/c.tmp", ""},
+		{"/a/b/x", "/a/b: /x"},
+		{"/a/b/d/x", ""},
+		{"/x", ""},
+		{"/a/b/keep.log", ""},
+		{"/keep.log", "*.log"},
+	}
+
+	for _, test := range tests {
+		if actual := matcher.IgnoringPattern(test.path, false); actual != test.expected {
+			t.Errorf("IgnoringPattern(%q) = %q, expected %q", test.path, actual, test.expected)
+		}
+	}
+
+	if err := matcher.AddPatterns("a\\b", []string{"*.tmp"}); err == nil {
+		t.Error("Expected an error for a base directory with Windows-style separators")
+	}
+}
+
+func TestLoadGitIgnoreMatcher(t *testing.T) {
+	projectRoot, err := ioutil.TempDir("", "filewatcher-gitignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(projectRoot)
+
+	files := map[string]string{
+		".gitignore":     "*.log\n/out/\r\n# A comment\n",
+		"sub/.gitignore": "!keep.log\n",
+		"out/.gitignore": "!*.log\n", // Not read, as its directory is ignored
+	}
+	for path, contents := range files {
+		localPath := filepath.Join(projectRoot, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(localPath, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matcher, err := LoadGitIgnoreMatcher(projectRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"/a.log", false, true},
+		{"/sub/keep.log", false, false},
+		{"/sub/other.log", false, true},
+		{"/out", true, true},
+		{"/out/a.log", false, true},
+		{"/sub/out", true, false},
+		{"/a.txt", false, false},
+	}
+
+	for _, test := range tests {
+		if actual := matcher.IsIgnored(test.path, test.isDir); actual != test.expected {
+			t.Errorf("IsIgnored(%q, %v) = %v, expected %v", test.path, test.isDir, actual, test.expected)
+		}
+	}
+}
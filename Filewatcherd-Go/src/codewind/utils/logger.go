@@ -12,44 +12,85 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 /**
- * Simple singleton logger with 4 log levels.
+ * Simple singleton logger with 5 log levels.
  *
  * Log levels:
  * - DEBUG: Fine-grained, noisy, excessively detailed, and mostly irrelevant messages.
  * - INFO: Coarse-grained messages related to the high-level inner workings of the code.
+ * - WARNING: Unusual conditions that are worth noting, but which do not (yet) indicate a failure.
  * - ERROR: Errors which are bad, but not entirely unexpected, such as errors I/O errors when running on a flaky network connection.
  * - SEVERE: Unexpected errors that strongly suggest a client/server implementation bug or a serious client/server runtime issue.
  *
+ * The log level defaults to INFO, and may be changed by setting the `filewatcher_log_level` environment variable
+ * to one of: debug, info, warning, error, severe. The log level of an individual project may also be overridden at
+ * runtime (see projectloglevel.go).
+ *
+ * By default, log statements are output as human-readable text. If the `FILEWATCHER_LOG_FORMAT` environment
+ * variable is set to `json`, each log statement is instead output as a single-line JSON object, containing
+ * the timestamp, level, message, error (if any), and fields (if any; see LogInfoFields).
+ *
+ * If the `FILEWATCHER_REDACT_PATHS` environment variable is set to `true`, the user's home directory and
+ * any registered project roots are redacted from log statements before they are output (see RedactPaths).
  */
 
 type MonitorLogger struct {
-	output   chan outputLine
-	logLevel LogLevel
+	output      chan outputLine
+	logLevel    LogLevel
+	jsonFormat  bool
+	redactPaths bool
 }
 
 type outputLine struct {
-	line      string
+	line      string // The full line, as output in text format
 	err       bool
 	timestamp int64
+
+	// The individual components of the line, as output in JSON format
+	level   LogLevel
+	msg     string
+	errText string
+	fields  map[string]string
+
+	flushed chan struct{} // If set, this is not a log statement: it is closed once every previous line is output
 }
 
 type LogLevel int
 
 const (
-	DEBUG  LogLevel = 1
-	INFO   LogLevel = 2
-	ERROR  LogLevel = 3
-	SEVERE LogLevel = 4
+	DEBUG   LogLevel = 1
+	INFO    LogLevel = 2
+	WARNING LogLevel = 3
+	ERROR   LogLevel = 4
+	SEVERE  LogLevel = 5
 )
 
+func (level LogLevel) String() string {
+	switch level {
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARNING:
+		return "WARNING"
+	case ERROR:
+		return "ERROR"
+	case SEVERE:
+		return "SEVERE"
+	}
+	return "UNKNOWN"
+}
+
 var (
 	logger *MonitorLogger
 	once   sync.Once
@@ -59,20 +100,36 @@ func loggerInternal() *MonitorLogger {
 	// Create a single instance of Logger, on first use
 	once.Do(func() {
 		messages := make(chan outputLine, 100)
-		logger = &MonitorLogger{messages, INFO}
+		jsonFormat := strings.EqualFold(strings.TrimSpace(os.Getenv("FILEWATCHER_LOG_FORMAT")), "json")
+		redactPaths := strings.EqualFold(strings.TrimSpace(os.Getenv("FILEWATCHER_REDACT_PATHS")), "true")
+		logger = &MonitorLogger{messages, logLevelFromEnvironment(), jsonFormat, redactPaths}
 		go logger.logOutputter()
 	})
 
 	return logger
 }
 
+// logLevelFromEnvironment returns the log level specified by the 'filewatcher_log_level' environment variable, or INFO if not specified.
+func logLevelFromEnvironment() LogLevel {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("filewatcher_log_level")))
+
+	if value == "" {
+		return INFO
+	} else if level, valid := ParseLogLevel(value); valid {
+		return level
+	}
+
+	os.Stderr.WriteString("Unrecognized value for filewatcher_log_level, defaulting to INFO: " + value + "\n")
+	return INFO
+}
+
 func LogDebug(msg string) {
 	l := loggerInternal()
 
 	if l.logLevel > DEBUG {
 		return
 	}
-	l.out(msg)
+	l.out(DEBUG, msg, msg, nil, nil)
 }
 
 func LogInfo(msg string) {
@@ -80,7 +137,27 @@ func LogInfo(msg string) {
 	if l.logLevel > INFO {
 		return
 	}
-	l.out(msg)
+	l.out(INFO, msg, msg, nil, nil)
+
+}
+
+// LogInfoFields logs the message at INFO level, along with additional key/value pairs (for example, the project ID)
+// which may be used to correlate log statements. If the fields include the 'projectID', the log level of that project
+// applies (see SetProjectLogLevel).
+func LogInfoFields(msg string, fields map[string]string) {
+	l := loggerInternal()
+	if l.projectLogLevel(fields["projectID"]) > INFO {
+		return
+	}
+	l.out(INFO, msg, msg, nil, fields)
+}
+
+func LogWarning(msg string) {
+	l := loggerInternal()
+	if l.logLevel > WARNING {
+		return
+	}
+	l.out(WARNING, "! WARNING !: "+msg, msg, nil, nil)
 
 }
 
@@ -89,7 +166,7 @@ func LogError(msg string) {
 	if l.logLevel > ERROR {
 		return
 	}
-	l.err("! ERROR !:" + msg)
+	l.err(ERROR, "! ERROR !:"+msg, msg, nil, nil)
 
 }
 
@@ -105,12 +182,12 @@ func LogErrorErr(msg string, err error) {
 		outputMsg += " - Error:" + err.Error()
 	}
 
-	l.err(outputMsg)
+	l.err(ERROR, outputMsg, msg, err, nil)
 }
 
 func LogSevere(msg string) {
 	l := loggerInternal()
-	l.err("!!! SEVERE !!!: " + msg)
+	l.err(SEVERE, "!!! SEVERE !!!: "+msg, msg, nil, nil)
 }
 
 func LogSevereErr(msg string, err error) {
@@ -122,7 +199,25 @@ func LogSevereErr(msg string, err error) {
 	}
 
 	l := loggerInternal()
-	l.err(outputMsg)
+	l.err(SEVERE, outputMsg, msg, err, nil)
+}
+
+// FlushLog waits (for at most the given timeout) until every log statement so far has been output; as log statements
+// are output by a separate goroutine, this should be called before the process exits.
+func FlushLog(timeout time.Duration) {
+	l := loggerInternal()
+
+	flushed := make(chan struct{})
+	select {
+	case l.output <- outputLine{flushed: flushed}:
+	case <-time.After(timeout):
+		return
+	}
+
+	select {
+	case <-flushed:
+	case <-time.After(timeout):
+	}
 }
 
 func IsLogDebug() bool {
@@ -130,22 +225,62 @@ func IsLogDebug() bool {
 	return l.logLevel == DEBUG
 }
 
-func (l *MonitorLogger) out(msg string) {
-	l.output <- outputLine{
-		msg,
-		false,
-		time.Now().UnixNano() / 1000000,
+func (l *MonitorLogger) out(level LogLevel, line string, msg string, err error, fields map[string]string) {
+	l.output <- l.redact(newOutputLine(level, line, msg, err, fields, false))
+}
+
+func (l *MonitorLogger) err(level LogLevel, line string, msg string, err error, fields map[string]string) {
+	l.output <- l.redact(newOutputLine(level, line, msg, err, fields, true))
+}
+
+// redact removes paths from the output line, if path redaction is enabled.
+func (l *MonitorLogger) redact(toPrint outputLine) outputLine {
+	if !l.redactPaths {
+		return toPrint
 	}
+
+	toPrint.line = RedactPaths(toPrint.line)
+	toPrint.msg = RedactPaths(toPrint.msg)
+	toPrint.errText = RedactPaths(toPrint.errText)
+
+	if len(toPrint.fields) > 0 {
+		redactedFields := make(map[string]string, len(toPrint.fields))
+		for key, value := range toPrint.fields {
+			redactedFields[key] = RedactPaths(value)
+		}
+		toPrint.fields = redactedFields
+	}
+
+	return toPrint
 }
 
-func (l *MonitorLogger) err(msg string) {
-	l.output <- outputLine{
-		msg,
-		true,
-		time.Now().UnixNano() / 1000000,
+func newOutputLine(level LogLevel, line string, msg string, err error, fields map[string]string, isErr bool) outputLine {
+
+	errText := ""
+	if err != nil {
+		errText = err.Error()
+	}
+
+	return outputLine{
+		line:      line,
+		err:       isErr,
+		timestamp: time.Now().UnixNano() / 1000000,
+		level:     level,
+		msg:       msg,
+		errText:   errText,
+		fields:    fields,
 	}
 }
 
+// jsonOutputLine is the format of each line when the logger is outputting JSON.
+type jsonOutputLine struct {
+	Timestamp string            `json:"timestamp"`
+	Level     string            `json:"level"`
+	Message   string            `json:"message"`
+	Error     string            `json:"error,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
 func (l *MonitorLogger) logOutputter() {
 
 	startTime := time.Now()
@@ -153,6 +288,16 @@ func (l *MonitorLogger) logOutputter() {
 	for {
 		toPrint := <-l.output
 
+		if toPrint.flushed != nil {
+			close(toPrint.flushed)
+			continue
+		}
+
+		if l.jsonFormat {
+			l.writeJSON(toPrint)
+			continue
+		}
+
 		t := time.Now()
 		formatted := "[" + fmt.Sprintf("%d-%02d-%02d %02d:%02d:%02d.%03d",
 			t.Year(), t.Month(), t.Day(),
@@ -168,10 +313,61 @@ func (l *MonitorLogger) logOutputter() {
 
 		time := formatted + " [" + strconv.Itoa(elapsedTimeInSeconds) + "." + elapsedTimeInDecimalStr + "] "
 
+		line := toPrint.line + formatFieldsAsText(toPrint.fields)
+
 		if toPrint.err {
-			os.Stderr.WriteString(time + toPrint.line + "\n")
+			os.Stderr.WriteString(time + line + "\n")
 		} else {
-			os.Stdout.WriteString(time + toPrint.line + "\n")
+			os.Stdout.WriteString(time + line + "\n")
 		}
 	}
 }
+
+func (l *MonitorLogger) writeJSON(toPrint outputLine) {
+
+	t := time.Unix(0, toPrint.timestamp*1000000)
+
+	jsonLine := jsonOutputLine{
+		Timestamp: t.Format("2006-01-02T15:04:05.000Z07:00"),
+		Level:     toPrint.level.String(),
+		Message:   toPrint.msg,
+		Error:     toPrint.errText,
+		Fields:    toPrint.fields,
+	}
+
+	bytes, err := json.Marshal(jsonLine)
+	if err != nil {
+		// This shouldn't happen, as all the fields are strings
+		os.Stderr.WriteString("Unable to marshal log line: " + toPrint.line + "\n")
+		return
+	}
+
+	if toPrint.err {
+		os.Stderr.WriteString(string(bytes) + "\n")
+	} else {
+		os.Stdout.WriteString(string(bytes) + "\n")
+	}
+}
+
+// formatFieldsAsText converts the fields to a string of the form " {key1=value1, key2=value2}", sorted by key.
+func formatFieldsAsText(fields map[string]string) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := ""
+	for _, key := range keys {
+		if len(result) > 0 {
+			result += ", "
+		}
+		result += key + "=" + fields[key]
+	}
+
+	return " {" + result + "}"
+}
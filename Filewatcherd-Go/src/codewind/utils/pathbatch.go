@@ -0,0 +1,81 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package utils
+
+import (
+	"runtime"
+	"sync"
+)
+
+/**
+ * Large lists of paths (for example, the ref paths of a project, or the changed files of a batch) may be processed
+ * concurrently by a bounded pool of goroutines, rather than one at a time. This helps most where each path requires
+ * a call to the file system (for example, to stat the file); short lists are processed on the calling goroutine, as
+ * the cost of starting the pool would exceed the benefit.
+ */
+
+// minConcurrentBatchSize is the smallest number of items that are processed by a pool of goroutines.
+const minConcurrentBatchSize = 64
+
+// ForEachConcurrently calls fn with each index from 0 to count-1, using at most maxWorkers goroutines (or GOMAXPROCS,
+// if maxWorkers is 0 or less), and returns once every call has returned. fn must be safe to call from multiple
+// goroutines at once; the order of the calls is not defined.
+func ForEachConcurrently(count int, maxWorkers int, fn func(index int)) {
+
+	if maxWorkers <= 0 {
+		maxWorkers = runtime.GOMAXPROCS(0)
+	}
+	if maxWorkers > count {
+		maxWorkers = count
+	}
+
+	if count < minConcurrentBatchSize || maxWorkers <= 1 {
+		for index := 0; index < count; index++ {
+			fn(index)
+		}
+		return
+	}
+
+	indices := make(chan int, count)
+	for index := 0; index < count; index++ {
+		indices <- index
+	}
+	close(indices)
+
+	var waitGroup sync.WaitGroup
+	for worker := 0; worker < maxWorkers; worker++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for index := range indices {
+				fn(index)
+			}
+		}()
+	}
+	waitGroup.Wait()
+}
+
+// ConvertPathsConcurrently converts each path with the given conversion function (for example,
+// ConvertAbsoluteUnixStyleNormalizedPathToLocalFile), using at most maxWorkers goroutines (see ForEachConcurrently).
+// The converted paths and errors are returned in the same order as the paths: if a path could not be converted, its
+// error is non-nil (and its converted path should be ignored).
+func ConvertPathsConcurrently(paths []string, maxWorkers int, convert func(string) (string, error)) ([]string, []error) {
+
+	converted := make([]string, len(paths))
+	errs := make([]error, len(paths))
+
+	ForEachConcurrently(len(paths), maxWorkers, func(index int) {
+		converted[index], errs[index] = convert(paths[index])
+	})
+
+	return converted, errs
+}
@@ -0,0 +1,120 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package utils
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestConvertPathsConcurrentlyPreservesOrder(t *testing.T) {
+	for _, size := range []int{0, 1, minConcurrentBatchSize - 1, minConcurrentBatchSize, 1000} {
+		paths := make([]string, size)
+		for index := range paths {
+			paths[index] = "/" + strconv.Itoa(index)
+		}
+
+		converted, errs := ConvertPathsConcurrently(paths, 0, func(path string) (string, error) {
+			if strings.HasSuffix(path, "7") {
+				return "", errors.New("unable to convert " + path)
+			}
+			return "local" + path, nil
+		})
+
+		if len(converted) != size || len(errs) != size {
+			t.Fatalf("Expected %d results, but got %d paths and %d errors", size, len(converted), len(errs))
+		}
+		for index, path := range paths {
+			if strings.HasSuffix(path, "7") {
+				if errs[index] == nil {
+					t.Errorf("Expected an error for %s", path)
+				}
+			} else if errs[index] != nil || converted[index] != "local"+path {
+				t.Errorf("Expected %s to be converted to local%s, but got %q (%v)", path, path, converted[index], errs[index])
+			}
+		}
+	}
+}
+
+// benchmarkPathCounts are the sizes of the lists of paths that are converted by the benchmarks: below, at, and well
+// above the size at which a pool of goroutines is used.
+var benchmarkPathCounts = []int{minConcurrentBatchSize / 2, minConcurrentBatchSize, 1024, 16384}
+
+// benchmarkConvertPaths compares converting the paths on the calling goroutine (one worker) with converting them
+// concurrently (GOMAXPROCS workers), for each of the benchmarkPathCounts.
+func benchmarkConvertPaths(b *testing.B, newPaths func(b *testing.B, count int) []string, convert func(string) (string, error)) {
+	for _, count := range benchmarkPathCounts {
+		paths := newPaths(b, count)
+
+		for _, workers := range []struct {
+			name       string
+			maxWorkers int
+		}{{"serial", 1}, {"concurrent", 0}} {
+			b.Run(strconv.Itoa(count)+"/"+workers.name, func(b *testing.B) {
+				for iteration := 0; iteration < b.N; iteration++ {
+					ConvertPathsConcurrently(paths, workers.maxWorkers, convert)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkConvertPathsConcurrently converts paths without calling the file system, so measures the overhead of the pool.
+func BenchmarkConvertPathsConcurrently(b *testing.B) {
+	newPaths := func(b *testing.B, count int) []string {
+		paths := make([]string, count)
+		for index := range paths {
+			paths[index] = "/c/Users/project/src/file" + strconv.Itoa(index) + ".go"
+		}
+		return paths
+	}
+
+	benchmarkConvertPaths(b, newPaths, ConvertAbsoluteUnixStyleNormalizedPathToLocalFile)
+}
+
+// BenchmarkConvertPathsConcurrentlyWithStat converts paths with a stat of each file, as when the files of a project
+// are checked.
+func BenchmarkConvertPathsConcurrentlyWithStat(b *testing.B) {
+	dir, err := ioutil.TempDir("", "filewatcher-benchmark")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newPaths := func(b *testing.B, count int) []string {
+		paths := make([]string, count)
+		for index := range paths {
+			paths[index] = filepath.Join(dir, "file"+strconv.Itoa(index)+".txt")
+			if _, err := os.Stat(paths[index]); err == nil {
+				continue
+			}
+			if err := ioutil.WriteFile(paths[index], []byte("contents"), 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+		return paths
+	}
+
+	convert := func(path string) (string, error) {
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+
+	benchmarkConvertPaths(b, newPaths, convert)
+}
@@ -17,12 +17,93 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"unicode"
 )
 
-// IsWindowsAbsolutePath returns true if the path is in Windows absolute path format, false otherwise.
+// caseInsensitivePaths is 1 if paths are case-insensitive, otherwise 0; accessed atomically.
+var caseInsensitivePaths = boolToInt32(IsCaseInsensitiveOS())
+
+// IsCaseInsensitiveOS returns true on Windows and macOS, whose file systems are case-insensitive by default (NTFS,
+// HFS+ and APFS).
+func IsCaseInsensitiveOS() bool {
+	return runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+}
+
+// IsCaseInsensitiveFileSystem returns true if paths that differ only in case refer to the same file: by default, the
+// value of IsCaseInsensitiveOS, unless overridden by SetCaseInsensitiveFileSystem.
+func IsCaseInsensitiveFileSystem() bool {
+	return atomic.LoadInt32(&caseInsensitivePaths) == 1
+}
+
+// SetCaseInsensitiveFileSystem sets whether paths that differ only in case refer to the same file (see the
+// caseInsensitivePaths setting of the filewatcher configuration). This should be called before any paths are
+// normalized or matched, as existing matchers and normalized paths are not updated.
+func SetCaseInsensitiveFileSystem(caseInsensitive bool) {
+	atomic.StoreInt32(&caseInsensitivePaths, boolToInt32(caseInsensitive))
+}
+
+func boolToInt32(value bool) int32 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// NormalizePathCase converts the path to a canonical case (lowercase) on case-insensitive filesystems, so that
+// paths which refer to the same file may be compared; on case-sensitive filesystems, the path is returned as-is.
+func NormalizePathCase(path string) string {
+	if IsCaseInsensitiveFileSystem() {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// caseInsensitiveRegexFlag is the flag to prefix to a regular expression that matches paths, so that the
+// expression is case-insensitive on case-insensitive filesystems.
+func caseInsensitiveRegexFlag() string {
+	if IsCaseInsensitiveFileSystem() {
+		return "(?i)"
+	}
+	return ""
+}
+
+// windowsExtendedLengthPrefix is prepended to Windows paths to allow them to exceed MAX_PATH (260) characters.
+const windowsExtendedLengthPrefix = "\\\\?\\"
+
+// windowsExtendedLengthUNCPrefix is the extended-length form of a UNC path (\\server\share => \\?\UNC\server\share).
+const windowsExtendedLengthUNCPrefix = windowsExtendedLengthPrefix + "UNC\\"
+
+// windowsLongPathThreshold is the length at which local paths are converted to extended-length paths: this is less
+// than MAX_PATH, as directories must leave room for an 8.3 filename (MAX_PATH - 12).
+const windowsLongPathThreshold = 248
+
+// StripWindowsExtendedLengthPrefix converts eg \\?\c:\Users\Administrator to c:\Users\Administrator, and
+// \\?\UNC\server\share to \\server\share; other paths are returned unchanged.
+func StripWindowsExtendedLengthPrefix(path string) string {
+
+	if strings.HasPrefix(path, windowsExtendedLengthUNCPrefix) {
+		return "\\\\" + path[len(windowsExtendedLengthUNCPrefix):]
+	}
+
+	return strings.TrimPrefix(path, windowsExtendedLengthPrefix)
+}
+
+// IsWindowsUNCPath returns true if the path is a Windows UNC path (\\server\share\...), with or without the
+// extended-length prefix, false otherwise.
+func IsWindowsUNCPath(path string) bool {
+
+	path = StripWindowsExtendedLengthPrefix(path)
+
+	return len(path) > 2 && strings.HasPrefix(path, "\\\\") && path[2] != '\\'
+}
+
+// IsWindowsAbsolutePath returns true if the path is in Windows absolute path format (with or without the
+// extended-length prefix), false otherwise.
 func IsWindowsAbsolutePath(absolutePath string) bool {
 
+	absolutePath = StripWindowsExtendedLengthPrefix(absolutePath)
+
 	if len(absolutePath) < 2 {
 		return false
 	}
@@ -79,13 +160,20 @@ func NormalizeDriveLetter(absolutePath string) (string, error) {
 	}
 }
 
-// ConvertFromWindowsDriveLetter converts C:\helloThere -> /c/helloThere
+// ConvertFromWindowsDriveLetter converts C:\helloThere -> /c/helloThere, and \\server\share -> //server/share
 func ConvertFromWindowsDriveLetter(absolutePath string) string {
 
+	if IsWindowsUNCPath(absolutePath) {
+		// \\server\share\project => //server/share/project
+		return strings.ReplaceAll(StripWindowsExtendedLengthPrefix(absolutePath), "\\", "/")
+	}
+
 	if !IsWindowsAbsolutePath(absolutePath) {
 		return absolutePath
 	}
 
+	absolutePath = StripWindowsExtendedLengthPrefix(absolutePath)
+
 	absolutePath = strings.ReplaceAll(absolutePath, "\\", "/")
 
 	char0 := absolutePath[0]
@@ -110,7 +198,10 @@ func ConvertAbsoluteUnixStyleNormalizedPathToLocalFile(str string) (string, erro
 	return ConvertAbsoluteUnixStyleNormalizedPathToLocalFileOS(str, true)
 }
 
-// ConvertAbsoluteUnixStyleNormalizedPathToLocalFileOS converts eg /c/Users/Administrator to c:\Users\Administrator */
+// ConvertAbsoluteUnixStyleNormalizedPathToLocalFileOS converts eg /c/Users/Administrator to c:\Users\Administrator.
+// Paths of windowsLongPathThreshold characters or more are returned as extended-length paths (\\?\c:\Users\...),
+// as otherwise they cannot be used by the Windows file APIs (or by cwctl). UNC paths are converted from eg
+// //server/share/project to \\server\share\project. */
 func ConvertAbsoluteUnixStyleNormalizedPathToLocalFileOS(str string, isWindows bool) (string, error) {
 
 	if !isWindows {
@@ -125,6 +216,10 @@ func ConvertAbsoluteUnixStyleNormalizedPathToLocalFileOS(str string, isWindows b
 		return "", errors.New("Cannot convert string with length of 0 or 1: " + str)
 	}
 
+	if strings.HasPrefix(str, "//") {
+		return convertUnixStyleUNCPathToLocalFile(str)
+	}
+
 	driveLetter := str[1]
 
 	if !unicode.IsLetter(rune(driveLetter)) {
@@ -140,24 +235,92 @@ func ConvertAbsoluteUnixStyleNormalizedPathToLocalFileOS(str string, isWindows b
 		return "", errors.New("Invalid path format: " + str)
 	}
 
-	return string(driveLetter) + ":\\" + strings.ReplaceAll(str[3:], "/", "\\"), nil
+	result := string(driveLetter) + ":\\" + strings.ReplaceAll(str[3:], "/", "\\")
+
+	if len(result) >= windowsLongPathThreshold {
+		result = windowsExtendedLengthPrefix + result
+	}
+
+	return result, nil
+
+}
+
+// convertUnixStyleUNCPathToLocalFile converts eg //server/share/project to \\server\share\project.
+func convertUnixStyleUNCPathToLocalFile(str string) (string, error) {
+
+	// The server and share names are both required
+	components := strings.SplitN(str[2:], "/", 3)
+	if len(components) < 2 || components[0] == "" || components[1] == "" {
+		return "", errors.New("Invalid UNC path format: " + str)
+	}
+
+	uncPath := strings.ReplaceAll(str[2:], "/", "\\")
 
+	if len(uncPath)+2 >= windowsLongPathThreshold {
+		return windowsExtendedLengthUNCPrefix + uncPath, nil
+	}
+
+	return "\\\\" + uncPath, nil
+}
+
+// FilewatcherOwnedFilenamePrefix is the filename prefix of every file (or directory) that the filewatcher itself
+// writes, such as watch self-test probes and clock skew measurements; any state or temporary files that are added in
+// future must also use it. Changes to these paths are never reported, regardless of the filters of the project, so
+// that the writes of the filewatcher cannot themselves trigger syncs.
+const FilewatcherOwnedFilenamePrefix = ".cw-filewatcher-"
+
+// IsFilewatcherOwnedPath returns true if the project-relative path (eg /some-dir/some-file.txt) is, or is within, a
+// file or directory that is owned by the filewatcher (see FilewatcherOwnedFilenamePrefix).
+func IsFilewatcherOwnedPath(path string) bool {
+	for _, name := range strings.Split(path, "/") {
+		if strings.HasPrefix(name, FilewatcherOwnedFilenamePrefix) {
+			return true
+		}
+	}
+	return false
 }
 
 // PathFilter is responsible for taking the filename/path filters for a project
 // on the watched projects list, and applying those filters against a given path
 // string (returning true if a filter should be ignored).
+//
+// If the project has IncludedPatterns (using the same gitignore-style syntax as
+// IgnoredPatterns, eg 'src/**/*.java'), then only the files that match one of them
+// are watched: a file is included if it (or one of its parent directories) matches
+// an included pattern, and it is not excluded by any of the ignore rules. That is,
+// the ignore rules take precedence over the included patterns. Directories are
+// never excluded by the included patterns, as they may contain matching files.
+// (The included patterns are not passed to cwctl, so a sync which examines the
+// entire project may still include other files.)
 type PathFilter struct {
 	filenameExcludePatterns []*regexp.Regexp
+	filenameExcludeRules    []string // The IgnoredFilenames entry of each of filenameExcludePatterns
 	pathExcludePatterns     []*regexp.Regexp
+	pathExcludeRules        []string       // The IgnoredPaths entry of each of pathExcludePatterns
+	ignoreMatcher           *IgnoreMatcher // From the gitignore-style IgnoredPatterns of the project
+	includeMatcher          *IgnoreMatcher // From the gitignore-style IncludedPatterns of the project; empty if all files are included
 }
 
 // NewPathFilter ...
 func NewPathFilter(project *models.ProjectToWatch) (*PathFilter, error) {
 
+	ignoreMatcher, err := NewIgnoreMatcher(project.IgnoredPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	includeMatcher, err := NewIgnoreMatcher(project.IncludedPatterns)
+	if err != nil {
+		return nil, err
+	}
+
 	result := PathFilter{
 		make([]*regexp.Regexp, 0),
+		make([]string, 0),
 		make([]*regexp.Regexp, 0),
+		make([]string, 0),
+		ignoreMatcher,
+		includeMatcher,
 	}
 
 	ignoredFilenames := project.IgnoredFilenames
@@ -168,7 +331,7 @@ func NewPathFilter(project *models.ProjectToWatch) (*PathFilter, error) {
 				return nil, errors.New("Ignore filenames may not contain path separators: " + val)
 			}
 
-			text := strings.ReplaceAll(val, "*", ".*")
+			text := caseInsensitiveRegexFlag() + convertWildcardFilterToRegex(val)
 			re, err := regexp.Compile(text)
 			if err != nil {
 				LogSevere("Unable to compile regex: " + text)
@@ -176,6 +339,7 @@ func NewPathFilter(project *models.ProjectToWatch) (*PathFilter, error) {
 			}
 
 			result.filenameExcludePatterns = append(result.filenameExcludePatterns, re)
+			result.filenameExcludeRules = append(result.filenameExcludeRules, val)
 
 		}
 	}
@@ -187,7 +351,7 @@ func NewPathFilter(project *models.ProjectToWatch) (*PathFilter, error) {
 				return nil, errors.New("Ignore paths may not contain Windows-style path separators: " + val)
 			}
 
-			text := strings.ReplaceAll(val, "*", ".*")
+			text := caseInsensitiveRegexFlag() + convertWildcardFilterToRegex(val)
 			re, err := regexp.Compile(text)
 			if err != nil {
 				LogSevere("Unable to compile regex: " + text)
@@ -195,6 +359,7 @@ func NewPathFilter(project *models.ProjectToWatch) (*PathFilter, error) {
 			}
 
 			result.pathExcludePatterns = append(result.pathExcludePatterns, re)
+			result.pathExcludeRules = append(result.pathExcludeRules, val)
 
 		}
 	}
@@ -202,12 +367,31 @@ func NewPathFilter(project *models.ProjectToWatch) (*PathFilter, error) {
 	return &result, nil
 }
 
+// convertWildcardFilterToRegex converts an IgnoredFilenames or IgnoredPaths entry to a regular expression: '*' matches
+// any sequence of characters, and every other character matches itself, so that filters for names containing spaces,
+// unicode, or characters that are special to regular expressions or shells (eg 'my file (1).txt') match literally.
+func convertWildcardFilterToRegex(filter string) string {
+
+	parts := strings.Split(filter, "*")
+	for index, part := range parts {
+		parts[index] = regexp.QuoteMeta(part)
+	}
+
+	return strings.Join(parts, ".*")
+}
+
 // IsFilteredOutByFilename ...
 func (p *PathFilter) IsFilteredOutByFilename(pathParam string) bool {
+	return p.MatchingFilenameRule(pathParam) != ""
+}
+
+// MatchingFilenameRule returns the IgnoredFilenames entry that matches the name of the path (or of one of its parent
+// directories), or "" if none do.
+func (p *PathFilter) MatchingFilenameRule(pathParam string) string {
 
 	if strings.Contains(pathParam, "\\") {
 		LogSevere("Parameter cannot contain Window-style file paths")
-		return false
+		return ""
 	}
 
 	strArr := strings.Split(pathParam, "/")
@@ -219,37 +403,112 @@ func (p *PathFilter) IsFilteredOutByFilename(pathParam string) bool {
 
 	for _, filename := range strArr {
 
-		for _, val := range p.filenameExcludePatterns {
+		for index, val := range p.filenameExcludePatterns {
 			if val.MatchString(filename) {
-				return true
+				return p.filenameExcludeRules[index]
 			}
 		}
 
 	}
 
-	return false
+	return ""
 }
 
 // IsFilteredOutByPath ...
 func (p *PathFilter) IsFilteredOutByPath(path string) bool {
+	return p.MatchingPathRule(path) != ""
+}
+
+// MatchingPathRule returns the IgnoredPaths entry that matches the path, or "" if none do. (Unlike IsFilteredOut,
+// the parent paths are not checked.)
+func (p *PathFilter) MatchingPathRule(path string) string {
 
 	if strings.Contains(path, "\\") {
 		LogSevere("Parameter cannot contain Window-style file paths")
+		return ""
+	}
+
+	for index, val := range p.pathExcludePatterns {
+
+		if val.MatchString(path) {
+			return p.pathExcludeRules[index]
+		}
+	}
+
+	return ""
+
+}
+
+// IsFilteredOutByIgnorePatterns returns true if the path (or one of its parent directories) is ignored by the
+// gitignore-style IgnoredPatterns of the project.
+func (p *PathFilter) IsFilteredOutByIgnorePatterns(path string, isDir bool) bool {
+	return p.ignoreMatcher.IsIgnored(path, isDir)
+}
+
+// MatchingIgnorePattern returns the IgnoredPatterns entry that causes the path to be ignored, or "" if it is not.
+func (p *PathFilter) MatchingIgnorePattern(path string, isDir bool) string {
+	return p.ignoreMatcher.IgnoringPattern(path, isDir)
+}
+
+// IsFilteredOutByIncludePatterns returns true if the project has IncludedPatterns, and the path is a file that does not
+// match any of them (nor do any of its parent directories).
+func (p *PathFilter) IsFilteredOutByIncludePatterns(path string, isDir bool) bool {
+	if isDir || p.includeMatcher.IsEmpty() {
 		return false
 	}
+	return !p.includeMatcher.IsIgnored(path, false)
+}
 
-	result := false
+// IsFilteredOut returns true if the project-relative path (eg /some-dir/some-file.txt) is excluded by any of the
+// filters: by ignored path (including the paths of its parents), ignored filename, or ignored pattern, or as it does
+// not match the included patterns. Paths owned by the filewatcher are always excluded.
+func (p *PathFilter) IsFilteredOut(path string, isDir bool) bool {
 
-	for _, val := range p.pathExcludePatterns {
+	if IsFilewatcherOwnedPath(path) || p.IsFilteredOutByPath(path) {
+		return true
+	}
 
-		if val.MatchString(path) {
-			result = true
-			break
+	for _, val := range SplitRelativeProjectPathIntoComponentPaths(path) {
+		if p.IsFilteredOutByPath(val) {
+			return true
 		}
 	}
 
-	return result
+	return p.IsFilteredOutByFilename(path) || p.IsFilteredOutByIgnorePatterns(path, isDir) ||
+		p.IsFilteredOutByIncludePatterns(path, isDir)
+}
+
+// NormalizeEventPath converts an absolute path from the OS (for example, from a file system event) into the canonical
+// form that is used for ignore matching, and for transmission to the server: forward slashes, no extended-length
+// prefix, and Windows drive letters in lowercase '/c/...' form (eg C:\Users\a.txt => /c/Users/a.txt). Paths that are
+// already in this form are returned unchanged.
+func NormalizeEventPath(path string) (string, error) {
+	path = StripWindowsExtendedLengthPrefix(path)
+	path = strings.ReplaceAll(path, "\\", "/")
+	path = ConvertFromWindowsDriveLetter(path)
+
+	return NormalizeDriveLetter(path)
+}
+
+// ConvertEventPathToProjectRelativePath normalizes the absolute path of an event and the project root (see
+// NormalizeEventPath), then returns the path relative to the project root (eg /some-dir/some-file.txt, or / for the
+// root itself). Returns nil if the path could not be converted, or is not within the project root. This is the single
+// point at which event paths are converted before they are matched against the ignore rules of the project.
+func ConvertEventPathToProjectRelativePath(path string, rootPath string) *string {
+
+	normalizedPath, err := NormalizeEventPath(path)
+	if err != nil {
+		LogSevereErr("Unable to normalize event path: "+path, err)
+		return nil
+	}
+
+	normalizedRootPath, err := NormalizeEventPath(rootPath)
+	if err != nil {
+		LogSevereErr("Unable to normalize project path: "+rootPath, err)
+		return nil
+	}
 
+	return ConvertAbsolutePathWithUnixSeparatorsToProjectRelativePath(normalizedPath, normalizedRootPath)
 }
 
 // ConvertAbsolutePathWithUnixSeparatorsToProjectRelativePath ...
@@ -267,13 +526,13 @@ func ConvertAbsolutePathWithUnixSeparatorsToProjectRelativePath(path string, roo
 
 	rootPath = StripTrailingForwardSlash(rootPath)
 
-	if !strings.HasPrefix(path, rootPath) {
+	if !isWithinRoot(path, rootPath) {
 		// This shouldn't happen, and is thus severe
 		LogSevere("Watch event '" + path + "' does not match project path '" + rootPath + "'")
 		return nil
 	}
 
-	path = strings.ReplaceAll(path, rootPath, "")
+	path = path[len(rootPath):]
 
 	if len(path) == 0 {
 		path = "/"
@@ -283,6 +542,31 @@ func ConvertAbsolutePathWithUnixSeparatorsToProjectRelativePath(path string, roo
 
 }
 
+// IsEventPathWithinProjectRoot returns true if the absolute path (in any form accepted by NormalizeEventPath) is the
+// project root, or is within it.
+func IsEventPathWithinProjectRoot(path string, rootPath string) bool {
+
+	normalizedPath, err := NormalizeEventPath(path)
+	if err != nil {
+		return false
+	}
+
+	normalizedRootPath, err := NormalizeEventPath(rootPath)
+	if err != nil {
+		return false
+	}
+
+	return isWithinRoot(normalizedPath, StripTrailingForwardSlash(normalizedRootPath))
+}
+
+// isWithinRoot returns true if the normalized path is within the normalized root (without a trailing slash). The root
+// must match a complete path component (/project is not the root of /project2/file), in the case of the filesystem
+// (eg C:\Users and c:\users are the same directory on Windows).
+func isWithinRoot(path string, rootPath string) bool {
+	return len(path) >= len(rootPath) && NormalizePathCase(path[0:len(rootPath)]) == NormalizePathCase(rootPath) &&
+		(len(path) == len(rootPath) || path[len(rootPath)] == '/')
+}
+
 // SplitRelativeProjectPathIntoComponentPaths will, eg, convert "/moo/cow" => [ "/moo/cow", "/moo"]
 func SplitRelativeProjectPathIntoComponentPaths(path string) []string {
 	result := make([]string, 0)
@@ -0,0 +1,327 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package utils
+
+import (
+	"codewind/models"
+	"strings"
+	"testing"
+)
+
+// deepUnixStylePath returns a path of deeply nested directories of exactly the given length, beginning with the prefix.
+func deepUnixStylePath(prefix string, length int) string {
+	path := prefix + strings.Repeat("directory/", length/10+1)
+	return path[:length-1] + "x"
+}
+
+func TestConvertLongPathToLocalFile(t *testing.T) {
+
+	tests := []struct {
+		length         int
+		extendedLength bool
+	}{
+		{windowsLongPathThreshold - 1, false},
+		{windowsLongPathThreshold, true},
+		{windowsLongPathThreshold + 1, true},
+		{1000, true},
+	}
+
+	for _, test := range tests {
+		unixStylePath := deepUnixStylePath("/c/", test.length)
+
+		expected := "c:\\" + strings.ReplaceAll(unixStylePath[3:], "/", "\\")
+		if test.extendedLength {
+			expected = "\\\\?\\" + expected
+		}
+
+		actual, err := ConvertAbsoluteUnixStyleNormalizedPathToLocalFileOS(unixStylePath, true)
+		if err != nil {
+			t.Errorf("Unable to convert a path of length %d: %v", test.length, err)
+			continue
+		}
+		if actual != expected {
+			t.Errorf("Expected a path of length %d to be converted to %q, but got %q", test.length, expected, actual)
+		}
+
+		// The conversion is reversed, with or without the extended-length prefix
+		if reversed := ConvertFromWindowsDriveLetter(actual); reversed != unixStylePath {
+			t.Errorf("Expected %q to be converted back to %q, but got %q", actual, unixStylePath, reversed)
+		}
+		if normalized, err := NormalizeEventPath(actual); err != nil || normalized != unixStylePath {
+			t.Errorf("Expected %q to be normalized to %q, but got %q (%v)", actual, unixStylePath, normalized, err)
+		}
+	}
+}
+
+func TestConvertUNCPathToLocalFile(t *testing.T) {
+
+	longUNCPath := deepUnixStylePath("//host/share/", windowsLongPathThreshold)
+
+	tests := []struct {
+		unixStylePath string
+		expected      string
+	}{
+		{"//host/share", "\\\\host\\share"},
+		{"//host/share/a/b/c", "\\\\host\\share\\a\\b\\c"},
+		{"//host.example.com/share$/my project", "\\\\host.example.com\\share$\\my project"},
+		{deepUnixStylePath("//host/share/", windowsLongPathThreshold-1), strings.ReplaceAll(deepUnixStylePath("//host/share/", windowsLongPathThreshold-1), "/", "\\")},
+		{longUNCPath, "\\\\?\\UNC\\" + strings.ReplaceAll(longUNCPath[2:], "/", "\\")},
+	}
+
+	for _, test := range tests {
+		actual, err := ConvertAbsoluteUnixStyleNormalizedPathToLocalFileOS(test.unixStylePath, true)
+		if err != nil {
+			t.Errorf("Unable to convert %q: %v", test.unixStylePath, err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("Expected %q to be converted to %q, but got %q", test.unixStylePath, test.expected, actual)
+		}
+
+		if !IsWindowsUNCPath(actual) {
+			t.Errorf("Expected %q to be a UNC path", actual)
+		}
+		if reversed := ConvertFromWindowsDriveLetter(actual); reversed != test.unixStylePath {
+			t.Errorf("Expected %q to be converted back to %q, but got %q", actual, test.unixStylePath, reversed)
+		}
+	}
+
+	// The server and share names are both required
+	for _, invalid := range []string{"//host", "//host/", "///share", "//"} {
+		if actual, err := ConvertAbsoluteUnixStyleNormalizedPathToLocalFileOS(invalid, true); err == nil {
+			t.Errorf("Expected an error converting %q, but got %q", invalid, actual)
+		}
+	}
+}
+
+func TestIsWindowsUNCPath(t *testing.T) {
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"\\\\host\\share", true},
+		{"\\\\?\\UNC\\host\\share\\a", true},
+		{"\\\\?\\c:\\Users", false},
+		{"\\\\\\share", false},
+		{"\\\\", false},
+		{"c:\\Users", false},
+		{"//host/share", false},
+	}
+
+	for _, test := range tests {
+		if actual := IsWindowsUNCPath(test.path); actual != test.expected {
+			t.Errorf("IsWindowsUNCPath(%q) = %v, expected %v", test.path, actual, test.expected)
+		}
+	}
+}
+
+func TestStripWindowsExtendedLengthPrefix(t *testing.T) {
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"\\\\?\\c:\\Users\\a", "c:\\Users\\a"},
+		{"\\\\?\\UNC\\host\\share\\a", "\\\\host\\share\\a"},
+		{"\\\\host\\share\\a", "\\\\host\\share\\a"},
+		{"c:\\Users\\a", "c:\\Users\\a"},
+		{"/c/Users/a", "/c/Users/a"},
+	}
+
+	for _, test := range tests {
+		if actual := StripWindowsExtendedLengthPrefix(test.path); actual != test.expected {
+			t.Errorf("StripWindowsExtendedLengthPrefix(%q) = %q, expected %q", test.path, actual, test.expected)
+		}
+	}
+}
+
+func TestNormalizeEventPath(t *testing.T) {
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/home/user/project/a.txt", "/home/user/project/a.txt"},
+		{"C:\\Users\\user\\project\\a.txt", "/c/Users/user/project/a.txt"},
+		{"c:/Users/user/project", "/c/Users/user/project"},
+		{"/C/Users/user", "/c/Users/user"},
+		{"\\\\?\\C:\\Users\\user", "/c/Users/user"},
+		{"\\\\host\\share\\a\\b\\c", "//host/share/a/b/c"},
+		{"\\\\?\\UNC\\host\\share\\a", "//host/share/a"},
+		{"//host/share/a", "//host/share/a"},
+	}
+
+	for _, test := range tests {
+		actual, err := NormalizeEventPath(test.path)
+		if err != nil {
+			t.Errorf("Unable to normalize %q: %v", test.path, err)
+		} else if actual != test.expected {
+			t.Errorf("NormalizeEventPath(%q) = %q, expected %q", test.path, actual, test.expected)
+		}
+	}
+
+	if actual, err := NormalizeEventPath("relative/path"); err == nil {
+		t.Errorf("Expected an error normalizing a relative path, but got %q", actual)
+	}
+}
+
+func TestConvertEventPathToProjectRelativePath(t *testing.T) {
+
+	tests := []struct {
+		path     string
+		rootPath string
+		expected string // "" if the path is not within the root
+	}{
+		{"/home/user/project/a.txt", "/home/user/project", "/a.txt"},
+		{"/home/user/project/a.txt", "/home/user/project/", "/a.txt"},
+		{"/home/user/project", "/home/user/project", "/"},
+		{"C:\\Users\\user\\project\\src\\a.txt", "/c/Users/user/project", "/src/a.txt"},
+		{"/c/Users/user/project/a.txt", "C:\\Users\\user\\project", "/a.txt"},
+		{"\\\\?\\c:\\Users\\user\\project\\a.txt", "c:\\Users\\user\\project", "/a.txt"},
+		{"\\\\host\\share\\project\\a.txt", "//host/share/project", "/a.txt"},
+
+		// Paths outside the root
+		{"/home/user/project2/a.txt", "/home/user/project", ""},
+		{"/home/user/a.txt", "/home/user/project", ""},
+		{"/home/user", "/home/user/project", ""},
+		{"/d/Users/user/project/a.txt", "/c/Users/user/project", ""},
+		{"\\\\other\\share\\project\\a.txt", "//host/share/project", ""},
+		{"relative/a.txt", "/home/user/project", ""},
+	}
+
+	for _, test := range tests {
+		actual := ConvertEventPathToProjectRelativePath(test.path, test.rootPath)
+
+		if test.expected == "" {
+			if actual != nil {
+				t.Errorf("Expected %q not to be within %q, but got %q", test.path, test.rootPath, *actual)
+			}
+			if IsEventPathWithinProjectRoot(test.path, test.rootPath) {
+				t.Errorf("Expected IsEventPathWithinProjectRoot(%q, %q) to be false", test.path, test.rootPath)
+			}
+			continue
+		}
+
+		if actual == nil {
+			t.Errorf("Expected %q to be converted to %q, but it was not within %q", test.path, test.expected, test.rootPath)
+		} else if *actual != test.expected {
+			t.Errorf("Expected %q to be converted to %q, but got %q", test.path, test.expected, *actual)
+		}
+		if !IsEventPathWithinProjectRoot(test.path, test.rootPath) {
+			t.Errorf("Expected IsEventPathWithinProjectRoot(%q, %q) to be true", test.path, test.rootPath)
+		}
+	}
+}
+
+func TestPathFilterMatchesRegexMetacharactersLiterally(t *testing.T) {
+
+	filter, err := NewPathFilter(&models.ProjectToWatch{
+		IgnoredFilenames: []string{"a.b", "c++", "my file (1).txt", "*.tmp", "[x]"},
+		IgnoredPaths:     []string{"/build.out/*", "/lib+/(old)", "/a|b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/a.b", true},
+		{"/axb", false},
+		{"/src/a.b/file.txt", true},
+		{"/c++", true},
+		{"/cc", false},
+		{"/c", false},
+		{"/my file (1).txt", true},
+		{"/my file 1.txt", false},
+		{"/file.tmp", true},
+		{"/filetmp", false},
+		{"/[x]", true},
+		{"/x", false},
+		{"/build.out/a.txt", true},
+		{"/buildxout/a.txt", false},
+		{"/lib+/(old)/a.txt", true},
+		{"/libb/old/a.txt", false},
+		{"/a|b", true},
+		{"/a", false},
+		{"/b", false},
+	}
+
+	for _, test := range tests {
+		if actual := filter.IsFilteredOut(test.path, false); actual != test.expected {
+			t.Errorf("IsFilteredOut(%q) = %v, expected %v", test.path, actual, test.expected)
+		}
+	}
+}
+
+// The Windows paths of events (including those with the extended-length prefix) are converted to project-relative
+// paths, by the single point of normalization, before they are matched against the ignore rules of the project.
+func TestPathFilterIsFilteredOutForWindowsEventPaths(t *testing.T) {
+
+	filter, err := NewPathFilter(&models.ProjectToWatch{
+		IgnoredPaths:    []string{"/node_modules/*"},
+		IgnoredPatterns: []string{"/build/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const rootPath = "C:\\Users\\user\\project"
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"C:\\Users\\user\\project\\node_modules\\x.js", true},
+		{"c:\\Users\\user\\project\\node_modules\\pkg\\index.js", true},
+		{"\\\\?\\C:\\Users\\user\\project\\node_modules\\x.js", true},
+		{"\\\\?\\c:\\Users\\user\\project\\build\\out.js", true},
+		{"/c/Users/user/project/node_modules/x.js", true},
+		{"C:\\Users\\user\\project\\src\\x.js", false},
+		{"\\\\?\\C:\\Users\\user\\project\\src\\node_modules.js", false},
+		{"\\\\?\\C:\\Users\\user\\project\\src\\build.js", false},
+	}
+
+	for _, test := range tests {
+		relativePath := ConvertEventPathToProjectRelativePath(test.path, rootPath)
+		if relativePath == nil {
+			t.Errorf("Expected %q to be within %q", test.path, rootPath)
+			continue
+		}
+
+		if actual := filter.IsFilteredOut(*relativePath, false); actual != test.expected {
+			t.Errorf("IsFilteredOut(%q) of event path %q = %v, expected %v", *relativePath, test.path, actual, test.expected)
+		}
+	}
+}
+
+func TestConvertWildcardFilterToRegex(t *testing.T) {
+
+	tests := []struct {
+		filter   string
+		expected string
+	}{
+		{"*.log", ".*\\.log"},
+		{"a+b", "a\\+b"},
+		{"(1)*", "\\(1\\).*"},
+		{"/build/*/out", "/build/.*/out"},
+		{"plain", "plain"},
+	}
+
+	for _, test := range tests {
+		if actual := convertWildcardFilterToRegex(test.filter); actual != test.expected {
+			t.Errorf("convertWildcardFilterToRegex(%q) = %q, expected %q", test.filter, actual, test.expected)
+		}
+	}
+}
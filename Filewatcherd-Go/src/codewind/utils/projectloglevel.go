@@ -0,0 +1,160 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package utils
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * The log level of an individual project may be overridden at runtime (for example, by the status server), so that
+ * verbose logs may be collected for a single project without flooding the logs with those of every other project. The
+ * override applies to the log statements of the project that are made with LogDebugProject, LogInfoProject, and
+ * LogInfoFields (if its fields include the 'projectID'); other log statements use the global log level. An override may
+ * expire after a given duration, after which the global log level applies again.
+ */
+
+type projectLogLevelOverride struct {
+	level   LogLevel
+	expires time.Time // Zero if the override does not expire
+}
+
+var (
+	// projectLogLevelsLock must be acquired before reading/writing projectLogLevels
+	projectLogLevelsLock = &sync.RWMutex{}
+
+	projectLogLevels = map[string]projectLogLevelOverride{}
+
+	// The number of entries in projectLogLevels; read without the lock, so that log statements need not acquire it when
+	// there are no overrides.
+	projectLogLevelCount int32
+)
+
+// ParseLogLevel returns the log level with the given name (one of: debug, info, warn/warning, error, severe; case
+// insensitive), and false if it is not recognized.
+func ParseLogLevel(value string) (LogLevel, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return DEBUG, true
+	case "info":
+		return INFO, true
+	case "warn", "warning":
+		return WARNING, true
+	case "error":
+		return ERROR, true
+	case "severe":
+		return SEVERE, true
+	}
+	return INFO, false
+}
+
+// SetProjectLogLevel overrides the log level of the project, until it is cleared, or (if the duration is greater than
+// 0) until the duration has elapsed.
+func SetProjectLogLevel(projectID string, level LogLevel, duration time.Duration) {
+	override := projectLogLevelOverride{level: level}
+	if duration > 0 {
+		override.expires = time.Now().Add(duration)
+	}
+
+	projectLogLevelsLock.Lock()
+	defer projectLogLevelsLock.Unlock()
+
+	projectLogLevels[projectID] = override
+	atomic.StoreInt32(&projectLogLevelCount, int32(len(projectLogLevels)))
+}
+
+// ClearProjectLogLevel removes the override of the log level of the project (if any), so that the global log level
+// applies to it.
+func ClearProjectLogLevel(projectID string) {
+	projectLogLevelsLock.Lock()
+	defer projectLogLevelsLock.Unlock()
+
+	delete(projectLogLevels, projectID)
+	atomic.StoreInt32(&projectLogLevelCount, int32(len(projectLogLevels)))
+}
+
+// GetProjectLogLevel returns the override of the log level of the project, and false if it is not overridden (or the
+// override has expired).
+func GetProjectLogLevel(projectID string) (LogLevel, bool) {
+	if projectID == "" || atomic.LoadInt32(&projectLogLevelCount) == 0 {
+		return INFO, false
+	}
+
+	projectLogLevelsLock.RLock()
+	override, exists := projectLogLevels[projectID]
+	projectLogLevelsLock.RUnlock()
+
+	if !exists {
+		return INFO, false
+	}
+
+	if !override.expires.IsZero() && time.Now().After(override.expires) {
+		clearExpiredProjectLogLevel(projectID)
+		return INFO, false
+	}
+
+	return override.level, true
+}
+
+// clearExpiredProjectLogLevel removes the override of the project, if it has expired (and not since been replaced).
+func clearExpiredProjectLogLevel(projectID string) {
+	projectLogLevelsLock.Lock()
+	defer projectLogLevelsLock.Unlock()
+
+	override, exists := projectLogLevels[projectID]
+	if !exists || override.expires.IsZero() || time.Now().Before(override.expires) {
+		return
+	}
+
+	delete(projectLogLevels, projectID)
+	atomic.StoreInt32(&projectLogLevelCount, int32(len(projectLogLevels)))
+
+	// Not logged with the project log functions, as the lock is held
+	loggerInternal().out(INFO, "The log level override of project "+projectID+" has expired", "The log level override of project "+projectID+" has expired", nil, nil)
+}
+
+// projectLogLevel returns the log level that applies to the log statements of the project: its override, if any,
+// otherwise the global log level.
+func (l *MonitorLogger) projectLogLevel(projectID string) LogLevel {
+	if level, overridden := GetProjectLogLevel(projectID); overridden {
+		return level
+	}
+	return l.logLevel
+}
+
+// LogDebugProject logs the message at DEBUG level, if enabled for the project (see SetProjectLogLevel).
+func LogDebugProject(projectID string, msg string) {
+	l := loggerInternal()
+	if l.projectLogLevel(projectID) > DEBUG {
+		return
+	}
+	l.out(DEBUG, msg, msg, nil, nil)
+}
+
+// LogInfoProject logs the message at INFO level, if enabled for the project (see SetProjectLogLevel).
+func LogInfoProject(projectID string, msg string) {
+	l := loggerInternal()
+	if l.projectLogLevel(projectID) > INFO {
+		return
+	}
+	l.out(INFO, msg, msg, nil, nil)
+}
+
+// IsLogDebugProject returns true if DEBUG level log statements are enabled for the project; this may be used to avoid
+// building expensive debug messages.
+func IsLogDebugProject(projectID string) bool {
+	l := loggerInternal()
+	return l.projectLogLevel(projectID) == DEBUG
+}
@@ -0,0 +1,217 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Path redaction: in shared environments, absolute paths in log statements may leak user names and internal directory
+// structure. When enabled in the logger (see `FILEWATCHER_REDACT_PATHS`), the user's home directory is replaced
+// with '~', and each registered project root is replaced with a placeholder containing a hash of the path (so that
+// log statements for a specific project can still be correlated). A path is only replaced where it ends at a path
+// separator, or at the end of a path in the log statement (see isRedactedPathBoundary): '/home/bob' is not replaced within
+// '/home/bobby'.
+//
+// Registered paths are never unregistered, as log statements about a project (eg of its watches being closed) may still
+// be output after it is removed; the number of projects is small.
+
+// redactedPath is a form of a registered path, and its placeholder.
+type redactedPath struct {
+	path        string
+	placeholder string
+}
+
+var (
+	// redactedPathsLock must be acquired before reading/writing redactedPaths and sortedRedactedPaths
+	redactedPathsLock = &sync.RWMutex{}
+
+	/* path -> placeholder, for each form of each registered path */
+	redactedPaths = map[string]string{}
+
+	// The entries of redactedPaths, longest first, so that a project root is replaced before the home directory that
+	// contains it; rebuilt (rather than modified) whenever redactedPaths changes, so it may be used without the lock.
+	sortedRedactedPaths = []redactedPath{}
+
+	redactedHomeDirOnce sync.Once
+)
+
+// RegisterRedactedPath registers a project root that should be redacted by RedactPaths. The path may be in either local
+// (eg 'c:\Users\user\project') or absolute unix-style normalized form (eg '/c/Users/user/project'); both forms will be redacted.
+func RegisterRedactedPath(path string) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return
+	}
+
+	hash := sha256.Sum256([]byte(normalizePathForRedaction(path)))
+	placeholder := "<project-" + hex.EncodeToString(hash[:])[0:8] + ">"
+
+	redactedPathsLock.Lock()
+	defer redactedPathsLock.Unlock()
+
+	for _, form := range getPathFormsForRedaction(path) {
+		redactedPaths[form] = placeholder
+	}
+	updateSortedRedactedPaths()
+}
+
+// updateSortedRedactedPaths rebuilds sortedRedactedPaths from redactedPaths; redactedPathsLock must be held.
+func updateSortedRedactedPaths() {
+	result := make([]redactedPath, 0, len(redactedPaths))
+	for path, placeholder := range redactedPaths {
+		result = append(result, redactedPath{path, placeholder})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i].path) != len(result[j].path) {
+			return len(result[i].path) > len(result[j].path)
+		}
+		return result[i].path < result[j].path
+	})
+
+	sortedRedactedPaths = result
+}
+
+// RedactPaths replaces any registered project roots, and the user's home directory, in the given string with placeholders.
+func RedactPaths(str string) string {
+
+	redactedHomeDirOnce.Do(func() {
+		homeDir, err := os.UserHomeDir()
+		if err != nil || strings.TrimSpace(homeDir) == "" {
+			return
+		}
+
+		redactedPathsLock.Lock()
+		defer redactedPathsLock.Unlock()
+		for _, form := range getPathFormsForRedaction(homeDir) {
+			// A project root that is the home directory keeps its project placeholder
+			if _, exists := redactedPaths[form]; !exists {
+				redactedPaths[form] = "~"
+			}
+		}
+		updateSortedRedactedPaths()
+	})
+
+	redactedPathsLock.RLock()
+	paths := sortedRedactedPaths
+	redactedPathsLock.RUnlock()
+
+	for _, path := range paths {
+		str = replaceRedactedPath(str, path)
+	}
+
+	return str
+}
+
+// replaceRedactedPath replaces each occurrence of the path in the string that ends at a boundary with its placeholder.
+func replaceRedactedPath(str string, path redactedPath) string {
+
+	var result strings.Builder
+	remaining := str
+
+	for {
+		index := strings.Index(remaining, path.path)
+		if index == -1 {
+			break
+		}
+
+		end := index + len(path.path)
+		result.WriteString(remaining[:index])
+		if isRedactedPathBoundary(remaining, end) {
+			result.WriteString(path.placeholder)
+		} else {
+			result.WriteString(path.path)
+		}
+		remaining = remaining[end:]
+	}
+
+	if result.Len() == 0 {
+		return str
+	}
+
+	result.WriteString(remaining)
+	return result.String()
+}
+
+// isRedactedPathBoundary returns true if a path that ends at the index of the string is complete: the index is the end of
+// the string, or is a path separator, or is a character that ends a path in a log statement (whitespace, a quote, a
+// closing bracket, or punctuation that is not followed by a further character of the file name).
+func isRedactedPathBoundary(str string, index int) bool {
+	if index >= len(str) {
+		return true
+	}
+
+	switch str[index] {
+	case '/', '\\', ' ', '\t', '\r', '\n', '"', '\'', '`', ')', ']', '}', '>', ',', ';':
+		return true
+	case '.', ':':
+		// Eg the end of a sentence, but not a file name such as '/home/bob.old'
+		return index+1 >= len(str) || isRedactedPathBoundary(str, index+1)
+	}
+
+	return false
+}
+
+// getPathFormsForRedaction returns the forms in which a path may appear in a log statement: as-is, with forward
+// slashes, and in absolute unix-style normalized form (for Windows paths).
+func getPathFormsForRedaction(path string) []string {
+
+	path = strings.TrimRight(path, "/\\")
+	if path == "" {
+		return []string{}
+	}
+
+	forms := map[string]bool{path: true}
+
+	forwardSlashes := strings.ReplaceAll(path, "\\", "/")
+	forms[forwardSlashes] = true
+
+	localWindowsPath := ""
+	if IsWindowsAbsolutePath(path) {
+		localWindowsPath = path
+		forms[ConvertFromWindowsDriveLetter(path)] = true
+	} else if len(forwardSlashes) > 2 && forwardSlashes[0] == '/' && forwardSlashes[2] == '/' {
+		// May be the unix-style normalized form of a Windows path (eg /c/Users/user), so also redact the local form
+		if converted, err := ConvertAbsoluteUnixStyleNormalizedPathToLocalFileOS(forwardSlashes, true); err == nil {
+			localWindowsPath = converted
+		}
+	}
+
+	if localWindowsPath != "" {
+		// The drive letter may be either upper or lowercase
+		forms[strings.ToUpper(localWindowsPath[0:1])+localWindowsPath[1:]] = true
+		forms[strings.ToLower(localWindowsPath[0:1])+localWindowsPath[1:]] = true
+	}
+
+	result := make([]string, 0, len(forms))
+	for form := range forms {
+		result = append(result, form)
+	}
+
+	return result
+}
+
+// normalizePathForRedaction converts the path to a single form, so that the placeholder of a path is the same regardless
+// of which form was registered.
+func normalizePathForRedaction(path string) string {
+	path = strings.TrimRight(path, "/\\")
+	if IsWindowsAbsolutePath(path) {
+		return ConvertFromWindowsDriveLetter(path)
+	}
+	return strings.ReplaceAll(path, "\\", "/")
+}
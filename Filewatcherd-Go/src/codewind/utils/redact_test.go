@@ -0,0 +1,124 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package utils
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRedactPathsUnix(t *testing.T) {
+	RegisterRedactedPath("/work/bob/project")
+	placeholder := RedactPaths("/work/bob/project")
+
+	if !strings.HasPrefix(placeholder, "<project-") {
+		t.Fatalf("Expected the project root to be replaced by a placeholder, but got: %s", placeholder)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/work/bob/project", placeholder},
+		{"Syncing /work/bob/project/src/main.go", "Syncing " + placeholder + "/src/main.go"},
+		{"Watching /work/bob/project.", "Watching " + placeholder + "."},
+		{"[ /work/bob/project] [ -i]", "[ " + placeholder + "] [ -i]"},
+		{"'/work/bob/project', \"/work/bob/project\"", "'" + placeholder + "', \"" + placeholder + "\""},
+		{"/work/bob/project /work/bob/project/a", placeholder + " " + placeholder + "/a"},
+
+		// Other paths that start with the project root are not replaced
+		{"/work/bob/projectile/src", "/work/bob/projectile/src"},
+		{"/work/bob/project.old", "/work/bob/project.old"},
+		{"/work/bob/project-2 and /work/bob/project/a", "/work/bob/project-2 and " + placeholder + "/a"},
+		{"/work/bob", "/work/bob"},
+	}
+
+	for _, test := range tests {
+		if actual := RedactPaths(test.input); actual != test.expected {
+			t.Errorf("RedactPaths(%q) = %q, expected %q", test.input, actual, test.expected)
+		}
+	}
+}
+
+func TestRedactPathsWindows(t *testing.T) {
+	RegisterRedactedPath("c:\\Users\\bob\\project")
+	placeholder := RedactPaths("c:\\Users\\bob\\project")
+
+	if !strings.HasPrefix(placeholder, "<project-") {
+		t.Fatalf("Expected the project root to be replaced by a placeholder, but got: %s", placeholder)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Each form of the path is replaced, with either case of drive letter
+		{"c:\\Users\\bob\\project\\src\\main.go", placeholder + "\\src\\main.go"},
+		{"C:\\Users\\bob\\project\\src", placeholder + "\\src"},
+		{"c:/Users/bob/project/src", placeholder + "/src"},
+		{"/c/Users/bob/project/src", placeholder + "/src"},
+		{"Watching C:\\Users\\bob\\project.", "Watching " + placeholder + "."},
+
+		// Other paths that start with the project root are not replaced
+		{"c:\\Users\\bob\\projects\\src", "c:\\Users\\bob\\projects\\src"},
+		{"/c/Users/bob/projects", "/c/Users/bob/projects"},
+	}
+
+	for _, test := range tests {
+		if actual := RedactPaths(test.input); actual != test.expected {
+			t.Errorf("RedactPaths(%q) = %q, expected %q", test.input, actual, test.expected)
+		}
+	}
+
+	// The placeholder is the same whichever form of the path is registered
+	RegisterRedactedPath("/d/Users/bob/project")
+	RegisterRedactedPath("d:\\Users\\bob\\project")
+	if unixForm, localForm := RedactPaths("/d/Users/bob/project"), RedactPaths("D:\\Users\\bob\\project"); unixForm != localForm {
+		t.Errorf("Expected the same placeholder for both forms of the path, but got %q and %q", unixForm, localForm)
+	}
+}
+
+func TestRedactPathsNestedProjects(t *testing.T) {
+	RegisterRedactedPath("/work/alice")
+	RegisterRedactedPath("/work/alice/project")
+
+	parent := RedactPaths("/work/alice")
+	child := RedactPaths("/work/alice/project")
+
+	if parent == child {
+		t.Fatalf("Expected different placeholders for different project roots, but both were %q", parent)
+	}
+
+	// The longest registered path is replaced
+	if actual := RedactPaths("/work/alice/project/a"); actual != child+"/a" {
+		t.Errorf("Expected %q, but got %q", child+"/a", actual)
+	}
+	if actual := RedactPaths("/work/alice/other/a"); actual != parent+"/other/a" {
+		t.Errorf("Expected %q, but got %q", parent+"/other/a", actual)
+	}
+}
+
+func TestRedactPathsHomeDirectory(t *testing.T) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil || strings.TrimRight(homeDir, "/\\") == "" {
+		t.Skip("The home directory is not known")
+	}
+	homeDir = strings.TrimRight(homeDir, "/\\")
+
+	if actual := RedactPaths(homeDir + "/file.txt"); actual != "~/file.txt" {
+		t.Errorf("Expected the home directory to be replaced by '~', but got %q", actual)
+	}
+	if actual := RedactPaths(homeDir + "2/file.txt"); actual != homeDir+"2/file.txt" {
+		t.Errorf("Expected a sibling of the home directory not to be replaced, but got %q", actual)
+	}
+}
@@ -0,0 +1,109 @@
+/*******************************************************************************
+* Copyright (c) 2020 IBM Corporation and others.
+* All rights reserved. This program and the accompanying materials
+* are made available under the terms of the Eclipse Public License v2.0
+* which accompanies this distribution, and is available at
+* http://www.eclipse.org/legal/epl-v20.html
+*
+* Contributors:
+*     IBM Corporation - initial API and implementation
+*******************************************************************************/
+
+package utils
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+/**
+ * RepeatedLogFilter suppresses repeats of the same log statement, for example when an operation fails for the same
+ * reason every time it is retried. Log statements are grouped by a key (for example, the kind of failure); the first
+ * statement of a key is logged, and each subsequent statement is only logged if it differs from the previous one.
+ *
+ * Identical statements are not discarded entirely: once the summary interval has elapsed since the statement was last
+ * logged, the next repeat is logged along with the number of times it was repeated in the meantime. Any repeats that
+ * have not yet been reported are also reported when the statement changes, or when the key is reset (for example, once
+ * the operation succeeds).
+ */
+type RepeatedLogFilter struct {
+	summaryInterval time.Duration
+
+	lock    *sync.Mutex
+	entries map[string]*repeatedLogEntry // lock must be acquired before reading/writing
+}
+
+type repeatedLogEntry struct {
+	msg        string
+	logFunc    func(string) // The function with which the statement was logged (eg LogSevere)
+	lastLogged time.Time
+	suppressed int // The number of repeats since lastLogged
+}
+
+// NewRepeatedLogFilter returns a filter which reports suppressed repeats at most once per summary interval.
+func NewRepeatedLogFilter(summaryInterval time.Duration) *RepeatedLogFilter {
+	return &RepeatedLogFilter{
+		summaryInterval: summaryInterval,
+		lock:            &sync.Mutex{},
+		entries:         make(map[string]*repeatedLogEntry),
+	}
+}
+
+// Log logs the message with the log function (eg LogError), unless it is a repeat of the previous message of the key,
+// in which case it is only counted (see the top of this file).
+func (filter *RepeatedLogFilter) Log(key string, msg string, logFunc func(string)) {
+
+	filter.lock.Lock()
+	defer filter.lock.Unlock()
+
+	now := time.Now()
+
+	entry, exists := filter.entries[key]
+	if exists && entry.msg == msg {
+		entry.suppressed++
+
+		if now.Sub(entry.lastLogged) >= filter.summaryInterval {
+			logFunc(msg + " (repeated " + timesToString(entry.suppressed) + " in the last " +
+				now.Sub(entry.lastLogged).Round(time.Second).String() + ")")
+			entry.lastLogged = now
+			entry.suppressed = 0
+		}
+		return
+	}
+
+	if exists {
+		entry.logSummary()
+	}
+
+	logFunc(msg)
+	filter.entries[key] = &repeatedLogEntry{msg: msg, logFunc: logFunc, lastLogged: now}
+}
+
+// Reset reports any repeats of the previous message of each key that have not yet been reported, after which the next
+// message of each key is logged, whether or not it is a repeat.
+func (filter *RepeatedLogFilter) Reset() {
+
+	filter.lock.Lock()
+	defer filter.lock.Unlock()
+
+	for key, entry := range filter.entries {
+		entry.logSummary()
+		delete(filter.entries, key)
+	}
+}
+
+// logSummary logs the number of repeats of the message since it was last logged, if there were any.
+func (entry *repeatedLogEntry) logSummary() {
+	if entry.suppressed > 0 {
+		entry.logFunc("The previous message was repeated " + timesToString(entry.suppressed) + " more: " + entry.msg)
+		entry.suppressed = 0
+	}
+}
+
+func timesToString(count int) string {
+	if count == 1 {
+		return "1 time"
+	}
+	return strconv.Itoa(count) + " times"
+}
@@ -15,6 +15,9 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	mathrand "math/rand"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -31,6 +34,10 @@ type ExponentialBackoff struct {
 	MaxFailureDelay int
 
 	BackoffExponent float32
+
+	// If non-zero, each sleep is randomly adjusted by up to this fraction of the delay (eg 0.5 sleeps for
+	// 50%-150% of the delay), so that many clients do not retry in lockstep.
+	JitterFraction float32
 }
 
 func (b *ExponentialBackoff) GetFailureDelay() int {
@@ -43,6 +50,31 @@ func NewExponentialBackoff() ExponentialBackoff {
 		0,
 		4000,
 		1.5,
+		0,
+	}
+}
+
+// NewExponentialBackoffFromEnv returns a backoff with the given jitter, whose minimum and maximum delays (in msecs)
+// may be overridden by the '<envPrefix>_MIN_MS' and '<envPrefix>_MAX_MS' environment variables.
+func NewExponentialBackoffFromEnv(envPrefix string, defaultMinFailureDelay int, defaultMaxFailureDelay int, jitterFraction float32) ExponentialBackoff {
+
+	minFailureDelay := GetEnvInt(envPrefix+"_MIN_MS", defaultMinFailureDelay)
+	if minFailureDelay < 1 {
+		minFailureDelay = 1
+	}
+
+	maxFailureDelay := GetEnvInt(envPrefix+"_MAX_MS", defaultMaxFailureDelay)
+	if maxFailureDelay < minFailureDelay {
+		LogError(envPrefix + "_MAX_MS is less than the minimum delay, so the minimum delay will be used: " + strconv.Itoa(minFailureDelay))
+		maxFailureDelay = minFailureDelay
+	}
+
+	return ExponentialBackoff{
+		MinFailureDelay: minFailureDelay,
+		FailureDelay:    0,
+		MaxFailureDelay: maxFailureDelay,
+		BackoffExponent: 1.5,
+		JitterFraction:  jitterFraction,
 	}
 }
 
@@ -52,7 +84,12 @@ func (b *ExponentialBackoff) SleepAfterFail() {
 		b.FailureDelay = b.MinFailureDelay
 	}
 
-	time.Sleep(time.Duration(b.FailureDelay) * time.Millisecond)
+	delay := float64(b.FailureDelay)
+	if b.JitterFraction > 0 {
+		delay = delay * (1 + float64(b.JitterFraction)*(2*mathrand.Float64()-1))
+	}
+
+	time.Sleep(time.Duration(delay) * time.Millisecond)
 }
 
 func (b *ExponentialBackoff) FailIncrease() {
@@ -84,6 +121,23 @@ func StripTrailingForwardSlash(str string) string {
 
 }
 
+// GetEnvInt returns the value of the given environment variable as an integer, or defaultValue if the
+// variable is not set (or cannot be parsed).
+func GetEnvInt(name string, defaultValue int) int {
+	str := strings.TrimSpace(os.Getenv(name))
+	if str == "" {
+		return defaultValue
+	}
+
+	val, err := strconv.Atoi(str)
+	if err != nil {
+		LogError("Unable to parse value of environment variable " + name + ": " + str)
+		return defaultValue
+	}
+
+	return val
+}
+
 func IsValidURLBase(str string) bool {
 
 	if strings.HasPrefix(str, "http://") {
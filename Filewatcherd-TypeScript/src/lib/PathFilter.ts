@@ -35,7 +35,7 @@ export class PathFilter {
                     return;
                 }
 
-                const text = e.split("*").join(".*");
+                const text = convertWildcardFilterToRegex(e);
 
                 filenameExcludePatterns.push(new RegExp(text));
 
@@ -52,7 +52,7 @@ export class PathFilter {
                     return;
                 }
 
-                const text = e.split("*").join(".*");
+                const text = convertWildcardFilterToRegex(e);
 
                 pathExcludePatterns.push(new RegExp(text));
 
@@ -107,3 +107,12 @@ export class PathFilter {
     }
 
 }
+
+/**
+ * Convert an ignored filename/path filter to a regular expression: '*' matches
+ * any sequence of characters, and all other characters (including spaces,
+ * unicode, and regex/shell special characters) match themselves.
+ */
+function convertWildcardFilterToRegex(filter: string): string {
+    return filter.split("*").map((e) => e.replace(/[.*+?^${}()|[\]\\]/g, "\\$&")).join(".*");
+}
@@ -58,7 +58,9 @@ protected void doGet(HttpServletRequest request, HttpServletResponse response)
 		ObjectMapper om = new ObjectMapper();
 		om.setSerializationInclusion(Include.NON_NULL);
 
+		// Project paths may contain non-ASCII characters
 		response.setContentType("application/json");
+		response.setCharacterEncoding("UTF-8");
 		response.setStatus(HttpServletResponse.SC_OK);
 		response.getWriter().println(om.writeValueAsString(result));
 	}
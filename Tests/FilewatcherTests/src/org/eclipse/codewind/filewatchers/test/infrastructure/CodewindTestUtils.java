@@ -14,6 +14,7 @@
 import java.io.ByteArrayOutputStream;
 import java.io.IOException;
 import java.io.InputStream;
+import java.nio.charset.StandardCharsets;
 
 public class CodewindTestUtils {
 
@@ -27,7 +28,7 @@ public static String readStringFromStream(InputStream is) throws IOException {
 			baos.write(barr, 0, c);
 		}
 
-		return new String(baos.toByteArray());
+		return new String(baos.toByteArray(), StandardCharsets.UTF_8);
 
 	}
 
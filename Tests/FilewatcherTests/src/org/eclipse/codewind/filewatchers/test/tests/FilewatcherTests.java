@@ -1137,6 +1137,85 @@ public void testDeleteProjectRoot() throws IOException {
 
 	}
 
+	/**
+	 * Are projects whose paths contain spaces, unicode, and characters that are
+	 * special to shells or regular expressions watched correctly: are changes
+	 * reported with the correct paths, and do the ignore rules of the project
+	 * match literally.
+	 */
+	@Test
+	public void testProjectPathsWithSpacesUnicodeAndShellCharacters() throws IOException {
+		initializeServer();
+		sendTestName();
+
+		List<String> projectDirNames = new ArrayList<>(Arrays.asList( //
+				"with spaces  and  double spaces", //
+				"na\u00efve-\u00fcn\u00efc\u00f6d\u00e9-\u65e5\u672c\u8a9e-\ud83d\ude00", //
+				"$HOME;&`id`'single'(1)[2]{3}!#%+=,~^@", //
+				"-leading-dash", //
+				"{path} {id} {timestamp}"));
+
+		if (!File.separator.equals("\\")) {
+			// Not valid in Windows filenames. (Backslashes are not tested, as they are
+			// treated as path separators on all platforms.)
+			projectDirNames.add("\"double quotes\" *?<>|");
+		}
+
+		List<ProjectToWatchJson> projects = new ArrayList<>();
+
+		for (String projectDirName : projectDirNames) {
+			File parentDir = Files.createTempDirectory("fw-test-").toFile();
+			addDisposableResource(parentDir);
+
+			File projectDir = new File(parentDir, projectDirName);
+			if (!projectDir.mkdirs()) {
+				fail("Unable to create: " + projectDir.getPath());
+			}
+			addDisposableResource(projectDir);
+
+			ProjectToWatchJson p = newProject(projectDir.getPath());
+			p.getIgnoredFilenames().add("ignored (copy) $x.txt");
+			p.getIgnoredPaths().add("/ignored [dir] {1}/*");
+
+			watcherState.addOrUpdateProject(p);
+			projects.add(p);
+		}
+
+		for (ProjectToWatchJson p : projects) {
+			waitForWatcherSuccess(p);
+		}
+
+		for (ProjectToWatchJson p : projects) {
+
+			___status___("Creating files in: " + p.getLocalPathToMonitor());
+
+			// The ignored files are created first, so any (unexpected) events for them
+			// will have been received by the time the event for the expected file is.
+			File ignoredFile = createOrModifyFile(new File(p.getLocalPathToMonitor(), "ignored (copy) $x.txt"));
+
+			File ignoredDir = createDir("ignored [dir] {1}", p);
+			File ignoredDirFile = createOrModifyFile(new File(ignoredDir, "file.txt"));
+
+			File dir = createDir("sub dir \u00fc \u65e5\u672c", p);
+			File file = createOrModifyFile(new File(dir, "file $x; 'y' (1).txt"));
+
+			waitForEventsFromFileList(Arrays.asList(dir, file), EventType.CREATE, p);
+
+			List<File> ignored = Arrays.asList(ignoredFile, ignoredDirFile);
+			List<ChangedFileEntry> ignoredChanges = changeList.getAllChangedFileEntriesByProjectId(p).stream()
+					.map(e -> convertToAbsolute(p, e)).filter(e -> ignored.contains(new File(e.getPath())))
+					.collect(Collectors.toList());
+			assertTrue("Ignored files were reported: " + ignoredChanges, ignoredChanges.size() == 0);
+
+			assertFilesExist(p, changeList.getAllChangedFileEntriesByProjectId(p));
+
+			deleteFile(file);
+
+			waitForEventsFromFileList(Arrays.asList(file), EventType.DELETE, p);
+		}
+
+	}
+
 	private List<File> excludeParentDirFromList(List<File> dirs, ProjectToWatchJson p) {
 		return dirs.stream().filter(e -> !e.equals(p.getLocalPathToMonitor())).collect(Collectors.toList());
 	}
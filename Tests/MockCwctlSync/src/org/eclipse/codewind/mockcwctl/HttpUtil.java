@@ -17,6 +17,7 @@
 import java.net.HttpURLConnection;
 import java.net.URI;
 import java.net.URLConnection;
+import java.nio.charset.StandardCharsets;
 import java.security.KeyManagementException;
 import java.security.NoSuchAlgorithmException;
 import java.security.cert.CertificateException;
@@ -52,7 +53,7 @@ public static HttpResult post(URI uri, String payload, IHttpConnectionConfig con
 				connection.setDoOutput(true);
 
 				DataOutputStream payloadStream = new DataOutputStream(connection.getOutputStream());
-				payloadStream.write(payload.getBytes());
+				payloadStream.write(payload.getBytes(StandardCharsets.UTF_8));
 			}
 
 			return new HttpResult(connection);
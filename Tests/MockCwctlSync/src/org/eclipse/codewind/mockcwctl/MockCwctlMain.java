@@ -15,10 +15,12 @@
 import java.io.IOException;
 import java.net.URI;
 import java.net.URISyntaxException;
+import java.nio.charset.StandardCharsets;
 import java.nio.file.Files;
 import java.nio.file.Path;
 import java.nio.file.Paths;
 import java.util.ArrayList;
+import java.util.Arrays;
 import java.util.Base64;
 import java.util.Collections;
 import java.util.HashSet;
@@ -149,7 +151,8 @@ private static void innerMain(String[] args) throws JsonbException, IOException,
 			return;
 		}
 
-		String projectJsonReceived = new String(Base64.getDecoder().decode(projectJsonStrBase64));
+		String projectJsonReceived = new String(Base64.getDecoder().decode(projectJsonStrBase64),
+				StandardCharsets.UTF_8);
 
 		System.out.println("projectJsonReceived: " + projectJsonReceived);
 
@@ -336,8 +339,7 @@ private static void innerMain(String[] args) throws JsonbException, IOException,
 					String filename = pathProper.getName(x).toString();
 
 					for (String ignoredFilenameFilter : pwJson.getIgnoredFilenames()) {
-						String filterText = ignoredFilenameFilter.replace("*", ".*");
-						Pattern p = Pattern.compile(filterText);
+						Pattern p = Pattern.compile(convertWildcardFilterToRegex(ignoredFilenameFilter));
 
 						if (p.matcher(filename).matches()) {
 							it.remove();
@@ -352,7 +354,7 @@ private static void innerMain(String[] args) throws JsonbException, IOException,
 			if (pwJson.getIgnoredPaths().size() > 0) {
 
 				for (String ignoredPathFilter : pwJson.getIgnoredPaths()) {
-					String filterText = ignoredPathFilter.replace("*", ".*");
+					String filterText = convertWildcardFilterToRegex(ignoredPathFilter);
 					System.out.println("filter: " + filterText);
 					Pattern p = Pattern.compile(filterText);
 
@@ -418,6 +420,16 @@ private static void postToURL(String urlRoot, List<ChangedFileEntryJson> cfejLis
 
 	}
 
+	/**
+	 * Convert an ignored filename/path filter to a regular expression, in the same
+	 * way as the filewatcher: '*' matches any sequence of characters, and all other
+	 * characters (including spaces, unicode, and regex/shell special characters)
+	 * match themselves.
+	 */
+	private static String convertWildcardFilterToRegex(String filter) {
+		return Arrays.stream(filter.split("\\*", -1)).map(e -> Pattern.quote(e)).collect(Collectors.joining(".*"));
+	}
+
 	private static void writeJsonDB(List<WalkEntry> allFiles, Path previousStateJson)
 			throws JsonbException, IOException {
 		// Write JSON database for latest use
@@ -436,7 +448,7 @@ private static void writeJsonDB(List<WalkEntry> allFiles, Path previousStateJson
 			return fe;
 		}).filter(e -> e != null).collect(Collectors.toList()));
 
-		Files.write(previousStateJson, JsonbBuilder.create().toJson(pcj).getBytes());
+		Files.write(previousStateJson, JsonbBuilder.create().toJson(pcj).getBytes(StandardCharsets.UTF_8));
 	}
 
 	private static List<WalkEntry> walkDirectory(Path directoryParam) throws IOException {
@@ -508,7 +520,7 @@ private final static byte[] compressString(String str) {
 
 		int uncompressedSize;
 		try {
-			byte[] strBytes = str.getBytes();
+			byte[] strBytes = str.getBytes(StandardCharsets.UTF_8);
 			dos.write(strBytes);
 			dos.close();
 			baos.close();
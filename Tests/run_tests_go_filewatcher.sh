@@ -9,6 +9,13 @@ cd target
 MOCK_CWCTL_JAR=`pwd`/`ls MockCwctlSync-*.jar`
 
 
+echo "Running Go unit tests with the race detector -----------------------------------"
+
+cd $SCRIPT_LOCT/../Filewatcherd-Go/src/codewind
+go vet ./... || exit 1
+go test -race ./... || exit 1
+
+
 echo "Starting Go filewatcher ---------------------------------------------------------"
 
 # GO_LOG=`mktemp`